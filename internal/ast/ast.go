@@ -2,7 +2,8 @@ package ast
 
 type (
 	File struct {
-		Body []*Stmt
+		Body     []*Stmt
+		Comments []*Comment // 按位置排序的注释
 		Position
 	}
 
@@ -26,6 +27,12 @@ type (
 		Position
 	}
 
+	// Comment 行注释或块注释，Text 包含注释符号
+	Comment struct {
+		Text string
+		Position
+	}
+
 	Operator struct {
 		Value string
 		Position
@@ -17,6 +17,7 @@ func (*BoolLiteral) isExpr()       {}
 func (*NullLiteral) isExpr()       {}
 func (*StringLiteral) isExpr()     {}
 func (*CharLiteral) isExpr()       {}
+func (*BadExpr) isExpr()           {}
 
 // expr
 type (
@@ -88,4 +89,8 @@ type (
 		Value rune
 		Text  string
 	}
+
+	// BadExpr 存在语法错误的表达式占位
+	BadExpr struct {
+	}
 )
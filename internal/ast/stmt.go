@@ -14,6 +14,7 @@ func (*IfStmt) isStmt()       {}
 func (*ForStmt) isStmt()      {}
 func (*BreakStmt) isStmt()    {}
 func (*ContinueStmt) isStmt() {}
+func (*BadStmt) isStmt()      {}
 
 func (*TTypeDecl) isStmt()      {}
 func (*TInterfaceDecl) isStmt() {}
@@ -83,6 +84,10 @@ type (
 	ContinueStmt struct {
 		Label *Identifier
 	}
+
+	// BadStmt 存在语法错误的语句占位
+	BadStmt struct {
+	}
 )
 
 /* kind decl */
@@ -1,3 +1,249 @@
 package bytecode
 
-// TODO
+import (
+	"github.com/peakchen90/noah-lang/internal/helper"
+)
+
+// Program 编译产物，包含所有模块
+type Program struct {
+	Modules []*Module
+	Entry   int // 入口模块索引
+}
+
+func NewProgram() *Program {
+	return &Program{
+		Modules: make([]*Module, 0, helper.DefaultCap),
+	}
+}
+
+// AddModule 添加模块，返回模块索引
+func (p *Program) AddModule(module *Module) int {
+	module.Index = len(p.Modules)
+	p.Modules = append(p.Modules, module)
+	return module.Index
+}
+
+// FindModule 根据模块 id 查找模块
+func (p *Program) FindModule(name string) *Module {
+	for _, module := range p.Modules {
+		if module.Name == name {
+			return module
+		}
+	}
+	return nil
+}
+
+/* module */
+
+type ExportType uint8
+
+const (
+	ExportGlobal ExportType = iota
+	ExportFunc
+	ExportKind
+)
+
+// Export 模块导出的符号
+type Export struct {
+	Name  string
+	Type  ExportType
+	Index int // 全局变量槽位、函数索引或常量池中的类型常量索引
+}
+
+// Method 方法表中的方法
+type Method struct {
+	Name string
+	Func FuncRef
+}
+
+// Impl 具名类型的方法表
+type Impl struct {
+	Kind    *Kind
+	Methods []*Method
+}
+
+// Module 模块的编译产物
+type Module struct {
+	Name      string // 模块 id
+	Index     int
+	Constants []Constant
+	Globals   []string // 全局变量名，下标为槽位
+	Functions []*Function
+	Init      int   // 模块初始化函数索引，-1 表示没有
+	Imports   []int // 依赖的模块索引，按引入顺序
+	Exports   []*Export
+	Impls     []*Impl
+
+	constantIndex map[Constant]int // 可复用常量在常量池中的索引
+}
+
+func NewModule(name string) *Module {
+	return &Module{
+		Name:      name,
+		Constants: make([]Constant, 0, helper.DefaultCap),
+		Globals:   make([]string, 0, helper.DefaultCap),
+		Functions: make([]*Function, 0, helper.DefaultCap),
+		Init:      -1,
+		Imports:   make([]int, 0, helper.SmallCap),
+		Exports:   make([]*Export, 0, helper.DefaultCap),
+		Impls:     make([]*Impl, 0, helper.DefaultCap),
+	}
+}
+
+// AddConstant 添加常量，相同的数字、字符串、字符、函数常量会被复用
+func (m *Module) AddConstant(constant Constant) int {
+	if !isReusable(constant) {
+		m.Constants = append(m.Constants, constant)
+		return len(m.Constants) - 1
+	}
+
+	if m.constantIndex == nil {
+		m.constantIndex = make(map[Constant]int, len(m.Constants))
+		for i, item := range m.Constants {
+			if _, has := m.constantIndex[item]; !has && isReusable(item) {
+				m.constantIndex[item] = i
+			}
+		}
+	}
+	if index, has := m.constantIndex[constant]; has {
+		return index
+	}
+
+	m.Constants = append(m.Constants, constant)
+	m.constantIndex[constant] = len(m.Constants) - 1
+	return len(m.Constants) - 1
+}
+
+func isReusable(constant Constant) bool {
+	switch constant.(type) {
+	case NumberConstant, StringConstant, CharConstant, FuncConstant, BuiltinConstant:
+		return true
+	}
+	return false
+}
+
+// AddImport 记录依赖的模块
+func (m *Module) AddImport(index int) {
+	for _, item := range m.Imports {
+		if item == index {
+			return
+		}
+	}
+	m.Imports = append(m.Imports, index)
+}
+
+// AddGlobal 添加全局变量，返回槽位
+func (m *Module) AddGlobal(name string) int {
+	m.Globals = append(m.Globals, name)
+	return len(m.Globals) - 1
+}
+
+// AddFunction 添加函数，返回函数索引
+func (m *Module) AddFunction(fn *Function) int {
+	m.Functions = append(m.Functions, fn)
+	return len(m.Functions) - 1
+}
+
+// FindExport 查找导出的符号
+func (m *Module) FindExport(name string) *Export {
+	for _, item := range m.Exports {
+		if item.Name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+/* function */
+
+// Function 函数的编译产物
+type Function struct {
+	Name      string
+	Arity     int  // 参数个数（剩余参数算作一个）
+	HasRest   bool // 最后一个参数是否为剩余参数
+	NumLocals int  // 局部变量槽位数量（包含参数）
+	Chunk     *Chunk
+}
+
+func NewFunction(name string) *Function {
+	return &Function{
+		Name:  name,
+		Chunk: NewChunk(),
+	}
+}
+
+/* chunk */
+
+// Line 指令位置对应的源码位置
+type Line struct {
+	Offset int // 指令起始位置
+	Pos    int // 源码位置（字符索引）
+	Line   int
+	Column int
+}
+
+// Chunk 指令序列
+type Chunk struct {
+	Code  []byte
+	Lines []Line // 按 Offset 升序，仅在源码位置变化时记录
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{
+		Code:  make([]byte, 0, 16),
+		Lines: make([]Line, 0, helper.DefaultCap),
+	}
+}
+
+// Write 写入一条指令，返回指令起始位置
+func (c *Chunk) Write(op OpCode, operands ...int) int {
+	offset := len(c.Code)
+	c.Code = append(c.Code, Make(op, operands...)...)
+	return offset
+}
+
+// Mark 记录后续指令对应的源码位置
+func (c *Chunk) Mark(pos int, line int, column int) {
+	offset := len(c.Code)
+	size := len(c.Lines)
+	if size > 0 {
+		last := &c.Lines[size-1]
+		if last.Pos == pos {
+			return
+		}
+		if last.Offset == offset {
+			*last = Line{Offset: offset, Pos: pos, Line: line, Column: column}
+			return
+		}
+	}
+	c.Lines = append(c.Lines, Line{Offset: offset, Pos: pos, Line: line, Column: column})
+}
+
+// PatchOperand 修改指令的 2 字节操作数（如回填跳转位置）
+func (c *Chunk) PatchOperand(offset int, index int, value int) {
+	def, err := Lookup(OpCode(c.Code[offset]))
+	if err != nil {
+		panic(err)
+	}
+	pos := offset + 1
+	for i := 0; i < index; i++ {
+		pos += def.OperandWidths[i]
+	}
+	checkOperand(def, def.OperandWidths[index], value)
+	c.Code[pos] = byte(value >> 8)
+	c.Code[pos+1] = byte(value)
+}
+
+// LineAt 返回指令位置对应的源码位置
+func (c *Chunk) LineAt(offset int) (Line, bool) {
+	var found Line
+	ok := false
+	for _, item := range c.Lines {
+		if item.Offset > offset {
+			break
+		}
+		found = item
+		ok = true
+	}
+	return found, ok
+}
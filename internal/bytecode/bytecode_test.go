@@ -0,0 +1,169 @@
+package bytecode
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDefinitions(t *testing.T) {
+	for op := OpNop; op <= OpAs; op++ {
+		def, err := Lookup(op)
+		assert.Nil(t, err, "opcode %d", op)
+		assert.Equal(t, def.Name, op.String())
+	}
+	_, err := Lookup(OpAs + 1)
+	assert.NotNil(t, err)
+}
+
+func TestMake(t *testing.T) {
+	assert.Equal(t, []byte{byte(OpConst), 0x01, 0x02}, Make(OpConst, 258))
+	assert.Equal(t, []byte{byte(OpInvoke), 0x00, 0x03, 0x02}, Make(OpInvoke, 3, 2))
+	assert.Equal(t, []byte{byte(OpAdd)}, Make(OpAdd))
+
+	ins := Make(OpGetGlobal, 1, 65535)
+	def, _ := Lookup(OpGetGlobal)
+	operands, read := ReadOperands(def, ins[1:])
+	assert.Equal(t, []int{1, 65535}, operands)
+	assert.Equal(t, 4, read)
+
+	assert.PanicsWithValue(t, "OpCall operand 256 out of range [0, 255]", func() { Make(OpCall, 256) })
+	assert.PanicsWithValue(t, "OpConst operand 65536 out of range [0, 65535]", func() { Make(OpConst, 65536) })
+	assert.PanicsWithValue(t, "OpJump operand -1 out of range [0, 65535]", func() { Make(OpJump, -1) })
+}
+
+func TestChunk(t *testing.T) {
+	chunk := NewChunk()
+	chunk.Mark(0, 1, 1)
+	chunk.Write(OpTrue)
+	jump := chunk.Write(OpJumpIfFalse, 0)
+	chunk.Mark(5, 1, 6)
+	chunk.Write(OpNull)
+	chunk.PatchOperand(jump, 0, len(chunk.Code))
+
+	assert.Equal(t, []byte{byte(OpTrue), byte(OpJumpIfFalse), 0, 5, byte(OpNull)}, chunk.Code)
+	assert.Panics(t, func() { chunk.PatchOperand(jump, 0, 65536) })
+
+	line, ok := chunk.LineAt(jump)
+	assert.True(t, ok)
+	assert.Equal(t, 1, line.Column)
+	line, _ = chunk.LineAt(4)
+	assert.Equal(t, 6, line.Column)
+}
+
+func TestDisassemble(t *testing.T) {
+	module := NewModule("main")
+	module.AddGlobal("count")
+	pi := module.AddConstant(NumberConstant(3.14))
+	assert.Equal(t, pi, module.AddConstant(NumberConstant(3.14)))
+	name := module.AddConstant(StringConstant("name"))
+
+	fn := NewFunction("main")
+	fn.Chunk.Mark(10, 2, 5)
+	fn.Chunk.Write(OpConst, pi)
+	fn.Chunk.Write(OpSetGlobal, 0, 0)
+	fn.Chunk.Write(OpPop)
+	fn.Chunk.Mark(20, 3, 5)
+	fn.Chunk.Write(OpGetLocal, 0)
+	fn.Chunk.Write(OpGetField, name)
+	fn.Chunk.Write(OpReturn)
+	module.AddFunction(fn)
+
+	expected := `== module main (#0) ==
+constants:
+  #0    number 3.14
+  #1    string "name"
+globals:
+  0     count
+fn main (#0, arity 0, locals 0):
+  0000      2:5 OpConst        0 ; 3.14
+  0003        | OpSetGlobal    0 0 ; main.count
+  0008        | OpPop
+  0009      3:5 OpGetLocal     0
+  0012        | OpGetField     1 ; "name"
+  0015        | OpReturn
+`
+	assert.Equal(t, expected, module.Disassemble())
+}
+
+func TestLoad(t *testing.T) {
+	program := NewProgram()
+	module := NewModule("main")
+	program.AddModule(module)
+	module.AddGlobal("count")
+	module.AddConstant(NumberConstant(-1.5))
+	module.AddConstant(StringConstant("名称"))
+	module.AddConstant(CharConstant('好'))
+	module.AddConstant(FuncConstant{Module: 0, Index: 0})
+	kind := &Kind{Tag: KindStruct, Name: "A", Fields: []string{"a", "b"}, Len: -1}
+	kindIndex := module.AddConstant(&KindConstant{Kind: &Kind{Tag: KindArray, Len: 3, Elem: kind}})
+	module.AddConstant(BuiltinConstant("println"))
+	module.Exports = append(module.Exports, &Export{Name: "A", Type: ExportKind, Index: kindIndex})
+	module.Impls = append(module.Impls, &Impl{Kind: kind, Methods: []*Method{{Name: "foo", Func: FuncRef{}}}})
+
+	fn := NewFunction("main")
+	fn.NumLocals = 1
+	fn.Chunk.Mark(3, 1, 4)
+	fn.Chunk.Write(OpConst, 0)
+	fn.Chunk.Write(OpSetLocal, 0)
+	fn.Chunk.Write(OpReturn)
+	module.AddFunction(fn)
+
+	data := program.Marshal()
+	assert.Equal(t, FileMagic, string(data[:len(FileMagic)]))
+
+	loaded, err := Load(data)
+	assert.NoError(t, err)
+	assert.Equal(t, program.Disassemble(), loaded.Disassemble())
+	assert.Equal(t, []Line{{Offset: 0, Pos: 3, Line: 1, Column: 4}}, loaded.Modules[0].Functions[0].Chunk.Lines)
+
+	assertError := func(data []byte, message string) {
+		_, err := Load(data)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+
+	assertError([]byte("hello"), "not a noah bytecode file")
+	assertError(append([]byte(FileMagic), 0, 9), "unsupported version 9")
+	assertError(data[:len(data)-1], "unexpected end of file")
+	assertError(append(append([]byte{}, data...), 0), "unexpected data at the end of file")
+
+	fn.Chunk.Write(OpGetLocal, 2)
+	assertError(program.Marshal(), "invalid local 2 in function main")
+	fn.Chunk.Code = fn.Chunk.Code[:len(fn.Chunk.Code)-3]
+
+	fn.Chunk.Code = append(fn.Chunk.Code, 0xff)
+	assertError(program.Marshal(), "opcode 255 undefined")
+	fn.Chunk.Code = fn.Chunk.Code[:len(fn.Chunk.Code)-1]
+
+	module.Constants[3] = FuncConstant{Module: 1, Index: 0}
+	assertError(program.Marshal(), "invalid function reference fn<1:0>")
+}
+
+func TestLoadCorrupted(t *testing.T) {
+	program := NewProgram()
+	module := NewModule("main")
+	program.AddModule(module)
+	fn := NewFunction("main")
+	fn.Chunk.Write(OpConst, module.AddConstant(NumberConstant(1)))
+	fn.Chunk.Write(OpConst, module.AddConstant(StringConstant("a")))
+	fn.Chunk.Write(OpCall, 1)
+	fn.Chunk.Write(OpReturn)
+	module.AddFunction(fn)
+	data := program.Marshal()
+
+	// 修改任意一个字节都不能通过校验
+	for i := range data {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0x5a
+		_, err := Load(corrupted)
+		assert.Error(t, err, "offset %d", i)
+	}
+
+	// 修改调用的参数个数，文件结构仍然完整
+	corrupted := append([]byte{}, data...)
+	corrupted[bytes.Index(data, fn.Chunk.Code)+len(fn.Chunk.Code)-2]++
+	_, err := Load(corrupted)
+	assert.EqualError(t, err, "invalid bytecode file at offset 8: checksum mismatch")
+}
@@ -0,0 +1,145 @@
+package bytecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/* constants */
+
+type Constant interface{ isConstant() }
+
+func (NumberConstant) isConstant()  {}
+func (StringConstant) isConstant()  {}
+func (CharConstant) isConstant()    {}
+func (FuncConstant) isConstant()    {}
+func (*KindConstant) isConstant()   {}
+func (BuiltinConstant) isConstant() {}
+
+type (
+	NumberConstant float64
+
+	StringConstant string
+
+	CharConstant rune
+
+	// FuncConstant 函数引用
+	FuncConstant FuncRef
+
+	// KindConstant 运行时类型描述
+	KindConstant struct {
+		Kind *Kind
+	}
+
+	// BuiltinConstant 内置函数引用（函数名）
+	BuiltinConstant string
+)
+
+func (c NumberConstant) String() string {
+	return strconv.FormatFloat(float64(c), 'g', -1, 64)
+}
+
+func (c StringConstant) String() string {
+	return strconv.Quote(string(c))
+}
+
+func (c CharConstant) String() string {
+	return strconv.QuoteRune(rune(c))
+}
+
+func (c FuncConstant) String() string {
+	return fmt.Sprintf("fn<%d:%d>", c.Module, c.Index)
+}
+
+func (c *KindConstant) String() string {
+	return c.Kind.String()
+}
+
+func (c BuiltinConstant) String() string {
+	return fmt.Sprintf("builtin<%s>", string(c))
+}
+
+// FuncRef 指向某个模块的函数
+type FuncRef struct {
+	Module int
+	Index  int
+}
+
+/* kind */
+
+type KindTag uint8
+
+const (
+	KindAny KindTag = iota
+	KindNumber
+	KindByte
+	KindChar
+	KindString
+	KindBool
+	KindArray
+	KindFunc
+	KindStruct
+	KindInterface
+	KindEnum
+	KindCustom
+)
+
+// Kind 运行时类型描述，用于 `is`/`as`、默认值及结构体创建
+type Kind struct {
+	Tag     KindTag
+	Name    string   // struct、interface、enum、custom 的名称
+	Module  int      // 类型所在模块，与 Name 一起标识一个具名类型
+	Elem    *Kind    // 数组元素类型、custom 底层类型
+	Len     int      // 数组长度，-1 表示可变长数组
+	Fields  []string // 结构体字段（含继承的字段），按名称排序
+	Extends []*Kind  // 结构体直接继承的结构体
+	Methods []string // 接口方法
+	Choices []string // 枚举选项
+}
+
+// IsNamed 是否为具名类型
+func (k *Kind) IsNamed() bool {
+	switch k.Tag {
+	case KindStruct, KindInterface, KindEnum, KindCustom:
+		return len(k.Name) > 0
+	}
+	return false
+}
+
+// SameNamed 判断是否为同一个具名类型
+func (k *Kind) SameNamed(other *Kind) bool {
+	return k.IsNamed() && other.IsNamed() && k.Tag == other.Tag && k.Module == other.Module && k.Name == other.Name
+}
+
+func (k *Kind) String() string {
+	switch k.Tag {
+	case KindAny:
+		return "any"
+	case KindNumber:
+		return "number"
+	case KindByte:
+		return "byte"
+	case KindChar:
+		return "char"
+	case KindString:
+		return "string"
+	case KindBool:
+		return "bool"
+	case KindArray:
+		if k.Len >= 0 {
+			return fmt.Sprintf("[%d]%s", k.Len, k.Elem)
+		}
+		return "[]" + k.Elem.String()
+	case KindFunc:
+		return "fn"
+	}
+
+	if k.IsNamed() {
+		return fmt.Sprintf("%s@%d", k.Name, k.Module)
+	}
+	if k.Tag == KindStruct {
+		return "struct{ " + strings.Join(k.Fields, ", ") + " }"
+	}
+	return "?"
+}
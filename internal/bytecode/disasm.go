@@ -0,0 +1,195 @@
+package bytecode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble 返回程序的反汇编文本
+func (p *Program) Disassemble() string {
+	builder := strings.Builder{}
+	for i, module := range p.Modules {
+		if i > 0 {
+			builder.WriteByte('\n')
+		}
+		disassembleModule(&builder, p, module)
+	}
+	return builder.String()
+}
+
+// Disassemble 返回模块的反汇编文本
+func (m *Module) Disassemble() string {
+	builder := strings.Builder{}
+	disassembleModule(&builder, nil, m)
+	return builder.String()
+}
+
+// Disassemble 返回函数的反汇编文本
+func (f *Function) Disassemble(module *Module) string {
+	builder := strings.Builder{}
+	disassembleFunction(&builder, nil, module, f)
+	return builder.String()
+}
+
+func disassembleModule(builder *strings.Builder, program *Program, m *Module) {
+	builder.WriteString(fmt.Sprintf("== module %s (#%d) ==\n", m.Name, m.Index))
+
+	if len(m.Constants) > 0 {
+		builder.WriteString("constants:\n")
+		for i, constant := range m.Constants {
+			builder.WriteString(fmt.Sprintf("  #%-4d %-6s %s\n", i, constantType(constant), constant))
+		}
+	}
+
+	if len(m.Imports) > 0 {
+		names := make([]string, len(m.Imports))
+		for i, index := range m.Imports {
+			if program != nil && index < len(program.Modules) {
+				names[i] = program.Modules[index].Name
+			} else {
+				names[i] = fmt.Sprintf("#%d", index)
+			}
+		}
+		builder.WriteString("imports: " + strings.Join(names, ", ") + "\n")
+	}
+
+	if len(m.Globals) > 0 {
+		builder.WriteString("globals:\n")
+		for i, name := range m.Globals {
+			builder.WriteString(fmt.Sprintf("  %-5d %s\n", i, name))
+		}
+	}
+
+	if len(m.Exports) > 0 {
+		builder.WriteString("exports:\n")
+		for _, item := range m.Exports {
+			builder.WriteString(fmt.Sprintf("  %-12s %s %d\n", item.Name, exportType(item.Type), item.Index))
+		}
+	}
+
+	if len(m.Impls) > 0 {
+		builder.WriteString("impls:\n")
+		for _, impl := range m.Impls {
+			for _, method := range impl.Methods {
+				builder.WriteString(fmt.Sprintf("  %s.%s -> %s\n", impl.Kind, method.Name, FuncConstant(method.Func)))
+			}
+		}
+	}
+
+	if m.Init >= 0 {
+		builder.WriteString(fmt.Sprintf("init: #%d\n", m.Init))
+	}
+
+	for i, fn := range m.Functions {
+		builder.WriteString(fmt.Sprintf("fn %s (#%d, arity %d", fn.Name, i, fn.Arity))
+		if fn.HasRest {
+			builder.WriteString(", rest")
+		}
+		builder.WriteString(fmt.Sprintf(", locals %d):\n", fn.NumLocals))
+		disassembleFunction(builder, program, m, fn)
+	}
+}
+
+func disassembleFunction(builder *strings.Builder, program *Program, m *Module, fn *Function) {
+	code := fn.Chunk.Code
+	lineIndex := 0
+	offset := 0
+
+	for offset < len(code) {
+		// 源码行列
+		location := "|"
+		lines := fn.Chunk.Lines
+		if lineIndex < len(lines) && lines[lineIndex].Offset <= offset {
+			for lineIndex+1 < len(lines) && lines[lineIndex+1].Offset <= offset {
+				lineIndex++
+			}
+			location = fmt.Sprintf("%d:%d", lines[lineIndex].Line, lines[lineIndex].Column)
+			lineIndex++
+		}
+
+		op := OpCode(code[offset])
+		def, err := Lookup(op)
+		if err != nil {
+			builder.WriteString(fmt.Sprintf("  %04d %8s ERROR: %s\n", offset, location, err))
+			offset++
+			continue
+		}
+
+		operands, read := ReadOperands(def, code[offset+1:])
+		line := strings.Builder{}
+		line.WriteString(fmt.Sprintf("  %04d %8s %-14s", offset, location, def.Name))
+		for _, operand := range operands {
+			line.WriteString(fmt.Sprintf(" %d", operand))
+		}
+		if comment := operandComment(program, m, op, operands); len(comment) > 0 {
+			line.WriteString(" ; ")
+			line.WriteString(comment)
+		}
+		builder.WriteString(strings.TrimRight(line.String(), " "))
+		builder.WriteByte('\n')
+
+		offset += 1 + read
+	}
+}
+
+// 操作数注释
+func operandComment(program *Program, m *Module, op OpCode, operands []int) string {
+	constantAt := func(index int) string {
+		if index < len(m.Constants) {
+			return fmt.Sprint(m.Constants[index])
+		}
+		return "?"
+	}
+
+	switch op {
+	case OpConst, OpDefault, OpStruct, OpIs, OpAs, OpGetField, OpSetField, OpInvoke:
+		return constantAt(operands[0])
+	case OpEnum:
+		constant, ok := m.Constants[operands[0]].(*KindConstant)
+		if ok && operands[1] < len(constant.Kind.Choices) {
+			return constant.Kind.String() + "." + constant.Kind.Choices[operands[1]]
+		}
+		return constantAt(operands[0])
+	case OpGetGlobal, OpSetGlobal:
+		target := m
+		if program != nil && operands[0] < len(program.Modules) {
+			target = program.Modules[operands[0]]
+		} else if operands[0] != m.Index {
+			return ""
+		}
+		if operands[1] < len(target.Globals) {
+			return target.Name + "." + target.Globals[operands[1]]
+		}
+	}
+	return ""
+}
+
+func constantType(constant Constant) string {
+	switch constant.(type) {
+	case NumberConstant:
+		return "number"
+	case StringConstant:
+		return "string"
+	case CharConstant:
+		return "char"
+	case FuncConstant:
+		return "fn"
+	case *KindConstant:
+		return "kind"
+	case BuiltinConstant:
+		return "fn"
+	}
+	return "?"
+}
+
+func exportType(t ExportType) string {
+	switch t {
+	case ExportGlobal:
+		return "global"
+	case ExportFunc:
+		return "fn"
+	case ExportKind:
+		return "kind"
+	}
+	return "?"
+}
@@ -0,0 +1,562 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+)
+
+// .noahc 文件格式：
+//
+//	magic    "NOAHC\x00"
+//	version  uint16（大端序）
+//	checksum uint32（大端序），之后所有内容的 CRC-32（IEEE）
+//	entry    入口模块索引
+//	modules  模块列表，每个模块依次包含名称、常量池、全局变量、函数表（含行号表）、
+//	         初始化函数、依赖模块、导出符号表及方法表
+//
+// 除 magic、version 与 checksum 外，整数使用 varint 编码，字符串与列表以长度作为前缀
+
+const (
+	FileMagic   = "NOAHC\x00"
+	FileVersion = 3
+	FileExt     = ".noahc"
+
+	fileHeaderSize = len(FileMagic) + 2 + 4
+)
+
+// 常量类型标记
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagChar
+	tagFunc
+	tagKind
+	tagBuiltin
+)
+
+// Marshal 将程序编码为 .noahc 文件内容
+func (p *Program) Marshal() []byte {
+	w := &fileWriter{}
+	w.buf.WriteString(FileMagic)
+	w.buf.Write([]byte{byte(FileVersion >> 8), byte(FileVersion)})
+	w.buf.Write(make([]byte, 4))
+
+	w.writeInt(p.Entry)
+	w.writeInt(len(p.Modules))
+	for _, module := range p.Modules {
+		w.writeModule(module)
+	}
+
+	data := w.buf.Bytes()
+	binary.BigEndian.PutUint32(data[fileHeaderSize-4:], crc32.ChecksumIEEE(data[fileHeaderSize:]))
+	return data
+}
+
+// WriteFile 将程序写入 .noahc 文件
+func (p *Program) WriteFile(filename string) error {
+	return os.WriteFile(filename, p.Marshal(), 0644)
+}
+
+// Load 读取并校验 .noahc 文件内容
+func Load(data []byte) (program *Program, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			fe, ok := e.(*FileError)
+			if !ok {
+				panic(e)
+			}
+			program, err = nil, fe
+		}
+	}()
+
+	r := &fileReader{data: data}
+	if !bytes.HasPrefix(data, []byte(FileMagic)) {
+		r.fail("not a noah bytecode file")
+	}
+	r.offset = len(FileMagic)
+	version := int(binary.BigEndian.Uint16(r.readN(2)))
+	if version != FileVersion {
+		r.fail("unsupported version %d (expect %d)", version, FileVersion)
+	}
+	checksum := binary.BigEndian.Uint32(r.readN(4))
+
+	program = NewProgram()
+	program.Entry = r.readInt()
+	count := r.readLen()
+	for i := 0; i < count; i++ {
+		program.AddModule(r.readModule())
+	}
+	if r.offset != len(data) {
+		r.fail("unexpected data at the end of file")
+	}
+	// 结构完整但内容被修改的文件由校验和发现，避免执行时访问越界
+	if crc32.ChecksumIEEE(data[fileHeaderSize:]) != checksum {
+		r.offset = fileHeaderSize - 4
+		r.fail("checksum mismatch")
+	}
+
+	r.validate(program)
+	return program, nil
+}
+
+// LoadFile 读取并校验 .noahc 文件
+func LoadFile(filename string) (*Program, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// FileError 文件格式错误
+type FileError struct {
+	Offset  int
+	Message string
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("invalid bytecode file at offset %d: %s", e.Offset, e.Message)
+}
+
+/* writer */
+
+type fileWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *fileWriter) writeInt(value int) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], int64(value))
+	w.buf.Write(tmp[:n])
+}
+
+func (w *fileWriter) writeBool(value bool) {
+	if value {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *fileWriter) writeBytes(value []byte) {
+	w.writeInt(len(value))
+	w.buf.Write(value)
+}
+
+func (w *fileWriter) writeString(value string) {
+	w.writeInt(len(value))
+	w.buf.WriteString(value)
+}
+
+func (w *fileWriter) writeStrings(list []string) {
+	w.writeInt(len(list))
+	for _, item := range list {
+		w.writeString(item)
+	}
+}
+
+func (w *fileWriter) writeFuncRef(ref FuncRef) {
+	w.writeInt(ref.Module)
+	w.writeInt(ref.Index)
+}
+
+func (w *fileWriter) writeModule(m *Module) {
+	w.writeString(m.Name)
+
+	w.writeInt(len(m.Constants))
+	for _, constant := range m.Constants {
+		w.writeConstant(constant)
+	}
+
+	w.writeStrings(m.Globals)
+
+	w.writeInt(len(m.Functions))
+	for _, fn := range m.Functions {
+		w.writeFunction(fn)
+	}
+
+	w.writeInt(m.Init)
+
+	w.writeInt(len(m.Imports))
+	for _, index := range m.Imports {
+		w.writeInt(index)
+	}
+
+	w.writeInt(len(m.Exports))
+	for _, item := range m.Exports {
+		w.writeString(item.Name)
+		w.buf.WriteByte(byte(item.Type))
+		w.writeInt(item.Index)
+	}
+
+	w.writeInt(len(m.Impls))
+	for _, impl := range m.Impls {
+		w.writeKind(impl.Kind)
+		w.writeInt(len(impl.Methods))
+		for _, method := range impl.Methods {
+			w.writeString(method.Name)
+			w.writeFuncRef(method.Func)
+		}
+	}
+}
+
+func (w *fileWriter) writeConstant(constant Constant) {
+	switch constant.(type) {
+	case NumberConstant:
+		w.buf.WriteByte(tagNumber)
+		var tmp [8]byte
+		binary.BigEndian.PutUint64(tmp[:], math.Float64bits(float64(constant.(NumberConstant))))
+		w.buf.Write(tmp[:])
+	case StringConstant:
+		w.buf.WriteByte(tagString)
+		w.writeString(string(constant.(StringConstant)))
+	case CharConstant:
+		w.buf.WriteByte(tagChar)
+		w.writeInt(int(constant.(CharConstant)))
+	case FuncConstant:
+		w.buf.WriteByte(tagFunc)
+		w.writeFuncRef(FuncRef(constant.(FuncConstant)))
+	case *KindConstant:
+		w.buf.WriteByte(tagKind)
+		w.writeKind(constant.(*KindConstant).Kind)
+	case BuiltinConstant:
+		w.buf.WriteByte(tagBuiltin)
+		w.writeString(string(constant.(BuiltinConstant)))
+	default:
+		panic(fmt.Sprintf("unknown constant: %T", constant))
+	}
+}
+
+func (w *fileWriter) writeKind(kind *Kind) {
+	w.buf.WriteByte(byte(kind.Tag))
+	w.writeString(kind.Name)
+	w.writeInt(kind.Module)
+	w.writeBool(kind.Elem != nil)
+	if kind.Elem != nil {
+		w.writeKind(kind.Elem)
+	}
+	w.writeInt(kind.Len)
+	w.writeStrings(kind.Fields)
+	w.writeInt(len(kind.Extends))
+	for _, extend := range kind.Extends {
+		w.writeKind(extend)
+	}
+	w.writeStrings(kind.Methods)
+	w.writeStrings(kind.Choices)
+}
+
+func (w *fileWriter) writeFunction(fn *Function) {
+	w.writeString(fn.Name)
+	w.writeInt(fn.Arity)
+	w.writeBool(fn.HasRest)
+	w.writeInt(fn.NumLocals)
+	w.writeBytes(fn.Chunk.Code)
+
+	w.writeInt(len(fn.Chunk.Lines))
+	for _, line := range fn.Chunk.Lines {
+		w.writeInt(line.Offset)
+		w.writeInt(line.Pos)
+		w.writeInt(line.Line)
+		w.writeInt(line.Column)
+	}
+}
+
+/* reader */
+
+type fileReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *fileReader) fail(format string, args ...interface{}) {
+	panic(&FileError{Offset: r.offset, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *fileReader) readN(n int) []byte {
+	if n < 0 || r.offset+n > len(r.data) {
+		r.fail("unexpected end of file")
+	}
+	value := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return value
+}
+
+func (r *fileReader) readByte() byte {
+	return r.readN(1)[0]
+}
+
+func (r *fileReader) readInt() int {
+	value, n := binary.Varint(r.data[r.offset:])
+	if n == 0 {
+		r.fail("unexpected end of file")
+	}
+	if n < 0 {
+		r.fail("malformed integer")
+	}
+	r.offset += n
+	return int(value)
+}
+
+// 读取列表长度（非负且不超过剩余的字节数）
+func (r *fileReader) readLen() int {
+	size := r.readInt()
+	if size < 0 || size > len(r.data)-r.offset {
+		r.fail("invalid length %d", size)
+	}
+	return size
+}
+
+func (r *fileReader) readBool() bool {
+	return r.readByte() != 0
+}
+
+func (r *fileReader) readString() string {
+	return string(r.readN(r.readLen()))
+}
+
+func (r *fileReader) readStrings() []string {
+	list := make([]string, r.readLen())
+	for i := range list {
+		list[i] = r.readString()
+	}
+	return list
+}
+
+func (r *fileReader) readFuncRef() FuncRef {
+	return FuncRef{Module: r.readInt(), Index: r.readInt()}
+}
+
+func (r *fileReader) readModule() *Module {
+	m := NewModule(r.readString())
+
+	count := r.readLen()
+	for i := 0; i < count; i++ {
+		m.Constants = append(m.Constants, r.readConstant())
+	}
+
+	m.Globals = append(m.Globals, r.readStrings()...)
+
+	count = r.readLen()
+	for i := 0; i < count; i++ {
+		m.AddFunction(r.readFunction())
+	}
+
+	m.Init = r.readInt()
+
+	count = r.readLen()
+	for i := 0; i < count; i++ {
+		m.Imports = append(m.Imports, r.readInt())
+	}
+
+	count = r.readLen()
+	for i := 0; i < count; i++ {
+		item := &Export{Name: r.readString()}
+		item.Type = ExportType(r.readByte())
+		item.Index = r.readInt()
+		m.Exports = append(m.Exports, item)
+	}
+
+	count = r.readLen()
+	for i := 0; i < count; i++ {
+		impl := &Impl{Kind: r.readKind()}
+		methods := r.readLen()
+		for j := 0; j < methods; j++ {
+			impl.Methods = append(impl.Methods, &Method{Name: r.readString(), Func: r.readFuncRef()})
+		}
+		m.Impls = append(m.Impls, impl)
+	}
+
+	return m
+}
+
+func (r *fileReader) readConstant() Constant {
+	switch tag := r.readByte(); tag {
+	case tagNumber:
+		return NumberConstant(math.Float64frombits(binary.BigEndian.Uint64(r.readN(8))))
+	case tagString:
+		return StringConstant(r.readString())
+	case tagChar:
+		return CharConstant(rune(r.readInt()))
+	case tagFunc:
+		return FuncConstant(r.readFuncRef())
+	case tagKind:
+		return &KindConstant{Kind: r.readKind()}
+	case tagBuiltin:
+		return BuiltinConstant(r.readString())
+	default:
+		r.fail("unknown constant tag %d", tag)
+	}
+	return nil
+}
+
+func (r *fileReader) readKind() *Kind {
+	kind := &Kind{Tag: KindTag(r.readByte())}
+	if kind.Tag > KindCustom {
+		r.fail("unknown kind tag %d", kind.Tag)
+	}
+	kind.Name = r.readString()
+	kind.Module = r.readInt()
+	if r.readBool() {
+		kind.Elem = r.readKind()
+	}
+	kind.Len = r.readInt()
+	kind.Fields = r.readStrings()
+	extends := r.readLen()
+	for i := 0; i < extends; i++ {
+		kind.Extends = append(kind.Extends, r.readKind())
+	}
+	kind.Methods = r.readStrings()
+	kind.Choices = r.readStrings()
+	return kind
+}
+
+func (r *fileReader) readFunction() *Function {
+	fn := NewFunction(r.readString())
+	fn.Arity = r.readInt()
+	fn.HasRest = r.readBool()
+	fn.NumLocals = r.readInt()
+	fn.Chunk.Code = append(fn.Chunk.Code, r.readN(r.readLen())...)
+
+	count := r.readLen()
+	for i := 0; i < count; i++ {
+		fn.Chunk.Lines = append(fn.Chunk.Lines, Line{
+			Offset: r.readInt(),
+			Pos:    r.readInt(),
+			Line:   r.readInt(),
+			Column: r.readInt(),
+		})
+	}
+	return fn
+}
+
+/* validate */
+
+// 校验模块、函数、常量之间的引用以及指令是否合法，避免虚拟机执行时越界
+func (r *fileReader) validate(p *Program) {
+	if p.Entry < 0 || p.Entry >= len(p.Modules) {
+		r.fail("invalid entry module %d", p.Entry)
+	}
+
+	checkFunc := func(ref FuncRef) {
+		if ref.Module < 0 || ref.Module >= len(p.Modules) ||
+			ref.Index < 0 || ref.Index >= len(p.Modules[ref.Module].Functions) {
+			r.fail("invalid function reference %s", FuncConstant(ref))
+		}
+	}
+	var checkKind func(kind *Kind)
+	checkKind = func(kind *Kind) {
+		if kind.Module < 0 || kind.Module >= len(p.Modules) {
+			r.fail("invalid module of kind %s", kind.Name)
+		}
+		if kind.Elem != nil {
+			checkKind(kind.Elem)
+		}
+		for _, extend := range kind.Extends {
+			checkKind(extend)
+		}
+	}
+
+	for _, m := range p.Modules {
+		for _, constant := range m.Constants {
+			switch constant.(type) {
+			case FuncConstant:
+				checkFunc(FuncRef(constant.(FuncConstant)))
+			case *KindConstant:
+				checkKind(constant.(*KindConstant).Kind)
+			}
+		}
+
+		if m.Init < -1 || m.Init >= len(m.Functions) {
+			r.fail("invalid init function %d in module %s", m.Init, m.Name)
+		}
+		for _, index := range m.Imports {
+			if index < 0 || index >= len(p.Modules) {
+				r.fail("invalid import %d in module %s", index, m.Name)
+			}
+		}
+
+		for _, item := range m.Exports {
+			size := 0
+			switch item.Type {
+			case ExportGlobal:
+				size = len(m.Globals)
+			case ExportFunc:
+				size = len(m.Functions)
+			case ExportKind:
+				size = len(m.Constants)
+				if item.Index >= 0 && item.Index < size {
+					if _, ok := m.Constants[item.Index].(*KindConstant); !ok {
+						size = 0
+					}
+				}
+			}
+			if item.Index < 0 || item.Index >= size {
+				r.fail("invalid export %s in module %s", item.Name, m.Name)
+			}
+		}
+
+		for _, impl := range m.Impls {
+			checkKind(impl.Kind)
+			for _, method := range impl.Methods {
+				checkFunc(method.Func)
+			}
+		}
+
+		for _, fn := range m.Functions {
+			r.validateCode(p, m, fn)
+		}
+	}
+}
+
+func (r *fileReader) validateCode(p *Program, m *Module, fn *Function) {
+	code := fn.Chunk.Code
+	offset := 0
+	for offset < len(code) {
+		op := OpCode(code[offset])
+		def, err := Lookup(op)
+		if err != nil {
+			r.fail("%s in function %s", err, fn.Name)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if offset+1+width > len(code) {
+			r.fail("truncated instruction %s in function %s", def.Name, fn.Name)
+		}
+
+		operands, _ := ReadOperands(def, code[offset+1:])
+		switch op {
+		case OpConst, OpDefault, OpStruct, OpEnum, OpIs, OpAs, OpGetField, OpSetField, OpInvoke:
+			if operands[0] >= len(m.Constants) {
+				r.fail("invalid constant %d in function %s", operands[0], fn.Name)
+			}
+		case OpGetLocal, OpSetLocal:
+			if operands[0] >= fn.NumLocals {
+				r.fail("invalid local %d in function %s", operands[0], fn.Name)
+			}
+		case OpJump, OpJumpIfFalse:
+			if operands[0] > len(code) {
+				r.fail("invalid jump target %d in function %s", operands[0], fn.Name)
+			}
+		case OpGetGlobal, OpSetGlobal:
+			if operands[0] >= len(p.Modules) || operands[1] >= len(p.Modules[operands[0]].Globals) {
+				r.fail("invalid global %d:%d in function %s", operands[0], operands[1], fn.Name)
+			}
+		}
+		offset += 1 + width
+	}
+
+	last := -1
+	for _, line := range fn.Chunk.Lines {
+		if line.Offset <= last || line.Offset > len(code) {
+			r.fail("invalid line table in function %s", fn.Name)
+		}
+		last = line.Offset
+	}
+}
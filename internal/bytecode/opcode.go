@@ -0,0 +1,242 @@
+package bytecode
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type OpCode uint8
+
+// 操作数的最大值
+const (
+	MaxU8  = 0xff
+	MaxU16 = 0xffff
+)
+
+// 指令集（基于栈），注释中的 [] 表示操作数
+// Note: 更新指令同时要更新 definitions
+const (
+	OpNop OpCode = iota
+
+	// 常量
+	OpConst   // [u16 常量索引] 压入常量
+	OpNull    // 压入 null
+	OpTrue    // 压入 true
+	OpFalse   // 压入 false
+	OpDefault // [u16 类型常量索引] 压入类型的默认值
+	OpEnum    // [u16 类型常量索引, u16 选项索引] 压入枚举值
+
+	// 栈操作
+	OpPop  // 弹出栈顶
+	OpDup  // 复制栈顶
+	OpDup2 // 复制栈顶两个值
+
+	// 变量
+	OpGetLocal  // [u16 槽位] 压入局部变量
+	OpSetLocal  // [u16 槽位] 设置局部变量（保留栈顶）
+	OpGetGlobal // [u16 模块索引, u16 槽位] 压入全局变量
+	OpSetGlobal // [u16 模块索引, u16 槽位] 设置全局变量（保留栈顶）
+
+	// 算术运算
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpRem
+	OpNeg      // -x
+	OpToNumber // +x
+	OpConcat   // 字符串拼接
+
+	// 位运算
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpBitNot
+	OpShl
+	OpShr
+
+	// 逻辑及比较
+	OpNot
+	OpEq
+	OpNe
+	OpLt
+	OpLe
+	OpGt
+	OpGe
+
+	// 跳转
+	OpJump        // [u16 目标位置]
+	OpJumpIfFalse // [u16 目标位置] 弹出栈顶，为 false 时跳转
+
+	// 函数
+	OpCall   // [u8 参数个数] 栈: callee, args...
+	OpInvoke // [u16 方法名常量索引, u8 参数个数] 栈: receiver, args...
+	OpReturn // 返回栈顶的值
+
+	// 结构体及数组
+	OpArray      // [u16 元素个数] 使用栈顶的元素创建可变长数组
+	OpFixedArray // [u16 元素个数] 使用栈顶的元素创建定长数组
+	OpStruct     // [u16 类型常量索引] 按类型的字段顺序弹出字段值创建结构体
+	OpGetField   // [u16 字段名常量索引]
+	OpSetField   // [u16 字段名常量索引] 栈: object, value（保留 value）
+	OpGetIndex   // 栈: object, index
+	OpSetIndex   // 栈: object, index, value（保留 value）
+	OpLen        // 数组或字符串长度
+
+	// 类型
+	OpIs // [u16 类型常量索引]
+	OpAs // [u16 类型常量索引]
+)
+
+// Definition 指令定义
+type Definition struct {
+	Name          string
+	OperandWidths []int // 每个操作数的字节数
+}
+
+var definitions = [...]Definition{
+	OpNop: {"OpNop", nil},
+
+	OpConst:   {"OpConst", []int{2}},
+	OpNull:    {"OpNull", nil},
+	OpTrue:    {"OpTrue", nil},
+	OpFalse:   {"OpFalse", nil},
+	OpDefault: {"OpDefault", []int{2}},
+	OpEnum:    {"OpEnum", []int{2, 2}},
+
+	OpPop:  {"OpPop", nil},
+	OpDup:  {"OpDup", nil},
+	OpDup2: {"OpDup2", nil},
+
+	OpGetLocal:  {"OpGetLocal", []int{2}},
+	OpSetLocal:  {"OpSetLocal", []int{2}},
+	OpGetGlobal: {"OpGetGlobal", []int{2, 2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2, 2}},
+
+	OpAdd:      {"OpAdd", nil},
+	OpSub:      {"OpSub", nil},
+	OpMul:      {"OpMul", nil},
+	OpDiv:      {"OpDiv", nil},
+	OpRem:      {"OpRem", nil},
+	OpNeg:      {"OpNeg", nil},
+	OpToNumber: {"OpToNumber", nil},
+	OpConcat:   {"OpConcat", nil},
+
+	OpBitAnd: {"OpBitAnd", nil},
+	OpBitOr:  {"OpBitOr", nil},
+	OpBitXor: {"OpBitXor", nil},
+	OpBitNot: {"OpBitNot", nil},
+	OpShl:    {"OpShl", nil},
+	OpShr:    {"OpShr", nil},
+
+	OpNot: {"OpNot", nil},
+	OpEq:  {"OpEq", nil},
+	OpNe:  {"OpNe", nil},
+	OpLt:  {"OpLt", nil},
+	OpLe:  {"OpLe", nil},
+	OpGt:  {"OpGt", nil},
+	OpGe:  {"OpGe", nil},
+
+	OpJump:        {"OpJump", []int{2}},
+	OpJumpIfFalse: {"OpJumpIfFalse", []int{2}},
+
+	OpCall:   {"OpCall", []int{1}},
+	OpInvoke: {"OpInvoke", []int{2, 1}},
+	OpReturn: {"OpReturn", nil},
+
+	OpArray:      {"OpArray", []int{2}},
+	OpFixedArray: {"OpFixedArray", []int{2}},
+	OpStruct:     {"OpStruct", []int{2}},
+	OpGetField:   {"OpGetField", []int{2}},
+	OpSetField:   {"OpSetField", []int{2}},
+	OpGetIndex:   {"OpGetIndex", nil},
+	OpSetIndex:   {"OpSetIndex", nil},
+	OpLen:        {"OpLen", nil},
+
+	OpIs: {"OpIs", []int{2}},
+	OpAs: {"OpAs", []int{2}},
+}
+
+// Lookup 查找指令定义
+func Lookup(op OpCode) (*Definition, error) {
+	if int(op) >= len(definitions) || len(definitions[op].Name) == 0 {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return &definitions[op], nil
+}
+
+func (op OpCode) String() string {
+	def, err := Lookup(op)
+	if err != nil {
+		return fmt.Sprintf("OpCode(%d)", op)
+	}
+	return def.Name
+}
+
+// Make 编码一条指令
+func Make(op OpCode, operands ...int) []byte {
+	def, err := Lookup(op)
+	if err != nil {
+		panic(err)
+	}
+	if len(operands) != len(def.OperandWidths) {
+		panic(fmt.Sprintf("%s expects %d operand(s), got %d", def.Name, len(def.OperandWidths), len(operands)))
+	}
+
+	size := 1
+	for _, width := range def.OperandWidths {
+		size += width
+	}
+
+	instruction := make([]byte, size)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, operand := range operands {
+		width := def.OperandWidths[i]
+		checkOperand(def, width, operand)
+		switch width {
+		case 1:
+			instruction[offset] = byte(operand)
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// 校验操作数是否可以编码，超出范围时 panic（避免被截断）
+func checkOperand(def *Definition, width int, operand int) {
+	max := MaxU16
+	if width == 1 {
+		max = MaxU8
+	}
+	if operand < 0 || operand > max {
+		panic(fmt.Sprintf("%s operand %d out of range [0, %d]", def.Name, operand, max))
+	}
+}
+
+// ReadOperands 读取指令的操作数，返回操作数及读取的字节数
+func ReadOperands(def *Definition, ins []byte) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ins[offset])
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 读取 2 字节的操作数
+func ReadUint16(ins []byte) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
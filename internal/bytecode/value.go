@@ -1,10 +0,0 @@
-package bytecode
-
-// TODO
-
-type NValue struct {
-}
-
-func NewNValue() *NValue {
-	return &NValue{}
-}
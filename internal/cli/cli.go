@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 退出码
+const (
+	ExitOK    = 0 // 成功
+	ExitError = 1 // 编译或运行错误
+	ExitUsage = 2 // 命令行参数错误
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx *context, args []string) int
+}
+
+type context struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]*command{}
+
+func register(cmd *command) {
+	commands[cmd.name] = cmd
+}
+
+// Run 执行命令行，返回进程退出码
+func Run(args []string, stdout io.Writer, stderr io.Writer) int {
+	ctx := &context{stdin: os.Stdin, stdout: stdout, stderr: stderr}
+
+	if len(args) == 0 {
+		ctx.printUsage()
+		return ExitUsage
+	}
+
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			if cmd, has := commands[args[1]]; has {
+				fmt.Fprintf(stdout, "usage: noah %s\n", cmd.usage)
+				return ExitOK
+			}
+		}
+		ctx.printUsage()
+		return ExitOK
+	}
+
+	cmd, has := commands[name]
+	if !has {
+		fmt.Fprintf(stderr, "noah: unknown command %q\n", name)
+		ctx.printUsage()
+		return ExitUsage
+	}
+
+	return cmd.run(ctx, args[1:])
+}
+
+func (c *context) printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	builder := strings.Builder{}
+	builder.WriteString("usage: noah <command> [arguments]\n\ncommands:\n")
+	for _, name := range names {
+		builder.WriteString(fmt.Sprintf("  %-8s %s\n", name, commands[name].summary))
+	}
+	builder.WriteString("\nuse \"noah help <command>\" for more information about a command\n")
+	fmt.Fprint(c.stderr, builder.String())
+}
+
+// 创建命令的参数解析器
+func (c *context) newFlagSet(cmd *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: noah %s\n", cmd.usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// 解析参数，返回是否需要退出及退出码
+func (c *context) parseFlags(flags *flag.FlagSet, args []string) (bool, int) {
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return true, ExitOK
+	}
+	if err != nil {
+		return true, ExitUsage
+	}
+	return false, ExitOK
+}
+
+func (c *context) errorf(format string, args ...any) int {
+	fmt.Fprintf(c.stderr, "noah: "+format+"\n", args...)
+	return ExitError
+}
+
+func (c *context) usageErrorf(cmd *command, format string, args ...any) int {
+	fmt.Fprintf(c.stderr, "noah %s: "+format+"\n", append([]any{cmd.name}, args...)...)
+	fmt.Fprintf(c.stderr, "usage: noah %s\n", cmd.usage)
+	return ExitUsage
+}
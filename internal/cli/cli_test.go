@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 执行命令行，返回退出码及标准输出、标准错误的内容
+func run(args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	code := Run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// 在临时目录中创建项目
+func writeProject(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, code := range files {
+		filename := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		assert.NoError(t, os.WriteFile(filename, []byte(code), 0644))
+	}
+	return root
+}
+
+func TestRunOK(t *testing.T) {
+	root := writeProject(t, map[string]string{
+		"main.noah":  "import lib.a\n\nfn main() -> number {\n    return a.one()\n}\n",
+		"lib/a.noah": "pub fn one() -> number {\n    return 1\n}\n",
+	})
+
+	code, stdout, stderr := run("check", root)
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "ok: "+root+"\n", stdout)
+	assert.Empty(t, stderr)
+
+	code, stdout, _ = run("help", "check")
+	assert.Equal(t, ExitOK, code)
+	assert.Equal(t, "usage: noah check [-entry module] [-root dir] [dir]\n", stdout)
+
+	code, _, stderr = run("check", "-h")
+	assert.Equal(t, ExitOK, code)
+	assert.Contains(t, stderr, "  -entry string\n    \tentry module id, such as main or app.main (default \"main\")\n")
+}
+
+func TestRunError(t *testing.T) {
+	root := writeProject(t, map[string]string{
+		"main.noah": "fn main() {\n    let n: number = \"a\"\n}\n",
+	})
+
+	code, stdout, stderr := run("check", root)
+	assert.Equal(t, ExitError, code)
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "--> main:2:21")
+	assert.Contains(t, stderr, "found 1 error(s)\n")
+
+	code, _, stderr = run("check", filepath.Join(root, "missing"))
+	assert.Equal(t, ExitError, code)
+	assert.Contains(t, stderr, "noah: project root is not a directory: ")
+}
+
+func TestRunUsage(t *testing.T) {
+	code, _, stderr := run()
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "usage: noah <command> [arguments]")
+
+	code, _, stderr = run("unknown")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "noah: unknown command \"unknown\"\n")
+
+	code, _, stderr = run("check", "-unknown")
+	assert.Equal(t, ExitUsage, code)
+	assert.Contains(t, stderr, "flag provided but not defined: -unknown")
+
+	code, _, stderr = run("check", "a", "b")
+	assert.Equal(t, ExitUsage, code)
+	assert.Equal(t, "noah check: too many arguments\nusage: noah check [-entry module] [-root dir] [dir]\n", stderr)
+}
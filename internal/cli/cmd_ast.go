@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/peakchen90/noah-lang/internal/parser"
+	"os"
+	"path/filepath"
+)
+
+var astCommand = &command{
+	name:    "ast",
+	usage:   "ast <file>",
+	summary: "print the syntax tree of a source file as JSON",
+}
+
+func init() {
+	astCommand.run = runAst
+	register(astCommand)
+}
+
+func runAst(c *context, args []string) int {
+	flags := c.newFlagSet(astCommand)
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if flags.NArg() != 1 {
+		return c.usageErrorf(astCommand, "expect exactly one file")
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+
+	// 存在语法错误时仍然输出恢复后的语法树
+	p := parser.NewParser(string(source), filepath.Base(filename))
+	file := p.Parse()
+	jsonStr, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return c.errorf("%s", err.Error())
+	}
+	fmt.Fprintln(c.stdout, string(jsonStr))
+
+	diagnostics := p.Diagnostics()
+	c.printDiagnostics(diagnostics, func(string) []rune {
+		return p.Source()
+	})
+	if diagnostic.HasError(diagnostics) {
+		return ExitError
+	}
+	return ExitOK
+}
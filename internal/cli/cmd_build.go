@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/codegen"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"path/filepath"
+)
+
+var buildCommand = &command{
+	name:    "build",
+	usage:   "build [-S] [-llvm] [-o file] [-entry module] [-root dir] [dir]",
+	summary: "compile a project",
+}
+
+func init() {
+	buildCommand.run = runBuild
+	register(buildCommand)
+}
+
+func runBuild(c *context, args []string) int {
+	project := &projectFlags{}
+	flags := c.newFlagSet(buildCommand)
+	project.register(flags)
+	disassemble := flags.Bool("S", false, "print the disassembly of the compiled program")
+	llvm := flags.Bool("llvm", false, "generate LLVM IR ("+codegen.FileExt+") for native compilation instead of bytecode")
+	output := flags.String("o", "", "output file (default <project>"+bytecode.FileExt+" or <project>"+codegen.FileExt+" in the current directory)")
+
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if exit, code := project.resolve(buildCommand, c, flags); exit {
+		return code
+	}
+
+	inst := c.compileProject(project)
+	if inst == nil {
+		return ExitError
+	}
+
+	if *disassemble {
+		fmt.Fprint(c.stdout, inst.Program.Disassemble())
+	}
+
+	ext := bytecode.FileExt
+	if *llvm {
+		ext = codegen.FileExt
+	}
+	filename := *output
+	if len(filename) == 0 {
+		root, err := filepath.Abs(project.root)
+		if err != nil {
+			return c.errorf("build: %s", err)
+		}
+		filename = filepath.Base(root) + ext
+	}
+
+	if *llvm {
+		module, err := codegen.Generate(inst)
+		if d, ok := err.(*diagnostic.Diagnostic); ok {
+			c.printDiagnostics([]*diagnostic.Diagnostic{d}, compilerSources(inst))
+			return ExitError
+		} else if err != nil {
+			return c.errorf("build: %s", err)
+		}
+		if err := codegen.WriteFile(module, filename); err != nil {
+			return c.errorf("build: %s", err)
+		}
+		// 运行时源文件写入输出文件所在的目录，链接时需要一起编译
+		runtime := filepath.Join(filepath.Dir(filename), codegen.RuntimeFile)
+		if err := codegen.WriteRuntime(runtime); err != nil {
+			return c.errorf("build: %s", err)
+		}
+		fmt.Fprintf(c.stdout, "generated LLVM IR for %d module(s) to %s (runtime: %s)\n", len(inst.Program.Modules), filename, runtime)
+		return ExitOK
+	}
+
+	if err := inst.Program.WriteFile(filename); err != nil {
+		return c.errorf("build: %s", err)
+	}
+
+	fmt.Fprintf(c.stdout, "compiled %d module(s), %d function(s) to %s\n", len(inst.Program.Modules), countFunctions(inst.Program), filename)
+	return ExitOK
+}
+
+func countFunctions(program *bytecode.Program) int {
+	count := 0
+	for _, module := range program.Modules {
+		count += len(module.Functions)
+	}
+	return count
+}
@@ -0,0 +1,34 @@
+package cli
+
+import "fmt"
+
+var checkCommand = &command{
+	name:    "check",
+	usage:   "check [-entry module] [-root dir] [dir]",
+	summary: "type check a project without producing output",
+}
+
+func init() {
+	checkCommand.run = runCheck
+	register(checkCommand)
+}
+
+func runCheck(c *context, args []string) int {
+	project := &projectFlags{}
+	flags := c.newFlagSet(checkCommand)
+	project.register(flags)
+
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if exit, code := project.resolve(checkCommand, c, flags); exit {
+		return code
+	}
+
+	if c.compileProject(project) == nil {
+		return ExitError
+	}
+
+	fmt.Fprintf(c.stdout, "ok: %s\n", project.root)
+	return ExitOK
+}
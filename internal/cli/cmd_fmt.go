@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/peakchen90/noah-lang/internal/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var fmtCommand = &command{
+	name:    "fmt",
+	usage:   "fmt [-check | -write] [path ...]",
+	summary: "format source files",
+}
+
+func init() {
+	fmtCommand.run = runFmt
+	register(fmtCommand)
+}
+
+// 路径可以是文件或目录（递归查找 .noah 文件），默认为当前目录。
+// 不指定参数时输出格式化后的源代码，`-check` 列出未格式化的文件，`-write` 写回源文件
+func runFmt(c *context, args []string) int {
+	var check, write bool
+	flags := c.newFlagSet(fmtCommand)
+	flags.BoolVar(&check, "check", false, "list files whose formatting differs and exit with 1 if any")
+	flags.BoolVar(&write, "write", false, "write the formatted source back to the files")
+
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if check && write {
+		return c.usageErrorf(fmtCommand, "-check and -write cannot be used together")
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return c.errorf("fmt: %s", err)
+	}
+
+	exitCode := ExitOK
+	for _, filename := range files {
+		code, err := os.ReadFile(filename)
+		if err != nil {
+			return c.errorf("fmt: %s", err)
+		}
+		source := string(code)
+
+		formatted, err := format.Source(source, filename)
+		if err != nil {
+			if d, ok := err.(*diagnostic.Diagnostic); ok {
+				c.printDiagnostics([]*diagnostic.Diagnostic{d}, func(string) []rune {
+					return []rune(source)
+				})
+			} else {
+				c.errorf("fmt: %s", err)
+			}
+			exitCode = ExitError
+			continue
+		}
+
+		switch {
+		case check:
+			if formatted != source {
+				fmt.Fprintln(c.stdout, filename)
+				exitCode = ExitError
+			}
+		case write:
+			if formatted != source {
+				if err := writeSource(filename, formatted); err != nil {
+					return c.errorf("fmt: %s", err)
+				}
+			}
+		default:
+			fmt.Fprint(c.stdout, formatted)
+		}
+	}
+	return exitCode
+}
+
+// 查找路径中的源文件，目录中的文件按路径排序
+func sourceFiles(paths []string) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(filename string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() && filepath.Ext(filename) == ".noah" {
+				files = append(files, filename)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import "github.com/peakchen90/noah-lang/internal/lsp"
+
+var lspCommand = &command{
+	name:    "lsp",
+	usage:   "lsp",
+	summary: "start a language server over stdio",
+}
+
+func init() {
+	lspCommand.run = runLsp
+	register(lspCommand)
+}
+
+// 语言服务器使用标准输入输出通信，日志输出到标准错误
+func runLsp(c *context, args []string) int {
+	flags := c.newFlagSet(lspCommand)
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if flags.NArg() > 0 {
+		return c.usageErrorf(lspCommand, "too many arguments")
+	}
+
+	if err := lsp.NewServer(c.stdin, c.stdout, c.stderr).Serve(); err != nil {
+		return c.errorf("%s", err.Error())
+	}
+	return ExitOK
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var renameCommand = &command{
+	name:    "rename",
+	usage:   "rename [-entry module] [-root dir] <module>:<offset> <newName>",
+	summary: "rename a symbol and all of its references",
+}
+
+func init() {
+	renameCommand.run = runRename
+	register(renameCommand)
+}
+
+// 位置为模块 id 及模块源代码中的字符索引，如 `other.foo:42`
+func runRename(c *context, args []string) int {
+	project := &projectFlags{}
+	flags := c.newFlagSet(renameCommand)
+	project.register(flags)
+
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+	if flags.NArg() != 2 {
+		return c.usageErrorf(renameCommand, "expected a position and a new name")
+	}
+	if exit, code := project.check(renameCommand, c); exit {
+		return code
+	}
+
+	position, newName := flags.Arg(0), flags.Arg(1)
+	index := strings.LastIndexByte(position, ':')
+	if index <= 0 {
+		return c.usageErrorf(renameCommand, "invalid position: %s", position)
+	}
+	moduleId := position[:index]
+	offset, err := strconv.Atoi(position[index+1:])
+	if err != nil || offset < 0 {
+		return c.usageErrorf(renameCommand, "invalid position: %s", position)
+	}
+
+	inst := c.compileProject(project)
+	if inst == nil {
+		return ExitError
+	}
+	edits, err := inst.Rename(moduleId, offset, newName)
+	if err != nil {
+		return c.errorf("rename: %s", err)
+	}
+	if len(edits) == 0 {
+		fmt.Fprintln(c.stdout, "nothing to rename")
+		return ExitOK
+	}
+
+	oldName := string(edits[0].Module.Source()[edits[0].Start:edits[0].End])
+	modules := make([]*compiler.Module, 0)
+	for i, edit := range edits {
+		if i == 0 || edit.Module != edits[i-1].Module {
+			modules = append(modules, edit.Module)
+		}
+	}
+	for _, module := range modules {
+		if err := writeSource(module.Path(), module.ApplyEdits(edits)); err != nil {
+			return c.errorf("rename: %s", err)
+		}
+	}
+
+	fmt.Fprintf(c.stdout, "renamed %s to %s: %d reference(s) in %d file(s)\n", oldName, newName, len(edits), len(modules))
+	return ExitOK
+}
+
+// 写入源文件，保留原有的文件权限
+func writeSource(filename string, source string) error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, []byte(source), stat.Mode().Perm())
+}
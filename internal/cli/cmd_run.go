@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/vm"
+	"strings"
+)
+
+var runCommand = &command{
+	name:    "run",
+	usage:   "run [-max-heap bytes] [-gcstats] [-entry module] [-root dir] [dir | file.noahc]",
+	summary: "compile and run a project",
+}
+
+func init() {
+	runCommand.run = runRun
+	register(runCommand)
+}
+
+// 虚拟机相关的参数
+type vmFlags struct {
+	maxHeap int
+	gcStats bool
+}
+
+func (v *vmFlags) register(flags *flag.FlagSet) {
+	flags.IntVar(&v.maxHeap, "max-heap", 0, "heap limit in bytes, 0 means unlimited")
+	flags.BoolVar(&v.gcStats, "gcstats", false, "print garbage collector statistics after running")
+}
+
+func runRun(c *context, args []string) int {
+	project := &projectFlags{}
+	options := &vmFlags{}
+	flags := c.newFlagSet(runCommand)
+	project.register(flags)
+	options.register(flags)
+
+	if exit, code := c.parseFlags(flags, args); exit {
+		return code
+	}
+
+	// 直接执行编译产物
+	if flags.NArg() == 1 && strings.HasSuffix(flags.Arg(0), bytecode.FileExt) {
+		program, err := bytecode.LoadFile(flags.Arg(0))
+		if err != nil {
+			return c.errorf("run: %s", err)
+		}
+		return c.execute(program, options, func(string) []rune { return nil })
+	}
+
+	if exit, code := project.resolve(runCommand, c, flags); exit {
+		return code
+	}
+
+	inst := c.compileProject(project)
+	if inst == nil {
+		return ExitError
+	}
+	return c.execute(inst.Program, options, compilerSources(inst))
+}
+
+// 使用虚拟机执行程序
+func (c *context) execute(program *bytecode.Program, options *vmFlags, sourceOf func(moduleId string) []rune) int {
+	heap := vm.DefaultHeapOptions
+	heap.MaxBytes = options.maxHeap
+
+	machine := vm.NewWithHeap(program, heap)
+	machine.Stdout = c.stdout
+	_, err := machine.Run()
+
+	if options.gcStats {
+		stats := machine.GCStats()
+		fmt.Fprintf(c.stderr, "gc: %d collection(s), %d allocated, %d freed, %d live object(s), %d live byte(s), %d peak byte(s), pause %s\n",
+			stats.Collections, stats.Allocated, stats.Freed, stats.LiveObjects, stats.LiveBytes, stats.PeakBytes, stats.TotalPause)
+	}
+	if err != nil {
+		c.printRuntimeError(err, sourceOf)
+		return ExitError
+	}
+	return ExitOK
+}
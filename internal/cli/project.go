@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"flag"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"os"
+)
+
+// 项目相关的公共参数
+type projectFlags struct {
+	root  string
+	entry string
+}
+
+func (p *projectFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&p.root, "root", ".", "project root directory")
+	flags.StringVar(&p.entry, "entry", compiler.DefaultEntry, "entry module id, such as main or app.main")
+}
+
+// 位置参数中的目录优先于 `-root` 参数
+func (p *projectFlags) resolve(cmd *command, c *context, flags *flag.FlagSet) (bool, int) {
+	switch flags.NArg() {
+	case 0:
+	case 1:
+		p.root = flags.Arg(0)
+	default:
+		return true, c.usageErrorf(cmd, "too many arguments")
+	}
+	return p.check(cmd, c)
+}
+
+// 检查项目根目录及入口模块
+func (p *projectFlags) check(cmd *command, c *context) (bool, int) {
+	stat, err := os.Stat(p.root)
+	if err != nil || !stat.IsDir() {
+		return true, c.errorf("project root is not a directory: %s", p.root)
+	}
+	if len(p.entry) == 0 {
+		return true, c.usageErrorf(cmd, "entry module cannot be empty")
+	}
+	return false, ExitOK
+}
+
+// 编译项目并输出诊断信息，编译失败时返回 nil
+func (c *context) compileProject(p *projectFlags) *compiler.Compiler {
+	inst := compiler.NewCompiler(p.root, true)
+	inst.Entry = p.entry
+	inst.Compile()
+
+	c.printCompileDiagnostics(inst)
+	if inst.HasError() {
+		return nil
+	}
+	return inst
+}
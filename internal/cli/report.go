@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/peakchen90/noah-lang/internal/helper"
+	"github.com/peakchen90/noah-lang/internal/vm"
+)
+
+// 输出诊断信息，sourceOf 用于查找模块源代码
+func (c *context) printDiagnostics(list []*diagnostic.Diagnostic, sourceOf func(moduleId string) []rune) {
+	errorCount := 0
+
+	for _, d := range list {
+		if d.IsError() {
+			errorCount++
+		}
+
+		fmt.Fprintf(c.stderr, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+		fmt.Fprintf(c.stderr, "  --> %s:%d:%d\n", d.ModuleId, d.Line, d.Column)
+
+		source := sourceOf(d.ModuleId)
+		if len(source) > 0 {
+			if d.IsError() {
+				helper.FprintErrorFrame(c.stderr, source, d.Start, d.Message)
+			} else {
+				helper.FprintWarnFrame(c.stderr, source, d.Start, d.Message)
+			}
+		}
+		fmt.Fprintln(c.stderr)
+	}
+
+	if errorCount > 0 {
+		fmt.Fprintf(c.stderr, "found %d error(s)\n", errorCount)
+	}
+}
+
+// 输出编译器产生的诊断信息
+func (c *context) printCompileDiagnostics(inst *compiler.Compiler) {
+	c.printDiagnostics(inst.Diagnostics, compilerSources(inst))
+}
+
+// 从编译器中查找模块源代码
+func compilerSources(inst *compiler.Compiler) func(moduleId string) []rune {
+	return func(moduleId string) []rune {
+		module, has := inst.Modules[moduleId]
+		if !has {
+			return nil
+		}
+		return module.Source()
+	}
+}
+
+// 输出运行时错误及调用栈，sourceOf 用于查找模块源代码
+func (c *context) printRuntimeError(err error, sourceOf func(moduleId string) []rune) {
+	runtimeErr, ok := err.(*vm.RuntimeError)
+	if !ok {
+		fmt.Fprintf(c.stderr, "error: %s\n", err)
+		return
+	}
+
+	fmt.Fprintf(c.stderr, "error: %s\n", runtimeErr.Message)
+	if len(runtimeErr.Trace) > 0 {
+		top := runtimeErr.Trace[0]
+		if top.Pos >= 0 {
+			fmt.Fprintf(c.stderr, "  --> %s:%d:%d\n", top.ModuleId, top.Line, top.Column)
+			if source := sourceOf(top.ModuleId); len(source) > 0 {
+				helper.FprintErrorFrame(c.stderr, source, top.Pos, runtimeErr.Message)
+			}
+		}
+	}
+	fmt.Fprint(c.stderr, runtimeErr.StackTrace())
+}
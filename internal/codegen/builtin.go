@@ -0,0 +1,213 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+)
+
+// 字符串的内置方法对应的运行时函数（参数均为 number 或 char）
+var stringRuntimeMethods = map[string]string{
+	"toUpperCase": "noah_string_to_upper",
+	"toLowerCase": "noah_string_to_lower",
+	"trim":        "noah_string_trim",
+	"indexOf":     "noah_string_index_of",
+	"slice":       "noah_string_slice",
+}
+
+// 内置方法（见 design/implicit-interface.md），由运行时实现
+func (g *Generator) genBuiltinMethod(object value.Value, name *ast.Identifier, params []*ast.Expr) value.Value {
+	typ := object.Type()
+	switch {
+	case g.arrayOf(typ) != nil:
+		return g.genArrayMethod(g.arrayOf(typ), object, name, params)
+	case typ.Equal(types.I8Ptr):
+		return g.genStringMethod(object, name, params)
+	case isNumeric(typ), typ.Equal(types.I1):
+		switch name.Name {
+		case "toStr":
+			g.expectArgs(name, params, 0)
+			return g.toString(object, nil, name.Position)
+		case "clone":
+			g.expectArgs(name, params, 0)
+			return object
+		}
+	}
+	g.unsupported(name.Position, "method `"+name.Name+"`")
+	return nil
+}
+
+func (g *Generator) genArrayMethod(array *arrayType, object value.Value, name *ast.Identifier, params []*ast.Expr) value.Value {
+	elemPtr := types.NewPointer(array.elem)
+
+	switch name.Name {
+	case "len":
+		g.expectArgs(name, params, 0)
+		return g.fn.block.NewSIToFP(g.callRuntime("noah_array_length", object), types.Double)
+	case "push", "unshift":
+		// unshift 的多个参数依次插入到开头，需要倒序插入
+		for i := range params {
+			param := params[i]
+			if name.Name == "unshift" {
+				param = params[len(params)-1-i]
+			}
+			v := g.genExprType(param, array.elem)
+			ptr := g.callRuntime("noah_array_"+name.Name, object)
+			g.fn.block.NewStore(v, g.fn.block.NewBitCast(ptr, elemPtr))
+		}
+		return constant.NewUndef(types.Void)
+	case "pop", "shift":
+		g.expectArgs(name, params, 0)
+		ptr := g.callRuntime("noah_array_"+name.Name, object)
+		return g.fn.block.NewLoad(array.elem, g.fn.block.NewBitCast(ptr, elemPtr))
+	case "clone":
+		g.expectArgs(name, params, 0)
+		return g.fn.block.NewBitCast(g.callRuntime("noah_array_clone", object), array.ptr)
+	case "slice":
+		g.expectArgs(name, params, 2)
+		result := g.callRuntime("noah_array_slice", object, g.genIndex(params[0]), g.genIndex(params[1]))
+		return g.fn.block.NewBitCast(result, array.ptr)
+	}
+	g.unsupported(name.Position, "array method `"+name.Name+"`")
+	return nil
+}
+
+func (g *Generator) genStringMethod(object value.Value, name *ast.Identifier, params []*ast.Expr) value.Value {
+	switch name.Name {
+	case "len":
+		g.expectArgs(name, params, 0)
+		return g.fn.block.NewSIToFP(g.callRuntime("noah_string_length", object), types.Double)
+	case "toStr", "clone":
+		g.expectArgs(name, params, 0)
+		return object
+	case "toChars":
+		g.expectArgs(name, params, 0)
+		result := g.callRuntime("noah_string_to_chars", object)
+		return g.fn.block.NewBitCast(result, g.arrayTypeOf(types.I32).ptr)
+	case "split":
+		g.expectArgs(name, params, 1)
+		result := g.callRuntime("noah_string_split", object, g.genExprType(params[0], types.I8Ptr))
+		return g.fn.block.NewBitCast(result, g.arrayTypeOf(types.I8Ptr).ptr)
+	}
+
+	fn, has := stringRuntimeMethods[name.Name]
+	if !has {
+		g.unsupported(name.Position, "string method `"+name.Name+"`")
+	}
+	sig := runtimeFuncs[fn]
+	g.expectArgs(name, params, len(sig.params)-1)
+	args := []value.Value{object}
+	for i, param := range params {
+		v := g.genExpr(param)
+		if sig.params[i+1].Equal(types.Double) {
+			v = g.toDouble(v)
+		}
+		args = append(args, g.convert(v, sig.params[i+1]))
+	}
+	return g.callRuntime(fn, args...)
+}
+
+func (g *Generator) expectArgs(name *ast.Identifier, params []*ast.Expr, n int) {
+	if len(params) != n {
+		g.failAt(name.Position, fmt.Sprintf("expect %d argument(s), but got %d", n, len(params)))
+	}
+}
+
+// 内置函数（见 design/README.md），参数个数及类型已由编译器校验
+func (g *Generator) genBuiltinCall(name string, pos ast.Position, params []*ast.Expr) value.Value {
+	switch name {
+	case "print", "println":
+		return g.callRuntime("noah_"+name, g.formatArgs(params))
+	case "panic":
+		g.callRuntime("noah_builtin_panic", g.genExprType(params[0], types.I8Ptr))
+		g.fn.block.NewUnreachable()
+		g.startBlock()
+		return constant.NewUndef(types.Void)
+	case "assert":
+		cond := g.genCondition(params[0])
+		fail := g.fn.fn.NewBlock("")
+		end := g.fn.fn.NewBlock("")
+		g.fn.block.NewCondBr(cond, end, fail)
+		g.fn.block = fail
+		g.callRuntime("noah_assert_fail", g.formatArgs(params[1:]))
+		g.fn.block.NewUnreachable()
+		g.fn.block = end
+		return constant.NewUndef(types.Void)
+	case "len":
+		v := g.genExpr(params[0])
+		switch {
+		case v.Type().Equal(types.I8Ptr):
+			return g.fn.block.NewSIToFP(g.callRuntime("noah_string_length", v), types.Double)
+		case g.arrayOf(v.Type()) != nil:
+			return g.fn.block.NewSIToFP(g.callRuntime("noah_array_length", v), types.Double)
+		}
+	case "typeof":
+		return g.genTypeof(g.genExpr(params[0]), g.info.Types[params[0]])
+	}
+	g.unsupported(pos, "built-in function `"+name+"`")
+	return nil
+}
+
+// 将参数格式化为字符串，以空格分隔
+func (g *Generator) formatArgs(params []*ast.Expr) value.Value {
+	var result value.Value = g.stringConst("")
+	for i, param := range params {
+		s := g.toString(g.genExpr(param), g.info.Types[param], param.Position)
+		if i > 0 {
+			result = g.callRuntime("noah_string_concat", result, g.stringConst(" "))
+			result = g.callRuntime("noah_string_concat", result, s)
+		} else {
+			result = s
+		}
+	}
+	return result
+}
+
+// 值的类型名称，与虚拟机一致（null 的类型名称为 `null`），结构体使用静态类型的名称
+func (g *Generator) genTypeof(v value.Value, kind *compiler.KindRef) value.Value {
+	typ := v.Type()
+	var null value.Value
+	name := ""
+	switch {
+	case typ.Equal(types.Double):
+		name = "number"
+	case typ.Equal(types.I8):
+		name = "byte"
+	case typ.Equal(types.I1):
+		name = "bool"
+	case typ.Equal(types.I8Ptr):
+		name = "string"
+	case typ.Equal(types.I32):
+		name = "char"
+		if kind != nil && kind.Kind() != nil {
+			if _, ok := compiler.Underlying(kind).Kind().(*compiler.TEnum); ok {
+				if decl := g.compiler.KindDecl(kind); decl != nil {
+					name = decl.Name()
+				}
+				null = constant.NewInt(types.I32, -1)
+			}
+		}
+	case g.arrayOf(typ) != nil:
+		name = "array"
+		null = constant.NewNull(typ.(*types.PointerType))
+	case g.layoutOf(typ) != nil:
+		name = "struct"
+		if decl := g.compiler.KindDecl(g.layoutOf(typ).kind); decl != nil {
+			name = decl.Name()
+		}
+		null = constant.NewNull(typ.(*types.PointerType))
+	case isPointer(typ):
+		name = "fn"
+		null = constant.NewNull(typ.(*types.PointerType))
+	}
+
+	if null == nil {
+		return g.stringConst(name)
+	}
+	isNull := g.fn.block.NewICmp(enum.IPredEQ, v, null)
+	return g.fn.block.NewSelect(isNull, g.stringConst("null"), g.stringConst(name))
+}
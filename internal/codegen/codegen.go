@@ -0,0 +1,318 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"os"
+	"sort"
+)
+
+// FileExt LLVM IR 文件的扩展名
+const FileExt = ".ll"
+
+// Generator 将类型检查后的模块翻译为 LLVM IR
+type Generator struct {
+	compiler *compiler.Compiler
+	info     *compiler.Info
+	module   *ir.Module
+	modules  []*compiler.Module // 按模块索引排列
+
+	/* context */
+	current *compiler.Module // 正在生成的模块
+	fn      *funcState       // 正在生成的函数
+	pos     ast.Position     // 正在生成的语句或表达式的位置
+
+	/* declarations */
+	funcs     map[*compiler.FuncValue]*ir.Func
+	globals   map[*compiler.VarValue]*ir.Global
+	inits     map[*compiler.Module]*ir.Func
+	structs   map[compiler.Kind]*structLayout
+	layouts   map[string]*structLayout              // 按 LLVM 指针类型查找结构体布局
+	shapes    map[string]*structLayout              // 按字段签名查找匿名结构体布局
+	arrays    map[string]*arrayType                 // 按名称及指针类型查找数组类型
+	runtime   map[string]*ir.Func                   // 已声明的运行时函数
+	enums     map[*compiler.TEnum]constant.Constant // 枚举选项的名称
+	strings   map[string]constant.Constant
+	anonymous int // 匿名函数的数量
+}
+
+// 正在生成的函数
+type funcState struct {
+	fn     *ir.Func
+	entry  *ir.Block // 入口块：只存放局部变量的 alloca
+	block  *ir.Block // 当前写入指令的块
+	self   value.Value
+	locals map[*compiler.VarValue]value.Value
+	loops  []*loopState
+}
+
+type loopState struct {
+	label      string
+	breakTo    *ir.Block
+	continueTo *ir.Block
+}
+
+// Generate 为编译成功的程序生成 LLVM IR 模块，遇到暂不支持的特性时返回 *diagnostic.Diagnostic
+func Generate(c *compiler.Compiler) (module *ir.Module, err error) {
+	if c.Main == nil || c.HasError() {
+		return nil, errors.New("cannot generate code for a program with errors")
+	}
+
+	g := newGenerator(c)
+	defer func() {
+		if r := recover(); r != nil {
+			d, ok := r.(*diagnostic.Diagnostic)
+			if !ok {
+				panic(r)
+			}
+			module, err = nil, d
+		}
+	}()
+
+	g.generate()
+	return g.module, nil
+}
+
+// WriteFile 将 LLVM IR 写入文件
+func WriteFile(module *ir.Module, filename string) error {
+	return os.WriteFile(filename, []byte(module.String()), 0644)
+}
+
+func newGenerator(c *compiler.Compiler) *Generator {
+	modules := make([]*compiler.Module, 0, len(c.Modules))
+	for _, module := range c.Modules {
+		modules = append(modules, module)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Code().Index < modules[j].Code().Index
+	})
+
+	return &Generator{
+		compiler: c,
+		info:     c.Info,
+		module:   ir.NewModule(),
+		modules:  modules,
+		funcs:    make(map[*compiler.FuncValue]*ir.Func),
+		globals:  make(map[*compiler.VarValue]*ir.Global),
+		inits:    make(map[*compiler.Module]*ir.Func),
+		structs:  make(map[compiler.Kind]*structLayout),
+		layouts:  make(map[string]*structLayout),
+		shapes:   make(map[string]*structLayout),
+		arrays:   make(map[string]*arrayType),
+		runtime:  make(map[string]*ir.Func),
+		enums:    make(map[*compiler.TEnum]constant.Constant),
+		strings:  make(map[string]constant.Constant),
+	}
+}
+
+func (g *Generator) generate() {
+	// 1. 声明所有模块的函数、全局变量（函数体内可能引用其他模块）
+	for _, module := range g.modules {
+		g.current = module
+		g.declareModule(module)
+	}
+
+	// 2. 生成模块初始化函数及函数体
+	for _, module := range g.modules {
+		g.current = module
+		g.defineModule(module)
+	}
+
+	g.current = g.compiler.Main
+	g.defineMain()
+}
+
+// 声明模块的函数及全局变量
+func (g *Generator) declareModule(module *compiler.Module) {
+	for _, stmt := range module.Ast.Body {
+		g.pos = stmt.Position
+
+		switch stmt.Node.(type) {
+		case *ast.FuncDecl:
+			node := stmt.Node.(*ast.FuncDecl)
+			g.declareFunc(node, nil)
+		case *ast.ImplDecl:
+			node := stmt.Node.(*ast.ImplDecl)
+			target := g.info.Impls[node]
+			for _, item := range node.Body.Node.(*ast.BlockStmt).Body {
+				g.declareFunc(item.Node.(*ast.FuncDecl), target)
+			}
+		case *ast.VarDecl:
+			node := stmt.Node.(*ast.VarDecl)
+			v := g.info.Defs[node.Id].(*compiler.VarValue)
+			global := g.module.NewGlobalDef(module.Id()+"."+v.Name, g.zero(v.Kind))
+			g.globals[v] = global
+		}
+	}
+}
+
+// 声明函数，方法的第一个参数为 self
+func (g *Generator) declareFunc(node *ast.FuncDecl, target *compiler.KindRef) {
+	v := g.info.Defs[node.Name].(*compiler.FuncValue)
+	code := v.Module().Code()
+	name := code.Name + "." + code.Functions[v.Ptr].Name
+
+	g.funcs[v] = g.newFunc(name, node.Kind, v.Kind.Kind().(*compiler.TFunc), target)
+}
+
+// 创建函数，参数名来自函数类型声明
+func (g *Generator) newFunc(name string, kindExpr *ast.KindExpr, t *compiler.TFunc, self *compiler.KindRef) *ir.Func {
+	params := make([]*ir.Param, 0, len(t.Arguments)+1)
+	if self != nil {
+		params = append(params, ir.NewParam("self", g.llvmType(self)))
+	}
+	for i, arg := range kindExpr.Node.(*ast.TFuncKind).Arguments {
+		params = append(params, ir.NewParam(arg.Name.Name, g.llvmType(t.Arguments[i])))
+	}
+	return g.module.NewFunc(name, g.llvmType(t.Return), params...)
+}
+
+// 生成模块的初始化函数（全局变量及顶层的可执行语句）及函数体
+func (g *Generator) defineModule(module *compiler.Module) {
+	inits := make([]*ast.Stmt, 0, len(module.Ast.Body))
+	for _, stmt := range module.Ast.Body {
+		switch stmt.Node.(type) {
+		case *ast.ImportDecl, *ast.TTypeDecl, *ast.TInterfaceDecl, *ast.TStructDecl, *ast.TEnumDecl:
+		case *ast.FuncDecl:
+			node := stmt.Node.(*ast.FuncDecl)
+			v := g.info.Defs[node.Name].(*compiler.FuncValue)
+			g.defineFunc(g.funcs[v], nil, node.Kind, node.Body)
+		case *ast.ImplDecl:
+			node := stmt.Node.(*ast.ImplDecl)
+			target := g.info.Impls[node]
+			for _, item := range node.Body.Node.(*ast.BlockStmt).Body {
+				funcNode := item.Node.(*ast.FuncDecl)
+				v := g.info.Defs[funcNode.Name].(*compiler.FuncValue)
+				g.defineFunc(g.funcs[v], target, funcNode.Kind, funcNode.Body)
+			}
+		default:
+			inits = append(inits, stmt)
+		}
+	}
+
+	if len(inits) > 0 {
+		fn := g.module.NewFunc(module.Id()+".<init>", types.Void)
+		g.inits[module] = fn
+		g.beginFunc(fn, nil, nil)
+		for _, stmt := range inits {
+			g.genStmt(stmt)
+		}
+		g.endFunc()
+	}
+}
+
+// 生成函数体，self 及参数保存在局部变量中
+func (g *Generator) defineFunc(fn *ir.Func, target *compiler.KindRef, kindExpr *ast.KindExpr, body *ast.Stmt) {
+	g.beginFunc(fn, target, kindExpr.Node.(*ast.TFuncKind).Arguments)
+	g.genBlockStmt(body.Node.(*ast.BlockStmt))
+	g.endFunc()
+}
+
+func (g *Generator) beginFunc(fn *ir.Func, target *compiler.KindRef, args []*ast.Argument) *funcState {
+	entry := fn.NewBlock("")
+	g.fn = &funcState{
+		fn:     fn,
+		entry:  entry,
+		block:  fn.NewBlock(""),
+		locals: make(map[*compiler.VarValue]value.Value),
+	}
+
+	params := fn.Params
+	if target != nil {
+		g.fn.self = params[0]
+		params = params[1:]
+	}
+	for i, arg := range args {
+		ptr := entry.NewAlloca(params[i].Typ)
+		g.fn.block.NewStore(params[i], ptr)
+		g.fn.locals[g.info.Defs[arg.Name].(*compiler.VarValue)] = ptr
+	}
+	return g.fn
+}
+
+// 结束函数：没有返回的分支返回默认值
+func (g *Generator) endFunc() {
+	fs := g.fn
+	fs.entry.NewBr(fs.fn.Blocks[1])
+	if fs.block.Term == nil {
+		ret := fs.fn.Sig.RetType
+		if ret.Equal(types.Void) {
+			fs.block.NewRet(nil)
+		} else {
+			fs.block.NewRet(g.zeroOf(ret))
+		}
+	}
+	g.fn = nil
+}
+
+// 生成 C 的 main 函数：按依赖顺序执行模块初始化函数，再调用入口模块的 main 函数，
+// main 函数返回 number 时作为进程的退出码
+func (g *Generator) defineMain() {
+	var entry *ir.Func
+	for _, stmt := range g.current.Ast.Body {
+		if node, ok := stmt.Node.(*ast.FuncDecl); ok && node.Name.Name == "main" {
+			entry = g.funcs[g.info.Defs[node.Name].(*compiler.FuncValue)]
+			g.pos = node.Name.Position
+		}
+	}
+	if entry == nil {
+		d := diagnostic.New(diagnostic.CodeSemantic, nil, ast.Position{}, "missing function `main` in entry module")
+		d.ModuleId = g.current.Id()
+		panic(d)
+	}
+	if len(entry.Params) > 0 {
+		g.fail("function `main` should not have arguments")
+	}
+
+	fn := g.module.NewFunc("main", types.I32)
+	block := fn.NewBlock("")
+	inited := make(map[*compiler.Module]bool)
+	var initModule func(module *compiler.Module)
+	initModule = func(module *compiler.Module) {
+		if inited[module] {
+			return
+		}
+		inited[module] = true
+		for _, index := range module.Code().Imports {
+			initModule(g.modules[index])
+		}
+		if init := g.inits[module]; init != nil {
+			block.NewCall(init)
+		}
+	}
+	initModule(g.current)
+
+	result := block.NewCall(entry)
+	if result.Type().Equal(types.Double) {
+		block.NewRet(block.NewFPToSI(result, types.I32))
+	} else {
+		block.NewRet(constant.NewInt(types.I32, 0))
+	}
+}
+
+// 抛出当前位置的诊断信息
+func (g *Generator) fail(format string, args ...interface{}) {
+	g.failAt(g.pos, fmt.Sprintf(format, args...))
+}
+
+func (g *Generator) failAt(pos ast.Position, msg string) {
+	g.report(diagnostic.CodeSemantic, pos, msg)
+}
+
+// 抛出暂不支持的特性的诊断信息
+func (g *Generator) unsupported(pos ast.Position, feature string) {
+	g.report(diagnostic.CodeUnsupported, pos, feature+" are not supported by the native backend yet")
+}
+
+func (g *Generator) report(code string, pos ast.Position, msg string) {
+	d := diagnostic.New(code, g.current.Source(), pos, msg)
+	d.ModuleId = g.current.Id()
+	panic(d)
+}
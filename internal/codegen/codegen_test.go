@@ -0,0 +1,470 @@
+package codegen
+
+import (
+	"errors"
+	"github.com/llir/llvm/ir"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/stretchr/testify/assert"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// 使用虚拟文件系统编译项目并生成 LLVM IR
+func generateFiles(t *testing.T, files map[string]string) (*ir.Module, error) {
+	c := compiler.NewCompiler("", false)
+	for name, code := range files {
+		_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, name), []byte(code))
+	}
+	c.Compile()
+	if !assert.False(t, c.HasError(), "%v", c.Diagnostics) {
+		t.FailNow()
+	}
+	return Generate(c)
+}
+
+func generateMain(t *testing.T, code string) *ir.Module {
+	module, err := generateFiles(t, map[string]string{"main.noah": code})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return module
+}
+
+// 使用 llc 及 gcc 编译 IR 并与运行时链接后运行，返回进程的退出码及输出（缺少工具链时跳过）
+func runNative(t *testing.T, module *ir.Module) (int, string) {
+	llc, err := exec.LookPath("llc")
+	if err != nil {
+		t.Skip("llc not found")
+	}
+	cc, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc not found")
+	}
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main"+FileExt)
+	object := filepath.Join(dir, "main.o")
+	binary := filepath.Join(dir, "main")
+	runtime := filepath.Join(dir, RuntimeFile)
+	if !assert.NoError(t, WriteFile(module, source)) || !assert.NoError(t, WriteRuntime(runtime)) {
+		t.FailNow()
+	}
+	if output, err := exec.Command(llc, "-filetype=obj", "-relocation-model=pic", "-o", object, source).CombinedOutput(); err != nil {
+		t.Fatalf("llc: %s\n%s", err, output)
+	}
+	if output, err := exec.Command(cc, "-o", binary, object, runtime).CombinedOutput(); err != nil {
+		t.Fatalf("gcc: %s\n%s", err, output)
+	}
+
+	output, err := exec.Command(binary).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(output)
+	}
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return 0, string(output)
+}
+
+func assertExitCode(t *testing.T, expected int, code string) {
+	exitCode, output := runNative(t, generateMain(t, code))
+	assert.Equal(t, expected, exitCode, output)
+}
+
+func TestGenerate(t *testing.T) {
+	module := generateMain(t, `
+struct Point {
+    x: number,
+    y: number
+}
+
+let origin = Point { x: 1, y: 2 }
+
+fn add(a: number, b: number) -> number {
+    return a + b
+}
+
+fn main() -> number {
+    return add(origin.x, origin.y)
+}`)
+	text := module.String()
+	assert.Contains(t, text, "%main.Point = type { double, double }")
+	assert.Contains(t, text, "@main.origin = global %main.Point* null")
+	assert.Contains(t, text, "define double @main.add(double %a, double %b)")
+	assert.Contains(t, text, "define void @\"main.<init>\"()")
+	assert.Contains(t, text, "define i32 @main()")
+	assert.Contains(t, text, "declare i8* @noah_alloc(i64 %0)")
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	_, err := generateFiles(t, map[string]string{
+		"main.noah": "fn main() -> number {\n    let a: any = 1\n    return 0\n}",
+	})
+	d, ok := err.(*diagnostic.Diagnostic)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, diagnostic.CodeUnsupported, d.Code)
+		assert.Equal(t, "main", d.ModuleId)
+		assert.Equal(t, 2, d.Line)
+		assert.Equal(t, 5, d.Column)
+	}
+
+	_, err = generateFiles(t, map[string]string{"main.noah": "fn foo() {}"})
+	assert.EqualError(t, err, "main:1:1: error[E0005]: missing function `main` in entry module")
+}
+
+func TestNativeExpr(t *testing.T) {
+	assertExitCode(t, 7, "fn main() -> number { return 1 + 2 * 3 }")
+	assertExitCode(t, 1, "fn main() -> number { return 7 % 3 }")
+	assertExitCode(t, 12, "fn main() -> number { return (3 << 2) | (5 & 1) - 1 }")
+	assertExitCode(t, 9, `
+fn main() -> number {
+    let c = 'a'
+    c++
+    let n = 0
+    if (c > 'a' && !(c >= 'c') || false) {
+        n = c - 89
+    }
+    return n
+}`)
+}
+
+func TestNativeLoop(t *testing.T) {
+	assertExitCode(t, 45, `
+fn main() -> number {
+    let sum = 0
+    for (let i = 0; i < 10; i++) {
+        sum += i
+    }
+    return sum
+}`)
+
+	assertExitCode(t, 6, `
+fn main() -> number {
+    let count = 0
+    outer: for (let i = 0; i < 5; i++) {
+        for (let j = 0; j < 5; j++) {
+            if (j == 2) {
+                continue outer
+            }
+            if (i == 3) {
+                break outer
+            }
+            count++
+        }
+    }
+    return count
+}`)
+}
+
+func TestNativeStructAndMethod(t *testing.T) {
+	assertExitCode(t, 13, `
+struct Point {
+    x: number,
+    y: number
+}
+
+struct Point3 <- Point {
+    z: number
+}
+
+impl Point {
+    fn sum() -> number {
+        return self.x + self.y
+    }
+}
+
+fn main() -> number {
+    let p = Point3 { x: 1, y: 2 }
+    p.z = 10
+    return p.sum() + p.z
+}`)
+
+	assertExitCode(t, 3, `
+struct Node {
+    value: number,
+    next: Node
+}
+
+fn main() -> number {
+    let head = Node { value: 1, next: Node { value: 2 } }
+    let sum = 0
+    for (let node = head; node != null; node = node.next) {
+        sum += node.value
+    }
+    return sum
+}`)
+}
+
+func TestNativeFunc(t *testing.T) {
+	assertExitCode(t, 120, `
+fn fact(n: number) -> number {
+    if (n <= 1) {
+        return 1
+    }
+    return n * fact(n - 1)
+}
+
+fn main() -> number {
+    let f = fact
+    return f(5)
+}`)
+
+	assertExitCode(t, 8, `
+fn apply(f: fn (x: number) -> number, x: number) -> number {
+    return f(x)
+}
+
+fn main() -> number {
+    return apply(fn (x: number) -> number { return x * 2 }, 4)
+}`)
+}
+
+func TestNativeEnum(t *testing.T) {
+	assertExitCode(t, 2, `
+enum Color {
+    Red,
+    Green
+}
+
+struct Box {
+    color: Color
+}
+
+fn main() -> number {
+    let c = Color.Green
+    if (c == Color.Red) {
+        return 1
+    }
+    let b = Box {}
+    if (b.color == null && c == Color.Green) {
+        return 2
+    }
+    return 3
+}`)
+}
+
+func TestNativeModuleInit(t *testing.T) {
+	module, err := generateFiles(t, map[string]string{
+		"main.noah": `
+import lib.a
+
+let local = a.value * 2
+
+fn main() -> number {
+    return local + a.value
+}`,
+		"lib/a.noah": `
+pub let value = compute()
+
+fn compute() -> number {
+    return 10
+}`,
+	})
+	if assert.NoError(t, err) {
+		exitCode, _ := runNative(t, module)
+		assert.Equal(t, 30, exitCode)
+	}
+}
+
+func TestNativeString(t *testing.T) {
+	assertExitCode(t, 1, `
+enum Color {
+    Red,
+    Green
+}
+
+fn main() -> number {
+    let s = "Man: " + "Tom"
+    s += ", " + 1.5 + " " + true + " " + 'x' + " " + Color.Green
+    if (s == "Man: Tom, 1.5 true x Color.Green" && s[5] == 'T' && "abc" < "abd") {
+        return 1
+    }
+    return 0
+}`)
+}
+
+func TestNativeCast(t *testing.T) {
+	assertExitCode(t, 1, `
+fn main() -> number {
+    let s = 1.5 as string
+    let n = 'a' as number
+    let c = 98 as char
+    let b = 233 as byte
+    if (s == "1.5" && n == 97 && c == 'b' && b as char as number == 233 && 'a' as byte == 97 as byte) {
+        return 1
+    }
+    return 0
+}`)
+
+	// 与虚拟机的错误信息一致
+	cases := map[string]string{
+		"300 as byte":         "cannot cast 300 to byte: out of range [0, 255]",
+		"1.5 as byte":         "cannot cast 1.5 to byte: not an integer",
+		"256 as char as byte": "cannot cast 256 to byte: out of range [0, 255]",
+		"-1 as char":          "cannot cast -1 to char: invalid code point",
+		"55296 as char":       "cannot cast 55296 to char: invalid code point",
+	}
+	for cast, message := range cases {
+		exitCode, output := runNative(t, generateMain(t, "fn main() -> number {\n    let v = "+cast+"\n    return 0\n}"))
+		assert.Equal(t, 1, exitCode, cast)
+		assert.Equal(t, "runtime error: "+message+"\n", output, cast)
+	}
+}
+
+func TestNativeArray(t *testing.T) {
+	assertExitCode(t, 31, `
+fn main() -> number {
+    let arr: []number = [1, 2, 3]
+    arr.push(4)
+    arr.unshift(10)
+    arr[1] = 5
+    arr[2] += 1
+    let sum = 0
+    for (item, i: arr) {
+        sum += item + i
+    }
+    return sum - arr.pop()
+}`)
+
+	assertExitCode(t, 6, `
+fn sum(...items: []number) -> number {
+    let result = 0
+    for (item: items) {
+        result += item
+    }
+    return result
+}
+
+fn main() -> number {
+    return sum(1, 2, 3) + sum()
+}`)
+
+	assertExitCode(t, 5, `
+struct Point {
+    x: number
+}
+
+fn main() -> number {
+    let points: []Point = []
+    points.push({ x: 2 })
+    let more: [2]Point = [{ x: 3 }, null]
+    if (more[1] == null) {
+        return points[0].x + more[0].x
+    }
+    return 0
+}`)
+
+	exitCode, output := runNative(t, generateMain(t, `
+fn main() -> number {
+    let arr = [1, 2]
+    return arr[2]
+}`))
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "runtime error: index out of range [2] with length 2\n", output)
+}
+
+func TestNativeFixedArray(t *testing.T) {
+	assertExitCode(t, 1, `
+const N = 2
+
+struct Box {
+    names: [N]string
+}
+
+fn main() -> number {
+    let a: [N + 1]number = [1, 2]
+    let b: [N][N]string
+    let v: []number = a
+    v.push(4)
+    let box = Box {}
+    if (a[2] == 0 && a.len() == 3 && v.len() == 4 && b[1][1] == "" && box.names[1] == "") {
+        return 1
+    }
+    return 0
+}`)
+}
+
+func TestNativeBuiltinMethod(t *testing.T) {
+	assertExitCode(t, 50, `
+fn main() -> number {
+    let arr: []number = [1, 2]
+    arr.push(3, 4)
+    arr.unshift(5, 6)
+    let first = arr.shift()
+    let part = arr.slice(1, 3)
+    let copy = part.clone()
+    copy[0] = 100
+    return first * 10 - arr.len() + part[0] - part.len() + arr[0]
+}`)
+
+	assertExitCode(t, 1, `
+fn main() -> number {
+    let s = "  Hello, World ".trim()
+    let n = 12
+    let parts = s.split(", ")
+    let chars = s.toChars()
+    if (s.toUpperCase() == "HELLO, WORLD" && s.slice(7, 12).toLowerCase() == "world" && s.indexOf('W') == 7 &&
+        s.len() == 12 && parts[1] == "World" && chars.len() == 12 && chars[4] == 'o' && n.toStr() == "12") {
+        return 1
+    }
+    return 0
+}`)
+}
+
+func TestRuntimeSource(t *testing.T) {
+	for name := range runtimeFuncs {
+		assert.Regexp(t, `(?m)^[\w ]+\*?`+name+`\(`, RuntimeSource, name)
+	}
+}
+
+func TestNativePrelude(t *testing.T) {
+	exitCode, output := runNative(t, generateMain(t, `
+enum Color {
+    Red
+}
+
+struct Point {
+    x: number
+}
+
+fn main() -> number {
+    let arr: []number = [1, 2]
+    let p: Point = null
+    let c: Color
+    print("a", 1)
+    println(" b", 'c', true, Color.Red)
+    println()
+    assert(len(arr) == 2, "len")
+    println(typeof(1), typeof(arr), typeof(Point {}), typeof(p), typeof(Color.Red), typeof(c), typeof(main))
+    return len("你好")
+}`))
+	assert.Equal(t, 2, exitCode)
+	assert.Equal(t, "a 1 b c true Color.Red\n\nnumber array Point null Color null fn\n", output)
+
+	exitCode, output = runNative(t, generateMain(t, `
+fn main() -> number {
+    let n = 1
+    assert(n == 2, "n =", n)
+    return 0
+}`))
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "runtime error: assertion failed: n = 1\n", output)
+
+	exitCode, output = runNative(t, generateMain(t, `
+fn check(n: number) -> number {
+    if (n > 0) {
+        return n
+    }
+    panic("negative")
+    return 0
+}
+
+fn main() -> number {
+    return check(3) + check(-1)
+}`))
+	assert.Equal(t, 1, exitCode)
+	assert.Equal(t, "runtime error: panic: negative\n", output)
+}
@@ -0,0 +1,788 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"strings"
+)
+
+// 比较运算符对应的有符号整数比较（用于字符串比较的结果）
+var signedPreds = map[enum.IPred]enum.IPred{
+	enum.IPredEQ:  enum.IPredEQ,
+	enum.IPredNE:  enum.IPredNE,
+	enum.IPredULT: enum.IPredSLT,
+	enum.IPredULE: enum.IPredSLE,
+	enum.IPredUGT: enum.IPredSGT,
+	enum.IPredUGE: enum.IPredSGE,
+}
+
+// 浮点数比较运算符
+var floatPreds = map[string]enum.FPred{
+	"==": enum.FPredOEQ,
+	"!=": enum.FPredUNE,
+	"<":  enum.FPredOLT,
+	"<=": enum.FPredOLE,
+	">":  enum.FPredOGT,
+	">=": enum.FPredOGE,
+}
+
+// 整数（byte、char、bool、枚举）比较运算符，均为无符号数
+var intPreds = map[string]enum.IPred{
+	"==": enum.IPredEQ,
+	"!=": enum.IPredNE,
+	"<":  enum.IPredULT,
+	"<=": enum.IPredULE,
+	">":  enum.IPredUGT,
+	">=": enum.IPredUGE,
+}
+
+func (g *Generator) genExpr(expr *ast.Expr) value.Value {
+	saved := g.pos
+	g.pos = expr.Position
+	defer func() { g.pos = saved }()
+
+	switch expr.Node.(type) {
+	case *ast.CallExpr:
+		return g.genCallExpr(expr.Node.(*ast.CallExpr))
+	case *ast.MemberExpr:
+		return g.genMemberExpr(expr)
+	case *ast.BinaryExpr:
+		return g.genBinaryExpr(expr.Node.(*ast.BinaryExpr))
+	case *ast.BinaryTypeExpr:
+		return g.genBinaryTypeExpr(expr)
+	case *ast.UnaryExpr:
+		return g.genUnaryExpr(expr.Node.(*ast.UnaryExpr))
+	case *ast.FuncExpr:
+		return g.genFuncExpr(expr)
+	case *ast.StructExpr:
+		return g.genStructExpr(expr)
+	case *ast.ArrayExpr:
+		return g.genArrayExpr(expr)
+	case *ast.IdentifierLiteral:
+		return g.genIdentifierLiteral(expr)
+	case *ast.NumberLiteral:
+		return constant.NewFloat(types.Double, expr.Node.(*ast.NumberLiteral).Value)
+	case *ast.BoolLiteral:
+		return constant.NewBool(expr.Node.(*ast.BoolLiteral).Value)
+	case *ast.NullLiteral:
+		kind := g.info.Types[expr]
+		if kind == nil {
+			g.fail("cannot infer the type of null")
+		}
+		return g.null(g.llvmType(kind))
+	case *ast.StringLiteral:
+		return g.stringConst(expr.Node.(*ast.StringLiteral).Value)
+	case *ast.CharLiteral:
+		return constant.NewInt(types.I32, int64(expr.Node.(*ast.CharLiteral).Value))
+	}
+	panic("Internal Err")
+}
+
+// 生成表达式并转换为期望的类型，null 使用期望类型的空值
+func (g *Generator) genExprType(expr *ast.Expr, typ types.Type) value.Value {
+	if _, ok := expr.Node.(*ast.NullLiteral); ok {
+		return g.null(typ)
+	}
+	v := g.convert(g.genExpr(expr), typ)
+	if g.info.Copies[expr] {
+		// 定长数组用作可变长数组时复制一份
+		v = g.fn.block.NewBitCast(g.callRuntime("noah_array_clone", v), typ)
+	}
+	return v
+}
+
+// 生成运算的操作数，null 使用另一个操作数类型的空值
+func (g *Generator) genOperand(expr *ast.Expr, typ types.Type) value.Value {
+	if _, ok := expr.Node.(*ast.NullLiteral); ok {
+		return g.null(typ)
+	}
+	return g.genExpr(expr)
+}
+
+// 生成条件表达式，结果必须为 bool
+func (g *Generator) genCondition(expr *ast.Expr) value.Value {
+	cond := g.genExpr(expr)
+	if !cond.Type().Equal(types.I1) {
+		g.failAt(expr.Position, "expect a bool value")
+	}
+	return cond
+}
+
+func (g *Generator) genIdentifierLiteral(expr *ast.Expr) value.Value {
+	v := g.info.Uses[expr]
+	if v == nil {
+		g.fail("not a value: %s", expr.Node.(*ast.IdentifierLiteral).Name.Name)
+	}
+	return g.loadValue(v)
+}
+
+// 读取变量、函数或 self 的值
+func (g *Generator) loadValue(v compiler.Value) value.Value {
+	switch v.(type) {
+	case *compiler.VarValue:
+		ptr := g.varPtr(v.(*compiler.VarValue))
+		return g.fn.block.NewLoad(elemType(ptr), ptr)
+	case *compiler.FuncValue:
+		return g.funcs[v.(*compiler.FuncValue)]
+	case *compiler.SelfValue:
+		if g.fn.self == nil {
+			g.fail("`self` is not available here")
+		}
+		return g.fn.self
+	case *compiler.BuiltinValue:
+		g.unsupported(g.pos, "built-in functions as values")
+	}
+	panic("Internal Err")
+}
+
+func (g *Generator) varPtr(v *compiler.VarValue) value.Value {
+	if v.Global {
+		return g.globals[v]
+	}
+	ptr := g.fn.locals[v]
+	if ptr == nil {
+		g.fail("cannot capture variable: %s", v.Name)
+	}
+	return ptr
+}
+
+func (g *Generator) genMemberExpr(expr *ast.Expr) value.Value {
+	if v := g.info.Uses[expr]; v != nil {
+		return g.loadValue(v)
+	}
+
+	node := expr.Node.(*ast.MemberExpr)
+	if node.Computed {
+		object := g.genExpr(node.Object)
+		if object.Type().Equal(types.I8Ptr) {
+			return g.callRuntime("noah_string_index", object, g.genIndex(node.Property))
+		}
+		ptr := g.elemPtr(object, node.Property)
+		return g.fn.block.NewLoad(elemType(ptr), ptr)
+	}
+	name := node.Property.Node.(*ast.IdentifierLiteral).Name
+	if choice, ok := g.enumChoice(expr); ok {
+		return constant.NewInt(types.I32, int64(choice))
+	}
+
+	ptr := g.fieldPtr(g.genExpr(node.Object), name)
+	return g.fn.block.NewLoad(elemType(ptr), ptr)
+}
+
+// 判断成员表达式是否为枚举选项（如 `Color.Red`），枚举类型不是值，不会记录类型或引用
+func (g *Generator) enumChoice(expr *ast.Expr) (int, bool) {
+	node, ok := expr.Node.(*ast.MemberExpr)
+	if !ok || node.Computed || g.info.Uses[node.Object] != nil || g.info.Types[node.Object] != nil {
+		return 0, false
+	}
+	kind := g.info.Types[expr]
+	if kind == nil {
+		return 0, false
+	}
+	t, ok := compiler.Underlying(kind).Kind().(*compiler.TEnum)
+	if !ok {
+		return 0, false
+	}
+	choice, has := t.Choices[node.Property.Node.(*ast.IdentifierLiteral).Name.Name]
+	return choice, has
+}
+
+// 数组元素的指针，由运行时检查索引是否越界
+func (g *Generator) elemPtr(object value.Value, index *ast.Expr) value.Value {
+	array := g.arrayOf(object.Type())
+	if array == nil {
+		g.failAt(index.Position, "cannot index this value")
+	}
+	ptr := g.callRuntime("noah_array_at", object, g.genIndex(index))
+	return g.fn.block.NewBitCast(ptr, types.NewPointer(array.elem))
+}
+
+// 索引统一转为 number 传给运行时
+func (g *Generator) genIndex(index *ast.Expr) value.Value {
+	v := g.genExpr(index)
+	if !isNumeric(v.Type()) {
+		g.failAt(index.Position, "expect a number index")
+	}
+	return g.toDouble(v)
+}
+
+// 结构体字段的指针
+func (g *Generator) fieldPtr(object value.Value, name *ast.Identifier) value.Value {
+	layout := g.layoutOf(object.Type())
+	if layout == nil {
+		g.unsupported(name.Position, "properties of non-struct values")
+	}
+	index, has := layout.index[name.Name]
+	if !has {
+		g.failAt(name.Position, "undefined field: "+name.Name)
+	}
+	zero := constant.NewInt(types.I32, 0)
+	return g.fn.block.NewGetElementPtr(layout.typ, object, zero, constant.NewInt(types.I32, int64(index)))
+}
+
+func (g *Generator) genCallExpr(expr *ast.CallExpr) value.Value {
+	callee := expr.Callee
+	if v, ok := g.info.Uses[callee].(*compiler.BuiltinValue); ok {
+		return g.genBuiltinCall(v.Name, callee.Position, expr.Params)
+	}
+	var fn value.Value
+	args := make([]value.Value, 0, len(expr.Params)+1)
+
+	// 方法调用：`object.method()`，没有对应的方法时调用函数类型的字段
+	member, ok := callee.Node.(*ast.MemberExpr)
+	if ok && !member.Computed && g.info.Uses[callee] == nil {
+		if _, isChoice := g.enumChoice(callee); !isChoice {
+			name := member.Property.Node.(*ast.IdentifierLiteral).Name
+			object := g.genExpr(member.Object)
+			if method := g.findMethod(member.Object, object, name.Name); method != nil {
+				f := g.funcs[method]
+				fn = f
+				args = append(args, g.convert(object, f.Params[0].Typ))
+			} else if g.layoutOf(object.Type()) == nil {
+				return g.genBuiltinMethod(object, name, expr.Params)
+			} else {
+				ptr := g.fieldPtr(object, name)
+				fn = g.fn.block.NewLoad(elemType(ptr), ptr)
+			}
+		}
+	}
+	if fn == nil {
+		fn = g.genExpr(callee)
+	}
+
+	ptr, ok := fn.Type().(*types.PointerType)
+	if !ok {
+		g.failAt(callee.Position, "not a function")
+	}
+	sig, ok := ptr.ElemType.(*types.FuncType)
+	if !ok {
+		g.failAt(callee.Position, "not a function")
+	}
+
+	params := sig.Params[len(args):]
+	rest := g.isRestFunc(callee)
+	if rest && len(expr.Params) >= len(params)-1 {
+		// 剩余参数打包为数组
+		for i, param := range expr.Params[:len(params)-1] {
+			args = append(args, g.genExprType(param, params[i]))
+		}
+		typ := params[len(params)-1]
+		items := expr.Params[len(params)-1:]
+		args = append(args, g.newArray(g.arrayOf(typ), items, len(items)))
+		return g.fn.block.NewCall(fn, args...)
+	}
+	if len(params) != len(expr.Params) {
+		g.failAt(callee.Position, fmt.Sprintf("expect %d argument(s), but got %d", len(params), len(expr.Params)))
+	}
+	for i, param := range expr.Params {
+		args = append(args, g.genExprType(param, params[i]))
+	}
+	return g.fn.block.NewCall(fn, args...)
+}
+
+// 判断被调用的函数是否有剩余参数
+func (g *Generator) isRestFunc(callee *ast.Expr) bool {
+	var kind *compiler.KindRef
+	switch v := g.info.Uses[callee].(type) {
+	case *compiler.FuncValue:
+		kind = v.Kind
+	case *compiler.VarValue:
+		kind = v.Kind
+	}
+	if kind == nil {
+		kind = g.info.Types[callee]
+	}
+	if kind == nil || kind.Kind() == nil {
+		return false
+	}
+	t, ok := compiler.Underlying(kind).Kind().(*compiler.TFunc)
+	return ok && t.HasRest
+}
+
+// 查找对象的方法，优先使用类型检查记录的类型，否则使用结构体布局对应的类型
+func (g *Generator) findMethod(expr *ast.Expr, object value.Value, name string) *compiler.FuncValue {
+	kind := g.info.Types[expr]
+	if kind == nil {
+		if layout := g.layoutOf(object.Type()); layout != nil {
+			kind = layout.kind
+		}
+	}
+	if kind == nil {
+		return nil
+	}
+	return compiler.FindMethod(kind, name)
+}
+
+func (g *Generator) genBinaryExpr(expr *ast.BinaryExpr) value.Value {
+	operator := expr.Operator.Value
+	switch operator {
+	// assign
+	case "=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "|=", "^=":
+		return g.genAssignExpr(expr)
+
+	// logic : 短路求值
+	case "&&", "||":
+		return g.genLogicalExpr(expr)
+	}
+
+	var left, right value.Value
+	if _, ok := expr.Left.Node.(*ast.NullLiteral); ok {
+		right = g.genExpr(expr.Right)
+		left = g.null(right.Type())
+	} else {
+		left = g.genExpr(expr.Left)
+		right = g.genStringOperand(expr.Right, left, operator)
+	}
+	return g.binaryOp(operator, left, right, expr.Operator.Position)
+}
+
+func (g *Generator) genLogicalExpr(expr *ast.BinaryExpr) value.Value {
+	isOr := expr.Operator.Value == "||"
+	left := g.genCondition(expr.Left)
+	leftBlock := g.fn.block
+	rightBlock := g.fn.fn.NewBlock("")
+	end := g.fn.fn.NewBlock("")
+	if isOr {
+		leftBlock.NewCondBr(left, end, rightBlock)
+	} else {
+		leftBlock.NewCondBr(left, rightBlock, end)
+	}
+
+	g.fn.block = rightBlock
+	right := g.genCondition(expr.Right)
+	rightBlock = g.fn.block
+	rightBlock.NewBr(end)
+
+	moveBlockToEnd(g.fn.fn, end)
+	g.fn.block = end
+	return end.NewPhi(ir.NewIncoming(constant.NewBool(isOr), leftBlock), ir.NewIncoming(right, rightBlock))
+}
+
+// 二元运算：算术及位运算的结果为 number（位运算先转为 64 位整数），
+// byte、char 之间的比较使用无符号整数比较
+func (g *Generator) binaryOp(operator string, left value.Value, right value.Value, pos ast.Position) value.Value {
+	block := g.fn.block
+	_, isCompare := intPreds[operator]
+	if isNumeric(left.Type()) && isNumeric(right.Type()) && (!isCompare || !left.Type().Equal(right.Type())) {
+		left, right = g.toDouble(left), g.toDouble(right)
+	}
+
+	switch {
+	case left.Type().Equal(types.Double):
+		if pred, ok := floatPreds[operator]; ok {
+			return block.NewFCmp(pred, left, right)
+		}
+		switch operator {
+		case "+":
+			return block.NewFAdd(left, right)
+		case "-":
+			return block.NewFSub(left, right)
+		case "*":
+			return block.NewFMul(left, right)
+		case "/":
+			return block.NewFDiv(left, right)
+		case "%":
+			return block.NewFRem(left, right)
+		}
+		a, b := block.NewFPToSI(left, types.I64), block.NewFPToSI(right, types.I64)
+		return block.NewSIToFP(g.bitOp(operator, a, b, pos), types.Double)
+
+	case left.Type().Equal(types.I8Ptr):
+		if !right.Type().Equal(types.I8Ptr) {
+			g.failAt(pos, "invalid operation: "+operator)
+		}
+		if operator == "+" {
+			return g.callRuntime("noah_string_concat", left, right)
+		}
+		pred, ok := intPreds[operator]
+		if !ok {
+			g.failAt(pos, "invalid operation: "+operator)
+		}
+		result := g.callRuntime("noah_string_compare", left, right)
+		return block.NewICmp(signedPreds[pred], result, constant.NewInt(types.I32, 0))
+
+	case isPointer(left.Type()):
+		if operator != "==" && operator != "!=" {
+			g.failAt(pos, "invalid operation: "+operator)
+		}
+		if g.layoutOf(right.Type()) != nil && !left.Type().Equal(right.Type()) && g.canConvert(left.Type(), right.Type()) {
+			left = g.convert(left, right.Type())
+		} else {
+			right = g.convert(right, left.Type())
+		}
+		return block.NewICmp(intPreds[operator], left, right)
+	}
+
+	if !isCompare {
+		g.failAt(pos, "invalid operation: "+operator)
+	}
+	return block.NewICmp(intPreds[operator], left, right)
+}
+
+// 字符串与其他值相加时，先将其格式化为字符串
+func (g *Generator) genStringOperand(expr *ast.Expr, left value.Value, operator string) value.Value {
+	right := g.genOperand(expr, left.Type())
+	if !left.Type().Equal(types.I8Ptr) || operator != "+" {
+		return right
+	}
+	return g.toString(right, g.info.Types[expr], expr.Position)
+}
+
+// 与虚拟机的格式化方式一致：byte 输出为数值，char 输出为字符，枚举输出为 `Kind.Choice`
+func (g *Generator) toString(v value.Value, kind *compiler.KindRef, pos ast.Position) value.Value {
+	typ := v.Type()
+	switch {
+	case typ.Equal(types.I8Ptr):
+		return v
+	case typ.Equal(types.Double), typ.Equal(types.I8):
+		return g.callRuntime("noah_number_to_string", g.toDouble(v))
+	case typ.Equal(types.I1):
+		return g.callRuntime("noah_bool_to_string", g.fn.block.NewZExt(v, types.I32))
+	case typ.Equal(types.I32):
+		if kind != nil && kind.Kind() != nil {
+			if t, ok := compiler.Underlying(kind).Kind().(*compiler.TEnum); ok {
+				names := g.enumNames(kind, t)
+				count := constant.NewInt(types.I32, int64(len(t.Choices)))
+				return g.callRuntime("noah_enum_to_string", names, count, v)
+			}
+		}
+		return g.callRuntime("noah_char_to_string", v)
+	}
+	g.unsupported(pos, "string conversions of "+typ.String()+" values")
+	return nil
+}
+
+// 枚举所有选项的名称（`Kind.Choice`），按选项索引排列
+func (g *Generator) enumNames(kind *compiler.KindRef, t *compiler.TEnum) constant.Constant {
+	if names, has := g.enums[t]; has {
+		return names
+	}
+
+	prefix := ""
+	if decl := g.compiler.KindDecl(kind); decl != nil {
+		prefix = decl.Name() + "."
+	}
+	elems := make([]constant.Constant, len(t.Choices))
+	for name, index := range t.Choices {
+		elems[index] = g.stringConst(prefix + name)
+	}
+	data := constant.NewArray(types.NewArray(uint64(len(elems)), types.I8Ptr), elems...)
+	global := g.module.NewGlobalDef(fmt.Sprintf(".enum.%d", len(g.enums)), data)
+	global.Immutable = true
+	global.Linkage = enum.LinkagePrivate
+	zero := constant.NewInt(types.I64, 0)
+	names := constant.NewGetElementPtr(data.Typ, global, zero, zero)
+	g.enums[t] = names
+	return names
+}
+
+// 64 位整数的位运算，`>>` 为算术右移
+func (g *Generator) bitOp(operator string, left value.Value, right value.Value, pos ast.Position) value.Value {
+	block := g.fn.block
+	switch operator {
+	case "&":
+		return block.NewAnd(left, right)
+	case "|":
+		return block.NewOr(left, right)
+	case "^":
+		return block.NewXor(left, right)
+	case "<<":
+		return block.NewShl(left, right)
+	case ">>":
+		return block.NewAShr(left, right)
+	}
+	g.failAt(pos, "invalid operation: "+operator)
+	return nil
+}
+
+func (g *Generator) genAssignExpr(expr *ast.BinaryExpr) value.Value {
+	operator := strings.TrimSuffix(expr.Operator.Value, "=")
+
+	if len(operator) == 0 {
+		_, result := g.genUpdate(expr.Left, false, func(_ value.Value, typ types.Type) value.Value {
+			return g.genExprType(expr.Right, typ)
+		})
+		return result
+	}
+
+	_, result := g.genUpdate(expr.Left, true, func(old value.Value, typ types.Type) value.Value {
+		right := g.genStringOperand(expr.Right, old, operator)
+		return g.cast(g.binaryOp(operator, old, right, expr.Operator.Position), typ)
+	})
+	return result
+}
+
+// 修改变量或字段，compound 为 true 时先读取原值，返回原值及新值
+func (g *Generator) genUpdate(target *ast.Expr, compound bool, compute func(old value.Value, typ types.Type) value.Value) (value.Value, value.Value) {
+	var ptr value.Value
+	if v := g.info.Uses[target]; v != nil {
+		varValue, ok := v.(*compiler.VarValue)
+		if !ok {
+			g.failAt(target.Position, "cannot assign to this expression")
+		}
+		ptr = g.varPtr(varValue)
+	} else if member, ok := target.Node.(*ast.MemberExpr); ok {
+		object := g.genExpr(member.Object)
+		if !member.Computed {
+			ptr = g.fieldPtr(object, member.Property.Node.(*ast.IdentifierLiteral).Name)
+		} else if g.arrayOf(object.Type()) != nil {
+			ptr = g.elemPtr(object, member.Property)
+		} else {
+			g.failAt(target.Position, "cannot assign to this expression")
+		}
+	} else {
+		g.failAt(target.Position, "cannot assign to this expression")
+	}
+
+	typ := elemType(ptr)
+	var old value.Value
+	if compound {
+		old = g.fn.block.NewLoad(typ, ptr)
+	}
+	result := compute(old, typ)
+	g.fn.block.NewStore(result, ptr)
+	return old, result
+}
+
+func (g *Generator) genBinaryTypeExpr(expr *ast.Expr) value.Value {
+	node := expr.Node.(*ast.BinaryTypeExpr)
+	if node.Operator.Value == "is" {
+		g.unsupported(node.Operator.Position, "`is` expressions")
+	}
+
+	kind := g.info.Types[expr]
+	if kind == nil {
+		g.failAt(node.Right.Position, "cannot resolve the target type")
+	}
+	typ := g.llvmType(kind)
+	if _, ok := node.Left.Node.(*ast.NullLiteral); ok {
+		return g.null(typ)
+	}
+
+	v := g.genExpr(node.Left)
+	g.pos = node.Operator.Position
+	if typ.Equal(types.I8Ptr) && v.Type().Equal(types.Double) {
+		return g.toString(v, g.info.Types[node.Left], node.Operator.Position)
+	}
+	return g.cast(v, typ)
+}
+
+func (g *Generator) genUnaryExpr(expr *ast.UnaryExpr) value.Value {
+	switch expr.Operator.Value {
+	// update : 后缀形式返回原值
+	case "++", "--":
+		operator := "+"
+		if expr.Operator.Value == "--" {
+			operator = "-"
+		}
+		old, result := g.genUpdate(expr.Argument, true, func(old value.Value, typ types.Type) value.Value {
+			if !isNumeric(typ) {
+				g.failAt(expr.Operator.Position, "invalid operation: "+expr.Operator.Value)
+			}
+			return g.cast(g.binaryOp(operator, old, g.one(typ), expr.Operator.Position), typ)
+		})
+		if expr.Prefix {
+			return result
+		}
+		return old
+	}
+
+	argument := g.genExpr(expr.Argument)
+	block := g.fn.block
+	typ := argument.Type()
+
+	switch expr.Operator.Value {
+	// number op
+	case "+":
+		if isNumeric(typ) {
+			return g.toDouble(argument)
+		}
+	case "-":
+		if typ.Equal(types.Double) {
+			return block.NewFNeg(argument)
+		}
+		if isNumeric(typ) {
+			return block.NewSub(constant.NewInt(typ.(*types.IntType), 0), argument)
+		}
+
+	// logic
+	case "!":
+		if typ.Equal(types.I1) {
+			return block.NewXor(argument, constant.NewBool(true))
+		}
+
+	// bit op
+	case "~":
+		if typ.Equal(types.Double) {
+			i := block.NewFPToSI(argument, types.I64)
+			return block.NewSIToFP(block.NewXor(i, constant.NewInt(types.I64, -1)), types.Double)
+		}
+		if isNumeric(typ) {
+			return block.NewXor(argument, constant.NewInt(typ.(*types.IntType), -1))
+		}
+	}
+
+	g.failAt(expr.Operator.Position, "invalid operation: "+expr.Operator.Value)
+	return nil
+}
+
+// 匿名函数生成为模块内的函数
+func (g *Generator) genFuncExpr(expr *ast.Expr) value.Value {
+	node := expr.Node.(*ast.FuncExpr)
+	t := compiler.Underlying(g.info.Types[expr]).Kind().(*compiler.TFunc)
+
+	g.anonymous++
+	fn := g.newFunc(fmt.Sprintf("%s.<anonymous>.%d", g.current.Id(), g.anonymous), node.FuncKind, t, nil)
+	saved := g.fn
+	g.defineFunc(fn, nil, node.FuncKind, node.Body)
+	g.fn = saved
+	return fn
+}
+
+// 结构体在堆上分配，未指定的字段使用默认值
+func (g *Generator) genStructExpr(expr *ast.Expr) value.Value {
+	node := expr.Node.(*ast.StructExpr)
+	kind := g.info.Types[expr]
+	if kind == nil {
+		g.fail("cannot infer the type of struct")
+	}
+	layout := g.structLayout(kind)
+
+	values := make(map[string]*ast.Expr, len(node.Properties))
+	for _, pair := range node.Properties {
+		values[pair.Key.Node.(*ast.IdentifierLiteral).Name.Name] = pair.Value
+	}
+
+	object := g.fn.block.NewBitCast(g.callRuntime("noah_alloc", sizeOf(layout.typ)), layout.ptr)
+	zero := constant.NewInt(types.I32, 0)
+	for i, field := range layout.fields {
+		var v value.Value
+		if item, has := values[field]; has {
+			v = g.genExprType(item, layout.typ.Fields[i])
+		} else {
+			v = g.zeroValue(layout.kinds[i])
+		}
+		ptr := g.fn.block.NewGetElementPtr(layout.typ, object, zero, constant.NewInt(types.I32, int64(i)))
+		g.fn.block.NewStore(v, ptr)
+	}
+	return object
+}
+
+// 数组由运行时分配，元素依次写入
+func (g *Generator) genArrayExpr(expr *ast.Expr) value.Value {
+	kind := g.info.Types[expr]
+	if kind == nil || kind.Kind() == nil {
+		g.fail("cannot infer the type of array")
+	}
+	t, ok := compiler.Underlying(kind).Kind().(*compiler.TArray)
+	if !ok {
+		g.fail("cannot infer the type of array")
+	}
+	// 定长数组不足的元素使用默认值填充
+	items := expr.Node.(*ast.ArrayExpr).Items
+	if t.Len > len(items) {
+		array := g.arrayType(t)
+		object := g.newArray(array, items, t.Len)
+		g.fillArray(array, object, t.Kind, len(items), t.Len)
+		return object
+	}
+	return g.newArray(g.arrayType(t), items, len(items))
+}
+
+// 创建长度为 length 的数组，前面的元素依次为 items 的值（其余元素的内存已清零）
+func (g *Generator) newArray(array *arrayType, items []*ast.Expr, length int) value.Value {
+	handle := g.callRuntime("noah_array_new", sizeOf(array.elem), constant.NewInt(types.I64, int64(length)))
+	data := g.fn.block.NewBitCast(g.callRuntime("noah_array_data", handle), types.NewPointer(array.elem))
+	for i, item := range items {
+		v := g.genExprType(item, array.elem)
+		ptr := g.fn.block.NewGetElementPtr(array.elem, data, constant.NewInt(types.I64, int64(i)))
+		g.fn.block.NewStore(v, ptr)
+	}
+	return g.fn.block.NewBitCast(handle, array.ptr)
+}
+
+/* conversions */
+
+// 隐式转换：子结构体的指针可以作为第一个父结构体的指针使用
+func (g *Generator) convert(v value.Value, typ types.Type) value.Value {
+	if v.Type().Equal(typ) {
+		return v
+	}
+	if !g.canConvert(v.Type(), typ) {
+		g.fail("cannot use %s as %s", v.Type(), typ)
+	}
+	return g.fn.block.NewBitCast(v, typ)
+}
+
+func (g *Generator) canConvert(from types.Type, to types.Type) bool {
+	fromLayout, toLayout := g.layoutOf(from), g.layoutOf(to)
+	return fromLayout != nil && toLayout != nil && isLayoutPrefix(fromLayout, toLayout)
+}
+
+// 显式转换（`as`）：数值类型之间互相转换，转为 byte、char 时由运行时检查数值的范围
+func (g *Generator) cast(v value.Value, typ types.Type) value.Value {
+	block := g.fn.block
+	from := v.Type()
+	switch {
+	case from.Equal(typ):
+		return v
+	case isNumeric(from) && typ.Equal(types.Double):
+		return g.toDouble(v)
+	case from.Equal(types.I8) && typ.Equal(types.I32):
+		return block.NewZExt(v, typ)
+	case isNumeric(from) && typ.Equal(types.I8):
+		return g.callRuntime("noah_cast_byte", g.toDouble(v))
+	case isNumeric(from) && typ.Equal(types.I32):
+		return g.callRuntime("noah_cast_char", g.toDouble(v))
+	case g.canConvert(from, typ):
+		return block.NewBitCast(v, typ)
+	}
+	g.fail("cannot cast %s to %s in the native backend", from, typ)
+	return nil
+}
+
+func (g *Generator) toDouble(v value.Value) value.Value {
+	if v.Type().Equal(types.Double) {
+		return v
+	}
+	return g.fn.block.NewUIToFP(v, types.Double)
+}
+
+// 类型的空值：结构体、函数为空指针，枚举为 -1
+func (g *Generator) null(typ types.Type) value.Value {
+	if isPointer(typ) && !typ.Equal(types.I8Ptr) {
+		return constant.NewNull(typ.(*types.PointerType))
+	}
+	if typ.Equal(types.I32) {
+		return constant.NewInt(types.I32, -1)
+	}
+	g.fail("cannot use null as %s", typ)
+	return nil
+}
+
+func (g *Generator) one(typ types.Type) value.Value {
+	if typ.Equal(types.Double) {
+		return constant.NewFloat(types.Double, 1)
+	}
+	return constant.NewInt(typ.(*types.IntType), 1)
+}
+
+// number、byte、char
+func isNumeric(typ types.Type) bool {
+	return typ.Equal(types.Double) || typ.Equal(types.I8) || typ.Equal(types.I32)
+}
+
+func isPointer(typ types.Type) bool {
+	_, ok := typ.(*types.PointerType)
+	return ok
+}
+
+func elemType(ptr value.Value) types.Type {
+	return ptr.Type().(*types.PointerType).ElemType
+}
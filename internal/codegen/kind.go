@@ -0,0 +1,312 @@
+package codegen
+
+import (
+	"fmt"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"sort"
+	"strings"
+)
+
+// 结构体的内存布局：第一个继承的结构体的字段作为前缀，其余字段按名称排序，
+// 因此子结构体的指针可以直接作为第一个父结构体的指针使用
+type structLayout struct {
+	kind   *compiler.KindRef
+	typ    *types.StructType
+	ptr    *types.PointerType
+	fields []string
+	kinds  []*compiler.KindRef
+	index  map[string]int
+}
+
+// 类型对应的 LLVM 类型：结构体、函数按引用传递，枚举值为选项索引（-1 表示 null）
+func (g *Generator) llvmType(kind *compiler.KindRef) types.Type {
+	if kind == nil || kind.Kind() == nil {
+		return types.Void
+	}
+
+	kind = compiler.Underlying(kind)
+	switch kind.Kind().(type) {
+	case *compiler.TNumber:
+		return types.Double
+	case *compiler.TBool:
+		return types.I1
+	case *compiler.TByte:
+		return types.I8
+	case *compiler.TChar:
+		return types.I32
+	case *compiler.TString:
+		return types.I8Ptr
+	case *compiler.TEnum:
+		return types.I32
+	case *compiler.TStruct:
+		return g.structLayout(kind).ptr
+	case *compiler.TFunc:
+		return types.NewPointer(g.funcType(kind.Kind().(*compiler.TFunc)))
+	case *compiler.TArray:
+		return g.arrayType(kind.Kind().(*compiler.TArray)).ptr
+	case *compiler.TAny:
+		g.unsupported(g.pos, "`any` values")
+	case *compiler.TInterface:
+		g.unsupported(g.pos, "interface values")
+	}
+	panic("Internal Err")
+}
+
+func (g *Generator) funcType(t *compiler.TFunc) *types.FuncType {
+	params := make([]types.Type, len(t.Arguments))
+	for i, arg := range t.Arguments {
+		params[i] = g.llvmType(arg)
+	}
+	return types.NewFunc(g.llvmType(t.Return), params...)
+}
+
+// 获取结构体的布局，首次使用时创建对应的 LLVM 结构体类型
+func (g *Generator) structLayout(kind *compiler.KindRef) *structLayout {
+	kind = compiler.Underlying(kind)
+	t := kind.Kind().(*compiler.TStruct)
+	if layout := g.structs[t]; layout != nil {
+		return layout
+	}
+
+	fields := compiler.StructFields(kind)
+	names := make([]string, 0, len(fields))
+	if len(t.Extends) > 0 {
+		names = append(names, g.structLayout(t.Extends[0]).fields...)
+	}
+	rest := make([]string, 0, len(fields))
+	for name := range fields {
+		if !contains(names, name) {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	if decl := g.compiler.KindDecl(kind); decl != nil {
+		return g.newStructLayout(kind, decl.Module().Id()+"."+decl.Name(), names, fields)
+	}
+
+	// 匿名结构体按字段及类型区分（结构相同的匿名结构体可以互相赋值）
+	signature := g.anonymousSignature(names, fields)
+	if layout := g.shapes[signature]; layout != nil {
+		g.structs[t] = layout
+		return layout
+	}
+	layout := g.newStructLayout(kind, fmt.Sprintf("struct.%d", len(g.shapes)), names, fields)
+	g.shapes[signature] = layout
+	return layout
+}
+
+func (g *Generator) newStructLayout(kind *compiler.KindRef, name string, names []string, fields map[string]*compiler.KindRef) *structLayout {
+	typ := types.NewStruct()
+	layout := &structLayout{
+		kind:   kind,
+		typ:    g.module.NewTypeDef(name, typ).(*types.StructType),
+		ptr:    types.NewPointer(typ),
+		fields: names,
+		kinds:  make([]*compiler.KindRef, len(names)),
+		index:  make(map[string]int, len(names)),
+	}
+	// 先登记布局再解析字段类型，字段可以引用结构体自身
+	g.structs[kind.Kind()] = layout
+	g.layouts[layout.ptr.String()] = layout
+
+	typ.Fields = make([]types.Type, len(names))
+	for i, field := range names {
+		layout.kinds[i] = fields[field]
+		layout.index[field] = i
+		typ.Fields[i] = g.llvmType(fields[field])
+	}
+	return layout
+}
+
+func (g *Generator) anonymousSignature(names []string, fields map[string]*compiler.KindRef) string {
+	builder := strings.Builder{}
+	builder.WriteString("struct{")
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(name + ":" + g.llvmType(fields[name]).String())
+	}
+	builder.WriteString("}")
+	return builder.String()
+}
+
+// 数组（包括定长数组）由运行时管理，每种元素类型对应一个不透明的类型，
+// 调用运行时函数时转为 i8*
+type arrayType struct {
+	ptr  *types.PointerType
+	elem types.Type
+}
+
+func (g *Generator) arrayType(t *compiler.TArray) *arrayType {
+	if t.Kind == nil {
+		g.unsupported(g.pos, "arrays of `any`")
+	}
+	return g.arrayTypeOf(g.llvmType(t.Kind))
+}
+
+// 元素为 elem 的数组类型
+func (g *Generator) arrayTypeOf(elem types.Type) *arrayType {
+	name := "[]" + elem.String()
+	if array := g.arrays[name]; array != nil {
+		return array
+	}
+
+	typ := types.NewStruct()
+	typ.Opaque = true
+	array := &arrayType{
+		ptr:  types.NewPointer(g.module.NewTypeDef(name, typ)),
+		elem: elem,
+	}
+	g.arrays[name] = array
+	g.arrays[array.ptr.String()] = array
+	return array
+}
+
+// 根据数组指针类型查找数组类型
+func (g *Generator) arrayOf(typ types.Type) *arrayType {
+	if _, ok := typ.(*types.PointerType); !ok {
+		return nil
+	}
+	return g.arrays[typ.String()]
+}
+
+// 根据结构体指针类型查找布局
+func (g *Generator) layoutOf(typ types.Type) *structLayout {
+	if _, ok := typ.(*types.PointerType); !ok {
+		return nil
+	}
+	return g.layouts[typ.String()]
+}
+
+// 判断结构体 from 的指针能否作为结构体 to 的指针使用（to 的字段是 from 的前缀）
+func isLayoutPrefix(from *structLayout, to *structLayout) bool {
+	if len(to.fields) > len(from.fields) {
+		return false
+	}
+	for i, field := range to.fields {
+		if from.fields[i] != field || !from.typ.Fields[i].Equal(to.typ.Fields[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 类型占用的字节数
+func sizeOf(typ types.Type) constant.Constant {
+	ptr := types.NewPointer(typ)
+	return constant.NewPtrToInt(constant.NewGetElementPtr(typ, constant.NewNull(ptr), constant.NewInt(types.I32, 1)), types.I64)
+}
+
+// 类型的默认值，枚举的默认值为 null
+func (g *Generator) zero(kind *compiler.KindRef) constant.Constant {
+	if _, ok := compiler.Underlying(kind).Kind().(*compiler.TEnum); ok {
+		return constant.NewInt(types.I32, -1)
+	}
+	return g.zeroOf(g.llvmType(kind))
+}
+
+// 变量、字段的默认值，定长数组创建为元素均为默认值的数组
+func (g *Generator) zeroValue(kind *compiler.KindRef) value.Value {
+	if t, ok := compiler.Underlying(kind).Kind().(*compiler.TArray); ok && t.Len >= 0 {
+		array := g.arrayType(t)
+		object := g.newArray(array, nil, t.Len)
+		g.fillArray(array, object, t.Kind, 0, t.Len)
+		return object
+	}
+	return g.zero(kind)
+}
+
+// 将数组下标为 [from, to) 的元素设为默认值，运行时分配的内存已清零，默认值为零值时不需要填充
+func (g *Generator) fillArray(array *arrayType, object value.Value, elem *compiler.KindRef, from int, to int) {
+	if from >= to || g.isZeroFilled(elem) {
+		return
+	}
+
+	data := g.fn.block.NewBitCast(g.callRuntime("noah_array_data", object), types.NewPointer(array.elem))
+	index := g.fn.entry.NewAlloca(types.I64)
+	g.fn.block.NewStore(constant.NewInt(types.I64, int64(from)), index)
+
+	test := g.fn.fn.NewBlock("")
+	body := g.fn.fn.NewBlock("")
+	end := g.fn.fn.NewBlock("")
+	g.fn.block.NewBr(test)
+
+	g.fn.block = test
+	i := g.fn.block.NewLoad(types.I64, index)
+	g.fn.block.NewCondBr(g.fn.block.NewICmp(enum.IPredSLT, i, constant.NewInt(types.I64, int64(to))), body, end)
+
+	g.fn.block = body
+	ptr := g.fn.block.NewGetElementPtr(array.elem, data, i)
+	g.fn.block.NewStore(g.zeroValue(elem), ptr)
+	g.fn.block.NewStore(g.fn.block.NewAdd(i, constant.NewInt(types.I64, 1)), index)
+	g.fn.block.NewBr(test)
+
+	moveBlockToEnd(g.fn.fn, end)
+	g.fn.block = end
+}
+
+// 判断类型的默认值是否为零值（内存清零即为默认值）
+func (g *Generator) isZeroFilled(kind *compiler.KindRef) bool {
+	if t, ok := compiler.Underlying(kind).Kind().(*compiler.TArray); ok && t.Len >= 0 {
+		return false
+	}
+	c := g.zero(kind)
+	switch c.(type) {
+	case *constant.Float:
+		return c.(*constant.Float).X.Sign() == 0
+	case *constant.Int:
+		return c.(*constant.Int).X.Sign() == 0
+	case *constant.Null:
+		return true
+	}
+	return false
+}
+
+func (g *Generator) zeroOf(typ types.Type) constant.Constant {
+	switch {
+	case typ.Equal(types.Double):
+		return constant.NewFloat(types.Double, 0)
+	case typ.Equal(types.I8Ptr):
+		return g.stringConst("")
+	}
+
+	switch typ.(type) {
+	case *types.IntType:
+		return constant.NewInt(typ.(*types.IntType), 0)
+	case *types.PointerType:
+		return constant.NewNull(typ.(*types.PointerType))
+	}
+	panic("Internal Err")
+}
+
+// 字符串常量，以 `\0` 结尾
+func (g *Generator) stringConst(s string) constant.Constant {
+	if c, has := g.strings[s]; has {
+		return c
+	}
+
+	data := constant.NewCharArrayFromString(s + "\x00")
+	global := g.module.NewGlobalDef(fmt.Sprintf(".str.%d", len(g.strings)), data)
+	global.Immutable = true
+	global.Linkage = enum.LinkagePrivate
+	zero := constant.NewInt(types.I64, 0)
+	c := constant.NewGetElementPtr(data.Typ, global, zero, zero)
+	g.strings[s] = c
+	return c
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package codegen
+
+import (
+	_ "embed"
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"os"
+)
+
+// RuntimeFile 本地运行时源文件的默认名称
+const RuntimeFile = "noah_runtime.c"
+
+// RuntimeSource 本地运行时的 C 源代码，生成的 IR 需要与其一起链接
+//
+//go:embed runtime/noah_runtime.c
+var RuntimeSource string
+
+// WriteRuntime 将本地运行时的源代码写入文件
+func WriteRuntime(filename string) error {
+	return os.WriteFile(filename, []byte(RuntimeSource), 0644)
+}
+
+// 运行时函数的签名，数组及其元素的位置均使用 i8*
+type runtimeFunc struct {
+	ret    types.Type
+	params []types.Type
+}
+
+var runtimeFuncs = map[string]runtimeFunc{
+	"noah_alloc":            {types.I8Ptr, []types.Type{types.I64}},
+	"noah_string_concat":    {types.I8Ptr, []types.Type{types.I8Ptr, types.I8Ptr}},
+	"noah_string_compare":   {types.I32, []types.Type{types.I8Ptr, types.I8Ptr}},
+	"noah_string_length":    {types.I64, []types.Type{types.I8Ptr}},
+	"noah_string_index":     {types.I32, []types.Type{types.I8Ptr, types.Double}},
+	"noah_string_slice":     {types.I8Ptr, []types.Type{types.I8Ptr, types.Double, types.Double}},
+	"noah_string_index_of":  {types.Double, []types.Type{types.I8Ptr, types.I32}},
+	"noah_string_to_upper":  {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_string_to_lower":  {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_string_trim":      {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_string_to_chars":  {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_string_split":     {types.I8Ptr, []types.Type{types.I8Ptr, types.I8Ptr}},
+	"noah_number_to_string": {types.I8Ptr, []types.Type{types.Double}},
+	"noah_bool_to_string":   {types.I8Ptr, []types.Type{types.I32}},
+	"noah_char_to_string":   {types.I8Ptr, []types.Type{types.I32}},
+	"noah_enum_to_string":   {types.I8Ptr, []types.Type{types.NewPointer(types.I8Ptr), types.I32, types.I32}},
+	"noah_cast_byte":        {types.I8, []types.Type{types.Double}},
+	"noah_cast_char":        {types.I32, []types.Type{types.Double}},
+	"noah_array_new":        {types.I8Ptr, []types.Type{types.I64, types.I64}},
+	"noah_array_length":     {types.I64, []types.Type{types.I8Ptr}},
+	"noah_array_data":       {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_array_at":         {types.I8Ptr, []types.Type{types.I8Ptr, types.Double}},
+	"noah_array_push":       {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_array_unshift":    {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_array_pop":        {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_array_shift":      {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_array_slice":      {types.I8Ptr, []types.Type{types.I8Ptr, types.Double, types.Double}},
+	"noah_array_clone":      {types.I8Ptr, []types.Type{types.I8Ptr}},
+	"noah_print":            {types.Void, []types.Type{types.I8Ptr}},
+	"noah_println":          {types.Void, []types.Type{types.I8Ptr}},
+	"noah_builtin_panic":    {types.Void, []types.Type{types.I8Ptr}},
+	"noah_assert_fail":      {types.Void, []types.Type{types.I8Ptr}},
+}
+
+// 调用运行时函数，首次调用时声明该函数
+func (g *Generator) callRuntime(name string, args ...value.Value) value.Value {
+	fn := g.runtime[name]
+	if fn == nil {
+		sig, has := runtimeFuncs[name]
+		if !has {
+			panic("Internal Err")
+		}
+		params := make([]*ir.Param, len(sig.params))
+		for i, param := range sig.params {
+			params[i] = ir.NewParam("", param)
+		}
+		fn = g.module.NewFunc(name, sig.ret, params...)
+		g.runtime[name] = fn
+	}
+
+	// 数组等指针参数统一转为 i8*
+	for i, arg := range args {
+		if isPointer(arg.Type()) && !arg.Type().Equal(fn.Sig.Params[i]) {
+			args[i] = g.fn.block.NewBitCast(arg, fn.Sig.Params[i])
+		}
+	}
+	return g.fn.block.NewCall(fn, args...)
+}
@@ -0,0 +1,440 @@
+// noah 本地运行时：由 LLVM 后端生成的代码调用，与生成的目标文件一起链接。
+// 字符串为以 `\0` 结尾的 UTF-8 字节序列，数组的元素连续存放，元素大小由调用方传入。
+// 运行时暂不回收内存。
+
+#include <ctype.h>
+#include <inttypes.h>
+#include <math.h>
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+    int64_t len;
+    int64_t cap;
+    int64_t size; // 元素大小
+    char *data;
+} noah_array;
+
+/* errors */
+
+// 输出运行时错误并退出进程
+void noah_panic(const char *format, ...) {
+    va_list args;
+    va_start(args, format);
+    fflush(stdout);
+    fputs("runtime error: ", stderr);
+    vfprintf(stderr, format, args);
+    fputc('\n', stderr);
+    va_end(args);
+    exit(1);
+}
+
+// 内置函数 panic
+void noah_builtin_panic(const char *message) {
+    noah_panic("panic: %s", message);
+}
+
+// 内置函数 assert 的条件不成立，message 为空字符串时不输出信息
+void noah_assert_fail(const char *message) {
+    if (*message == '\0') {
+        noah_panic("assertion failed");
+    }
+    noah_panic("assertion failed: %s", message);
+}
+
+/* memory */
+
+// 分配清零的内存
+void *noah_alloc(int64_t size) {
+    void *ptr = calloc(1, size > 0 ? (size_t) size : 1);
+    if (ptr == NULL) {
+        noah_panic("out of memory");
+    }
+    return ptr;
+}
+
+static char *noah_strdup(const char *s, size_t len) {
+    char *result = noah_alloc((int64_t) len + 1);
+    memcpy(result, s, len);
+    return result;
+}
+
+/* strings */
+
+char *noah_string_concat(const char *a, const char *b) {
+    size_t len_a = strlen(a), len_b = strlen(b);
+    char *result = noah_alloc((int64_t) (len_a + len_b + 1));
+    memcpy(result, a, len_a);
+    memcpy(result + len_a, b, len_b);
+    return result;
+}
+
+int32_t noah_string_compare(const char *a, const char *b) {
+    int result = strcmp(a, b);
+    return result < 0 ? -1 : result > 0;
+}
+
+// 解码一个 UTF-8 字符，返回字符占用的字节数
+static int noah_decode_rune(const unsigned char *s, uint32_t *rune) {
+    if (s[0] < 0x80) {
+        *rune = s[0];
+        return 1;
+    }
+    if ((s[0] & 0xe0) == 0xc0 && s[1]) {
+        *rune = ((uint32_t) (s[0] & 0x1f) << 6) | (s[1] & 0x3f);
+        return 2;
+    }
+    if ((s[0] & 0xf0) == 0xe0 && s[1] && s[2]) {
+        *rune = ((uint32_t) (s[0] & 0x0f) << 12) | ((uint32_t) (s[1] & 0x3f) << 6) | (s[2] & 0x3f);
+        return 3;
+    }
+    if ((s[0] & 0xf8) == 0xf0 && s[1] && s[2] && s[3]) {
+        *rune = ((uint32_t) (s[0] & 0x07) << 18) | ((uint32_t) (s[1] & 0x3f) << 12) |
+                ((uint32_t) (s[2] & 0x3f) << 6) | (s[3] & 0x3f);
+        return 4;
+    }
+    *rune = 0xfffd;
+    return 1;
+}
+
+// 字符串的长度（字符数）
+int64_t noah_string_length(const char *s) {
+    int64_t count = 0;
+    uint32_t rune;
+    while (*s) {
+        s += noah_decode_rune((const unsigned char *) s, &rune);
+        count++;
+    }
+    return count;
+}
+
+static char *noah_format_number(double value);
+
+// 校验索引，与虚拟机的错误信息保持一致
+static int64_t noah_check_index(double index, int64_t len) {
+    if (!(index >= 0 && index < (double) len)) {
+        char *text = noah_format_number(index);
+        noah_panic("index out of range [%s] with length %" PRId64, text, len);
+    }
+    return (int64_t) index;
+}
+
+uint32_t noah_string_index(const char *s, double index) {
+    int64_t target = noah_check_index(index, noah_string_length(s));
+    uint32_t rune = 0;
+    for (int64_t i = 0; i <= target; i++) {
+        s += noah_decode_rune((const unsigned char *) s, &rune);
+    }
+    return rune;
+}
+
+// 校验切片的范围 [start:end]，与虚拟机的错误信息保持一致
+static void noah_check_slice(double start, double end, int64_t len) {
+    if (start != (double) (int64_t) start || end != (double) (int64_t) end) {
+        noah_panic("invalid argument: %s", noah_format_number(start != (double) (int64_t) start ? start : end));
+    }
+    if (start < 0 || end < start || end > (double) len) {
+        noah_panic("slice bounds out of range [%" PRId64 ":%" PRId64 "] with length %" PRId64,
+                   (int64_t) start, (int64_t) end, len);
+    }
+}
+
+// 第 index 个字符的起始位置
+static const char *noah_rune_at(const char *s, int64_t index) {
+    uint32_t rune;
+    for (int64_t i = 0; i < index && *s; i++) {
+        s += noah_decode_rune((const unsigned char *) s, &rune);
+    }
+    return s;
+}
+
+char *noah_string_slice(const char *s, double start, double end) {
+    noah_check_slice(start, end, noah_string_length(s));
+    const char *from = noah_rune_at(s, (int64_t) start);
+    const char *to = noah_rune_at(from, (int64_t) (end - start));
+    return noah_strdup(from, (size_t) (to - from));
+}
+
+double noah_string_index_of(const char *s, uint32_t ch) {
+    uint32_t rune;
+    for (int64_t i = 0; *s; i++) {
+        s += noah_decode_rune((const unsigned char *) s, &rune);
+        if (rune == ch) {
+            return (double) i;
+        }
+    }
+    return -1;
+}
+
+// 大小写转换只处理 ASCII 字符
+char *noah_string_to_upper(const char *s) {
+    char *result = noah_strdup(s, strlen(s));
+    for (char *p = result; *p; p++) {
+        *p = (char) toupper((unsigned char) *p);
+    }
+    return result;
+}
+
+char *noah_string_to_lower(const char *s) {
+    char *result = noah_strdup(s, strlen(s));
+    for (char *p = result; *p; p++) {
+        *p = (char) tolower((unsigned char) *p);
+    }
+    return result;
+}
+
+char *noah_string_trim(const char *s) {
+    size_t len = strlen(s);
+    while (len > 0 && isspace((unsigned char) s[len - 1])) {
+        len--;
+    }
+    while (len > 0 && isspace((unsigned char) *s)) {
+        s++;
+        len--;
+    }
+    return noah_strdup(s, len);
+}
+
+/* formatting */
+
+// 与 Go 的 strconv.FormatFloat(value, 'f', -1, 64) 一致：使用能还原数值的最短表示
+static char *noah_format_number(double value) {
+    char buffer[512];
+    if (isnan(value)) {
+        return noah_strdup("NaN", 3);
+    }
+    if (isinf(value)) {
+        return value > 0 ? noah_strdup("+Inf", 4) : noah_strdup("-Inf", 4);
+    }
+    for (int precision = 1; precision <= 17; precision++) {
+        snprintf(buffer, sizeof(buffer), "%.*g", precision, value);
+        if (strtod(buffer, NULL) == value) {
+            break;
+        }
+    }
+    // 科学计数法转为小数形式
+    if (strchr(buffer, 'e') != NULL) {
+        double digits = strtod(buffer, NULL);
+        int decimals = 0;
+        while (decimals < 340) {
+            snprintf(buffer, sizeof(buffer), "%.*f", decimals, digits);
+            if (strtod(buffer, NULL) == value) {
+                break;
+            }
+            decimals++;
+        }
+    }
+    return noah_strdup(buffer, strlen(buffer));
+}
+
+char *noah_number_to_string(double value) {
+    return noah_format_number(value);
+}
+
+char *noah_bool_to_string(int32_t value) {
+    return value ? noah_strdup("true", 4) : noah_strdup("false", 5);
+}
+
+// 将字符编码为 UTF-8
+char *noah_char_to_string(uint32_t rune) {
+    char buffer[5] = {0};
+    if (rune < 0x80) {
+        buffer[0] = (char) rune;
+    } else if (rune < 0x800) {
+        buffer[0] = (char) (0xc0 | (rune >> 6));
+        buffer[1] = (char) (0x80 | (rune & 0x3f));
+    } else if (rune < 0x10000) {
+        buffer[0] = (char) (0xe0 | (rune >> 12));
+        buffer[1] = (char) (0x80 | ((rune >> 6) & 0x3f));
+        buffer[2] = (char) (0x80 | (rune & 0x3f));
+    } else {
+        buffer[0] = (char) (0xf0 | (rune >> 18));
+        buffer[1] = (char) (0x80 | ((rune >> 12) & 0x3f));
+        buffer[2] = (char) (0x80 | ((rune >> 6) & 0x3f));
+        buffer[3] = (char) (0x80 | (rune & 0x3f));
+    }
+    return noah_strdup(buffer, strlen(buffer));
+}
+
+// 枚举值格式化为 `Kind.Choice`，names 为所有选项的名称
+const char *noah_enum_to_string(const char **names, int32_t count, int32_t index) {
+    if (index < 0 || index >= count) {
+        return "null";
+    }
+    return names[index];
+}
+
+/* casts */
+
+// 转换为 byte、char 的数值必须是整数，与虚拟机的错误信息保持一致（不依赖 libm）
+static void noah_check_cast_integer(double value, const char *target) {
+    // 绝对值超过 1e18 的浮点数（包括无穷大）均为整数
+    int integer = !isnan(value) && (value > 1e18 || value < -1e18 || value == (double) (int64_t) value);
+    if (!integer) {
+        noah_panic("cannot cast %s to %s: not an integer", noah_format_number(value), target);
+    }
+}
+
+uint8_t noah_cast_byte(double value) {
+    noah_check_cast_integer(value, "byte");
+    if (value < 0 || value > 255) {
+        noah_panic("cannot cast %s to byte: out of range [0, 255]", noah_format_number(value));
+    }
+    return (uint8_t) value;
+}
+
+// 有效的 Unicode 码点，不包括代理区 [0xd800, 0xdfff]
+uint32_t noah_cast_char(double value) {
+    noah_check_cast_integer(value, "char");
+    if (value < 0 || value > 0x10ffff || (value >= 0xd800 && value <= 0xdfff)) {
+        noah_panic("cannot cast %s to char: invalid code point", noah_format_number(value));
+    }
+    return (uint32_t) value;
+}
+
+/* arrays */
+
+noah_array *noah_array_new(int64_t size, int64_t len) {
+    noah_array *array = noah_alloc(sizeof(noah_array));
+    array->len = len;
+    array->cap = len;
+    array->size = size;
+    array->data = noah_alloc(size * len);
+    return array;
+}
+
+static noah_array *noah_check_array(noah_array *array, const char *action) {
+    if (array == NULL) {
+        noah_panic("cannot %s null", action);
+    }
+    return array;
+}
+
+int64_t noah_array_length(noah_array *array) {
+    return noah_check_array(array, "get length of")->len;
+}
+
+// 元素的存储位置
+void *noah_array_data(noah_array *array) {
+    return array->data;
+}
+
+// 读写元素前调用，返回元素的位置（包含越界检查）
+void *noah_array_at(noah_array *array, double index) {
+    noah_check_array(array, "index");
+    return array->data + noah_check_index(index, array->len) * array->size;
+}
+
+static void noah_array_grow(noah_array *array) {
+    if (array->len < array->cap) {
+        return;
+    }
+    int64_t cap = array->cap < 4 ? 4 : array->cap * 2;
+    char *data = noah_alloc(cap * array->size);
+    memcpy(data, array->data, (size_t) (array->len * array->size));
+    array->data = data;
+    array->cap = cap;
+}
+
+// 在末尾添加一个元素，返回新元素的位置
+void *noah_array_push(noah_array *array) {
+    noah_check_array(array, "push to");
+    noah_array_grow(array);
+    return array->data + array->len++ * array->size;
+}
+
+// 在开头添加一个元素，返回新元素的位置
+void *noah_array_unshift(noah_array *array) {
+    noah_check_array(array, "unshift to");
+    noah_array_grow(array);
+    memmove(array->data + array->size, array->data, (size_t) (array->len * array->size));
+    array->len++;
+    return array->data;
+}
+
+// 移除最后一个元素，返回被移除元素的位置（下次修改数组前有效）
+void *noah_array_pop(noah_array *array) {
+    noah_check_array(array, "pop from");
+    if (array->len == 0) {
+        noah_panic("cannot pop from an empty array");
+    }
+    array->len--;
+    return array->data + array->len * array->size;
+}
+
+// 移除第一个元素，返回被移除元素的副本
+void *noah_array_shift(noah_array *array) {
+    noah_check_array(array, "shift from");
+    if (array->len == 0) {
+        noah_panic("cannot shift from an empty array");
+    }
+    void *item = noah_alloc(array->size);
+    memcpy(item, array->data, (size_t) array->size);
+    array->len--;
+    memmove(array->data, array->data + array->size, (size_t) (array->len * array->size));
+    return item;
+}
+
+noah_array *noah_array_slice(noah_array *array, double start, double end) {
+    noah_check_array(array, "slice");
+    noah_check_slice(start, end, array->len);
+    int64_t len = (int64_t) end - (int64_t) start;
+    noah_array *result = noah_array_new(array->size, len);
+    memcpy(result->data, array->data + (int64_t) start * array->size, (size_t) (len * array->size));
+    return result;
+}
+
+noah_array *noah_array_clone(noah_array *array) {
+    noah_check_array(array, "clone");
+    return noah_array_slice(array, 0, (double) array->len);
+}
+
+/* strings & arrays */
+
+// 将字符串拆分为字符数组
+noah_array *noah_string_to_chars(const char *s) {
+    noah_array *array = noah_array_new(sizeof(uint32_t), noah_string_length(s));
+    uint32_t *data = (uint32_t *) array->data;
+    for (int64_t i = 0; *s; i++) {
+        s += noah_decode_rune((const unsigned char *) s, &data[i]);
+    }
+    return array;
+}
+
+// 与 Go 的 strings.Split 一致：分隔符为空时拆分为单个字符
+noah_array *noah_string_split(const char *s, const char *sep) {
+    noah_array *array = noah_array_new(sizeof(char *), 0);
+    size_t sep_len = strlen(sep);
+    uint32_t rune;
+    if (sep_len == 0) {
+        while (*s) {
+            int n = noah_decode_rune((const unsigned char *) s, &rune);
+            *(char **) noah_array_push(array) = noah_strdup(s, (size_t) n);
+            s += n;
+        }
+        return array;
+    }
+    for (;;) {
+        const char *found = strstr(s, sep);
+        if (found == NULL) {
+            *(char **) noah_array_push(array) = noah_strdup(s, strlen(s));
+            return array;
+        }
+        *(char **) noah_array_push(array) = noah_strdup(s, (size_t) (found - s));
+        s = found + sep_len;
+    }
+}
+
+/* output */
+
+void noah_print(const char *s) {
+    fputs(s, stdout);
+}
+
+void noah_println(const char *s) {
+    fputs(s, stdout);
+    fputc('\n', stdout);
+}
@@ -0,0 +1,245 @@
+package codegen
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+)
+
+func (g *Generator) genStmt(stmt *ast.Stmt) {
+	saved := g.pos
+	g.pos = stmt.Position
+	defer func() { g.pos = saved }()
+
+	switch stmt.Node.(type) {
+	case *ast.VarDecl:
+		g.genVarDecl(stmt.Node.(*ast.VarDecl))
+	case *ast.BlockStmt:
+		g.genBlockStmt(stmt.Node.(*ast.BlockStmt))
+	case *ast.ReturnStmt:
+		g.genReturnStmt(stmt.Node.(*ast.ReturnStmt))
+	case *ast.ExprStmt:
+		g.genExpr(stmt.Node.(*ast.ExprStmt).Expression)
+	case *ast.IfStmt:
+		g.genIfStmt(stmt.Node.(*ast.IfStmt))
+	case *ast.ForStmt:
+		g.genForStmt(stmt.Node.(*ast.ForStmt))
+	case *ast.BreakStmt:
+		loop := g.findLoop(stmt.Node.(*ast.BreakStmt).Label)
+		g.fn.block.NewBr(loop.breakTo)
+		g.startBlock()
+	case *ast.ContinueStmt:
+		loop := g.findLoop(stmt.Node.(*ast.ContinueStmt).Label)
+		g.fn.block.NewBr(loop.continueTo)
+		g.startBlock()
+	case *ast.TTypeDecl, *ast.TInterfaceDecl, *ast.TStructDecl, *ast.TEnumDecl:
+	default:
+		g.fail("unexpected statement")
+	}
+}
+
+// 全局变量保存在模块的全局变量中，局部变量在函数入口块分配
+func (g *Generator) genVarDecl(node *ast.VarDecl) {
+	v := g.info.Defs[node.Id].(*compiler.VarValue)
+
+	var ptr value.Value
+	typ := g.llvmType(v.Kind)
+	if v.Global {
+		ptr = g.globals[v]
+	} else {
+		ptr = g.fn.entry.NewAlloca(typ)
+		g.fn.locals[v] = ptr
+	}
+
+	var init value.Value
+	if node.Init != nil {
+		init = g.genExprType(node.Init, typ)
+	} else {
+		init = g.zeroValue(v.Kind)
+	}
+	g.fn.block.NewStore(init, ptr)
+}
+
+func (g *Generator) genBlockStmt(node *ast.BlockStmt) {
+	for _, stmt := range node.Body {
+		g.genStmt(stmt)
+	}
+}
+
+func (g *Generator) genReturnStmt(node *ast.ReturnStmt) {
+	ret := g.fn.fn.Sig.RetType
+	switch {
+	case ret.Equal(types.Void):
+		if node.Argument != nil {
+			g.genExpr(node.Argument)
+		}
+		g.fn.block.NewRet(nil)
+	case node.Argument == nil:
+		g.fn.block.NewRet(g.zeroOf(ret))
+	default:
+		g.fn.block.NewRet(g.genExprType(node.Argument, ret))
+	}
+	g.startBlock()
+}
+
+func (g *Generator) genIfStmt(node *ast.IfStmt) {
+	cond := g.genCondition(node.Condition)
+	then := g.fn.fn.NewBlock("")
+	end := g.fn.fn.NewBlock("")
+	alternate := end
+	if node.Alternate != nil {
+		alternate = g.fn.fn.NewBlock("")
+	}
+	g.fn.block.NewCondBr(cond, then, alternate)
+
+	g.fn.block = then
+	g.genStmt(node.Consequent)
+	g.branch(end)
+
+	if node.Alternate != nil {
+		g.fn.block = alternate
+		g.genStmt(node.Alternate)
+		g.branch(end)
+	}
+
+	moveBlockToEnd(g.fn.fn, end)
+	g.fn.block = end
+}
+
+// 生成 for 循环：条件块 -> 循环体 -> 更新块（continue 的目标） -> 条件块
+func (g *Generator) genForStmt(node *ast.ForStmt) {
+	if node.EachVisitor != nil {
+		g.genEachLoop(node)
+		return
+	}
+
+	if node.Init != nil {
+		g.genStmt(node.Init)
+	}
+
+	test := g.fn.fn.NewBlock("")
+	body := g.fn.fn.NewBlock("")
+	update := g.fn.fn.NewBlock("")
+	end := g.fn.fn.NewBlock("")
+	g.branch(test)
+
+	g.fn.block = test
+	if node.Test != nil {
+		g.fn.block.NewCondBr(g.genCondition(node.Test), body, end)
+	} else {
+		g.fn.block.NewBr(body)
+	}
+
+	g.fn.block = body
+	g.genLoopBody(node, update, end)
+
+	g.fn.block = update
+	if node.Update != nil {
+		g.genExpr(node.Update)
+	}
+	g.fn.block.NewBr(test)
+
+	moveBlockToEnd(g.fn.fn, end)
+	g.fn.block = end
+}
+
+// 遍历数组：每次循环重新读取数组长度，与虚拟机一致
+func (g *Generator) genEachLoop(node *ast.ForStmt) {
+	visitor := node.EachVisitor
+	target := g.genExpr(visitor.Target)
+	array := g.arrayOf(target.Type())
+	if array == nil {
+		g.unsupported(visitor.Target.Position, "for-each loops over non-array values")
+	}
+
+	index := g.fn.entry.NewAlloca(types.I64)
+	g.fn.block.NewStore(constant.NewInt(types.I64, 0), index)
+
+	test := g.fn.fn.NewBlock("")
+	body := g.fn.fn.NewBlock("")
+	update := g.fn.fn.NewBlock("")
+	end := g.fn.fn.NewBlock("")
+	g.branch(test)
+
+	g.fn.block = test
+	i := g.fn.block.NewLoad(types.I64, index)
+	length := g.callRuntime("noah_array_length", target)
+	g.fn.block.NewCondBr(g.fn.block.NewICmp(enum.IPredSLT, i, length), body, end)
+
+	g.fn.block = body
+	key := g.fn.block.NewSIToFP(i, types.Double)
+	ptr := g.fn.block.NewBitCast(g.callRuntime("noah_array_at", target, key), types.NewPointer(array.elem))
+	g.defineLocal(visitor.Value, g.fn.block.NewLoad(array.elem, ptr))
+	if visitor.Key != nil {
+		g.defineLocal(visitor.Key, key)
+	}
+	g.genLoopBody(node, update, end)
+
+	g.fn.block = update
+	next := g.fn.block.NewAdd(g.fn.block.NewLoad(types.I64, index), constant.NewInt(types.I64, 1))
+	g.fn.block.NewStore(next, index)
+	g.fn.block.NewBr(test)
+
+	moveBlockToEnd(g.fn.fn, end)
+	g.fn.block = end
+}
+
+// 生成循环体，continue 跳转到 update，break 跳转到 end
+func (g *Generator) genLoopBody(node *ast.ForStmt, update *ir.Block, end *ir.Block) {
+	label := ""
+	if node.Label != nil {
+		label = node.Label.Name
+	}
+	g.fn.loops = append(g.fn.loops, &loopState{label: label, breakTo: end, continueTo: update})
+	g.genStmt(node.Body)
+	g.branch(update)
+	g.fn.loops = g.fn.loops[:len(g.fn.loops)-1]
+	moveBlockToEnd(g.fn.fn, update)
+}
+
+// 定义循环变量等编译器生成的局部变量
+func (g *Generator) defineLocal(id *ast.Identifier, init value.Value) {
+	v := g.info.Defs[id].(*compiler.VarValue)
+	ptr := g.fn.entry.NewAlloca(init.Type())
+	g.fn.locals[v] = ptr
+	g.fn.block.NewStore(init, ptr)
+}
+
+// 查找 break、continue 对应的循环，未指定标签时为最内层的循环
+func (g *Generator) findLoop(label *ast.Identifier) *loopState {
+	loops := g.fn.loops
+	for i := len(loops) - 1; i >= 0; i-- {
+		if label == nil || loops[i].label == label.Name {
+			return loops[i]
+		}
+	}
+	g.fail("no loop found")
+	return nil
+}
+
+// 当前块未结束时跳转到目标块
+func (g *Generator) branch(target *ir.Block) {
+	if g.fn.block.Term == nil {
+		g.fn.block.NewBr(target)
+	}
+}
+
+// 开始一个新的块（如 return 之后的不可达代码）
+func (g *Generator) startBlock() {
+	g.fn.block = g.fn.fn.NewBlock("")
+}
+
+// 将块移动到函数的最后，使生成的块按执行顺序排列
+func moveBlockToEnd(fn *ir.Func, block *ir.Block) {
+	blocks := fn.Blocks[:0]
+	for _, item := range fn.Blocks {
+		if item != block {
+			blocks = append(blocks, item)
+		}
+	}
+	fn.Blocks = append(blocks, block)
+}
@@ -0,0 +1,116 @@
+package compiler
+
+// 内置方法的签名（见 design/implicit-interface.md），类型使用名称表示：
+// `T` 为数组的元素类型（字符串为 char），`[]T` 为元素类型相同的可变长数组，
+// `self` 为接收者的类型，空字符串表示没有返回值
+type builtinSig struct {
+	args    []string
+	ret     string
+	hasRest bool
+}
+
+// number、byte、char、bool
+var scalarMethods = map[string]builtinSig{
+	"toStr": {ret: "string"},
+	"clone": {ret: "self"},
+}
+
+var stringMethods = map[string]builtinSig{
+	"toStr":       {ret: "string"},
+	"len":         {ret: "number"},
+	"clone":       {ret: "string"},
+	"split":       {args: []string{"string"}, ret: "[]string"},
+	"toChars":     {ret: "[]T"},
+	"toUpperCase": {ret: "string"},
+	"toLowerCase": {ret: "string"},
+	"trim":        {ret: "string"},
+	"indexOf":     {args: []string{"char"}, ret: "number"},
+	"slice":       {args: []string{"number", "number"}, ret: "string"},
+}
+
+// 定长数组及可变长数组
+var arrayMethods = map[string]builtinSig{
+	"toStr": {ret: "string"},
+	"len":   {ret: "number"},
+	"clone": {ret: "[]T"},
+}
+
+// 仅可变长数组
+var vectorMethods = map[string]builtinSig{
+	"push":    {args: []string{"[]T"}, hasRest: true},
+	"pop":     {ret: "T"},
+	"unshift": {args: []string{"[]T"}, hasRest: true},
+	"shift":   {ret: "T"},
+	"splice":  {args: []string{"number", "number", "[]T"}, ret: "[]T", hasRest: true},
+	"slice":   {args: []string{"number", "number"}, ret: "[]T"},
+}
+
+// 查找类型的内置方法，返回方法的类型
+func (m *Module) findBuiltinMethod(kind *KindRef, name string) *KindRef {
+	underlying := getUnderlyingKind(kind)
+	var sig builtinSig
+	var has bool
+	elem := newKindRef(m, -1)
+
+	switch underlying.current.(type) {
+	case *TNumber, *TByte, *TChar, *TBool:
+		sig, has = scalarMethods[name]
+	case *TString:
+		sig, has = stringMethods[name]
+		elem.current = typeChar
+	case *TArray:
+		t := underlying.current.(*TArray)
+		if sig, has = arrayMethods[name]; !has && t.Len < 0 {
+			sig, has = vectorMethods[name]
+		}
+		if t.Kind != nil {
+			elem = t.Kind
+		} else {
+			elem.current = typeAny
+		}
+	}
+	if !has {
+		return nil
+	}
+
+	resolve := func(name string) *KindRef {
+		if len(name) == 0 {
+			return nil
+		}
+		ref := newKindRef(m, -1)
+		switch name {
+		case "self":
+			return kind
+		case "T":
+			return elem
+		case "[]T":
+			ref.current = &TArray{Kind: elem, Len: -1, Impl: newImpl()}
+		case "[]string":
+			str := newKindRef(m, -1)
+			str.current = typeString
+			ref.current = &TArray{Kind: str, Len: -1, Impl: newImpl()}
+		case "number":
+			ref.current = typeNumber
+		case "char":
+			ref.current = typeChar
+		case "string":
+			ref.current = typeString
+		default:
+			panic("Internal Err")
+		}
+		return ref
+	}
+
+	t := &TFunc{
+		Arguments: make([]*KindRef, len(sig.args)),
+		Return:    resolve(sig.ret),
+		HasRest:   sig.hasRest,
+		Impl:      newImpl(),
+	}
+	for i, arg := range sig.args {
+		t.Arguments[i] = resolve(arg)
+	}
+	ref := newKindRef(m, -1)
+	ref.current = t
+	return ref
+}
@@ -1,131 +1,678 @@
 package compiler
 
 import (
+	"fmt"
 	"github.com/peakchen90/noah-lang/internal/ast"
 	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"sort"
+	"strings"
 )
 
-func (m *Module) compileExpr(expr *ast.Expr) *bytecode.NValue {
+// 二元运算符对应的指令
+var binaryOps = map[string]bytecode.OpCode{
+	"+":  bytecode.OpAdd,
+	"-":  bytecode.OpSub,
+	"*":  bytecode.OpMul,
+	"/":  bytecode.OpDiv,
+	"%":  bytecode.OpRem,
+	"|":  bytecode.OpBitOr,
+	"^":  bytecode.OpBitXor,
+	"&":  bytecode.OpBitAnd,
+	"<<": bytecode.OpShl,
+	">>": bytecode.OpShr,
+	"==": bytecode.OpEq,
+	"!=": bytecode.OpNe,
+	"<":  bytecode.OpLt,
+	"<=": bytecode.OpLe,
+	">":  bytecode.OpGt,
+	">=": bytecode.OpGe,
+}
+
+func (m *Module) compileExpr(expr *ast.Expr) {
+	m.mark(expr.Position)
+	m.recordInferredType(expr)
+
 	switch (expr.Node).(type) {
 	case *ast.CallExpr:
-		return m.compileCallExpr(expr.Node.(*ast.CallExpr))
+		m.compileCallExpr(expr.Node.(*ast.CallExpr))
 	case *ast.MemberExpr:
-		return m.compileMemberExpr(expr.Node.(*ast.MemberExpr))
+		m.compileMemberExpr(expr)
 	case *ast.BinaryExpr:
-		return m.compileBinaryExpr(expr.Node.(*ast.BinaryExpr))
+		m.compileBinaryExpr(expr.Node.(*ast.BinaryExpr))
 	case *ast.BinaryTypeExpr:
-		return m.compileBinaryTypeExpr(expr.Node.(*ast.BinaryTypeExpr))
+		m.compileBinaryTypeExpr(expr.Node.(*ast.BinaryTypeExpr))
 	case *ast.UnaryExpr:
-		return m.compileUnaryExpr(expr.Node.(*ast.UnaryExpr))
+		m.compileUnaryExpr(expr.Node.(*ast.UnaryExpr))
 	case *ast.FuncExpr:
-		return m.compileFuncExpr(expr.Node.(*ast.FuncExpr))
+		m.compileFuncExpr(expr.Node.(*ast.FuncExpr))
 	case *ast.StructExpr:
-		return m.compileStructExpr(expr.Node.(*ast.StructExpr))
+		m.compileStructExpr(expr.Node.(*ast.StructExpr), nil)
 	case *ast.ArrayExpr:
-		return m.compileArrayExpr(expr.Node.(*ast.ArrayExpr))
+		m.compileArrayExpr(expr.Node.(*ast.ArrayExpr), nil)
 	case *ast.IdentifierLiteral:
-		return m.compileIdentifierLiteral(expr.Node.(*ast.IdentifierLiteral))
+		m.compileIdentifierLiteral(expr)
 	case *ast.NumberLiteral:
-		return m.compileNumberLiteral(expr.Node.(*ast.NumberLiteral))
+		m.compileNumberLiteral(expr.Node.(*ast.NumberLiteral))
 	case *ast.BoolLiteral:
-		return m.compileBoolLiteral(expr.Node.(*ast.BoolLiteral))
+		m.compileBoolLiteral(expr.Node.(*ast.BoolLiteral))
 	case *ast.NullLiteral:
-		return m.compileNullLiteral(expr.Node.(*ast.NullLiteral))
+		m.compileNullLiteral(expr.Node.(*ast.NullLiteral))
 	case *ast.StringLiteral:
-		return m.compileStringLiteral(expr.Node.(*ast.StringLiteral))
+		m.compileStringLiteral(expr.Node.(*ast.StringLiteral))
 	case *ast.CharLiteral:
-		return m.compileCharLiteral(expr.Node.(*ast.CharLiteral))
+		m.compileCharLiteral(expr.Node.(*ast.CharLiteral))
+	case *ast.BadExpr:
+		m.unexpectedAt(expr.Position, "invalid expression")
 	default:
 		panic("Internal Err")
 	}
 }
 
-func (m *Module) compileCallExpr(expr *ast.CallExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+// 编译表达式，结构体、数组字面量会使用期望的类型（如变量声明的类型）
+func (m *Module) compileExprExpected(expr *ast.Expr, expected *KindRef) {
+	switch expr.Node.(type) {
+	case *ast.StructExpr:
+		m.mark(expr.Position)
+		if kind := m.compileStructExpr(expr.Node.(*ast.StructExpr), expected); kind != nil {
+			m.recordType(expr, kind)
+		} else {
+			m.recordInferredType(expr)
+		}
+	case *ast.ArrayExpr:
+		m.mark(expr.Position)
+		m.compileArrayExpr(expr.Node.(*ast.ArrayExpr), expected)
+		if expected != nil {
+			if _, ok := resolveSelfKind(expected).current.(*TArray); ok {
+				m.recordType(expr, expected)
+				return
+			}
+		}
+		m.recordInferredType(expr)
+	case *ast.NullLiteral:
+		m.compileExpr(expr)
+		m.recordType(expr, expected)
+	default:
+		m.compileExpr(expr)
+	}
 }
 
-func (m *Module) compileMemberExpr(expr *ast.MemberExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileCallExpr(expr *ast.CallExpr) {
+	callee := expr.Callee
+	if len(expr.Params) > bytecode.MaxU8 {
+		m.unexpectedAt(callee.Position, fmt.Sprintf("too many arguments in call: %d (max %d)", len(expr.Params), bytecode.MaxU8))
+	}
+
+	// 参数的期望类型
+	argKinds := m.checkCallArity(expr)
+	compileParams := func() {
+		for i, param := range expr.Params {
+			if argKinds != nil {
+				m.compileValue(param, argKinds[i])
+			} else {
+				m.compileExpr(param)
+			}
+		}
+	}
+
+	// 方法调用：`object.method()`
+	member, ok := callee.Node.(*ast.MemberExpr)
+	if ok && !member.Computed {
+		object := m.scopes.findStaticMember(member.Object, false)
+		if object == nil || object.value != nil || object.choice >= 0 {
+			name := member.Property.Node.(*ast.IdentifierLiteral).Name
+			m.recordPropertyRef(member.Object, name)
+			m.compileExpr(member.Object)
+			compileParams()
+			m.mark(name.Position)
+			m.emit(bytecode.OpInvoke, m.addConstant(bytecode.StringConstant(name.Name)), len(expr.Params))
+			return
+		}
+	}
+
+	if id, ok := callee.Node.(*ast.IdentifierLiteral); ok {
+		if value, ok := m.scopes.findValue(id.Name, false).(*BuiltinValue); ok {
+			m.checkBuiltinCall(value, expr)
+		}
+	}
+	m.compileExpr(callee)
+	compileParams()
+	m.mark(callee.Position)
+	m.emit(bytecode.OpCall, len(expr.Params))
 }
 
-func (m *Module) compileBinaryExpr(expr *ast.BinaryExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+// 校验调用的参数个数，返回每个参数的期望类型（剩余参数为数组的元素类型），
+// 无法推断被调用者的类型时返回 nil
+func (m *Module) checkCallArity(expr *ast.CallExpr) []*KindRef {
+	kind := m.tryInferKind(expr.Callee)
+	if kind == nil || getUnderlyingKind(kind).current == typeAny {
+		return nil
+	}
+	t, ok := getUnderlyingKind(kind).current.(*TFunc)
+	if !ok {
+		m.unexpectedAt(expr.Callee.Position, "not a function")
+	}
+
+	count := len(t.Arguments)
+	if t.HasRest {
+		count--
+		if len(expr.Params) < count {
+			m.unexpectedAt(expr.Callee.Position, fmt.Sprintf("expect at least %d argument(s), but got %d", count, len(expr.Params)))
+		}
+	} else if len(expr.Params) != count {
+		pos := expr.Callee.Position
+		if len(expr.Params) > count {
+			pos = expr.Params[count].Position
+		}
+		m.unexpectedAt(pos, fmt.Sprintf("expect %d argument(s), but got %d", count, len(expr.Params)))
+	}
+
+	argKinds := make([]*KindRef, len(expr.Params))
+	for i := range expr.Params {
+		if i < count {
+			argKinds[i] = t.Arguments[i]
+		} else {
+			argKinds[i] = t.Arguments[count].current.(*TArray).Kind
+		}
+	}
+	return argKinds
 }
 
-func (m *Module) compileBinaryTypeExpr(expr *ast.BinaryTypeExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+// 编译用作期望类型的值（变量初始值、参数、返回值等）并校验类型，
+// 定长数组用作可变长数组时复制一份，避免修改原数组的长度
+func (m *Module) compileValue(expr *ast.Expr, expected *KindRef) {
+	m.compileExprExpected(expr, expected)
+	m.checkAssignable(expr, expected)
+	if m.isArrayCopy(expr, expected) {
+		m.compiler.Info.Copies[expr] = true
+		m.emit(bytecode.OpInvoke, m.addConstant(bytecode.StringConstant("clone")), 0)
+	}
 }
 
-func (m *Module) compileUnaryExpr(expr *ast.UnaryExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
+// 判断是否为定长数组转为可变长数组（数组字面量直接以期望类型创建，不需要复制）
+func (m *Module) isArrayCopy(expr *ast.Expr, expected *KindRef) bool {
+	switch expr.Node.(type) {
+	case *ast.ArrayExpr, *ast.NullLiteral:
+		return false
+	}
+	e, ok := getUnderlyingKind(expected).current.(*TArray)
+	if expected == nil || !ok || e.Len >= 0 {
+		return false
+	}
+	kind := m.tryInferKind(expr)
+	if kind == nil {
+		return false
+	}
+	r, ok := getUnderlyingKind(kind).current.(*TArray)
+	return ok && r.Len >= 0
+}
 
-	kind, _ := m.inferKind(expr.Argument)
+// 校验表达式的值能否用作期望的类型，无法推断表达式的类型时不校验
+func (m *Module) checkAssignable(expr *ast.Expr, expected *KindRef) {
+	if expected == nil || getUnderlyingKind(expected).current == typeAny {
+		return
+	}
+
+	switch expr.Node.(type) {
+	case *ast.NullLiteral:
+		if !isReferenceKind(expected) {
+			m.unexpectedAt(expr.Position, "cannot use null as "+m.kindString(expected))
+		}
+		return
+	case *ast.ArrayExpr:
+		// 数组字面量的元素逐个校验，定长数组的元素个数不能超过数组长度（不足的使用默认值填充）
+		if t, ok := getUnderlyingKind(expected).current.(*TArray); ok {
+			items := expr.Node.(*ast.ArrayExpr).Items
+			if t.Len >= 0 && len(items) > t.Len {
+				m.unexpectedAt(items[t.Len].Position, fmt.Sprintf("too many elements for %s: expect at most %d, but got %d", m.kindString(expected), t.Len, len(items)))
+			}
+			for _, item := range items {
+				m.checkAssignable(item, t.Kind)
+			}
+			return
+		}
+	case *ast.StructExpr:
+		// 没有指定类型的结构体字面量以期望类型编译，字段已在编译时校验
+		if expr.Node.(*ast.StructExpr).Ctor == nil {
+			if _, ok := getUnderlyingKind(expected).current.(*TStruct); ok {
+				return
+			}
+		}
+	}
+
+	kind := m.tryInferKind(expr)
+	if kind != nil && !assignableKind(expected, kind) {
+		m.unexpectedAt(expr.Position, fmt.Sprintf("cannot use %s as %s", m.kindString(kind), m.kindString(expected)))
+	}
+}
+
+func (m *Module) compileMemberExpr(expr *ast.Expr) {
+	member := m.scopes.findStaticMember(expr, true)
+	if member != nil {
+		m.recordUse(expr, member.value)
+		m.recordStaticRefs(expr)
+		m.emitStaticMember(member, expr.Position)
+		return
+	}
+
+	// 校验成员是否存在及能否访问
+	_, _ = m.inferMemberExprKind(expr)
+
+	node := expr.Node.(*ast.MemberExpr)
+	m.compileExpr(node.Object)
+	if node.Computed {
+		m.compileExpr(node.Property)
+		m.mark(node.Property.Position)
+		m.emit(bytecode.OpGetIndex)
+	} else {
+		name := node.Property.Node.(*ast.IdentifierLiteral).Name
+		m.recordPropertyRef(node.Object, name)
+		m.mark(name.Position)
+		m.emit(bytecode.OpGetField, m.addConstant(bytecode.StringConstant(name.Name)))
+	}
+}
+
+// 写入读取静态成员（变量、函数、枚举选项）的指令
+func (m *Module) emitStaticMember(member *staticMember, pos ast.Position) {
+	switch {
+	case member.value != nil:
+		m.emitLoadValue(member.value, pos)
+	case member.choice >= 0:
+		m.emit(bytecode.OpEnum, m.kindConstant(member.kind), member.choice)
+	default:
+		m.unexpectedAt(pos, "not a value: "+string(m.source[pos.Start:pos.End]))
+	}
+}
+
+func (m *Module) compileBinaryExpr(expr *ast.BinaryExpr) {
+	switch expr.Operator.Value {
+	// assign
+	case "=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "|=", "^=":
+		m.compileAssignExpr(expr)
+
+	// logic : 短路求值，右侧在左侧的值为 true（`&&`）或 false（`||`）时才执行，可以使用左侧收窄的类型
+	case "&&", "||":
+		// 校验操作数类型
+		_, _ = m.inferBinaryExprKind(expr)
+		m.compileExpr(expr.Left)
+		m.emit(bytecode.OpDup)
+		if expr.Operator.Value == "||" {
+			m.emit(bytecode.OpNot)
+		}
+		endJump := m.emitJump(bytecode.OpJumpIfFalse)
+		m.emit(bytecode.OpPop)
+		m.scopes.push()
+		for value, kind := range m.narrowings(expr.Left, expr.Operator.Value == "&&") {
+			m.scopes.narrow(value, kind)
+		}
+		m.compileExpr(expr.Right)
+		m.scopes.pop()
+		m.patchJump(endJump)
+
+	default:
+		// 校验操作数类型
+		_, _ = m.inferBinaryExprKind(expr)
+		m.compileExpr(expr.Left)
+		m.compileExpr(expr.Right)
+		m.mark(expr.Operator.Position)
+		m.emit(m.binaryOp(expr.Operator.Value, expr.Left))
+	}
+}
+
+// 二元运算对应的指令，字符串相加时为拼接
+func (m *Module) binaryOp(operator string, left *ast.Expr) bytecode.OpCode {
+	op, ok := binaryOps[operator]
+	if !ok {
+		panic("Internal Err")
+	}
+	if op == bytecode.OpAdd && m.isStringExpr(left) {
+		return bytecode.OpConcat
+	}
+	return op
+}
+
+func (m *Module) compileAssignExpr(expr *ast.BinaryExpr) {
+	operator := strings.TrimSuffix(expr.Operator.Value, "=")
+	m.clearNarrowed(expr.Left)
+
+	leftKind := m.tryInferKind(expr.Left)
+	if len(operator) == 0 {
+		m.compileUpdate(expr.Left, false, func() {
+			m.compileValue(expr.Right, leftKind)
+		})
+	} else {
+		m.compileUpdate(expr.Left, true, func() {
+			m.checkCompoundAssign(expr, leftKind)
+			m.compileExpr(expr.Right)
+			m.mark(expr.Operator.Position)
+			m.emit(m.binaryOp(operator, expr.Left))
+		})
+	}
+}
+
+// 校验复合赋值：字符串只能使用 +=，其余均要求两侧为数值
+func (m *Module) checkCompoundAssign(expr *ast.BinaryExpr, leftKind *KindRef) {
+	if leftKind == nil || getUnderlyingKind(leftKind).current == typeAny {
+		return
+	}
+	if expr.Operator.Value == "+=" && getUnderlyingKind(leftKind).current == typeString {
+		return
+	}
+	if !isNumericKind(leftKind) {
+		m.unexpectedAt(expr.Operator.Position, fmt.Sprintf("invalid operation: operator %s not defined on %s", expr.Operator.Value, m.kindString(leftKind)))
+	}
+	if rightKind := m.tryInferKind(expr.Right); rightKind != nil && !isNumericKind(rightKind) {
+		m.unexpectedAt(expr.Right.Position, fmt.Sprintf("cannot use %s as %s", m.kindString(rightKind), m.kindString(leftKind)))
+	}
+}
+
+// 编译对变量、字段或数组元素的修改，compound 为 true 时 compute 执行前栈顶为原值，
+// compute 执行后栈顶为新值
+func (m *Module) compileUpdate(target *ast.Expr, compound bool, compute func()) {
+	m.mark(target.Position)
+
+	switch target.Node.(type) {
+	case *ast.IdentifierLiteral, *ast.MemberExpr:
+		member := m.scopes.findStaticMember(target, true)
+		if member != nil {
+			switch member.value.(type) {
+			case nil:
+				m.unexpectedAt(target.Position, "cannot assign to this expression")
+			case *FuncValue:
+				m.unexpectedAt(target.Position, "cannot assign to function: "+member.value.(*FuncValue).Name)
+			case *BuiltinValue:
+				m.unexpectedAt(target.Position, "cannot assign to function: "+member.value.(*BuiltinValue).Name)
+			case *VarValue:
+				if member.value.isConst() {
+					m.unexpectedAt(target.Position, "cannot assign to constant: "+member.value.(*VarValue).Name)
+				}
+			}
+			m.recordUse(target, member.value)
+			m.recordStaticRefs(target)
+			m.recordInferredType(target)
+			if compound {
+				m.emitLoadValue(member.value, target.Position)
+			}
+			compute()
+			m.mark(target.Position)
+			m.emitStoreValue(member.value, target.Position)
+			return
+		}
+
+		node := target.Node.(*ast.MemberExpr)
+		if !node.Computed {
+			m.checkAssignField(node.Object, node.Property.Node.(*ast.IdentifierLiteral).Name)
+		}
+		m.recordInferredType(target)
+		m.compileExpr(node.Object)
+		if node.Computed {
+			// 字符串不可修改
+			if kind := m.tryInferKind(node.Object); kind != nil && getUnderlyingKind(kind).current == typeString {
+				m.unexpectedAt(target.Position, "cannot assign to an element of string")
+			}
+			m.compileExpr(node.Property)
+			if compound {
+				m.emit(bytecode.OpDup2)
+				m.emit(bytecode.OpGetIndex)
+			}
+			compute()
+			m.mark(target.Position)
+			m.emit(bytecode.OpSetIndex)
+		} else {
+			m.recordPropertyRef(node.Object, node.Property.Node.(*ast.IdentifierLiteral).Name)
+			name := m.addConstant(bytecode.StringConstant(node.Property.Node.(*ast.IdentifierLiteral).Name.Name))
+			if compound {
+				m.emit(bytecode.OpDup)
+				m.emit(bytecode.OpGetField, name)
+			}
+			compute()
+			m.mark(target.Position)
+			m.emit(bytecode.OpSetField, name)
+		}
+	default:
+		m.unexpectedAt(target.Position, "cannot assign to this expression")
+	}
+}
+
+// 只有结构体字段可以赋值，方法及内置方法不能赋值
+func (m *Module) checkAssignField(object *ast.Expr, name *ast.Identifier) {
+	kind := m.tryInferKind(object)
+	if kind == nil {
+		return
+	}
+	underlying := getUnderlyingKind(kind)
+	switch underlying.current.(type) {
+	case *TAny:
+		return
+	case *TStruct:
+		if _, has := getStructProperties(underlying)[name.Name]; has {
+			return
+		}
+	case *TInterface:
+		if _, has := underlying.current.(*TInterface).Properties[name.Name]; has {
+			m.unexpectedAt(name.Position, "cannot assign to method: "+name.Name)
+		}
+	}
+	if m.findMethod(kind, name.Name) != nil || m.findBuiltinMethod(kind, name.Name) != nil {
+		m.unexpectedAt(name.Position, "cannot assign to method: "+name.Name)
+	}
+}
+
+func (m *Module) compileBinaryTypeExpr(expr *ast.BinaryTypeExpr) {
+	target := m.compileKindExpr(expr.Right)
+	if expr.Operator.Value == "as" {
+		// 校验是否可以转换
+		_, _ = m.inferBinaryTypeExprKind(expr)
+		// 字面量以目标类型作为期望类型，如 [1, "b"] as []any
+		m.compileExprExpected(expr.Left, target)
+	} else {
+		m.compileExpr(expr.Left)
+	}
+	kind := m.kindConstant(target)
+	m.mark(expr.Operator.Position)
+
+	switch expr.Operator.Value {
+	case "is":
+		m.emit(bytecode.OpIs, kind)
+	case "as":
+		m.emit(bytecode.OpAs, kind)
+	default:
+		panic("Internal Err")
+	}
+}
+
+func (m *Module) compileUnaryExpr(expr *ast.UnaryExpr) {
+	switch expr.Operator.Value {
+	// update : 后缀形式通过反向运算得到原值
+	case "++", "--":
+		m.clearNarrowed(expr.Argument)
+		op, inverse := bytecode.OpAdd, bytecode.OpSub
+		if expr.Operator.Value == "--" {
+			op, inverse = inverse, op
+		}
+		one := m.addConstant(bytecode.NumberConstant(1))
+		m.compileUpdate(expr.Argument, true, func() {
+			if kind := m.tryInferKind(expr.Argument); kind != nil && !isNumericKind(kind) {
+				m.unexpectedAt(expr.Operator.Position, fmt.Sprintf("invalid operation: operator %s not defined on %s", expr.Operator.Value, m.kindString(kind)))
+			}
+			m.emit(bytecode.OpConst, one)
+			m.emit(op)
+		})
+		if !expr.Prefix {
+			m.emit(bytecode.OpConst, one)
+			m.emit(inverse)
+		}
+		return
+	}
+
+	// 校验操作数类型
+	_, _ = m.inferUnaryExprKind(expr)
+	m.compileExpr(expr.Argument)
+	m.mark(expr.Operator.Position)
 
 	switch expr.Operator.Value {
 	// number op
-	case "+", "-", "++", "--":
-		kind.current = typeNumber
+	case "+":
+		m.emit(bytecode.OpToNumber)
+	case "-":
+		m.emit(bytecode.OpNeg)
 
 	// logic
 	case "!":
-		kind.current = typeBool
+		m.emit(bytecode.OpNot)
 
 	// bit op
 	case "~":
-		kind.current = typeNumber
+		m.emit(bytecode.OpBitNot)
 
 	default:
 		panic("Internal Err")
 	}
-
-	return compileValue
 }
 
-func (m *Module) compileFuncExpr(expr *ast.FuncExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileFuncExpr(expr *ast.FuncExpr) {
+	kind := m.compileKindExpr(expr.FuncKind)
+	fn := bytecode.NewFunction("<anonymous>")
+	index := m.code.AddFunction(fn)
+
+	m.compileFuncBody(fn, expr.FuncKind, kind.current.(*TFunc), nil, expr.Body)
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.FuncConstant{
+		Module: m.code.Index,
+		Index:  index,
+	}))
 }
 
-func (m *Module) compileStructExpr(expr *ast.StructExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+// 编译结构体字面量，返回结构体的类型（匿名结构体返回 nil）
+func (m *Module) compileStructExpr(expr *ast.StructExpr, expected *KindRef) *KindRef {
+	values := make(map[string]*ast.Expr)
+	for _, pair := range expr.Properties {
+		key := pair.Key.Node.(*ast.IdentifierLiteral).Name.Name
+		_, has := values[key]
+		if has {
+			m.unexpectedAt(pair.Key.Position, "duplicate key: "+key)
+		}
+		values[key] = pair.Value
+	}
+
+	var kind *KindRef
+	if expr.Ctor != nil {
+		kind = m.compileKindExpr(expr.Ctor)
+		if _, ok := resolveSelfKind(kind).current.(*TStruct); !ok {
+			m.unexpectedAt(expr.Ctor.Position, "expect a struct")
+		}
+	} else if expected != nil {
+		if _, ok := resolveSelfKind(expected).current.(*TStruct); ok {
+			kind = expected
+		}
+	}
+
+	// 匿名结构体
+	if kind == nil {
+		fields := make([]string, 0, len(values))
+		for key := range values {
+			fields = append(fields, key)
+		}
+		sort.Strings(fields)
+		for _, key := range fields {
+			m.compileExpr(values[key])
+		}
+		m.emit(bytecode.OpStruct, m.addConstant(&bytecode.KindConstant{
+			Kind: &bytecode.Kind{Tag: bytecode.KindStruct, Len: -1, Fields: fields},
+		}))
+		return nil
+	}
+
+	props := getStructFields(resolveSelfKind(kind))
+	for _, pair := range expr.Properties {
+		key := pair.Key.Node.(*ast.IdentifierLiteral).Name
+		if props[key.Name] == nil {
+			m.unexpectedAt(key.Position, "unknown field: "+key.Name)
+		}
+		if key.Name[0] == '_' && props[key.Name].module != m {
+			m.unexpectedAt(key.Position, "cannot access private field: "+key.Name)
+		}
+		owner := findFieldOwner(resolveSelfKind(kind), key.Name)
+		m.recordRef(key, m.compiler.memberSymbol(owner, key.Name, SymbolField), false)
+	}
+
+	// 按运行时类型的字段顺序压入字段值，缺省的字段使用默认值
+	index := m.kindConstant(kind)
+	for _, key := range m.code.Constants[index].(*bytecode.KindConstant).Kind.Fields {
+		value, has := values[key]
+		if has {
+			m.compileValue(value, props[key])
+		} else {
+			m.emitDefault(props[key])
+		}
+	}
+	m.emit(bytecode.OpStruct, index)
+	return kind
 }
 
-func (m *Module) compileArrayExpr(expr *ast.ArrayExpr) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileArrayExpr(expr *ast.ArrayExpr, expected *KindRef) {
+	var itemKind *KindRef
+	size := len(expr.Items)
+	op := bytecode.OpArray
+	if expected != nil {
+		if t, ok := getUnderlyingKind(expected).current.(*TArray); ok {
+			itemKind = t.Kind
+			if t.Len >= 0 {
+				op = bytecode.OpFixedArray
+			}
+			if t.Len > size {
+				size = t.Len
+			}
+		}
+	}
+
+	// 没有期望类型时由元素推断，校验元素类型是否一致
+	if expected == nil {
+		_, _ = m.inferArrayExprKind(expr)
+	}
+
+	for _, item := range expr.Items {
+		if itemKind != nil {
+			m.compileValue(item, itemKind)
+		} else {
+			m.compileExprExpected(item, itemKind)
+		}
+	}
+	// 定长数组不足的元素使用默认值填充
+	for i := len(expr.Items); i < size; i++ {
+		m.emitDefault(itemKind)
+	}
+	if size > bytecode.MaxU16 {
+		m.unexpectedPos(m.markedPos(), fmt.Sprintf("too many array items: %d (max %d)", size, bytecode.MaxU16))
+	}
+	m.emit(op, size)
 }
 
-func (m *Module) compileIdentifierLiteral(expr *ast.IdentifierLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileIdentifierLiteral(expr *ast.Expr) {
+	member := m.scopes.findStaticMember(expr, true)
+	m.recordUse(expr, member.value)
+	m.recordStaticRefs(expr)
+	m.emitStaticMember(member, expr.Position)
 }
 
-func (m *Module) compileNumberLiteral(expr *ast.NumberLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileNumberLiteral(expr *ast.NumberLiteral) {
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.NumberConstant(expr.Value)))
 }
 
-func (m *Module) compileBoolLiteral(expr *ast.BoolLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileBoolLiteral(expr *ast.BoolLiteral) {
+	if expr.Value {
+		m.emit(bytecode.OpTrue)
+	} else {
+		m.emit(bytecode.OpFalse)
+	}
 }
 
-func (m *Module) compileNullLiteral(expr *ast.NullLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileNullLiteral(expr *ast.NullLiteral) {
+	m.emit(bytecode.OpNull)
 }
 
-func (m *Module) compileStringLiteral(expr *ast.StringLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileStringLiteral(expr *ast.StringLiteral) {
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.StringConstant(expr.Value)))
 }
 
-func (m *Module) compileCharLiteral(expr *ast.CharLiteral) *bytecode.NValue {
-	compileValue := bytecode.NewNValue()
-	return compileValue
+func (m *Module) compileCharLiteral(expr *ast.CharLiteral) {
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.CharConstant(expr.Value)))
 }
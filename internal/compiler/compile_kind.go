@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"errors"
+	"fmt"
 	"github.com/peakchen90/noah-lang/internal/ast"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"math"
@@ -34,7 +35,9 @@ func (m *Module) compileKindExpr(kindExpr *ast.KindExpr) *KindRef {
 		return m.compileArrayKind(kindExpr)
 	case *ast.TIdentifier:
 		node := node.(*ast.TIdentifier)
-		return m.scopes.findIdentifierKind(node.Name, true)
+		kind := m.scopes.findIdentifierKind(node.Name, true)
+		m.recordRef(node.Name, m.compiler.kindSymbol(kind), false)
+		return kind
 	case *ast.TMemberKind:
 		return m.scopes.findMemberKind(kindExpr, true)
 	case *ast.TFuncKind:
@@ -53,9 +56,12 @@ func (m *Module) compileArrayKind(kindExpr *ast.KindExpr) *KindRef {
 	size := -1 // vector array
 
 	if node.Len != nil {
-		rawVal := node.Len.Node.(*ast.NumberLiteral).Value
+		rawVal, ok := m.constNumber(node.Len, 0)
+		if !ok {
+			m.unexpectedAt(node.Len.Position, "array length must be a constant expression")
+		}
 		if rawVal < 0 || math.Floor(rawVal) != rawVal {
-			m.unexpectedPos(node.Len.Start, "expect be a positive integer")
+			m.unexpectedAt(node.Len.Position, "expect be a positive integer")
 		}
 		size = int(rawVal)
 	}
@@ -68,6 +74,68 @@ func (m *Module) compileArrayKind(kindExpr *ast.KindExpr) *KindRef {
 	return kind
 }
 
+// 计算常量表达式的值：数字字面量、常量及其组成的算术运算，depth 用于避免常量循环引用
+func (m *Module) constNumber(expr *ast.Expr, depth int) (float64, bool) {
+	if depth > 100 {
+		return 0, false
+	}
+
+	switch expr.Node.(type) {
+	case *ast.NumberLiteral:
+		return expr.Node.(*ast.NumberLiteral).Value, true
+	case *ast.IdentifierLiteral, *ast.MemberExpr:
+		member := m.scopes.findStaticMember(expr, false)
+		if member == nil {
+			return 0, false
+		}
+		v, ok := member.value.(*VarValue)
+		if !ok || !v.Const || v.init == nil {
+			return 0, false
+		}
+		return v.module.constNumber(v.init, depth+1)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		value, ok := m.constNumber(node.Argument, depth+1)
+		switch {
+		case !ok:
+		case node.Operator.Value == "+":
+			return value, true
+		case node.Operator.Value == "-":
+			return -value, true
+		}
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		left, ok1 := m.constNumber(node.Left, depth+1)
+		right, ok2 := m.constNumber(node.Right, depth+1)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		switch node.Operator.Value {
+		case "+":
+			return left + right, true
+		case "-":
+			return left - right, true
+		case "*":
+			return left * right, true
+		case "/":
+			return left / right, true
+		case "%":
+			return math.Mod(left, right), true
+		case "<<":
+			return float64(int64(left) << int64(right)), true
+		case ">>":
+			return float64(int64(left) >> int64(right)), true
+		case "&":
+			return float64(int64(left) & int64(right)), true
+		case "|":
+			return float64(int64(left) | int64(right)), true
+		case "^":
+			return float64(int64(left) ^ int64(right)), true
+		}
+	}
+	return 0, false
+}
+
 func (m *Module) compileFuncKind(kindExpr *ast.KindExpr) *KindRef {
 	node := kindExpr.Node.(*ast.TFuncKind)
 
@@ -78,7 +146,7 @@ func (m *Module) compileFuncKind(kindExpr *ast.KindExpr) *KindRef {
 	for i, arg := range node.Arguments {
 		if arg.Rest {
 			if i < len(node.Arguments)-1 {
-				m.unexpectedPos(arg.Start, "the rest argument should be placed last")
+				m.unexpectedAt(arg.Position, "the rest argument should be placed last")
 			}
 			hasRest = true
 		}
@@ -107,7 +175,7 @@ func (m *Module) compileStructKind(kind *KindRef, kindExpr *ast.KindExpr) *KindR
 		key := pair.Key.Name
 		_, has := props[key]
 		if has {
-			m.unexpectedPos(pair.Start, "duplicate key: "+key)
+			m.unexpectedAt(pair.Position, "duplicate key: "+key)
 		}
 		props[key] = m.compileKindExpr(pair.Kind)
 	}
@@ -115,16 +183,16 @@ func (m *Module) compileStructKind(kind *KindRef, kindExpr *ast.KindExpr) *KindR
 	for _, item := range node.Extends {
 		extendKind := m.compileKindExpr(item)
 		if extendKind == kind {
-			m.unexpectedPos(item.Start, "cannot extend itself")
+			m.unexpectedAt(item.Position, "cannot extend itself")
 		}
 		for _, ref := range kind.refs {
 			if ref == extendKind {
-				m.unexpectedPos(item.Start, "cannot extends cycle")
+				m.unexpectedAt(item.Position, "cannot extends cycle")
 			}
 		}
 		_, is := extendKind.current.(*TStruct)
 		if !is {
-			m.unexpectedPos(item.Start, "expect a struct")
+			m.unexpectedAt(item.Position, "expect a struct")
 		}
 		extends = append(extends, extendKind)
 
@@ -138,6 +206,9 @@ func (m *Module) compileStructKind(kind *KindRef, kindExpr *ast.KindExpr) *KindR
 		Properties: props,
 		Impl:       newImpl(),
 	}
+	for _, pair := range node.Properties {
+		m.recordRef(pair.Key, m.compiler.memberSymbol(kind, pair.Key.Name, SymbolField), true)
+	}
 	return kind
 }
 
@@ -173,6 +244,8 @@ func (m *Module) inferKind(expr *ast.Expr) (*KindRef, error) {
 		kind.current = typeString
 	case *ast.CharLiteral:
 		kind.current = typeChar
+	case *ast.BadExpr:
+		return nil, errors.New("invalid expression")
 	default:
 		panic("Internal Err")
 	}
@@ -180,26 +253,31 @@ func (m *Module) inferKind(expr *ast.Expr) (*KindRef, error) {
 	return kind, nil
 }
 
-func (m *Module) inferCallExprKind(expr *ast.CallExpr) (kind *KindRef, err error) {
-	callee := expr.Callee.Node
+// 推断表达式类型，无法推断时返回 nil
+func (m *Module) tryInferKind(expr *ast.Expr) *KindRef {
+	kind, err := m.inferKind(expr)
+	if err != nil {
+		return nil
+	}
+	return kind
+}
 
-	switch callee.(type) {
-	case *ast.IdentifierLiteral:
-		value := m.scopes.findValue(callee.(*ast.IdentifierLiteral).Name, true)
-		kind, err = m.getValueKind(value)
-	case *ast.MemberExpr:
-		value := m.scopes.findMemberValue(expr.Callee, true)
-		kind, err = m.getValueKind(value)
-	case *ast.FuncExpr:
-		kind = m.compileKindExpr(callee.(*ast.FuncExpr).FuncKind)
-	default:
-		panic("Internal Err")
+// 判断表达式是否为字符串类型
+func (m *Module) isStringExpr(expr *ast.Expr) bool {
+	kind := m.tryInferKind(expr)
+	return kind != nil && getUnderlyingKind(kind).current == typeString
+}
+
+func (m *Module) inferCallExprKind(expr *ast.CallExpr) (kind *KindRef, err error) {
+	kind, err = m.inferKind(expr.Callee)
+	if err != nil {
+		return nil, err
 	}
 
-	if kind != nil {
-		funcKind, ok := kind.current.(*TFunc)
+	if kind != nil && getUnderlyingKind(kind).current != typeAny {
+		funcKind, ok := getUnderlyingKind(kind).current.(*TFunc)
 		if !ok {
-			m.unexpectedPos(expr.Callee.Start, "not a function")
+			m.unexpectedAt(expr.Callee.Position, "not a function")
 		}
 		kind = funcKind.Return
 	}
@@ -215,6 +293,8 @@ func (m *Module) getValueKind(value Value) (kind *KindRef, err error) {
 		kind = value.(*VarValue).Kind
 	case *SelfValue:
 		kind = value.(*SelfValue).Kind
+	case *BuiltinValue:
+		kind = value.(*BuiltinValue).Kind
 	default:
 		panic("Internal Error")
 	}
@@ -225,6 +305,9 @@ func (m *Module) getValueKind(value Value) (kind *KindRef, err error) {
 func (m *Module) inferIdentifierLiteralKind(expr *ast.IdentifierLiteral) (*KindRef, error) {
 	value := m.scopes.findValue(expr.Name, false)
 	if value != nil {
+		if kind := m.scopes.findNarrowed(value); kind != nil {
+			return kind, nil
+		}
 		return m.getValueKind(value)
 	}
 
@@ -233,15 +316,142 @@ func (m *Module) inferIdentifierLiteralKind(expr *ast.IdentifierLiteral) (*KindR
 }
 
 func (m *Module) inferMemberExprKind(expr *ast.Expr) (*KindRef, error) {
-	value := m.scopes.findMemberValue(expr, false)
-	if value != nil {
-		return m.getValueKind(value)
+	member := m.scopes.findStaticMember(expr, true)
+	if member != nil {
+		if member.value != nil {
+			return m.getValueKind(member.value)
+		}
+		if member.choice >= 0 {
+			return member.kind, nil
+		}
+		return nil, errors.New("not a value: " + string(m.source[expr.Start:expr.End]))
+	}
+
+	node := expr.Node.(*ast.MemberExpr)
+	objectKind, err := m.inferKind(node.Object)
+	if err != nil || objectKind == nil {
+		return nil, err
+	}
+	if node.Computed {
+		return m.inferIndexKind(node, objectKind)
+	}
+	return m.inferPropertyKind(objectKind, node.Property.Node.(*ast.IdentifierLiteral).Name)
+}
+
+// 推断索引访问的类型：数组为元素类型，字符串为 char
+func (m *Module) inferIndexKind(node *ast.MemberExpr, objectKind *KindRef) (*KindRef, error) {
+	if indexKind := m.tryInferKind(node.Property); indexKind != nil && !isNumericKind(indexKind) {
+		m.unexpectedAt(node.Property.Position, "invalid index type: "+m.kindString(indexKind))
 	}
 
-	// TODO
+	kind := newKindRef(m, -1)
+	switch getUnderlyingKind(objectKind).current.(type) {
+	case *TAny:
+		kind.current = typeAny
+	case *TString:
+		kind.current = typeChar
+	case *TArray:
+		t := getUnderlyingKind(objectKind).current.(*TArray)
+		// 常量索引在编译时检查是否越界
+		if index, ok := m.constNumber(node.Property, 0); ok && (index < 0 || (t.Len >= 0 && int(index) >= t.Len)) {
+			message := fmt.Sprintf("index out of range [%v]", index)
+			if t.Len >= 0 {
+				message += fmt.Sprintf(" with length %d", t.Len)
+			}
+			m.unexpectedAt(node.Property.Position, message)
+		}
+		if t.Kind != nil {
+			return t.Kind, nil
+		}
+		kind.current = typeAny
+	default:
+		m.unexpectedAt(node.Object.Position, "cannot index a value of type "+m.kindString(objectKind))
+	}
+	return kind, nil
+}
+
+// 推断属性的类型：结构体字段（包含继承的字段）、接口方法、impl 实现的方法及内置方法，
+// 以 `_` 开头的成员只能在声明的模块内访问
+func (m *Module) inferPropertyKind(objectKind *KindRef, name *ast.Identifier) (*KindRef, error) {
+	m.completeAt(name, func() []*CompletionItem { return m.memberItems(objectKind) })
+	underlying := getUnderlyingKind(objectKind)
+	isPrivate := name.Name[0] == '_'
+
+	switch underlying.current.(type) {
+	case *TAny:
+		kind := newKindRef(m, -1)
+		kind.current = typeAny
+		return kind, nil
+	case *TStruct:
+		if prop, has := getStructProperties(underlying)[name.Name]; has {
+			if isPrivate && prop.module != m {
+				m.unexpectedAt(name.Position, "cannot access private field: "+name.Name)
+			}
+			return prop, nil
+		}
+	case *TInterface:
+		if prop, has := underlying.current.(*TInterface).Properties[name.Name]; has {
+			return prop, nil
+		}
+	}
+
+	if value := m.findMethod(objectKind, name.Name); value != nil {
+		if isPrivate && value.module != m {
+			m.unexpectedAt(name.Position, "cannot access private method: "+name.Name)
+		}
+		return value.Kind, nil
+	}
+	if kind := m.findBuiltinMethod(objectKind, name.Name); kind != nil {
+		return kind, nil
+	}
+
+	m.unexpectedAt(name.Position, fmt.Sprintf("undefined property `%s` for type %s", name.Name, m.kindString(objectKind)))
 	return nil, nil
 }
 
+// 查找类型的方法，依次查找自定义类型、底层类型及继承的结构体
+func (m *Module) findMethod(kind *KindRef, name string) *FuncValue {
+	if value := FindMethod(kind, name); value != nil {
+		return value
+	}
+	if underlying := getUnderlyingKind(kind); underlying != resolveSelfKind(kind) {
+		return FindMethod(underlying, name)
+	}
+	return nil
+}
+
+// 校验运算符的操作数类型，expect 为 typeNumber（包括 byte、char）或 typeBool，
+// 操作数为 any 或无法推断类型时不校验。isLeft 表示左侧（或一元运算）的操作数
+func (m *Module) checkOperand(operator *ast.Operator, operand *ast.Expr, isLeft bool, expect Kind) {
+	kind := m.tryInferKind(operand)
+	if isVoidKind(kind) {
+		return
+	}
+	name := "number"
+	if expect == typeBool {
+		name = "bool"
+		if current := getUnderlyingKind(kind).current; current == typeBool || current == typeAny {
+			return
+		}
+	} else if isNumericKind(kind) {
+		return
+	}
+
+	if isLeft {
+		m.unexpectedAt(operator.Position, fmt.Sprintf("invalid operation: operator %s not defined on %s", operator.Value, m.kindString(kind)))
+	}
+	m.unexpectedAt(operand.Position, fmt.Sprintf("cannot use %s as %s", m.kindString(kind), name))
+}
+
+// number、byte、char
+func isNumericKind(kind *KindRef) bool {
+	switch getUnderlyingKind(kind).current {
+	case typeNumber, typeByte, typeChar, typeAny:
+		return true
+	}
+	return false
+}
+
 func (m *Module) inferBinaryExprKind(expr *ast.BinaryExpr) (*KindRef, error) {
 	kind := newKindRef(m, -1)
 
@@ -250,16 +460,35 @@ func (m *Module) inferBinaryExprKind(expr *ast.BinaryExpr) (*KindRef, error) {
 	case "=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "|=", "^=":
 		return m.inferKind(expr.Left)
 
-	// logic
-	case "||", "&&", "==", "!=", "<", "<=", ">", ">=":
+	// logic : 右侧可以使用左侧收窄的类型
+	case "||", "&&":
+		m.checkOperand(expr.Operator, expr.Left, true, typeBool)
+		m.scopes.push()
+		for value, narrowed := range m.narrowings(expr.Left, expr.Operator.Value == "&&") {
+			m.scopes.narrow(value, narrowed)
+		}
+		m.checkOperand(expr.Operator, expr.Right, false, typeBool)
+		m.scopes.pop()
+		kind.current = typeBool
+	case "==", "!=", "<", "<=", ">", ">=":
 		kind.current = typeBool
 
 	// bit op
 	case "|", "^", "&", "<<", ">>":
+		m.checkOperand(expr.Operator, expr.Left, true, typeNumber)
+		m.checkOperand(expr.Operator, expr.Right, false, typeNumber)
 		kind.current = typeNumber
 
-	// decimal calc
-	case "+", "-", "*", "/", "%":
+	// decimal calc : 左侧为字符串时为拼接
+	case "+":
+		if m.isStringExpr(expr.Left) {
+			kind.current = typeString
+			break
+		}
+		fallthrough
+	case "-", "*", "/", "%":
+		m.checkOperand(expr.Operator, expr.Left, true, typeNumber)
+		m.checkOperand(expr.Operator, expr.Right, false, typeNumber)
 		kind.current = typeNumber
 
 	default:
@@ -277,18 +506,25 @@ func (m *Module) inferBinaryTypeExprKind(expr *ast.BinaryTypeExpr) (*KindRef, er
 		kind.current = typeBool
 	case "as":
 		kind = m.compileKindExpr(expr.Right)
+		if _, ok := expr.Left.Node.(*ast.ArrayExpr); ok {
+			// 数组字面量按元素逐个校验，如 [1, "b"] as []any
+			if _, ok := getUnderlyingKind(kind).current.(*TArray); ok {
+				m.checkAssignable(expr.Left, kind)
+				return kind, nil
+			}
+		}
 		leftKind, err := m.inferKind(expr.Left)
 		if err != nil {
 			_, isNull := expr.Left.Node.(*ast.NullLiteral)
 			if isNull {
 				if !isReferenceKind(kind) {
-					m.unexpectedPos(expr.Right.Start, "expect a reference type, but found: "+getKindExprString(expr.Right))
+					m.unexpectedAt(expr.Right.Position, "expect a reference type, but found: "+getKindExprString(expr.Right))
 				}
 			} else {
 				return nil, err
 			}
-		} else if !matchKind(leftKind, kind, true) {
-			m.unexpectedPos(expr.Operator.Start, "cannot use `as` on incompatible type: "+getKindExprString(expr.Right))
+		} else if !castableKind(leftKind, kind) {
+			m.unexpectedAt(expr.Operator.Position, fmt.Sprintf("cannot cast %s to %s", m.kindString(leftKind), m.kindString(kind)))
 		}
 	default:
 		panic("Internal Err")
@@ -302,15 +538,20 @@ func (m *Module) inferUnaryExprKind(expr *ast.UnaryExpr) (*KindRef, error) {
 
 	switch expr.Operator.Value {
 	// number op
-	case "+", "-", "++", "--":
+	case "+", "-":
+		m.checkOperand(expr.Operator, expr.Argument, true, typeNumber)
+		kind.current = typeNumber
+	case "++", "--":
 		kind.current = typeNumber
 
 	// logic
 	case "!":
+		m.checkOperand(expr.Operator, expr.Argument, true, typeBool)
 		kind.current = typeBool
 
 	// bit op
 	case "~":
+		m.checkOperand(expr.Operator, expr.Argument, true, typeNumber)
 		kind.current = typeNumber
 
 	default:
@@ -324,11 +565,31 @@ func (m *Module) inferStructExprKind(expr *ast.StructExpr) (*KindRef, error) {
 	kind := newKindRef(m, 0)
 	props := make(map[string]*KindRef)
 
+	// 指定了类型时以字段的类型作为期望类型，如 `P { next: null }`
+	var ctorKind *KindRef
+	var fields map[string]*KindRef
+	if expr.Ctor != nil {
+		ctorKind = m.compileKindExpr(expr.Ctor)
+		_, ok := ctorKind.current.(*TStruct)
+		if !ok {
+			m.unexpectedAt(expr.Ctor.Position, "expect a struct")
+		}
+		fields = getStructFields(ctorKind)
+	}
+
 	for _, pair := range expr.Properties {
 		key := pair.Key.Node.(*ast.IdentifierLiteral).Name.Name
 		_, has := props[key]
 		if has {
-			m.unexpectedPos(pair.Key.Start, "duplicate key: "+key)
+			m.unexpectedAt(pair.Key.Position, "duplicate key: "+key)
+		}
+		if ctorKind != nil {
+			if fields[key] == nil {
+				m.unexpectedAt(pair.Key.Position, "unknown field: "+key)
+			}
+			m.checkAssignable(pair.Value, fields[key])
+			props[key] = fields[key]
+			continue
 		}
 		inferKind, err := m.inferKind(pair.Value)
 		if err != nil {
@@ -343,13 +604,7 @@ func (m *Module) inferStructExprKind(expr *ast.StructExpr) (*KindRef, error) {
 		Impl:       newImpl(),
 	}
 
-	if expr.Ctor != nil {
-		ctorKind := m.compileKindExpr(expr.Ctor)
-		_, ok := ctorKind.current.(*TStruct)
-		if !ok {
-			m.unexpectedPos(expr.Ctor.Start, "expect a struct")
-		}
-
+	if ctorKind != nil {
 		if !matchKind(ctorKind, kind, true) {
 			m.unexpectedPos(expr.Ctor.End, "cannot match struct: "+getKindExprString(expr.Ctor))
 		}
@@ -362,19 +617,44 @@ func (m *Module) inferStructExprKind(expr *ast.StructExpr) (*KindRef, error) {
 
 func (m *Module) inferArrayExprKind(expr *ast.ArrayExpr) (*KindRef, error) {
 	kind := newKindRef(m, -1)
-	arr := &TArray{}
+	arr := &TArray{Len: -1, Impl: newImpl()} // 没有期望类型时推断为可变长数组
 	kind.current = arr
 
-	if len(expr.Items) > 0 {
-		inferKind, err := m.inferKind(expr.Items[0])
+	// 空数组及全部为 null 的数组无法推断，需要通过期望类型确定
+	if len(expr.Items) == 0 {
+		return nil, errors.New("cannot infer the type of an empty array")
+	}
+
+	// 元素的类型需要一致，子结构体的元素可以与父结构体混合
+	var nulls []*ast.Expr
+	for _, item := range expr.Items {
+		if _, ok := item.Node.(*ast.NullLiteral); ok {
+			nulls = append(nulls, item)
+			continue
+		}
+		inferKind, err := m.inferKind(item)
 		if err != nil {
 			return nil, err
 		}
-		arr.Kind = inferKind
-		arr.Len = len(expr.Items)
+		switch {
+		case arr.Kind == nil || assignableKind(arr.Kind, inferKind):
+			if arr.Kind == nil {
+				arr.Kind = inferKind
+			}
+		case assignableKind(inferKind, arr.Kind):
+			arr.Kind = inferKind
+		default:
+			m.unexpectedAt(item.Position, fmt.Sprintf("mixed types in array: %s and %s", m.kindString(arr.Kind), m.kindString(inferKind)))
+		}
+	}
+	if arr.Kind == nil {
+		return nil, errors.New("cannot infer the type of null")
+	}
+	for _, item := range nulls {
+		if !isReferenceKind(arr.Kind) {
+			m.unexpectedAt(item.Position, "cannot use null as "+m.kindString(arr.Kind))
+		}
 	}
-
-	// TODO 没有元素如何推断？
 
 	return kind, nil
 }
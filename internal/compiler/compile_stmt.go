@@ -3,11 +3,17 @@ package compiler
 import (
 	"fmt"
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"strings"
 )
 
 func (m *Module) compileStmt(stmt *ast.Stmt) {
+	if m.fn != nil {
+		m.mark(stmt.Position)
+	}
+
 	switch (stmt.Node).(type) {
 	case *ast.ImportDecl:
 		m.compileImportDecl(stmt.Node.(*ast.ImportDecl), false)
@@ -20,7 +26,7 @@ func (m *Module) compileStmt(stmt *ast.Stmt) {
 	case *ast.BlockStmt:
 		m.compileBlockStmt(stmt.Node.(*ast.BlockStmt))
 	case *ast.ReturnStmt:
-		m.compileReturnStmt(stmt.Node.(*ast.ReturnStmt))
+		m.compileReturnStmt(stmt.Node.(*ast.ReturnStmt), stmt.Position)
 	case *ast.ExprStmt:
 		m.compileExprStmt(stmt.Node.(*ast.ExprStmt))
 	case *ast.IfStmt:
@@ -28,9 +34,9 @@ func (m *Module) compileStmt(stmt *ast.Stmt) {
 	case *ast.ForStmt:
 		m.compileForStmt(stmt.Node.(*ast.ForStmt))
 	case *ast.BreakStmt:
-		m.compileBreakStmt(stmt.Node.(*ast.BreakStmt))
+		m.compileBreakStmt(stmt.Node.(*ast.BreakStmt), stmt.Position)
 	case *ast.ContinueStmt:
-		m.compileContinueStmt(stmt.Node.(*ast.ContinueStmt))
+		m.compileContinueStmt(stmt.Node.(*ast.ContinueStmt), stmt.Position)
 	case *ast.TTypeDecl:
 		m.compileTTypeDecl(stmt.Node.(*ast.TTypeDecl), false)
 	case *ast.TInterfaceDecl:
@@ -39,6 +45,8 @@ func (m *Module) compileStmt(stmt *ast.Stmt) {
 		m.compileTStructDecl(stmt.Node.(*ast.TStructDecl), false)
 	case *ast.TEnumDecl:
 		m.compileTEnumDecl(stmt.Node.(*ast.TEnumDecl), false)
+	case *ast.BadStmt:
+		// 只在补全时编译存在语法错误的模块
 	default:
 		panic("Internal Err")
 	}
@@ -46,10 +54,10 @@ func (m *Module) compileStmt(stmt *ast.Stmt) {
 
 func (m *Module) compileImportDecl(node *ast.ImportDecl, isPrecompile bool) {
 	builder := strings.Builder{}
-	importPathStart := node.Paths[0].Start
+	importPath := *ast.NewPosition(node.Paths[0].Start, node.Paths[len(node.Paths)-1].End)
 
 	if node.Package != nil {
-		importPathStart = node.Package.Start
+		importPath.Start = node.Package.Start
 		builder.WriteString(node.Package.Name)
 		builder.WriteString(":")
 	}
@@ -64,13 +72,14 @@ func (m *Module) compileImportDecl(node *ast.ImportDecl, isPrecompile bool) {
 	module, has := m.compiler.Modules.find(moduleId)
 
 	if !has {
+		// 预编译时已报告无法解析的模块
 		if !isPrecompile {
-			panic("Internal Err")
+			return
 		}
 
 		_mod, err := NewModule(m.compiler).resolve(moduleId)
 		if err != nil {
-			m.unexpectedPos(importPathStart, err.Error())
+			m.unexpectedCode(diagnostic.CodeModule, importPath, err.Error())
 		} else {
 			module = _mod
 		}
@@ -82,14 +91,23 @@ func (m *Module) compileImportDecl(node *ast.ImportDecl, isPrecompile bool) {
 	}
 
 	if local.Name == "self" {
-		m.unexpectedPos(local.Start, "cannot use `self` as a local identifier")
+		m.unexpectedAt(local.Position, "cannot use `self` as a local identifier")
 	}
 
 	if isPrecompile {
 		m.scopes.putModule(local, module, true)
+		m.recordRef(local, m.compiler.moduleSymbol(module), false)
+		if local != node.Paths[len(node.Paths)-1] {
+			m.recordRef(node.Paths[len(node.Paths)-1], m.compiler.moduleSymbol(module), false)
+		}
+		m.code.AddImport(module.code.Index)
 		err := module.parse()
-		if err != nil {
-			m.unexpectedPos(importPathStart, err.Error())
+		if err == errSyntax {
+			if m.compiler.cursor == nil {
+				m.compiler.abort()
+			}
+		} else if err != nil {
+			m.unexpectedCode(diagnostic.CodeModule, importPath, err.Error())
 		}
 		module.precompile()
 	} else {
@@ -103,18 +121,29 @@ func (m *Module) compileFuncSign(node *ast.FuncDecl, target *KindRef, isPrecompi
 
 	if isPrecompile {
 		if name.Name == "self" {
-			m.unexpectedPos(name.Start, "identifier 'self' is not allowed")
+			m.unexpectedAt(name.Position, "identifier 'self' is not allowed")
 		}
 
+		funcName := name.Name
+		if target != nil && len(target.name) > 0 {
+			funcName = target.name + "." + funcName
+		}
 		value = &FuncValue{
-			Name: name.Name,
-			Kind: newKindRef(m, -1),
+			Name:   name.Name,
+			Kind:   newKindRef(m, -1),
+			Ptr:    m.code.AddFunction(bytecode.NewFunction(funcName)),
+			module: m,
 		}
 
+		m.recordDef(name, value)
 		if target != nil {
+			symbol := m.compiler.valueSymbol(value)
+			symbol.Tag = SymbolMethod
+			symbol.Owner = target
+
 			impls := target.current.getImpl()
 			if impls.hasFunc(name.Name) {
-				m.unexpectedPos(node.Name.Start, "duplicate key: "+name.Name)
+				m.unexpectedAt(node.Name.Position, "duplicate key: "+name.Name)
 			}
 			impls.addFunc(value)
 		} else {
@@ -146,12 +175,10 @@ func (m *Module) compileFuncSign(node *ast.FuncDecl, target *KindRef, isPrecompi
 		t, ok := restArgKind.current.(*TArray)
 		if !ok || t.Len >= 0 {
 			restKindNode := funcKindNode.Arguments[len(argKinds)-1].Kind
-			m.unexpectedPos(restKindNode.Start, "the rest argument should be: []T")
+			m.unexpectedAt(restKindNode.Position, "the rest argument should be: []T")
 		}
 	}
 
-	value.Ptr = 0 // TODO ptr
-
 	return value
 }
 
@@ -165,30 +192,54 @@ func (m *Module) compileFuncDecl(node *ast.FuncDecl, target *KindRef) {
 		value = m.scopes.findFuncValue(name, true)
 	}
 
-	funcKindNode := node.Kind.Node.(*ast.TFuncKind)
-	funcKind := value.Kind.current.(*TFunc)
-	argKinds := funcKind.Arguments
+	// 签名存在错误（仅在补全时忽略错误继续编译）
+	if _, ok := value.Kind.current.(*TFunc); !ok {
+		return
+	}
+	fn := value.module.code.Functions[value.Ptr]
+	m.compileFuncBody(fn, node.Kind, value.Kind.current.(*TFunc), target, node.Body)
+}
+
+// 编译函数体，self 及参数依次占用前面的局部变量槽位
+func (m *Module) compileFuncBody(fn *bytecode.Function, kindExpr *ast.KindExpr, funcKind *TFunc, target *KindRef, body *ast.Stmt) {
+	fn.Arity = len(funcKind.Arguments)
+	fn.HasRest = funcKind.HasRest
+	m.beginFunc(fn).kind = funcKind
 
 	// compile func argument
 	m.scopes.push()
-	for i, arg := range funcKindNode.Arguments {
+	if target != nil {
+		m.scopes.putSelfKind(target)
+		m.scopes.putSelfValue(&SelfValue{Kind: target, Ptr: m.addLocal(), fn: m.fn})
+	}
+	for i, arg := range kindExpr.Node.(*ast.TFuncKind).Arguments {
 		argValue := &VarValue{
-			Name:  name.Name,
-			Kind:  argKinds[i],
-			Const: false,
-			Ptr:   0, // TODO ptr
+			Name:   arg.Name.Name,
+			Kind:   funcKind.Arguments[i],
+			Const:  false,
+			Ptr:    m.addLocal(),
+			module: m,
+			fn:     m.fn,
 		}
 		m.scopes.putValue(arg.Name, argValue, true)
+		m.recordDef(arg.Name, argValue)
 	}
 
 	// compile func body
-	body := node.Body.Node.(*ast.BlockStmt)
-	m.compileBlockStmt(body)
+	m.compileBlockStmt(body.Node.(*ast.BlockStmt))
 	m.scopes.pop()
+
+	end := *ast.NewPosition(body.End-1, body.End)
+	if !isVoidKind(funcKind.Return) && !isTerminating(body) {
+		m.unexpectedAt(end, "missing return at the end of function")
+	}
+	m.mark(end)
+	m.endFunc()
 }
 
 func (m *Module) compileImplDecl(node *ast.ImplDecl, onlyFuncSign bool) {
 	target := m.compileKindExpr(node.Target)
+	m.compiler.Info.Impls[node] = target
 
 	// 编译 impl 函数签名
 	if onlyFuncSign {
@@ -199,22 +250,31 @@ func (m *Module) compileImplDecl(node *ast.ImplDecl, onlyFuncSign bool) {
 
 		switch target.current.(type) {
 		case *TInterface:
-			m.unexpectedPos(node.Target.Start, "cannot implements for `interface` type")
+			m.unexpectedAt(node.Target.Position, "cannot implements for `interface` type")
 		case *TAny:
-			m.unexpectedPos(node.Target.Start, "cannot implements for `any` type")
+			m.unexpectedAt(node.Target.Position, "cannot implements for `any` type")
 		case *TSelf:
-			m.unexpectedPos(node.Target.Start, "cannot implements for `self` type")
+			m.unexpectedAt(node.Target.Position, "cannot implements for `self` type")
 		}
 
 		implValues := make(map[string]*FuncValue)
 		implDecls := make(map[string]*ast.Stmt)
+		impl := &bytecode.Impl{
+			Kind:    m.compiler.runtimeKind(target),
+			Methods: make([]*bytecode.Method, 0, helper.DefaultCap),
+		}
 		for _, stmt := range node.Body.Node.(*ast.BlockStmt).Body {
 			funcNode := stmt.Node.(*ast.FuncDecl)
 			value := m.compileFuncSign(funcNode, target, true)
 			value = m.compileFuncSign(funcNode, target, false)
 			implValues[value.Name] = value
 			implDecls[value.Name] = stmt
+			impl.Methods = append(impl.Methods, &bytecode.Method{
+				Name: value.Name,
+				Func: bytecode.FuncRef{Module: m.code.Index, Index: value.Ptr},
+			})
 		}
+		m.code.Impls = append(m.code.Impls, impl)
 
 		if node.Interface != nil {
 			interfaceKind := m.compileKindExpr(node.Interface)
@@ -224,7 +284,7 @@ func (m *Module) compileImplDecl(node *ast.ImplDecl, onlyFuncSign bool) {
 				interfaceName := getKindExprString(node.Interface)
 				for key, interfaceDeclKind := range t.Properties {
 					if implValues[key] == nil {
-						m.unexpectedPos(node.Body.Start, fmt.Sprintf("no implement method: %s.%s", interfaceName, key))
+						m.unexpectedAt(node.Body.Position, fmt.Sprintf("no implement method: %s.%s", interfaceName, key))
 					}
 					if !matchKind(interfaceDeclKind, implValues[key].Kind, true) {
 						funcNode := implDecls[key].Node.(*ast.FuncDecl)
@@ -233,16 +293,16 @@ func (m *Module) compileImplDecl(node *ast.ImplDecl, onlyFuncSign bool) {
 				}
 			} else {
 				if t == nil {
-					m.unexpectedPos(node.Interface.Start, "cannot found: "+getKindExprString(node.Interface))
+					m.unexpectedAt(node.Interface.Position, "cannot found: "+getKindExprString(node.Interface))
 				}
-				m.unexpectedPos(node.Interface.Start, "expect be an interface type")
+				m.unexpectedAt(node.Interface.Position, "expect be an interface type")
 			}
 		}
 		m.scopes.pop()
 	} else {
 		// 编译 impl 函数
 		for _, stmt := range node.Body.Node.(*ast.BlockStmt).Body {
-			m.compileFuncDecl(stmt.Node.(*ast.FuncDecl), target)
+			m.recoverDecl(func() { m.compileFuncDecl(stmt.Node.(*ast.FuncDecl), target) })
 		}
 	}
 
@@ -252,71 +312,360 @@ func (m *Module) compileVarDecl(node *ast.VarDecl, isPrecompile bool) {
 	name := node.Id
 	if isPrecompile {
 		if name.Name == "self" {
-			m.unexpectedPos(name.Start, "identifier 'self' is not allowed")
+			m.unexpectedAt(name.Position, "identifier 'self' is not allowed")
 		}
 		scope := &VarValue{
-			Name:  name.Name,
-			Kind:  newKindRef(m, -1),
-			Const: node.Const,
+			Name:   name.Name,
+			Kind:   newKindRef(m, -1),
+			Const:  node.Const,
+			Ptr:    m.code.AddGlobal(name.Name),
+			Global: true,
+			init:   node.Init,
+			module: m,
 		}
 		m.scopes.putValue(name, scope, true)
+		m.recordDef(name, scope)
 		if node.Pub {
 			m.exports.setValue(name.Name, scope)
 		}
 		return
 	}
 
-	value := m.scopes.findVarValue(name, true)
+	// 顶层作用域的变量已经预编译，局部变量在初始化之后才放入作用域
+	var value *VarValue
+	isGlobal := m.scopes.isTopLevel()
+	if isGlobal {
+		value = m.scopes.findVarValue(name, true)
+	} else {
+		if name.Name == "self" {
+			m.unexpectedAt(name.Position, "identifier 'self' is not allowed")
+		}
+		value = &VarValue{
+			Name:   name.Name,
+			Kind:   newKindRef(m, -1),
+			Const:  node.Const,
+			init:   node.Init,
+			module: m,
+			fn:     m.fn,
+		}
+	}
 
 	// 变量类型
+	// 变量类型：声明了类型时作为初始值的期望类型，否则由初始值推断
 	var kind *KindRef
 	if node.Kind != nil {
 		kind = m.compileKindExpr(node.Kind)
-	}
-	if node.Init != nil {
+	} else if node.Init != nil {
 		inferKind, err := m.inferKind(node.Init)
 		if err != nil {
-			m.unexpectedPos(node.Init.Start, err.Error())
-		} else if kind == nil {
-			kind = inferKind
+			m.unexpectedAt(node.Init.Position, err.Error())
 		}
-
-		// TODO maybe assign
-
-		value.Ptr = 0 // TODO ptr
+		kind = inferKind
 	}
 
 	if kind == nil {
-		m.unexpectedPos(node.Id.Start, "cannot infer variable type")
+		m.unexpectedAt(node.Id.Position, "cannot infer variable type")
 	}
 	value.Kind.current = kind.current
+
+	if node.Init != nil {
+		m.compileValue(node.Init, kind)
+	} else {
+		m.emitDefault(kind)
+	}
+	if !isGlobal {
+		value.Ptr = m.addLocal()
+		m.scopes.putValue(name, value, true)
+		m.recordDef(name, value)
+	}
+	m.mark(name.Position)
+	m.emitStoreValue(value, name.Position)
+	m.emit(bytecode.OpPop)
 }
 
 func (m *Module) compileBlockStmt(node *ast.BlockStmt) {
 	m.scopes.push()
 	for _, stmt := range node.Body {
-		m.compileStmt(stmt)
+		m.tolerate(func() { m.compileStmt(stmt) })
 	}
 	m.scopes.pop()
 }
 
-func (m *Module) compileReturnStmt(node *ast.ReturnStmt) {
+func (m *Module) compileReturnStmt(node *ast.ReturnStmt, pos ast.Position) {
+	if m.fn.isInit {
+		m.unexpectedAt(pos, "`return` outside of a function")
+	}
+
+	ret := m.fn.kind.Return
+	if node.Argument != nil {
+		if isVoidKind(ret) {
+			m.unexpectedAt(node.Argument.Position, "unexpected return value in function without return type")
+		}
+		m.compileValue(node.Argument, ret)
+	} else {
+		if !isVoidKind(ret) {
+			m.unexpectedAt(pos, "missing return value, expect "+m.kindString(ret))
+		}
+		m.emit(bytecode.OpNull)
+	}
+	m.emit(bytecode.OpReturn)
 }
 
 func (m *Module) compileExprStmt(node *ast.ExprStmt) {
 	m.compileExpr(node.Expression)
+	m.emit(bytecode.OpPop)
 }
 
 func (m *Module) compileIfStmt(node *ast.IfStmt) {
+	m.compileCondition(node.Condition)
+	elseJump := m.emitJump(bytecode.OpJumpIfFalse)
+	m.compileNarrowed(node.Consequent, m.narrowings(node.Condition, true))
+
+	if node.Alternate != nil {
+		endJump := m.emitJump(bytecode.OpJump)
+		m.patchJump(elseJump)
+		m.compileNarrowed(node.Alternate, m.narrowings(node.Condition, false))
+		m.patchJump(endJump)
+	} else {
+		m.patchJump(elseJump)
+	}
+
+	// 一个分支提前跳出时，后续的语句只会在另一个分支之后执行
+	var narrowed map[Value]*KindRef
+	if isJumping(node.Consequent) {
+		narrowed = m.narrowings(node.Condition, false)
+	} else if node.Alternate != nil && isJumping(node.Alternate) {
+		narrowed = m.narrowings(node.Condition, true)
+	}
+	for value, kind := range narrowed {
+		m.scopes.narrow(value, kind)
+	}
+}
+
+// 在收窄变量类型的作用域中编译语句
+func (m *Module) compileNarrowed(stmt *ast.Stmt, narrowed map[Value]*KindRef) {
+	m.scopes.push()
+	for value, kind := range narrowed {
+		m.scopes.narrow(value, kind)
+	}
+	m.compileStmt(stmt)
+	m.scopes.pop()
+}
+
+// 条件的值为 truthy 时可以收窄的局部变量类型，支持 `x is T`、`!cond` 及 `&&`、`||` 组合的条件，
+// 只有目标类型可以用作变量原本的类型时（如 any、接口、父结构体）才收窄
+func (m *Module) narrowings(cond *ast.Expr, truthy bool) map[Value]*KindRef {
+	result := make(map[Value]*KindRef)
+
+	switch cond.Node.(type) {
+	case *ast.BinaryTypeExpr:
+		node := cond.Node.(*ast.BinaryTypeExpr)
+		id, ok := node.Left.Node.(*ast.IdentifierLiteral)
+		if node.Operator.Value != "is" || !truthy || !ok {
+			break
+		}
+		v, ok := m.scopes.findValue(id.Name, false).(*VarValue)
+		if !ok || v.Global {
+			break
+		}
+		kind := m.tryInferKind(node.Left)
+		target := m.compileKindExpr(node.Right)
+		if kind != nil && assignableKind(kind, target) {
+			result[v] = target
+		}
+	case *ast.UnaryExpr:
+		node := cond.Node.(*ast.UnaryExpr)
+		if node.Operator.Value == "!" {
+			return m.narrowings(node.Argument, !truthy)
+		}
+	case *ast.BinaryExpr:
+		node := cond.Node.(*ast.BinaryExpr)
+		if (node.Operator.Value == "&&" && truthy) || (node.Operator.Value == "||" && !truthy) {
+			for _, narrowed := range []map[Value]*KindRef{m.narrowings(node.Left, truthy), m.narrowings(node.Right, truthy)} {
+				for value, kind := range narrowed {
+					result[value] = kind
+				}
+			}
+		}
+	}
+	return result
+}
+
+// 变量重新赋值后不再收窄
+func (m *Module) clearNarrowed(target *ast.Expr) {
+	if id, ok := target.Node.(*ast.IdentifierLiteral); ok {
+		if value := m.scopes.findValue(id.Name, false); value != nil {
+			m.scopes.clearNarrowed(value)
+		}
+	}
 }
 
 func (m *Module) compileForStmt(node *ast.ForStmt) {
+	if node.Label != nil {
+		for _, item := range m.fn.loops {
+			if item.label != nil && item.label.Name == node.Label.Name {
+				m.unexpectedAt(node.Label.Position, "label has already been declared: "+node.Label.Name)
+			}
+		}
+	}
+
+	// 循环体会多次执行，循环中重新赋值的变量在整个循环中都不再收窄
+	for _, expr := range []*ast.Expr{node.Test, node.Update} {
+		if expr != nil {
+			findAssignedExpr(expr, m.clearNarrowed)
+		}
+	}
+	findAssigned(node.Body, m.clearNarrowed)
+
+	// push scope : 用于存放循环变量
+	m.scopes.push()
+	loop := &loopState{label: node.Label}
+
+	if node.EachVisitor != nil {
+		m.compileEachLoop(node, loop)
+	} else {
+		if node.Init != nil {
+			m.compileStmt(node.Init)
+		}
+
+		start := m.offset()
+		exitJump := -1
+		if node.Test != nil {
+			m.compileCondition(node.Test)
+			exitJump = m.emitJump(bytecode.OpJumpIfFalse)
+		}
+
+		m.compileLoopBody(loop, node.Body)
+		if node.Update != nil {
+			m.compileExpr(node.Update)
+			m.emit(bytecode.OpPop)
+		}
+		m.emitLoop(start)
+
+		if exitJump >= 0 {
+			m.patchJump(exitJump)
+		}
+	}
+
+	for _, offset := range loop.breaks {
+		m.patchJump(offset)
+	}
+	m.scopes.pop()
 }
 
-func (m *Module) compileBreakStmt(node *ast.BreakStmt) {
+// 编译 `for item, index: target {}`，使用两个隐藏的局部变量保存数组及当前索引
+func (m *Module) compileEachLoop(node *ast.ForStmt, loop *loopState) {
+	visitor := node.EachVisitor
+
+	// 数组的元素为数组元素的类型，字符串的元素为 char
+	itemKind := newKindRef(m, -1)
+	itemKind.current = typeAny
+	if kind := m.tryInferKind(visitor.Target); kind != nil {
+		switch getUnderlyingKind(kind).current.(type) {
+		case *TArray:
+			if t := getUnderlyingKind(kind).current.(*TArray); t.Kind != nil {
+				itemKind = t.Kind
+			}
+		case *TString:
+			itemKind.current = typeChar
+		case *TAny:
+		default:
+			m.unexpectedAt(visitor.Target.Position, "cannot iterate over a value of type "+m.kindString(kind))
+		}
+	}
+
+	m.compileExpr(visitor.Target)
+	target := m.addLocal()
+	m.emit(bytecode.OpSetLocal, target)
+	m.emit(bytecode.OpPop)
+
+	index := m.addLocal()
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.NumberConstant(0)))
+	m.emit(bytecode.OpSetLocal, index)
+	m.emit(bytecode.OpPop)
+
+	// index < len(target)
+	start := m.offset()
+	m.emit(bytecode.OpGetLocal, index)
+	m.emit(bytecode.OpGetLocal, target)
+	m.emit(bytecode.OpLen)
+	m.emit(bytecode.OpLt)
+	exitJump := m.emitJump(bytecode.OpJumpIfFalse)
+
+	// item = target[index]
+	item := &VarValue{
+		Name:   visitor.Value.Name,
+		Kind:   itemKind,
+		Ptr:    m.addLocal(),
+		module: m,
+		fn:     m.fn,
+	}
+	m.scopes.putValue(visitor.Value, item, true)
+	m.recordDef(visitor.Value, item)
+	m.emit(bytecode.OpGetLocal, target)
+	m.emit(bytecode.OpGetLocal, index)
+	m.emit(bytecode.OpGetIndex)
+	m.emit(bytecode.OpSetLocal, item.Ptr)
+	m.emit(bytecode.OpPop)
+
+	if visitor.Key != nil {
+		keyKind := newKindRef(m, -1)
+		keyKind.current = typeNumber
+		key := &VarValue{
+			Name:   visitor.Key.Name,
+			Kind:   keyKind,
+			Ptr:    m.addLocal(),
+			module: m,
+			fn:     m.fn,
+		}
+		m.scopes.putValue(visitor.Key, key, true)
+		m.recordDef(visitor.Key, key)
+		m.emit(bytecode.OpGetLocal, index)
+		m.emit(bytecode.OpSetLocal, key.Ptr)
+		m.emit(bytecode.OpPop)
+	}
+
+	m.compileLoopBody(loop, node.Body)
+
+	// index++
+	m.emit(bytecode.OpGetLocal, index)
+	m.emit(bytecode.OpConst, m.addConstant(bytecode.NumberConstant(1)))
+	m.emit(bytecode.OpAdd)
+	m.emit(bytecode.OpSetLocal, index)
+	m.emit(bytecode.OpPop)
+	m.emitLoop(start)
+
+	m.patchJump(exitJump)
 }
 
-func (m *Module) compileContinueStmt(node *ast.ContinueStmt) {
+// 编译循环体，`continue` 跳转到循环体之后
+func (m *Module) compileLoopBody(loop *loopState, body *ast.Stmt) {
+	m.fn.loops = append(m.fn.loops, loop)
+	m.compileStmt(body)
+	m.fn.loops = m.fn.loops[:len(m.fn.loops)-1]
+
+	for _, offset := range loop.continues {
+		m.patchJump(offset)
+	}
+}
+
+// 编译条件表达式，条件必须为 bool
+func (m *Module) compileCondition(expr *ast.Expr) {
+	m.compileExpr(expr)
+	kind := m.tryInferKind(expr)
+	if kind != nil && !isVoidKind(kind) && getUnderlyingKind(kind).current != typeBool && getUnderlyingKind(kind).current != typeAny {
+		m.unexpectedAt(expr.Position, "expect a bool condition, but got "+m.kindString(kind))
+	}
+}
+
+func (m *Module) compileBreakStmt(node *ast.BreakStmt, pos ast.Position) {
+	loop := m.findLoop(node.Label, pos, "break")
+	loop.breaks = append(loop.breaks, m.emitJump(bytecode.OpJump))
+}
+
+func (m *Module) compileContinueStmt(node *ast.ContinueStmt, pos ast.Position) {
+	loop := m.findLoop(node.Label, pos, "continue")
+	loop.continues = append(loop.continues, m.emitJump(bytecode.OpJump))
 }
 
 /* type decl */
@@ -324,9 +673,11 @@ func (m *Module) compileContinueStmt(node *ast.ContinueStmt) {
 func (m *Module) processKindDecl(initKind *KindRef, name *ast.Identifier, pub bool, isPrecompile bool) *KindRef {
 	if isPrecompile {
 		if name.Name == "self" {
-			m.unexpectedPos(name.Start, "identifier 'self' is not allowed")
+			m.unexpectedAt(name.Position, "identifier 'self' is not allowed")
 		}
+		initKind.name = name.Name
 		m.scopes.putKind(name, initKind, true)
+		m.recordRef(name, m.compiler.kindSymbol(initKind), true)
 		if pub {
 			m.exports.setKind(name.Name, initKind)
 		}
@@ -335,6 +686,11 @@ func (m *Module) processKindDecl(initKind *KindRef, name *ast.Identifier, pub bo
 	return m.scopes.findIdentifierKind(name, true)
 }
 
+// 记录具名类型的声明，用于生成运行时类型
+func (m *Module) declareKind(kind *KindRef) {
+	m.compiler.kindDecls[kind.current] = kind
+}
+
 func (m *Module) compileTTypeDecl(node *ast.TTypeDecl, isPrecompile bool) {
 	initKind := newKindRef(m, -1)
 	initKind.current = &TCustom{}
@@ -347,6 +703,7 @@ func (m *Module) compileTTypeDecl(node *ast.TTypeDecl, isPrecompile bool) {
 		Kind: m.compileKindExpr(node.Kind),
 		Impl: newImpl(),
 	}
+	m.declareKind(kind)
 }
 
 func (m *Module) compileTInterfaceDecl(node *ast.TInterfaceDecl, isPrecompile bool) {
@@ -361,6 +718,7 @@ func (m *Module) compileTInterfaceDecl(node *ast.TInterfaceDecl, isPrecompile bo
 		Properties: make(map[string]*KindRef),
 	}
 	kind.current = _type
+	m.declareKind(kind)
 
 	// push scope : 用于存放 self 指向
 	m.scopes.push()
@@ -370,11 +728,12 @@ func (m *Module) compileTInterfaceDecl(node *ast.TInterfaceDecl, isPrecompile bo
 		key := pair.Key.Name
 		_, has := _type.Properties[key]
 		if has {
-			m.unexpectedPos(pair.Key.Start, "duplicate key: "+key)
+			m.unexpectedAt(pair.Key.Position, "duplicate key: "+key)
 		} else if key[0] == '_' {
-			m.unexpectedPos(pair.Key.Start, "should not be private method: "+key)
+			m.unexpectedAt(pair.Key.Position, "should not be private method: "+key)
 		}
 		_type.Properties[key] = m.compileKindExpr(pair.Kind)
+		m.recordRef(pair.Key, m.compiler.memberSymbol(kind, key, SymbolMethod), true)
 	}
 
 	m.scopes.pop()
@@ -391,6 +750,7 @@ func (m *Module) compileTStructDecl(node *ast.TStructDecl, isPrecompile bool) {
 	result := m.compileStructKind(kind, node.Kind)
 	kind.current = result.current
 	kind.refs = result.refs
+	m.declareKind(kind)
 }
 
 func (m *Module) compileTEnumDecl(node *ast.TEnumDecl, isPrecompile bool) {
@@ -407,7 +767,7 @@ func (m *Module) compileTEnumDecl(node *ast.TEnumDecl, isPrecompile bool) {
 		name := item.Name
 		_, has := choices[name]
 		if has {
-			m.unexpectedPos(item.Start, "duplicate item: "+name)
+			m.unexpectedAt(item.Position, "duplicate item: "+name)
 		}
 		choices[name] = i
 	}
@@ -415,4 +775,9 @@ func (m *Module) compileTEnumDecl(node *ast.TEnumDecl, isPrecompile bool) {
 	kind.current = &TEnum{
 		Choices: choices,
 	}
+	m.declareKind(kind)
+
+	for _, item := range node.Choices {
+		m.recordRef(item, m.compiler.memberSymbol(kind, item.Name, SymbolChoice), true)
+	}
 }
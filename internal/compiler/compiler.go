@@ -1,36 +1,111 @@
 package compiler
 
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+)
+
 /* compiler */
 
+// DefaultEntry 默认的入口模块
+const DefaultEntry = "main"
+
 type Compiler struct {
-	Main      *Module
-	Modules   ModuleMap
-	VirtualFS *VirtualFS
+	Main        *Module
+	Entry       string // 入口模块 id，默认为 `main`
+	Modules     ModuleMap
+	VirtualFS   *VirtualFS
+	Diagnostics []*diagnostic.Diagnostic
+	Program     *bytecode.Program       // 编译产物（仅在编译成功时可用）
+	Info        *Info                   // 类型检查的结果
+	kindDecls   map[Kind]*KindRef       // 具名类型的声明
+	symbols     map[interface{}]*Symbol // 声明对应的符号，键为值、模块、类型或类型成员
+	cursor      *cursor                 // 补全的光标位置，不为 nil 时忽略语法错误继续编译
+}
+
+// 记录诊断信息，预编译及编译阶段重复报告的相同错误只记录一次
+func (c *Compiler) addDiagnostic(d *diagnostic.Diagnostic) {
+	for _, item := range c.Diagnostics {
+		if item.ModuleId == d.ModuleId && item.Start == d.Start && item.Message == d.Message {
+			return
+		}
+	}
+	c.Diagnostics = append(c.Diagnostics, d)
 }
 
+// 中止编译的信号（诊断信息已记录）
+type abortSignal struct{}
+
 func NewCompiler(root string, isFileSystem bool) *Compiler {
 	virtualFS := newVirtualFS(root, isFileSystem)
 	return &Compiler{
+		Entry:     DefaultEntry,
 		Modules:   make(ModuleMap),
 		VirtualFS: virtualFS,
+		Program:   bytecode.NewProgram(),
+		Info:      newInfo(),
+		kindDecls: make(map[Kind]*KindRef),
+		symbols:   make(map[interface{}]*Symbol),
 	}
 }
 
-func (c *Compiler) Compile() *Compiler {
-	module, err := NewModule(c).resolve("main")
-	if err != nil {
-		panic(err)
-	}
+// Compile 编译入口模块及其依赖的模块，返回编译过程中产生的诊断信息
+func (c *Compiler) Compile() []*diagnostic.Diagnostic {
+	c.catch(func() {
+		module, err := NewModule(c).resolve(c.Entry)
+		if err != nil {
+			d := diagnostic.New(diagnostic.CodeModule, nil, ast.Position{}, err.Error())
+			d.ModuleId = c.Entry
+			panic(d)
+		}
 
-	err = module.parse()
-	if err != nil {
-		panic(err)
-	}
+		c.Main = module
+		c.Program.Entry = module.code.Index
+		err = module.parse()
+		// 补全时继续编译存在语法错误的模块
+		if err == errSyntax {
+			if c.cursor == nil {
+				c.abort()
+			}
+		} else if err != nil {
+			d := diagnostic.New(diagnostic.CodeModule, nil, ast.Position{}, err.Error())
+			d.ModuleId = c.Entry
+			panic(d)
+		}
+
+		c.Main.precompile()
+		c.Main.compile()
+	})
+
+	return c.Diagnostics
+}
+
+// HasError 判断编译结果是否存在错误
+func (c *Compiler) HasError() bool {
+	return diagnostic.HasError(c.Diagnostics)
+}
+
+// 执行编译函数并捕获抛出的诊断信息
+func (c *Compiler) catch(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case *diagnostic.Diagnostic:
+				c.addDiagnostic(r.(*diagnostic.Diagnostic))
+			case abortSignal:
+			default:
+				panic(r)
+			}
+		}
+	}()
+
+	fn()
+}
 
-	c.Main = module
-	c.Main.precompile()
-	c.Main.compile()
-	return c
+// 中止编译
+func (c *Compiler) abort() {
+	panic(abortSignal{})
 }
 
 /* module map */
@@ -0,0 +1,951 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 使用虚拟文件系统编译项目
+func compileFiles(files map[string]string) *Compiler {
+	c := NewCompiler("", false)
+	for name, code := range files {
+		_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, name), []byte(code))
+	}
+	c.Compile()
+	return c
+}
+
+func TestCompileDiagnostics(t *testing.T) {
+	c := compileFiles(map[string]string{})
+	assert.Len(t, c.Diagnostics, 1)
+	assert.Equal(t, diagnostic.CodeModule, c.Diagnostics[0].Code)
+
+	c = compileFiles(map[string]string{
+		"main.noah": "let a = 1\nlet b: Foo\n",
+	})
+	assert.Len(t, c.Diagnostics, 1)
+	d := c.Diagnostics[0]
+	assert.Equal(t, "main", d.ModuleId)
+	assert.Equal(t, diagnostic.CodeUndefined, d.Code)
+	assert.Equal(t, 2, d.Line)
+	assert.Equal(t, 8, d.Column)
+	assert.Equal(t, "Foo", string(c.Main.Source()[d.Start:d.End]))
+
+	c = compileFiles(map[string]string{
+		"main.noah":      "import lib.foo\n",
+		"lib/foo.noah":   "let a = )",
+		"lib/other.noah": "",
+	})
+	assert.Len(t, c.Diagnostics, 1)
+	assert.Equal(t, "lib.foo", c.Diagnostics[0].ModuleId)
+	assert.Equal(t, diagnostic.CodeSyntax, c.Diagnostics[0].Code)
+
+	// 每个声明中的第一个错误都会被报告
+	c = compileFiles(map[string]string{
+		"main.noah": "let a: Foo = 1\nlet b = a + 1\nfn f() {\n    let x: number = \"a\"\n    let y: string = 1\n}\n" +
+			"fn g() -> number {\n    return \"b\"\n}\nfn main() {\n    f()\n    println(-\"a\")\n}\n",
+	})
+	messages := make([]string, 0, len(c.Diagnostics))
+	for _, d := range c.Diagnostics {
+		messages = append(messages, fmt.Sprintf("%d: %s", d.Line, d.Message))
+	}
+	assert.Equal(t, []string{
+		"1: Foo is not found",
+		"4: cannot use string as number",
+		"8: cannot use string as number",
+		"12: invalid operation: operator - not defined on string",
+	}, messages)
+
+	c = compileFiles(map[string]string{
+		"main.noah": "import lib.bar\n",
+	})
+	assert.Len(t, c.Diagnostics, 1)
+	assert.Equal(t, diagnostic.CodeModule, c.Diagnostics[0].Code)
+	assert.Equal(t, 1, c.Diagnostics[0].Line)
+	assert.Equal(t, 8, c.Diagnostics[0].Column)
+}
+
+// 模块中的函数名称
+func functionNames(module *bytecode.Module) []string {
+	names := make([]string, 0, len(module.Functions))
+	for _, fn := range module.Functions {
+		names = append(names, fn.Name)
+	}
+	return names
+}
+
+func TestCompileProgram(t *testing.T) {
+	c := NewCompiler("../../examples/simple", true)
+	c.Compile()
+	assert.Empty(t, c.Diagnostics)
+
+	program := c.Program
+	assert.Len(t, program.Modules, 3)
+	assert.Equal(t, "main", program.Modules[program.Entry].Name)
+
+	main := program.FindModule("main")
+	assert.Equal(t, []string{"main", "Person.name2"}, functionNames(main))
+	assert.Equal(t, -1, main.Init)
+	assert.Len(t, main.Impls, 1)
+	assert.Equal(t, "Person", main.Impls[0].Kind.Name)
+	assert.Equal(t, program.FindModule("other.foo").Index, main.Impls[0].Kind.Module)
+
+	bar := program.FindModule("other.bar")
+	assert.Equal(t, []string{"say", "<init>"}, functionNames(bar))
+	assert.Equal(t, 1, bar.Init)
+	assert.Equal(t, bytecode.ExportFunc, bar.FindExport("say").Type)
+	assert.Nil(t, bar.FindExport("n1"))
+
+	foo := program.FindModule("other.foo")
+	assert.Equal(t, []string{"Person.name", "<init>"}, functionNames(foo))
+	assert.Equal(t, []string{"abc", "PI"}, foo.Globals)
+}
+
+func TestProgramFileRoundTrip(t *testing.T) {
+	for _, root := range []string{"../../examples/simple", "../../examples/some"} {
+		c := NewCompiler(root, true)
+		c.Compile()
+		assert.False(t, c.HasError(), root)
+
+		loaded, err := bytecode.Load(c.Program.Marshal())
+		if assert.NoError(t, err, root) {
+			assert.Equal(t, c.Program.Disassemble(), loaded.Disassemble(), root)
+			assert.Equal(t, c.Program.Marshal(), loaded.Marshal(), root)
+		}
+	}
+}
+
+func TestCompileStmtBytecode(t *testing.T) {
+	c := compileFiles(map[string]string{
+		"main.noah": `fn main() -> number {
+    let n = 0
+    loop: for let i = 0; i < 10; i++ {
+        if i == 5 {
+            break loop
+        }
+        n += i
+    }
+    return n
+}`,
+	})
+	assert.Empty(t, c.Diagnostics)
+
+	expected := `  0000     2:13 OpConst        0 ; 0
+  0003      2:9 OpSetLocal     0
+  0006        | OpPop
+  0007     3:23 OpConst        0 ; 0
+  0010     3:19 OpSetLocal     1
+  0013        | OpPop
+  0014     3:26 OpGetLocal     1
+  0017     3:30 OpConst        1 ; 10
+  0020     3:28 OpLt
+  0021        | OpJumpIfFalse  66
+  0024     4:12 OpGetLocal     1
+  0027     4:17 OpConst        2 ; 5
+  0030     4:14 OpEq
+  0031        | OpJumpIfFalse  37
+  0034     5:13 OpJump         66
+  0037      7:9 OpGetLocal     0
+  0040     7:14 OpGetLocal     1
+  0043     7:11 OpAdd
+  0044      7:9 OpSetLocal     0
+  0047        | OpPop
+  0048     3:34 OpGetLocal     1
+  0051        | OpConst        3 ; 1
+  0054        | OpAdd
+  0055        | OpSetLocal     1
+  0058        | OpConst        3 ; 1
+  0061        | OpSub
+  0062        | OpPop
+  0063        | OpJump         14
+  0066     9:12 OpGetLocal     0
+  0069        | OpReturn
+  0070     10:1 OpNull
+  0071        | OpReturn
+`
+	main := c.Program.Modules[0]
+	assert.Equal(t, expected, main.Functions[0].Disassemble(main))
+}
+
+func TestCompileStmtErrors(t *testing.T) {
+	cases := map[string]string{
+		"fn main() { break }":                          "`break` outside of a loop",
+		"fn main() { for { continue a } }":             "undefined label: a",
+		"fn main() { a: for { a: for {} } }":           "label has already been declared: a",
+		"fn main() { let a = 1\n let f = fn() { a } }": "cannot capture local variable of enclosing function: a",
+		"return 1": "`return` outside of a function",
+		"enum Color { Red }\nfn main() { let c = Color.Blue }":      "no enum choice: Blue",
+		"enum Color { Red }\nfn main() { let c = Color }":           "not a value: Color",
+		"struct A { a: number }\nfn main() { let a: A = { b: 1 } }": "unknown field: b",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": code})
+		if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestCompileCallErrors(t *testing.T) {
+	c := compileFiles(map[string]string{"main.noah": `
+struct Point {
+    x: number
+}
+
+struct Point3 <- Point {
+    z: number
+}
+
+fn add(...nums: []number) -> number {
+    let sum = 0
+    for (n: nums) {
+        sum += n
+    }
+    return sum
+}
+
+fn getX(p: Point) -> number {
+    return p.x
+}
+
+fn main() -> number {
+    return add(1, 2) + add(10, 20, 30) + add() + getX(Point3 { x: 1, z: 2 }) + getX(null)
+}`})
+	assert.Empty(t, c.Diagnostics)
+
+	decls := "fn one(a: number) {}\nfn rest(a: string, ...b: []number) {}\nlet n = 1\n"
+	cases := map[string]string{
+		"fn add(...nums: []number) {}\nfn main() { add(\"x\") }": "cannot use string as number",
+		"fn main() { one() }":                             "expect 1 argument(s), but got 0",
+		"fn main() { one(1, 2) }":                         "expect 1 argument(s), but got 2",
+		"fn main() { one(true) }":                         "cannot use bool as number",
+		"fn main() { one(null) }":                         "cannot use null as number",
+		"fn main() { rest() }":                            "expect at least 1 argument(s), but got 0",
+		"fn main() { rest(\"a\", 1, 'c') }":               "cannot use char as number",
+		"fn main() { n() }":                               "not a function",
+		"fn f(a: []string) {}\nfn main() { f([1]) }":      "cannot use number as string",
+		"fn f(g: fn(a: number)) {}\nfn main() { f(one) }": "",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	// 重复生成代码片段
+	repeat := func(n int, f func(i int) string) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(f(i))
+		}
+		return b.String()
+	}
+	args := func(n int) string {
+		return strings.TrimSuffix(repeat(n, func(int) string { return "1," }), ",")
+	}
+
+	cases := map[string]string{
+		"fn add(...nums: []number) {}\nfn main() { add(" + args(255) + ") }":                                                "",
+		"fn add(...nums: []number) {}\nfn main() { add(" + args(256) + ") }":                                                "too many arguments in call: 256 (max 255)",
+		"fn main() {\n" + repeat(65535, func(i int) string { return fmt.Sprintf("println(%d)\n", i) }) + "}":                "",
+		"fn main() {\n" + repeat(65537, func(i int) string { return fmt.Sprintf("println(%d)\n", i) }) + "}":                "too many constants in module: exceeds 65536",
+		"fn main() {\nif (false) {\n" + repeat(15000, func(int) string { return "println(1)\n" }) + "}\n}":                  "function is too large: jump target 135004 exceeds 65535",
+		"fn main() {\nfor (let i = 0; i < 1; i++) {\n" + repeat(15000, func(int) string { return "println(1)\n" }) + "}\n}": "function is too large: jump target 135035 exceeds 65535",
+		"fn main() {\n" + repeat(8000, func(int) string { return "println(1)\n" }) + "for (let i = 0; i < 1; i++) {}\n}":    "function is too large: jump target 72007 exceeds 65535",
+		"fn main() {\n" + repeat(65537, func(i int) string { return fmt.Sprintf("let a%d = 0\n", i) }) + "}":                "too many local variables in function: exceeds 65536",
+		"fn main() {\nlet a = [" + args(65536) + "]\n}":                                                                     "too many array items: 65536 (max 65535)",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, message)
+		} else if assert.Len(t, c.Diagnostics, 1, message) {
+			assert.Equal(t, message, c.Diagnostics[0].Message)
+		}
+	}
+}
+
+func TestCompileStmtTypeErrors(t *testing.T) {
+	cases := map[string]string{
+		"fn main() { if (1) {} }":                                              "expect a bool condition, but got number",
+		"fn main() { for (let i = 0; \"a\"; i++) {} }":                         "expect a bool condition, but got string",
+		"fn main() { let a: any = 1\n if (a) {} }":                             "",
+		"fn f() -> number { return \"a\" }":                                    "cannot use string as number",
+		"fn f() -> number {\n return\n}":                                       "missing return value, expect number",
+		"fn f() { return 1 }":                                                  "unexpected return value in function without return type",
+		"fn f() -> string { return null }":                                     "cannot use null as string",
+		"fn f(a: bool) -> number { if (a) { return 1 } }":                      "missing return at the end of function",
+		"fn f(a: bool) -> number { if (a) { return 1 } else { return 2 } }":    "",
+		"fn f() -> number { for { break } }":                                   "missing return at the end of function",
+		"fn f() -> number { a: for { for { break a } } }":                      "missing return at the end of function",
+		"fn f() -> number { for { for { break } } }":                           "",
+		"fn f() -> number { let g = fn() -> bool { return true }\n return 1 }": "",
+		"fn main() { for (c: \"abc\") { let d: char = c } }":                   "",
+		"fn f() -> string { for (c: \"abc\") { return c }\n return \"\" }":     "cannot use char as string",
+		"fn main() { for (c: 1) {} }":                                          "cannot iterate over a value of type number",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestCompileAssignErrors(t *testing.T) {
+	decls := "struct P { x: number, s: string }\nconst c = 1\nfn f() {}\n"
+	cases := map[string]string{
+		"fn main() { let a = 1\n a = 2\n a += 1\n a <<= 1\n a++ }":                  "",
+		"fn main() { let p = P {}\n p.x = 1\n p.s += 1\n p.s = \"a\" }":             "",
+		"fn main() { let arr = [1, 2]\n arr[0] = 3\n arr[1] *= 2\n arr[0]-- }":      "",
+		"fn main() { let ch = 'a'\n ch++ }":                                         "",
+		"fn main() { c = 2 }":                                                       "cannot assign to constant: c",
+		"fn main() { const d = 1\n d += 2 }":                                        "cannot assign to constant: d",
+		"fn main() { c++ }":                                                         "cannot assign to constant: c",
+		"fn main() { f = fn() {} }":                                                 "cannot assign to function: f",
+		"fn main() { 1 = 2 }":                                                       "cannot assign to this expression",
+		"fn main() { let s = \"ab\"\n s[0] = 'c' }":                                 "cannot assign to an element of string",
+		"fn main() { let a = 1\n a = \"x\" }":                                       "cannot use string as number",
+		"fn main() { let p = P {}\n p.x = true }":                                   "cannot use bool as number",
+		"fn main() { let a = 1\n a += \"x\" }":                                      "cannot use string as number",
+		"fn main() { let b = true\n b += 1 }":                                       "invalid operation: operator += not defined on bool",
+		"fn main() { let s = \"a\"\n s -= 1 }":                                      "invalid operation: operator -= not defined on string",
+		"fn main() { let s = \"a\"\n s++ }":                                         "invalid operation: operator ++ not defined on string",
+		"fn main() { let a = [1]\n a.len = fn () -> number { return 1 } }":          "cannot assign to method: len",
+		"fn main() { let a = [1]\n a.len = 3 }":                                     "cannot assign to method: len",
+		"fn main() { let a = [1]\n a.len += 1 }":                                    "cannot assign to method: len",
+		"fn main() { let s = \"a\"\n s.trim++ }":                                    "cannot assign to method: trim",
+		"impl P { fn hello() {} }\nfn main() { let p = P {}\n p.hello = fn () {} }": "cannot assign to method: hello",
+		"interface I { fn hello() }\nfn main(i: I) { i.hello = fn () {} }":          "cannot assign to method: hello",
+		"fn main() { let p = P {}\n p.y = 1 }":                                      "undefined property `y` for type P",
+		"fn main() { let a: any = P {}\n a.x = 1 }":                                 "",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestCompileOperatorErrors(t *testing.T) {
+	decls := "struct Dog { bark: string }\nlet x = 1\nlet s = \"a\"\nlet b = 1 as byte\nlet v: any = 1\n"
+	cases := map[string]string{
+		"fn main() { x = x - 1 + b * 'c' }":                       "",
+		"fn main() { s = s + 1 + true }":                          "",
+		"fn main() { x = (v - 1) | ~v }":                          "",
+		"fn main() { println(!(x > 1) && true || v) }":            "",
+		"fn main(a: any) { println(a is Dog && a.bark != \"\") }": "",
+		"fn main() { x = x - \"a\" }":                             "cannot use string as number",
+		"fn main() { let y = 1 - \"a\" }":                         "cannot use string as number",
+		"fn main() { let y = 1 + s }":                             "cannot use string as number",
+		"fn main() { let y = true * 2 }":                          "invalid operation: operator * not defined on bool",
+		"fn main() { println(x << true) }":                        "cannot use bool as number",
+		"fn main() { println(!1) }":                               "invalid operation: operator ! not defined on number",
+		"fn main() { println(-\"a\") }":                           "invalid operation: operator - not defined on string",
+		"fn main() { println(~s) }":                               "invalid operation: operator ~ not defined on string",
+		"fn main() { println(x && true) }":                        "invalid operation: operator && not defined on number",
+		"fn main() { println(true || s) }":                        "cannot use string as bool",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestInferMemberKind(t *testing.T) {
+	lib := `
+pub const PI = 3.14
+
+pub struct Person {
+    name: string,
+    _secret: number
+}
+
+impl Person {
+    fn greet() -> string {
+        return "hi " + self.name + self._secret
+    }
+
+    fn _hidden() -> number {
+        return self._secret
+    }
+}`
+	main := `
+import lib.a
+
+enum Color {
+    Red,
+    Green
+}
+
+struct Student <- a.Person {
+    grade: number
+}
+
+fn num(n: number) {}
+fn str(s: string) {}
+fn color(c: Color) {}
+fn ch(c: char) {}
+
+fn main() {
+    let s = Student { name: "Tom", grade: 3 }
+    let list: []Student = [s]
+    str(s.name)
+    str(s.greet())
+    num(s.grade)
+    num(a.PI)
+    color(Color.Red)
+    num(list[0].grade)
+    ch("abc"[1])
+`
+	c := compileFiles(map[string]string{"main.noah": main + "}", "lib/a.noah": lib})
+	assert.Empty(t, c.Diagnostics)
+
+	cases := map[string]string{
+		"num(s.name)":            "cannot use string as number",
+		"str(list[0])":           "cannot use Student as string",
+		"num(s.age)":             "undefined property `age` for type Student",
+		"num(s._secret)":         "undefined property `_secret` for type Student",
+		"num(s._hidden())":       "cannot access private method: _hidden",
+		"num(list[\"a\"].grade)": "invalid index type: string",
+		"num(s[0])":              "cannot index a value of type Student",
+		"num(Color.Red)":         "cannot use Color as number",
+		"let f = fn(p: a.Person) -> number { return p._secret }": "cannot access private field: _secret",
+		"let p = a.Person { _secret: 5 }":                        "cannot access private field: _secret",
+		"let p: a.Person = { _secret: 7 }":                       "cannot access private field: _secret",
+	}
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": main + code + "\n}", "lib/a.noah": lib})
+		if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestBuiltinMethodKind(t *testing.T) {
+	decls := "fn num(n: number) {}\nfn str(s: string) {}\nfn main() {\n    let v: []string = [\"a\"]\n    let f: [2]number = [1, 2]\n"
+	cases := map[string]string{
+		"num(v.len() + f.len() + \"abc\".indexOf('b'))\nlet n = 1\nstr(v.pop() + n.toStr())\nv.push(\"b\", \"c\")": "",
+		"str(\"a,b\".split(\",\")[0].trim().toUpperCase())\nnum(v.splice(0, 1)[0].len())":                          "",
+		"f.push(3)":           "undefined property `push` for type [2]number",
+		"v.push(1)":           "cannot use number as string",
+		"num(v.shift())":      "cannot use string as number",
+		"num(\"a\".slice(0))": "expect 2 argument(s), but got 1",
+		"num(true.clone())":   "cannot use bool as number",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code + "\n}"})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestExpectedKind(t *testing.T) {
+	decls := "struct Person { name: string }\nstruct Man <- Person { age: number }\nenum Color { Red }\nfn apply(f: fn(x: number) -> number) {}\n" +
+		"struct Node { name: string, next: Node, kids: []Node, tags: [2]string }\n"
+	cases := map[string]string{
+		"fn main() { let a: []string = []\n let b: any = [1, \"b\"]\n let c = [1, 2] }":                                                              "",
+		"fn main() { let a: [2]Person = [{ name: \"a\" }, { name: \"b\" }]\n let b: []Person = [null, { name: \"c\" }] }":                            "",
+		"fn main() { let p: Person = null\n let c: Color = null\n let f: fn() = null }":                                                              "",
+		"fn main() { let a = [Man { name: \"a\" }, Person { name: \"b\" }, null] }":                                                                  "",
+		"fn main() { apply(fn(x: number) -> number { return x })\n let s: []any = [1, \"b\"] as []any }":                                             "",
+		"fn main() { let a = Node { name: \"a\", next: null }\n let b = Node { kids: [], tags: [\"x\"] }\n let c = Node { next: { name: \"b\" } } }": "",
+		"fn main() { let a = [Node { kids: [null] }, Node { next: Node {} }] }":                                                                      "",
+		"fn main() { let a = Node { name: null } }":                                                                                                  "cannot use null as string",
+		"fn main() { let a = Node { kids: [1] } }":                                                                                                   "cannot use number as Node",
+		"fn main() { let a = Node { tags: [\"a\", \"b\", \"c\"] } }":                                                                                 "too many elements for [2]string: expect at most 2, but got 3",
+		"fn main() { let a = Man { age: \"1\" } }":                                                                                                   "cannot use string as number",
+		"fn main() { let a = Man { size: [] } }":                                                                                                     "unknown field: size",
+		"fn main() { let a = [] }":                                                                                                                   "cannot infer the type of an empty array",
+		"fn main() { let a = [null] }":                                                                                                               "cannot infer the type of null",
+		"fn main() { let a = [1, \"b\"] }":                                                                                                           "mixed types in array: number and string",
+		"fn main() { [1, [2]] }":                                                                                                                     "mixed types in array: number and []number",
+		"fn main() { let a = [1, null] }":                                                                                                            "cannot use null as number",
+		"fn main() { let a: string = 3 }":                                                                                                            "cannot use number as string",
+		"fn main() { let a: number = null }":                                                                                                         "cannot use null as number",
+		"fn main() { let a: []string = [\"a\", 1] }":                                                                                                 "cannot use number as string",
+		"fn main() { let a: []Person = [{ name: 1 }] }":                                                                                              "cannot use number as string",
+		"fn main() { let a: []Person = [{ age: 1 }] }":                                                                                               "unknown field: age",
+		"fn main() { apply(fn(x: string) -> number { return 1 }) }":                                                                                  "cannot use fn(string) -> number as fn(number) -> number",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestFixedArrayKind(t *testing.T) {
+	decls := "const N = 2\nlet n = 2\n"
+	cases := map[string]string{
+		"fn main() { let a: [N * 2]number = [1, 2]\n let b: []number = a\n b.push(a[3]) }": "",
+		"fn main() { let a: [2]number\n let b: [][2]number = [a] }":                        "",
+		"fn main() { let a: [2]number = [1, 2, 3] }":                                       "too many elements for [2]number: expect at most 2, but got 3",
+		"fn main() { let a: [2]number = [1]\n let b = a[N] }":                              "index out of range [2] with length 2",
+		"fn main() { let a = [1]\n let b = a[-1] }":                                        "index out of range [-1]",
+		"fn main() { let a: [n]number }":                                                   "array length must be a constant expression",
+		"const M = 1.5\nfn main() { let a: [M]number }":                                    "expect be a positive integer",
+		"fn main() { let a: []number = [1]\n let b: [1]number = a }":                       "cannot use []number as [1]number",
+		"fn main() { let a: [2]number\n let b: [3]number = a }":                            "cannot use [2]number as [3]number",
+		"fn main() { let a: [2]number\n a.push(1) }":                                       "undefined property `push` for type [2]number",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+
+	c := compileFiles(map[string]string{
+		"main.noah":  "import lib.a\nfn main() { let b: [a.SIZE]number = [1, 2, 3] }",
+		"lib/a.noah": "pub const SIZE = 3",
+	})
+	assert.Empty(t, c.Diagnostics)
+}
+
+func TestNarrowKind(t *testing.T) {
+	decls := `struct Animal { name: string }
+struct Dog <- Animal { bark: string }
+interface Speaker { fn speak() -> string }
+impl (Speaker) Dog {
+    fn speak() -> string { return self.bark }
+}
+fn str(s: string) {}
+`
+	cases := map[string]string{
+		"fn f(a: Animal) { if (a is Dog) { str(a.bark) } }":                                                                                     "",
+		"fn f(s: Speaker) { if (s is Dog) { str(s.name) } }":                                                                                    "",
+		"fn f(a: Animal) -> string { if (!(a is Dog)) { return \"\" }\n return a.bark }":                                                        "",
+		"fn f(a: Animal) -> string { if (!(a is Dog)) { return \"\" } else { return a.bark } }":                                                 "",
+		"fn f(a: Animal) -> bool { return a is Dog && a.bark == \"x\" }":                                                                        "",
+		"fn f(a: Animal) -> bool { return !(a is Dog) || a.bark == \"x\" }":                                                                     "",
+		"fn f(list: []Animal) { for (a: list) { if (!(a is Dog)) { continue }\n str(a.bark) } }":                                                "",
+		"fn f(v: any) { if (v is number) { } else if (v is string) { let s = v\n str(s) } }":                                                    "",
+		"fn f(v: any) { if (v is string) { let n: number = v } }":                                                                               "cannot use string as number",
+		"fn f(a: Animal) { if (a is Dog) { str(a.bark) }\n str(a.bark) }":                                                                       "undefined property `bark` for type Animal",
+		"fn f(a: Animal) { if (a is Dog) { a = Animal {}\n str(a.bark) } }":                                                                     "undefined property `bark` for type Animal",
+		"fn f(a: Animal) { if (a is Dog || true) { str(a.bark) } }":                                                                             "undefined property `bark` for type Animal",
+		"fn f(n: number) { if (n is string) { str(n) } }":                                                                                       "cannot use number as string",
+		"fn f(a: Animal, list: []number) { if (!(a is Dog)) { return\n }\n for (n: list) { str(a.bark) } }":                                     "",
+		"fn f(a: Animal, list: []number) { if (!(a is Dog)) { return\n }\n for (n: list) { str(a.bark)\n a = Animal {} } }":                     "undefined property `bark` for type Animal",
+		"fn f(a: Animal) { if (!(a is Dog)) { return\n }\n for (let i = 0; i < 2; i++) { if (i > 0) { str(a.bark) } else { a = Animal {} } } }": "undefined property `bark` for type Animal",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestCastKind(t *testing.T) {
+	decls := `struct Animal { name: string }
+struct Dog <- Animal { bark: string }
+interface Speaker { fn speak() -> string }
+impl (Speaker) Dog {
+    fn speak() -> string { return self.bark }
+}
+type Meters number
+`
+	cases := map[string]string{
+		"fn main() { let a = 'a' as number\n let b = 97 as char\n let c = 1 as byte\n let d = 1.5 as string }": "",
+		"fn main() { let v: any = 1\n let s = v as string\n let a = null as Animal }":                          "",
+		"fn main() { let d = Dog {}\n let s = d as Speaker\n let a = d as Animal\n let b = a as Dog }":         "",
+		"fn main() { let s: Speaker = Dog {}\n let d = s as Dog }":                                             "",
+		"fn main() { let m = 1 as Meters\n let n = m as number }":                                              "",
+		"fn main() { let a = \"a\" as number }":                                                                "cannot cast string to number",
+		"fn main() { let a = true as number }":                                                                 "cannot cast bool to number",
+		"fn main() { let a = 'a' as string }":                                                                  "cannot cast char to string",
+		"fn main() { let a = 1 as Animal }":                                                                    "cannot cast number to Animal",
+		"fn main() { let a = Animal {} as Speaker }":                                                           "cannot cast Animal to Speaker",
+		"fn main() { println(\"1\" as number) }":                                                               "cannot cast string to number",
+		"fn main() { println(true as number) }":                                                                "cannot cast bool to number",
+		"fn main() { \"1\" as number }":                                                                        "cannot cast string to number",
+		"fn main() { println([1, \"b\"] as []any) }":                                                           "",
+		"fn main() { println(null as number) }":                                                                "expect a reference type, but found: number",
+		"fn main() { let a = null as number }":                                                                 "expect a reference type, but found: number",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": decls + code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+}
+
+func TestPrelude(t *testing.T) {
+	cases := map[string]string{
+		"fn main() { println(1, \"a\", [1])\n print()\n assert(true)\n assert(1 < 2, \"ok\") }": "",
+		"fn main() { let n: number = len(\"ab\") + len([1])\n let s: string = typeof(n) }":      "",
+		"fn main() { let v: any = 1\n let n = len(v)\n let p = println\n p(n) }":                "",
+		"fn println(s: string) {}\nfn main() { println(\"a\") }":                                "",
+		"let print = 1\nfn main() { let n: number = print }":                                    "",
+		"fn main() { let len = 1\n let typeof = len + 1 }":                                      "",
+		"fn main() { panic(1) }":                                                   "cannot use number as string",
+		"fn main() { assert(1) }":                                                  "cannot use number as bool",
+		"fn main() { len(\"a\", \"b\") }":                                          "expect 1 argument(s), but got 2",
+		"fn main() { len(1) }":                                                     "invalid argument for len: number",
+		"fn main() { let s: string = len(\"a\") }":                                 "cannot use number as string",
+		"fn main() { println = fn() {} }":                                          "cannot assign to function: println",
+		"fn println(s: string) {}\nfn main() { println(1) }":                       "cannot use number as string",
+		"fn println(s: string) {}\nfn main() { let p: fn(...a: []any) = println }": "cannot use fn(string) as fn(...[]any)",
+	}
+
+	for code, message := range cases {
+		c := compileFiles(map[string]string{"main.noah": code})
+		if message == "" {
+			assert.Empty(t, c.Diagnostics, code)
+		} else if assert.Len(t, c.Diagnostics, 1, code) {
+			assert.Equal(t, message, c.Diagnostics[0].Message, code)
+		}
+	}
+
+	c := compileFiles(map[string]string{"main.noah": "fn main() { println(1) }"})
+	var value Value
+	for expr, v := range c.Info.Uses {
+		if expr.Node.(*ast.IdentifierLiteral).Name.Name == "println" {
+			value = v
+		}
+	}
+	if assert.IsType(t, &BuiltinValue{}, value) {
+		assert.Equal(t, "fn(...[]any)", c.Main.kindString(value.(*BuiltinValue).Kind))
+	}
+}
+
+// 模块中第 n 个（从 0 开始）匹配的文本处的标识符
+func refAt(c *Compiler, moduleId string, text string, n int) *Ref {
+	module := c.Modules[moduleId]
+	source := string(module.Source())
+	offset := 0
+	for i := 0; i <= n; i++ {
+		index := strings.Index(source[offset:], text)
+		if index < 0 {
+			return nil
+		}
+		offset += index
+		if i < n {
+			offset += len(text)
+		}
+	}
+	return c.Info.RefAt(module, len([]rune(source[:offset])))
+}
+
+func TestSymbols(t *testing.T) {
+	c := compileFiles(map[string]string{
+		"main.noah": `import lib.shape as s
+
+fn main() {
+    let p = s.Point { x: 1 }
+    p.x = p.y + s.origin.x
+    let d = p.dist()
+    let c = s.Color.Red
+    let v: s.Point = null
+    println(d, c, v)
+}`,
+		"lib/shape.noah": `// 平面上的点
+// 坐标均为数字
+pub struct Point {
+    x: number,
+    y: number
+}
+
+pub enum Color {
+    Red
+}
+
+pub const origin = Point { x: 0, y: 0 }
+
+impl Point {
+    // 到原点的距离
+    fn dist() -> number {
+        return self.x * self.x + self.y * self.y
+    }
+}`,
+	})
+	if !assert.Empty(t, c.Diagnostics) {
+		return
+	}
+
+	point := refAt(c, "main", "Point", 0)
+	if assert.NotNil(t, point) {
+		assert.False(t, point.IsDecl)
+		assert.Equal(t, SymbolType, point.Symbol.Tag)
+		assert.Equal(t, "lib.shape", point.Symbol.Module.Id())
+		assert.Equal(t, "struct Point", point.Symbol.Signature())
+		assert.Equal(t, "平面上的点\n坐标均为数字", point.Symbol.Doc())
+		assert.Len(t, c.Info.References(point.Symbol), 5)
+		assert.Same(t, point.Symbol, refAt(c, "main", "Point", 1).Symbol)
+		assert.True(t, refAt(c, "lib.shape", "Point", 0).IsDecl)
+	}
+
+	x := refAt(c, "main", "x", 1)
+	if assert.NotNil(t, x) {
+		assert.Equal(t, "field Point.x: number", x.Symbol.Signature())
+		assert.Equal(t, "x", string(x.Symbol.Module.Source()[x.Symbol.Decl.Start:x.Symbol.Decl.End]))
+		// 声明、结构体字面量的键、赋值、`s.origin.x` 及方法中的两次 `self.x`
+		refs := c.Info.References(x.Symbol)
+		assert.Len(t, refs, 7)
+		assert.Equal(t, "lib.shape", refs[0].Module.Id())
+		assert.True(t, refs[0].IsDecl)
+	}
+
+	dist := refAt(c, "main", "dist", 0)
+	if assert.NotNil(t, dist) {
+		assert.Equal(t, SymbolMethod, dist.Symbol.Tag)
+		assert.Equal(t, "fn Point.dist() -> number", dist.Symbol.Signature())
+		assert.Equal(t, "到原点的距离", dist.Symbol.Doc())
+	}
+
+	module := refAt(c, "main", "s.", 0)
+	if assert.NotNil(t, module) {
+		assert.Equal(t, "module lib.shape", module.Symbol.Signature())
+		// import 的路径及别名、4 次 `s.` 访问
+		assert.Len(t, c.Info.References(module.Symbol), 6)
+	}
+
+	assert.Equal(t, "const origin: Point", refAt(c, "main", "origin", 0).Symbol.Signature())
+	assert.Equal(t, "choice Color.Red", refAt(c, "main", "Red", 0).Symbol.Signature())
+	assert.Equal(t, "let p: Point", refAt(c, "main", "p =", 0).Symbol.Signature())
+	assert.Equal(t, "fn println(...[]any)", refAt(c, "main", "println", 0).Symbol.Signature())
+	assert.Nil(t, refAt(c, "lib.shape", "self", 0))
+}
+
+// 以 `|` 标记光标位置，返回补全项的名称
+func completeLabels(files map[string]string, moduleId string) []string {
+	c := NewCompiler("", false)
+	offset := 0
+	for name, code := range files {
+		if index := strings.IndexByte(code, '|'); index >= 0 {
+			offset = len([]rune(code[:index]))
+			code = code[:index] + code[index+1:]
+		}
+		_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, name), []byte(code))
+	}
+
+	labels := make([]string, 0)
+	for _, item := range c.Complete(moduleId, offset) {
+		labels = append(labels, item.Label)
+	}
+	return labels
+}
+
+func TestComplete(t *testing.T) {
+	lib := `pub struct Point {
+    x: number,
+    _y: number
+}
+
+pub enum Color {
+    Red,
+    Green
+}
+
+pub const origin = Point { x: 0 }
+let hidden = 1
+
+impl Point {
+    fn dist() -> number {
+        return self.|
+    }
+    fn _secret() {}
+}`
+	main := `import lib.shape as s
+
+fn main() {
+    let count = 1
+    let p = s.Point { x: 1 }
+    let str = "a"
+    let arr: []number = []
+    |
+}`
+
+	cases := []struct {
+		code     string
+		expected []string
+	}{
+		{"s.|", []string{"Color", "Point", "origin"}},
+		{"p.|", []string{"dist", "x"}},
+		{"count.|", []string{"clone", "toStr"}},
+		{"s.Color.|", []string{"Green", "Red"}},
+		{"str.to|", []string{"toChars", "toLowerCase", "toStr", "toUpperCase"}},
+		{"arr.s|", []string{"shift", "slice", "splice"}},
+		{"co|", []string{"count"}},
+		{"pr|", []string{"print", "println"}},
+		{"let q: s.|", []string{"Color", "Point"}},
+		{"let q: |", []string{"s"}},
+		{"println(count, p.|)", []string{"dist", "x"}},
+		// 光标之前的语义错误及之后的语法错误不影响补全
+		{"let bad: string = 1\n    s.origin.|\n    let = )", []string{"dist", "x"}},
+	}
+	for _, item := range cases {
+		code := strings.Replace(main, "|", item.code, 1)
+		labels := completeLabels(map[string]string{
+			"main.noah":      code,
+			"lib/shape.noah": strings.Replace(lib, "|", "x", 1),
+		}, "main")
+		assert.Equal(t, item.expected, labels, item.code)
+	}
+
+	// self 的成员包含模块内的私有成员
+	labels := completeLabels(map[string]string{
+		"main.noah":      "import lib.shape\nfn main() {}",
+		"lib/shape.noah": lib,
+	}, "lib.shape")
+	assert.Equal(t, []string{"_secret", "_y", "dist", "x"}, labels)
+
+	c := NewCompiler("", false)
+	_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, "main.noah"), []byte("// 计数\nlet count = 1\nfn main() { c }"))
+	items := c.Complete("main", 33)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "count", items[0].Label)
+		assert.Equal(t, SymbolVar, items[0].Symbol.Tag)
+		assert.Equal(t, "let count: number", items[0].Symbol.Signature())
+		assert.Equal(t, "计数", items[0].Symbol.Doc())
+	}
+}
+
+// 重命名第 n 个 text 处的符号，返回修改后的各模块源代码
+func renameAt(c *Compiler, moduleId string, text string, n int, newName string) (map[string]string, error) {
+	ref := refAt(c, moduleId, text, n)
+	if ref == nil {
+		return nil, errors.New("no identifier: " + text)
+	}
+	edits, err := c.Rename(moduleId, ref.Name.Start, newName)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, edit := range edits {
+		result[edit.Module.Id()] = edit.Module.ApplyEdits(edits)
+	}
+	return result, nil
+}
+
+func TestRename(t *testing.T) {
+	c := compileFiles(map[string]string{
+		"main.noah": `import lib.shape
+
+const limit = 10
+
+fn main() {
+    let p = shape.Point { x: 1 }
+    let n = p.x + shape.origin.x
+    let d = p.dist()
+    println(limit + n + d)
+}`,
+		"lib/shape.noah": `pub struct Point {
+    x: number
+}
+
+pub enum Color {
+    Red
+}
+
+pub const origin = Point { x: 0 }
+
+impl Point {
+    fn dist() -> number {
+        return self.x
+    }
+}`,
+	})
+	if !assert.Empty(t, c.Diagnostics) {
+		return
+	}
+
+	sources, err := renameAt(c, "main", "Point", 0, "Vec")
+	if assert.NoError(t, err) {
+		assert.Len(t, sources, 2)
+		assert.Contains(t, sources["main"], "shape.Vec { x: 1 }")
+		assert.Contains(t, sources["lib.shape"], "pub struct Vec {")
+		assert.Contains(t, sources["lib.shape"], "impl Vec {")
+		assert.Equal(t, 3, strings.Count(sources["lib.shape"], "Vec"))
+	}
+
+	sources, err = renameAt(c, "lib.shape", "x", 0, "px")
+	if assert.NoError(t, err) {
+		assert.Contains(t, sources["main"], "shape.Point { px: 1 }")
+		assert.Contains(t, sources["main"], "p.px + shape.origin.px")
+		assert.Contains(t, sources["lib.shape"], "return self.px")
+	}
+
+	sources, err = renameAt(c, "main", "dist", 0, "length")
+	if assert.NoError(t, err) {
+		assert.Contains(t, sources["main"], "p.length()")
+		assert.Contains(t, sources["lib.shape"], "fn length() -> number")
+	}
+
+	sources, err = renameAt(c, "main", "n =", 0, "n")
+	if assert.NoError(t, err) {
+		assert.Empty(t, sources)
+	}
+
+	errs := []struct {
+		moduleId string
+		text     string
+		newName  string
+		expected string
+	}{
+		// 同一作用域中重复声明
+		{"main", "d =", "n", "n collides with an existing identifier: identifier has already been declared: n"},
+		{"lib.shape", "Point", "Color", "Color collides with an existing identifier"},
+		// 内层的声明覆盖外层的引用
+		{"main", "n =", "limit", "limit collides with an existing identifier"},
+		{"main", "p =", "self", "cannot rename to reserved identifier: self"},
+		{"main", "p =", "fn", "invalid identifier: fn"},
+		{"main", "p =", "true", "invalid identifier: true"},
+		{"main", "p =", "1p", "invalid identifier: 1p"},
+		{"main", "shape.Point", "geo", "cannot rename module: lib.shape"},
+		{"main", "println", "print", "cannot rename built-in identifier: println"},
+	}
+	for _, item := range errs {
+		_, err := renameAt(c, item.moduleId, item.text, 0, item.newName)
+		if assert.Error(t, err, item.text) {
+			assert.Contains(t, err.Error(), item.expected, item.text)
+		}
+	}
+}
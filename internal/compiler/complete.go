@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/helper"
+	"sort"
+	"strings"
+)
+
+// CompletionItem 补全项，Label 为输入的名称（模块为引入时的局部名称）
+type CompletionItem struct {
+	Label  string
+	Symbol *Symbol
+}
+
+// 补全的光标位置
+type cursor struct {
+	moduleId string
+	offset   int
+	start    int    // 光标处标识符的开始位置
+	prefix   string // 光标之前已输入的部分
+	items    []*CompletionItem
+}
+
+// Complete 编译项目直到模块中光标处的标识符，返回光标处可以输入的名称（按名称排序）。
+// 语法错误及光标之前语句的语义错误不影响补全，光标处没有标识符时（如 `a.` 之后）补充占位标识符
+func (c *Compiler) Complete(moduleId string, offset int) []*CompletionItem {
+	c.cursor = &cursor{moduleId: moduleId, offset: offset}
+	c.Compile()
+
+	result := make([]*CompletionItem, 0, len(c.cursor.items))
+	for _, item := range c.cursor.items {
+		if strings.HasPrefix(item.Label, c.cursor.prefix) {
+			result = append(result, item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Label < result[j].Label
+	})
+	return result
+}
+
+// 记录光标之前已输入的部分，光标处没有标识符时插入占位标识符
+func (c *cursor) patch(code string) string {
+	source := []rune(code)
+	if c.offset > len(source) {
+		c.offset = len(source)
+	}
+	c.start = c.offset
+	for c.start > 0 && helper.IsIdentifierChar(source[c.start-1], false) {
+		c.start--
+	}
+	c.prefix = string(source[c.start:c.offset])
+
+	if len(c.prefix) == 0 && (c.offset == len(source) || !helper.IsIdentifierChar(source[c.offset], false)) {
+		return string(source[:c.offset]) + "_" + string(source[c.offset:])
+	}
+	return code
+}
+
+// 标识符位于补全的光标处时收集补全项并中止编译
+func (m *Module) completeAt(name *ast.Identifier, collect func() []*CompletionItem) {
+	cursor := m.compiler.cursor
+	if cursor == nil || cursor.moduleId != m.moduleId || name.Start != cursor.start {
+		return
+	}
+	cursor.items = collect()
+	m.compiler.abort()
+}
+
+// 补全时忽略语句的语义错误，恢复作用域及函数状态后继续编译后续的语句直到光标处
+func (m *Module) tolerate(fn func()) {
+	if m.compiler.cursor == nil {
+		fn()
+		return
+	}
+	m.recoverDecl(fn)
+}
+
+/* items */
+
+// 作用域中可见的名称，内层的声明覆盖外层的同名声明；onlyKind 为 true 时（类型表达式中）只包含模块及类型
+func (m *Module) scopeItems(onlyKind bool) []*CompletionItem {
+	items := make([]*CompletionItem, 0, helper.DefaultCap)
+	seen := make(map[string]bool)
+	add := func(name string, symbol *Symbol) {
+		if !seen[name] && symbol != nil {
+			seen[name] = true
+			items = append(items, &CompletionItem{Label: name, Symbol: symbol})
+		}
+	}
+
+	for i := m.scopes.size() - 1; i >= 0; i-- {
+		scope := m.scopes.stack[i]
+		if !onlyKind {
+			for name, value := range scope.value {
+				add(name, m.compiler.valueItemSymbol(name, value))
+			}
+		}
+		for name, module := range scope.module {
+			add(name, m.compiler.moduleSymbol(module))
+		}
+		for name, kind := range scope.kind {
+			if name != "self" {
+				add(name, m.compiler.kindSymbol(kind))
+			}
+		}
+	}
+	return items
+}
+
+// 模块导出的名称，onlyKind 为 true 时只包含类型
+func (m *Module) exportItems(module *Module, onlyKind bool) []*CompletionItem {
+	items := make([]*CompletionItem, 0, helper.DefaultCap)
+	if !onlyKind {
+		for name, value := range module.exports.value {
+			items = append(items, &CompletionItem{Label: name, Symbol: m.compiler.valueSymbol(value)})
+		}
+	}
+	for name, kind := range module.exports.kind {
+		items = append(items, &CompletionItem{Label: name, Symbol: m.compiler.kindSymbol(kind)})
+	}
+	return items
+}
+
+// 枚举的选项
+func (m *Module) choiceItems(kind *KindRef) []*CompletionItem {
+	items := make([]*CompletionItem, 0, helper.DefaultCap)
+	for name := range kind.current.(*TEnum).Choices {
+		items = append(items, &CompletionItem{Label: name, Symbol: m.compiler.memberSymbol(kind, name, SymbolChoice)})
+	}
+	return items
+}
+
+// 值的成员：结构体字段、接口方法、impl 实现的方法及内置方法，不包含其他模块的私有成员
+func (m *Module) memberItems(kind *KindRef) []*CompletionItem {
+	items := make([]*CompletionItem, 0, helper.DefaultCap)
+	seen := make(map[string]bool)
+	add := func(name string, symbol *Symbol) {
+		if !seen[name] && (name[0] != '_' || symbol.Module == m) {
+			seen[name] = true
+			items = append(items, &CompletionItem{Label: name, Symbol: symbol})
+		}
+	}
+
+	underlying := getUnderlyingKind(kind)
+	switch underlying.current.(type) {
+	case *TStruct:
+		for name := range getStructProperties(underlying) {
+			add(name, m.compiler.memberSymbol(findFieldOwner(underlying, name), name, SymbolField))
+		}
+	case *TInterface:
+		for name := range underlying.current.(*TInterface).Properties {
+			add(name, m.compiler.memberSymbol(underlying, name, SymbolMethod))
+		}
+	}
+
+	// 与 findMethod 的查找顺序一致：类型自身、继承的结构体及底层类型
+	var collect func(kind *KindRef)
+	collect = func(kind *KindRef) {
+		kind = resolveSelfKind(kind)
+		if impl := kind.current.getImpl(); impl != nil {
+			for name, value := range impl.methods {
+				add(name, m.compiler.valueSymbol(value))
+			}
+		}
+		if t, ok := kind.current.(*TStruct); ok {
+			for _, extend := range t.Extends {
+				collect(extend)
+			}
+		}
+	}
+	collect(kind)
+	if underlying != resolveSelfKind(kind) {
+		collect(underlying)
+	}
+
+	for _, methods := range []map[string]builtinSig{scalarMethods, stringMethods, arrayMethods, vectorMethods} {
+		for name := range methods {
+			if t := m.findBuiltinMethod(kind, name); t != nil {
+				add(name, &Symbol{Tag: SymbolMethod, Name: name, Type: t})
+			}
+		}
+	}
+	return items
+}
+
+// 值对应的符号，self 没有声明，使用其类型作为变量的符号
+func (c *Compiler) valueItemSymbol(name string, value Value) *Symbol {
+	if v, ok := value.(*SelfValue); ok {
+		return &Symbol{Tag: SymbolVar, Name: name, Type: v.Kind}
+	}
+	return c.valueSymbol(value)
+}
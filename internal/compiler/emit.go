@@ -0,0 +1,298 @@
+package compiler
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/peakchen90/noah-lang/internal/helper"
+	"sort"
+)
+
+// 跳转指令的占位目标位置，回填前不会被执行
+const jumpPlaceholder = 0xffff
+
+// 正在生成指令的函数
+type funcState struct {
+	parent *funcState
+	fn     *bytecode.Function
+	kind   *TFunc // 函数的类型，模块初始化函数为 nil
+	loops  []*loopState
+	isInit bool // 是否为模块初始化函数
+}
+
+// 正在生成指令的循环，用于回填 break、continue 的跳转位置
+type loopState struct {
+	label     *ast.Identifier
+	breaks    []int
+	continues []int
+}
+
+// 开始生成函数指令
+func (m *Module) beginFunc(fn *bytecode.Function) *funcState {
+	m.fn = &funcState{
+		parent: m.fn,
+		fn:     fn,
+		loops:  make([]*loopState, 0, helper.SmallCap),
+	}
+	return m.fn
+}
+
+// 结束生成函数指令，补充隐式的 `return`
+func (m *Module) endFunc() {
+	m.emit(bytecode.OpNull)
+	m.emit(bytecode.OpReturn)
+	m.fn = m.fn.parent
+}
+
+// 写入一条指令，返回指令位置
+func (m *Module) emit(op bytecode.OpCode, operands ...int) int {
+	return m.fn.fn.Chunk.Write(op, operands...)
+}
+
+// 记录后续指令对应的源码位置
+func (m *Module) mark(pos ast.Position) {
+	line, column := m.location(pos.Start)
+	m.fn.fn.Chunk.Mark(pos.Start, line, column)
+}
+
+// 返回源码位置对应的行列（从 1 开始）
+func (m *Module) location(index int) (int, int) {
+	if m.lineStarts == nil {
+		m.lineStarts = []int{0}
+		for i, ch := range m.source {
+			if ch == '\n' {
+				m.lineStarts = append(m.lineStarts, i+1)
+			}
+		}
+	}
+
+	line := sort.Search(len(m.lineStarts), func(i int) bool {
+		return m.lineStarts[i] > index
+	})
+	return line, index - m.lineStarts[line-1] + 1
+}
+
+// 分配局部变量槽位
+func (m *Module) addLocal() int {
+	fn := m.fn.fn
+	if fn.NumLocals > bytecode.MaxU16 {
+		m.unexpectedPos(m.markedPos(), fmt.Sprintf("too many local variables in function: exceeds %d", bytecode.MaxU16+1))
+	}
+	fn.NumLocals++
+	return fn.NumLocals - 1
+}
+
+// 当前指令位置
+func (m *Module) offset() int {
+	return len(m.fn.fn.Chunk.Code)
+}
+
+// 写入跳转指令，目标位置待回填
+func (m *Module) emitJump(op bytecode.OpCode) int {
+	return m.emit(op, jumpPlaceholder)
+}
+
+// 回填跳转指令的目标位置为当前指令位置
+func (m *Module) patchJump(offset int) {
+	chunk := m.fn.fn.Chunk
+	line, _ := chunk.LineAt(offset)
+	m.checkJumpTarget(m.offset(), line.Pos)
+	chunk.PatchOperand(offset, 0, m.offset())
+}
+
+// 写入跳回到循环开始位置的指令
+func (m *Module) emitLoop(start int) {
+	m.checkJumpTarget(start, m.markedPos())
+	m.emit(bytecode.OpJump, start)
+}
+
+// 跳转位置为 u16 操作数，函数的指令过长时无法编码
+func (m *Module) checkJumpTarget(target int, pos int) {
+	if target > bytecode.MaxU16 {
+		m.unexpectedPos(pos, fmt.Sprintf("function is too large: jump target %d exceeds %d", target, bytecode.MaxU16))
+	}
+}
+
+// 最近记录的源码位置
+func (m *Module) markedPos() int {
+	lines := m.fn.fn.Chunk.Lines
+	if len(lines) == 0 {
+		return 0
+	}
+	return lines[len(lines)-1].Pos
+}
+
+func (m *Module) addConstant(constant bytecode.Constant) int {
+	index := m.code.AddConstant(constant)
+	if index > bytecode.MaxU16 {
+		m.unexpectedPos(m.markedPos(), fmt.Sprintf("too many constants in module: exceeds %d", bytecode.MaxU16+1))
+	}
+	return index
+}
+
+// 添加类型常量，同一个类型只会添加一次
+func (m *Module) kindConstant(kind *KindRef) int {
+	kind = resolveSelfKind(kind)
+	index, has := m.kindConstants[kind.current]
+	if !has {
+		index = m.addConstant(&bytecode.KindConstant{Kind: m.compiler.runtimeKind(kind)})
+		m.kindConstants[kind.current] = index
+	}
+	return index
+}
+
+// 写入类型的默认值
+func (m *Module) emitDefault(kind *KindRef) {
+	m.emit(bytecode.OpDefault, m.kindConstant(kind))
+}
+
+// 写入读取值的指令
+func (m *Module) emitLoadValue(value Value, pos ast.Position) {
+	switch value.(type) {
+	case *FuncValue:
+		v := value.(*FuncValue)
+		m.emit(bytecode.OpConst, m.addConstant(bytecode.FuncConstant{
+			Module: v.module.code.Index,
+			Index:  v.Ptr,
+		}))
+	case *VarValue:
+		v := value.(*VarValue)
+		if v.Global {
+			m.emit(bytecode.OpGetGlobal, v.module.code.Index, v.Ptr)
+		} else {
+			m.checkCapture(v.fn, v.Name, pos)
+			m.emit(bytecode.OpGetLocal, v.Ptr)
+		}
+	case *SelfValue:
+		v := value.(*SelfValue)
+		m.checkCapture(v.fn, "self", pos)
+		m.emit(bytecode.OpGetLocal, v.Ptr)
+	case *BuiltinValue:
+		m.emit(bytecode.OpConst, m.addConstant(bytecode.BuiltinConstant(value.(*BuiltinValue).Name)))
+	default:
+		panic("Internal Err")
+	}
+}
+
+// 写入设置变量的指令（保留栈顶的值）
+func (m *Module) emitStoreValue(value Value, pos ast.Position) {
+	v, ok := value.(*VarValue)
+	if !ok {
+		m.unexpectedAt(pos, "cannot assign to this expression")
+	}
+
+	if v.Global {
+		m.emit(bytecode.OpSetGlobal, v.module.code.Index, v.Ptr)
+	} else {
+		m.checkCapture(v.fn, v.Name, pos)
+		m.emit(bytecode.OpSetLocal, v.Ptr)
+	}
+}
+
+// 暂不支持闭包：函数表达式不能访问外层函数的局部变量
+func (m *Module) checkCapture(fn *funcState, name string, pos ast.Position) {
+	if fn != m.fn {
+		m.unexpectedAt(pos, "cannot capture local variable of enclosing function: "+name)
+	}
+}
+
+// 按标签查找所在的循环，标签为空时返回最内层的循环
+func (m *Module) findLoop(label *ast.Identifier, pos ast.Position, keyword string) *loopState {
+	loops := m.fn.loops
+	if label == nil {
+		if len(loops) == 0 {
+			m.unexpectedAt(pos, "`"+keyword+"` outside of a loop")
+		}
+		return loops[len(loops)-1]
+	}
+
+	for i := len(loops) - 1; i >= 0; i-- {
+		if loops[i].label != nil && loops[i].label.Name == label.Name {
+			return loops[i]
+		}
+	}
+	m.unexpectedCode(diagnostic.CodeUndefined, label.Position, "undefined label: "+label.Name)
+	return nil
+}
+
+/* runtime kind */
+
+// 将编译期类型转为运行时类型描述
+func (c *Compiler) runtimeKind(kind *KindRef) *bytecode.Kind {
+	kind = resolveSelfKind(kind)
+	result := &bytecode.Kind{Len: -1}
+
+	if decl, has := c.kindDecls[kind.current]; has {
+		result.Name = decl.name
+		result.Module = decl.module.code.Index
+	}
+
+	switch kind.current.(type) {
+	case *TNumber:
+		result.Tag = bytecode.KindNumber
+	case *TByte:
+		result.Tag = bytecode.KindByte
+	case *TChar:
+		result.Tag = bytecode.KindChar
+	case *TString:
+		result.Tag = bytecode.KindString
+	case *TBool:
+		result.Tag = bytecode.KindBool
+	case *TAny:
+		result.Tag = bytecode.KindAny
+	case *TArray:
+		t := kind.current.(*TArray)
+		result.Tag = bytecode.KindArray
+		result.Len = t.Len
+		if t.Kind != nil {
+			result.Elem = c.runtimeKind(t.Kind)
+		} else {
+			result.Elem = &bytecode.Kind{Tag: bytecode.KindAny, Len: -1}
+		}
+	case *TFunc:
+		result.Tag = bytecode.KindFunc
+	case *TStruct:
+		t := kind.current.(*TStruct)
+		result.Tag = bytecode.KindStruct
+		for key := range getStructFields(kind) {
+			result.Fields = append(result.Fields, key)
+		}
+		sort.Strings(result.Fields)
+		for _, extend := range t.Extends {
+			result.Extends = append(result.Extends, c.runtimeKind(extend))
+		}
+	case *TInterface:
+		t := kind.current.(*TInterface)
+		result.Tag = bytecode.KindInterface
+		for key := range t.Properties {
+			result.Methods = append(result.Methods, key)
+		}
+		sort.Strings(result.Methods)
+	case *TEnum:
+		t := kind.current.(*TEnum)
+		result.Tag = bytecode.KindEnum
+		result.Choices = make([]string, len(t.Choices))
+		for key, index := range t.Choices {
+			result.Choices[index] = key
+		}
+	case *TCustom:
+		result.Tag = bytecode.KindCustom
+		result.Elem = c.runtimeKind(kind.current.(*TCustom).Kind)
+	default:
+		panic("Internal Err")
+	}
+
+	return result
+}
+
+// 获取 self 类型指向的类型
+func resolveSelfKind(kind *KindRef) *KindRef {
+	for {
+		t, ok := kind.current.(*TSelf)
+		if !ok {
+			return kind
+		}
+		kind = t.Kind
+	}
+}
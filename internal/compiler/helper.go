@@ -2,6 +2,8 @@ package compiler
 
 import (
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -90,7 +92,7 @@ func matchKind(expected *KindRef, received *KindRef, isLooseStruct bool) bool {
 		r, ok := received.current.(*TInterface)
 		e := expected.current.(*TInterface)
 		if !ok {
-			for _, ref := range expected.refs {
+			for _, ref := range implementRefs(expected) {
 				if matchKind(ref, received, isLooseStruct) {
 					return true
 				}
@@ -115,6 +117,305 @@ func matchKind(expected *KindRef, received *KindRef, isLooseStruct bool) bool {
 	return false
 }
 
+// 实现接口的类型，变量等引用的接口类型只复制了 current，需要从声明的类型中获取
+func implementRefs(kind *KindRef) []*KindRef {
+	if kind.module != nil {
+		if decl := kind.module.compiler.KindDecl(kind); decl != nil {
+			return decl.refs
+		}
+	}
+	return kind.refs
+}
+
+// 判断 received 类型的值能否用作 expected 类型，子结构体可以用作父结构体
+func assignableKind(expected *KindRef, received *KindRef) bool {
+	if matchKind(expected, received, false) || matchKind(expected, getUnderlyingKind(received), false) {
+		return true
+	}
+	// 定长数组可以用作元素类型相同的可变长数组
+	if e, ok := getUnderlyingKind(expected).current.(*TArray); ok {
+		r, ok := getUnderlyingKind(received).current.(*TArray)
+		return ok && e.Len < 0 && r.Len >= 0 && matchKind(e.Kind, r.Kind, false)
+	}
+	_, ok1 := getUnderlyingKind(expected).current.(*TStruct)
+	_, ok2 := getUnderlyingKind(received).current.(*TStruct)
+	return ok1 && ok2 && matchKind(getUnderlyingKind(received), getUnderlyingKind(expected), true)
+}
+
+// 判断能否使用 `as` 将 from 类型的值转换为 to 类型：
+//   - 可以赋值的类型，如子结构体转为父结构体、结构体转为实现的接口
+//   - any 转为其他类型、父结构体转为子结构体、接口转为结构体，运行时检查值的类型
+//   - 自定义类型与底层类型之间
+//   - 数值类型（number、byte、char）之间，number 转为 string
+//
+// 运行时的转换规则见 design/README.md 中的类型转换
+func castableKind(from *KindRef, to *KindRef) bool {
+	if assignableKind(to, from) || assignableKind(from, to) {
+		return true
+	}
+	if matchKind(getUnderlyingKind(to), getUnderlyingKind(from), false) {
+		return true
+	}
+	if isNumericKind(from) && isNumericKind(to) {
+		return true
+	}
+	return getUnderlyingKind(from).current == typeNumber && getUnderlyingKind(to).current == typeString
+}
+
+// 类型的描述（用于错误信息），具名类型使用类型的名称
+func (m *Module) kindString(kind *KindRef) string {
+	if kind == nil {
+		return "unknown"
+	}
+	kind = resolveSelfKind(kind)
+	if len(kind.name) > 0 {
+		return kind.name
+	}
+	if decl := m.compiler.KindDecl(kind); decl != nil && len(decl.name) > 0 {
+		return decl.name
+	}
+
+	builder := strings.Builder{}
+	switch kind.current.(type) {
+	case *TNumber:
+		builder.WriteString("number")
+	case *TByte:
+		builder.WriteString("byte")
+	case *TChar:
+		builder.WriteString("char")
+	case *TString:
+		builder.WriteString("string")
+	case *TBool:
+		builder.WriteString("bool")
+	case *TAny:
+		builder.WriteString("any")
+	case *TArray:
+		t := kind.current.(*TArray)
+		builder.WriteString("[")
+		if t.Len >= 0 {
+			builder.WriteString(strconv.Itoa(t.Len))
+		}
+		builder.WriteString("]")
+		if t.Kind == nil {
+			builder.WriteString("any")
+		} else {
+			builder.WriteString(m.kindString(t.Kind))
+		}
+	case *TFunc:
+		t := kind.current.(*TFunc)
+		builder.WriteString("fn(")
+		for i, arg := range t.Arguments {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			if t.HasRest && i == len(t.Arguments)-1 {
+				builder.WriteString("...")
+			}
+			builder.WriteString(m.kindString(arg))
+		}
+		builder.WriteString(")")
+		if !isVoidKind(t.Return) {
+			builder.WriteString(" -> ")
+			builder.WriteString(m.kindString(t.Return))
+		}
+	case *TStruct:
+		props := getStructProperties(kind)
+		keys := make([]string, 0, len(props))
+		for key := range props {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		builder.WriteString("struct {")
+		for i, key := range keys {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(" " + key + ": " + m.kindString(props[key]))
+		}
+		if len(keys) > 0 {
+			builder.WriteString(" ")
+		}
+		builder.WriteString("}")
+	case *TInterface:
+		builder.WriteString("interface")
+	case *TEnum:
+		builder.WriteString("enum")
+	case *TCustom:
+		builder.WriteString(m.kindString(kind.current.(*TCustom).Kind))
+	}
+	return builder.String()
+}
+
+// 判断是否为空类型（函数没有返回值）
+func isVoidKind(kind *KindRef) bool {
+	return kind == nil || kind.current == nil
+}
+
+// 判断语句执行后是否一定不会继续执行后面的语句（用于检查函数末尾是否缺少 return）
+func isTerminating(stmt *ast.Stmt) bool {
+	switch stmt.Node.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BlockStmt:
+		body := stmt.Node.(*ast.BlockStmt).Body
+		return len(body) > 0 && isTerminating(body[len(body)-1])
+	case *ast.IfStmt:
+		node := stmt.Node.(*ast.IfStmt)
+		return node.Alternate != nil && isTerminating(node.Consequent) && isTerminating(node.Alternate)
+	case *ast.ForStmt:
+		// 没有条件且不会被 break 的循环
+		node := stmt.Node.(*ast.ForStmt)
+		return node.EachVisitor == nil && node.Test == nil && !hasBreak(node.Body, node.Label, 0)
+	}
+	return false
+}
+
+// 判断语句执行后是否一定会跳转（return、break、continue），不会继续执行后面的语句
+func isJumping(stmt *ast.Stmt) bool {
+	switch stmt.Node.(type) {
+	case *ast.BreakStmt, *ast.ContinueStmt:
+		return true
+	case *ast.BlockStmt:
+		body := stmt.Node.(*ast.BlockStmt).Body
+		return len(body) > 0 && isJumping(body[len(body)-1])
+	case *ast.IfStmt:
+		node := stmt.Node.(*ast.IfStmt)
+		return node.Alternate != nil && isJumping(node.Consequent) && isJumping(node.Alternate)
+	}
+	return isTerminating(stmt)
+}
+
+// 判断语句中是否有跳出指定循环的 break，depth 为嵌套的循环层数
+func hasBreak(stmt *ast.Stmt, label *ast.Identifier, depth int) bool {
+	switch stmt.Node.(type) {
+	case *ast.BreakStmt:
+		target := stmt.Node.(*ast.BreakStmt).Label
+		if target == nil {
+			return depth == 0
+		}
+		return label != nil && target.Name == label.Name
+	case *ast.BlockStmt:
+		for _, item := range stmt.Node.(*ast.BlockStmt).Body {
+			if hasBreak(item, label, depth) {
+				return true
+			}
+		}
+	case *ast.IfStmt:
+		node := stmt.Node.(*ast.IfStmt)
+		return hasBreak(node.Consequent, label, depth) || (node.Alternate != nil && hasBreak(node.Alternate, label, depth))
+	case *ast.ForStmt:
+		return hasBreak(stmt.Node.(*ast.ForStmt).Body, label, depth+1)
+	}
+	return false
+}
+
+// 查找语句中被赋值（包括 `++`、`--`）的目标表达式，包括函数表达式中的赋值
+func findAssigned(stmt *ast.Stmt, callback func(target *ast.Expr)) {
+	switch stmt.Node.(type) {
+	case *ast.VarDecl:
+		if init := stmt.Node.(*ast.VarDecl).Init; init != nil {
+			findAssignedExpr(init, callback)
+		}
+	case *ast.BlockStmt:
+		for _, item := range stmt.Node.(*ast.BlockStmt).Body {
+			findAssigned(item, callback)
+		}
+	case *ast.ReturnStmt:
+		if argument := stmt.Node.(*ast.ReturnStmt).Argument; argument != nil {
+			findAssignedExpr(argument, callback)
+		}
+	case *ast.ExprStmt:
+		findAssignedExpr(stmt.Node.(*ast.ExprStmt).Expression, callback)
+	case *ast.IfStmt:
+		node := stmt.Node.(*ast.IfStmt)
+		findAssignedExpr(node.Condition, callback)
+		findAssigned(node.Consequent, callback)
+		if node.Alternate != nil {
+			findAssigned(node.Alternate, callback)
+		}
+	case *ast.ForStmt:
+		node := stmt.Node.(*ast.ForStmt)
+		if node.Init != nil {
+			findAssigned(node.Init, callback)
+		}
+		if node.Test != nil {
+			findAssignedExpr(node.Test, callback)
+		}
+		if node.Update != nil {
+			findAssignedExpr(node.Update, callback)
+		}
+		if node.EachVisitor != nil {
+			findAssignedExpr(node.EachVisitor.Target, callback)
+		}
+		findAssigned(node.Body, callback)
+	}
+}
+
+func findAssignedExpr(expr *ast.Expr, callback func(target *ast.Expr)) {
+	switch expr.Node.(type) {
+	case *ast.CallExpr:
+		node := expr.Node.(*ast.CallExpr)
+		findAssignedExpr(node.Callee, callback)
+		for _, param := range node.Params {
+			findAssignedExpr(param, callback)
+		}
+	case *ast.MemberExpr:
+		node := expr.Node.(*ast.MemberExpr)
+		findAssignedExpr(node.Object, callback)
+		if node.Computed {
+			findAssignedExpr(node.Property, callback)
+		}
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		switch node.Operator.Value {
+		case "=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "|=", "^=":
+			callback(node.Left)
+		}
+		findAssignedExpr(node.Left, callback)
+		findAssignedExpr(node.Right, callback)
+	case *ast.BinaryTypeExpr:
+		findAssignedExpr(expr.Node.(*ast.BinaryTypeExpr).Left, callback)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		if node.Operator.Value == "++" || node.Operator.Value == "--" {
+			callback(node.Argument)
+		}
+		findAssignedExpr(node.Argument, callback)
+	case *ast.FuncExpr:
+		findAssigned(expr.Node.(*ast.FuncExpr).Body, callback)
+	case *ast.StructExpr:
+		for _, property := range expr.Node.(*ast.StructExpr).Properties {
+			findAssignedExpr(property.Value, callback)
+		}
+	case *ast.ArrayExpr:
+		for _, item := range expr.Node.(*ast.ArrayExpr).Items {
+			findAssignedExpr(item, callback)
+		}
+	}
+}
+
+// 常量表达式的描述（用于数组长度）
+func getConstExprString(expr *ast.Expr) string {
+	switch expr.Node.(type) {
+	case *ast.NumberLiteral:
+		return expr.Node.(*ast.NumberLiteral).Text
+	case *ast.IdentifierLiteral:
+		return expr.Node.(*ast.IdentifierLiteral).Name.Name
+	case *ast.MemberExpr:
+		node := expr.Node.(*ast.MemberExpr)
+		if !node.Computed {
+			return getConstExprString(node.Object) + "." + getConstExprString(node.Property)
+		}
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		return node.Operator.Value + getConstExprString(node.Argument)
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		return getConstExprString(node.Left) + " " + node.Operator.Value + " " + getConstExprString(node.Right)
+	}
+	return "_"
+}
+
 func getKindExprString(expr *ast.KindExpr) string {
 	if expr == nil {
 		return ""
@@ -141,8 +442,7 @@ func getKindExprString(expr *ast.KindExpr) string {
 		node := expr.Node.(*ast.TArray)
 		builder.WriteString("[")
 		if node.Len != nil {
-			lenNode := node.Len.Node.(*ast.NumberLiteral)
-			builder.WriteString(lenNode.Text)
+			builder.WriteString(getConstExprString(node.Len))
 		}
 		builder.WriteString("]")
 		builder.WriteString(getKindExprString(node.Kind))
@@ -254,3 +554,28 @@ func getStructProperties(kind *KindRef) map[string]*KindRef {
 
 	return properties
 }
+
+// 获取结构体的所有字段（包含继承的私有字段），用于生成结构体的运行时布局
+func getStructFields(kind *KindRef) map[string]*KindRef {
+	fields := make(map[string]*KindRef)
+	walkStruct(kind, func(_kind *KindRef) {
+		for k, v := range _kind.current.(*TStruct).Properties {
+			fields[k] = v
+		}
+	}, true)
+	return fields
+}
+
+// 获取类型的底层类型（去除 self 及自定义类型）
+func getUnderlyingKind(kind *KindRef) *KindRef {
+	for {
+		switch kind.current.(type) {
+		case *TSelf:
+			kind = kind.current.(*TSelf).Kind
+		case *TCustom:
+			kind = kind.current.(*TCustom).Kind
+		default:
+			return kind
+		}
+	}
+}
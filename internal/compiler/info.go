@@ -0,0 +1,130 @@
+package compiler
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+)
+
+// Info 类型检查的结果，供代码生成等后端使用
+type Info struct {
+	Types  map[*ast.Expr]*KindRef     // 表达式的类型（无法推断的表达式不记录，`null` 记录为期望的类型）
+	Uses   map[*ast.Expr]Value        // 标识符或静态成员表达式（如 `foo.PI`）引用的值
+	Defs   map[*ast.Identifier]Value  // 函数、变量及参数声明对应的值
+	Impls  map[*ast.ImplDecl]*KindRef // impl 的目标类型
+	Copies map[*ast.Expr]bool         // 定长数组用作可变长数组时需要复制的表达式
+	Refs   map[*ast.Identifier]*Ref   // 标识符（声明及引用）对应的符号
+}
+
+func newInfo() *Info {
+	return &Info{
+		Types:  make(map[*ast.Expr]*KindRef),
+		Uses:   make(map[*ast.Expr]Value),
+		Defs:   make(map[*ast.Identifier]Value),
+		Impls:  make(map[*ast.ImplDecl]*KindRef),
+		Copies: make(map[*ast.Expr]bool),
+		Refs:   make(map[*ast.Identifier]*Ref),
+	}
+}
+
+// 记录表达式的类型
+func (m *Module) recordType(expr *ast.Expr, kind *KindRef) {
+	if kind != nil {
+		m.compiler.Info.Types[expr] = kind
+	}
+}
+
+// 推断并记录表达式的类型，推断失败时不记录（错误由编译过程报告）
+func (m *Module) recordInferredType(expr *ast.Expr) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*diagnostic.Diagnostic); !ok {
+				panic(r)
+			}
+		}
+	}()
+	m.recordType(expr, m.tryInferKind(expr))
+}
+
+// 记录表达式引用的值
+func (m *Module) recordUse(expr *ast.Expr, value Value) {
+	if value != nil {
+		m.compiler.Info.Uses[expr] = value
+	}
+}
+
+// 记录声明的值
+func (m *Module) recordDef(name *ast.Identifier, value Value) {
+	m.compiler.Info.Defs[name] = value
+	m.recordRef(name, m.compiler.valueSymbol(value), true)
+}
+
+/* accessors */
+
+// Code 返回模块的字节码
+func (m *Module) Code() *bytecode.Module {
+	return m.code
+}
+
+// Kind 返回类型引用当前指向的类型
+func (k *KindRef) Kind() Kind {
+	return k.current
+}
+
+// Name 返回具名类型的名称，匿名类型返回空字符串
+func (k *KindRef) Name() string {
+	return k.name
+}
+
+// Module 返回类型所在的模块
+func (k *KindRef) Module() *Module {
+	return k.module
+}
+
+// Module 返回函数所在的模块
+func (v *FuncValue) Module() *Module {
+	return v.module
+}
+
+// Module 返回变量所在的模块
+func (v *VarValue) Module() *Module {
+	return v.module
+}
+
+// Underlying 返回类型的底层类型（去除 self 及自定义类型）
+func Underlying(kind *KindRef) *KindRef {
+	return getUnderlyingKind(kind)
+}
+
+// ResolveSelf 返回 self 类型指向的类型
+func ResolveSelf(kind *KindRef) *KindRef {
+	return resolveSelfKind(kind)
+}
+
+// StructFields 返回结构体的所有字段（包含继承的字段）
+func StructFields(kind *KindRef) map[string]*KindRef {
+	return getStructFields(resolveSelfKind(kind))
+}
+
+// FindMethod 查找类型实现的方法，结构体会继续查找继承的结构体
+func FindMethod(kind *KindRef, name string) *FuncValue {
+	kind = resolveSelfKind(kind)
+	if impl := kind.current.getImpl(); impl != nil {
+		if value := impl.getFunc(name); value != nil {
+			return value
+		}
+	}
+	if t, ok := kind.current.(*TStruct); ok {
+		for _, extend := range t.Extends {
+			if value := FindMethod(extend, name); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// KindDecl 返回具名类型的声明（包含名称及所在模块），匿名类型返回 nil
+func (c *Compiler) KindDecl(kind *KindRef) *KindRef {
+	return c.kindDecls[resolveSelfKind(kind).current]
+}
@@ -3,21 +3,34 @@ package compiler
 import (
 	"errors"
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"github.com/peakchen90/noah-lang/internal/parser"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// 模块存在语法错误
+var errSyntax = errors.New("syntax error")
+
 type Module struct {
 	Ast      *ast.File
 	compiler *Compiler
 	moduleId string
 	path     string
+	source   []rune
 	parser   *parser.Parser
 	exports  *Scope
 	scopes   *ScopeStack
 
+	/* code generation */
+	code          *bytecode.Module // 编译产物
+	fn            *funcState       // 正在生成指令的函数
+	kindConstants map[Kind]int
+	lineStarts    []int
+
 	/* context flags */
 	state       ModuleState
 	allowImport bool
@@ -25,10 +38,11 @@ type Module struct {
 
 func NewModule(compiler *Compiler) *Module {
 	module := &Module{
-		compiler:    compiler,
-		exports:     newScope(),
-		state:       ModuleInit,
-		allowImport: true,
+		compiler:      compiler,
+		exports:       newScope(),
+		kindConstants: make(map[Kind]int),
+		state:         ModuleInit,
+		allowImport:   true,
 	}
 	module.scopes = newScopeStack(module)
 	return module
@@ -71,7 +85,9 @@ func (m *Module) resolve(moduleId string) (*Module, error) {
 
 	m.moduleId = moduleId
 	m.path = modulePath
+	m.code = bytecode.NewModule(moduleId)
 	m.compiler.Modules.add(m)
+	m.compiler.Program.AddModule(m.code)
 
 	return m, nil
 }
@@ -88,8 +104,19 @@ func (m *Module) parse() error {
 		return err
 	}
 
-	m.parser = parser.NewParser(string(code), m.moduleId)
+	source := string(code)
+	if cursor := m.compiler.cursor; cursor != nil && cursor.moduleId == m.moduleId {
+		source = cursor.patch(source)
+	}
+	m.parser = parser.NewParser(source, m.moduleId)
 	m.Ast = m.parser.Parse()
+	m.source = m.parser.Source()
+
+	diagnostics := m.parser.Diagnostics()
+	m.compiler.Diagnostics = append(m.compiler.Diagnostics, diagnostics...)
+	if diagnostic.HasError(diagnostics) {
+		return errSyntax
+	}
 
 	return nil
 }
@@ -101,7 +128,8 @@ func (m *Module) precompile() {
 	}
 	m.state = ModulePrecompile
 
-	// push scope : 将顶层定义全部放在这里
+	// push scope : 内置函数在最底层，顶层定义全部放在其上
+	m.scopes.pushPrelude()
 	m.scopes.push()
 
 	for _, stmt := range m.Ast.Body {
@@ -110,25 +138,27 @@ func (m *Module) precompile() {
 			m.allowImport = false
 		}
 
-		switch stmt.Node.(type) {
-		case *ast.ImportDecl:
-			if !m.allowImport {
-				m.unexpectedPos(stmt.Start, "`import` should be at the top of the file")
+		m.recoverDecl(func() {
+			switch stmt.Node.(type) {
+			case *ast.ImportDecl:
+				if !m.allowImport {
+					m.unexpectedAt(stmt.Position, "`import` should be at the top of the file")
+				}
+				m.compileImportDecl(stmt.Node.(*ast.ImportDecl), true)
+			case *ast.FuncDecl:
+				m.compileFuncSign(stmt.Node.(*ast.FuncDecl), nil, true)
+			case *ast.VarDecl:
+				m.compileVarDecl(stmt.Node.(*ast.VarDecl), true)
+			case *ast.TTypeDecl:
+				m.compileTTypeDecl(stmt.Node.(*ast.TTypeDecl), true)
+			case *ast.TInterfaceDecl:
+				m.compileTInterfaceDecl(stmt.Node.(*ast.TInterfaceDecl), true)
+			case *ast.TStructDecl:
+				m.compileTStructDecl(stmt.Node.(*ast.TStructDecl), true)
+			case *ast.TEnumDecl:
+				m.compileTEnumDecl(stmt.Node.(*ast.TEnumDecl), true)
 			}
-			m.compileImportDecl(stmt.Node.(*ast.ImportDecl), true)
-		case *ast.FuncDecl:
-			m.compileFuncSign(stmt.Node.(*ast.FuncDecl), nil, true)
-		case *ast.VarDecl:
-			m.compileVarDecl(stmt.Node.(*ast.VarDecl), true)
-		case *ast.TTypeDecl:
-			m.compileTTypeDecl(stmt.Node.(*ast.TTypeDecl), true)
-		case *ast.TInterfaceDecl:
-			m.compileTInterfaceDecl(stmt.Node.(*ast.TInterfaceDecl), true)
-		case *ast.TStructDecl:
-			m.compileTStructDecl(stmt.Node.(*ast.TStructDecl), true)
-		case *ast.TEnumDecl:
-			m.compileTEnumDecl(stmt.Node.(*ast.TEnumDecl), true)
-		}
+		})
 	}
 }
 
@@ -140,50 +170,140 @@ func (m *Module) compile() {
 	m.state = ModuleCompile
 
 	fns := make([]*ast.Stmt, 0, helper.DefaultCap)
-	vars := make([]*ast.Stmt, 0, helper.DefaultCap)
+	inits := make([]*ast.Stmt, 0, helper.DefaultCap) // 全局变量及顶层的可执行语句
 
 	// 1. 优先编译 类型声明、模块引入
 	for _, stmt := range m.Ast.Body {
 		switch stmt.Node.(type) {
 		case *ast.FuncDecl, *ast.ImplDecl:
 			fns = append(fns, stmt)
-		case *ast.VarDecl:
-			vars = append(vars, stmt)
+		case *ast.ImportDecl, *ast.TTypeDecl, *ast.TInterfaceDecl, *ast.TStructDecl, *ast.TEnumDecl:
+			m.recoverDecl(func() { m.compileStmt(stmt) })
 		default:
-			m.compileStmt(stmt)
+			inits = append(inits, stmt)
 		}
 	}
 
 	// 2. 其次编译函数签名
 	for _, stmt := range fns {
-		switch stmt.Node.(type) {
-		case *ast.FuncDecl:
-			m.compileFuncSign(stmt.Node.(*ast.FuncDecl), nil, false)
-		case *ast.ImplDecl:
-			m.compileImplDecl(stmt.Node.(*ast.ImplDecl), true)
-		default:
-			panic("Internal Err")
-		}
+		m.recoverDecl(func() {
+			switch stmt.Node.(type) {
+			case *ast.FuncDecl:
+				m.compileFuncSign(stmt.Node.(*ast.FuncDecl), nil, false)
+			case *ast.ImplDecl:
+				m.compileImplDecl(stmt.Node.(*ast.ImplDecl), true)
+			default:
+				panic("Internal Err")
+			}
+		})
 	}
 
-	// 3. 编译全局变量（变量可能依赖类型定义、函数返回值等）
-	for _, stmt := range vars {
-		m.compileVarDecl(stmt.Node.(*ast.VarDecl), false)
+	// 3. 编译模块初始化函数（全局变量可能依赖类型定义、函数返回值等）
+	if len(inits) > 0 {
+		fn := bytecode.NewFunction("<init>")
+		m.code.Init = m.code.AddFunction(fn)
+		m.beginFunc(fn).isInit = true
+		for _, stmt := range inits {
+			m.recoverDecl(func() { m.compileStmt(stmt) })
+		}
+		m.endFunc()
 	}
 
 	// 4. 编译函数（函数体内部可能依赖其他函数、全局变量）
 	for _, stmt := range fns {
-		switch stmt.Node.(type) {
-		case *ast.FuncDecl:
-			m.compileFuncDecl(stmt.Node.(*ast.FuncDecl), nil)
-		case *ast.ImplDecl:
-			m.compileImplDecl(stmt.Node.(*ast.ImplDecl), false)
-		default:
-			panic("Internal Err")
+		m.recoverDecl(func() {
+			switch stmt.Node.(type) {
+			case *ast.FuncDecl:
+				m.compileFuncDecl(stmt.Node.(*ast.FuncDecl), nil)
+			case *ast.ImplDecl:
+				m.compileImplDecl(stmt.Node.(*ast.ImplDecl), false)
+			default:
+				panic("Internal Err")
+			}
+		})
+	}
+
+	m.compileExports()
+}
+
+// 记录模块导出的符号，按名称排序
+func (m *Module) compileExports() {
+	names := make([]string, 0, len(m.exports.value)+len(m.exports.kind))
+	for name := range m.exports.value {
+		names = append(names, name)
+	}
+	for name := range m.exports.kind {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if kind := m.exports.getKind(name); kind != nil {
+			m.code.Exports = append(m.code.Exports, &bytecode.Export{
+				Name:  name,
+				Type:  bytecode.ExportKind,
+				Index: m.kindConstant(kind),
+			})
+			continue
+		}
+
+		switch value := m.exports.getValue(name).(type) {
+		case *FuncValue:
+			m.code.Exports = append(m.code.Exports, &bytecode.Export{Name: name, Type: bytecode.ExportFunc, Index: value.Ptr})
+		case *VarValue:
+			m.code.Exports = append(m.code.Exports, &bytecode.Export{Name: name, Type: bytecode.ExportGlobal, Index: value.Ptr})
 		}
 	}
 }
 
+// Id 返回模块 id
+func (m *Module) Id() string {
+	return m.moduleId
+}
+
+// Path 返回模块文件的路径
+func (m *Module) Path() string {
+	return m.path
+}
+
+// Source 返回模块源代码字符
+func (m *Module) Source() []rune {
+	return m.source
+}
+
 func (m *Module) unexpectedPos(index int, msg string) {
-	m.parser.UnexpectedPos(index, msg)
+	m.unexpectedAt(*ast.NewPosition(index, index), msg)
+}
+
+func (m *Module) unexpectedAt(pos ast.Position, msg string) {
+	m.unexpectedCode(diagnostic.CodeSemantic, pos, msg)
+}
+
+// 记录声明中的语义错误，恢复作用域及函数状态后继续编译后续的声明，
+// 一次编译可以报告多个互不相关的错误（同一个声明中只报告第一个错误）
+func (m *Module) recoverDecl(fn func()) {
+	size, state := m.scopes.size(), m.fn
+	defer func() {
+		if r := recover(); r != nil {
+			d, ok := r.(*diagnostic.Diagnostic)
+			if !ok {
+				// 之前的错误导致声明处于不完整的状态时中止编译，只报告已记录的错误
+				if _, isAbort := r.(abortSignal); !isAbort && m.compiler.HasError() {
+					m.compiler.abort()
+				}
+				panic(r)
+			}
+			m.compiler.addDiagnostic(d)
+			m.scopes.stack = m.scopes.stack[:size]
+			m.fn = state
+		}
+	}()
+	fn()
+}
+
+// 抛出编译错误诊断（由 Compiler 捕获）
+func (m *Module) unexpectedCode(code string, pos ast.Position, msg string) {
+	d := diagnostic.New(code, m.source, pos, msg)
+	d.ModuleId = m.moduleId
+	panic(d)
 }
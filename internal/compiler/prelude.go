@@ -0,0 +1,74 @@
+package compiler
+
+import "github.com/peakchen90/noah-lang/internal/ast"
+
+// 内置函数的签名，类型使用名称表示，空字符串表示没有返回值
+var preludeFuncs = map[string]builtinSig{
+	"print":   {args: []string{"[]any"}, hasRest: true},
+	"println": {args: []string{"[]any"}, hasRest: true},
+	"panic":   {args: []string{"string"}},
+	"assert":  {args: []string{"bool", "[]any"}, hasRest: true},
+	"len":     {args: []string{"any"}, ret: "number"},
+	"typeof":  {args: []string{"any"}, ret: "string"},
+}
+
+// 创建内置作用域，位于模块顶层作用域之下，模块中同名的声明会覆盖内置函数
+func (m *Module) newPrelude() *Scope {
+	resolve := func(name string) *KindRef {
+		if len(name) == 0 {
+			return nil
+		}
+		ref := newKindRef(m, -1)
+		switch name {
+		case "any":
+			ref.current = typeAny
+		case "[]any":
+			elem := newKindRef(m, -1)
+			elem.current = typeAny
+			ref.current = &TArray{Kind: elem, Len: -1, Impl: newImpl()}
+		case "number":
+			ref.current = typeNumber
+		case "string":
+			ref.current = typeString
+		case "bool":
+			ref.current = typeBool
+		default:
+			panic("Internal Err")
+		}
+		return ref
+	}
+
+	scope := newScope()
+	for name, sig := range preludeFuncs {
+		t := &TFunc{
+			Arguments: make([]*KindRef, len(sig.args)),
+			Return:    resolve(sig.ret),
+			HasRest:   sig.hasRest,
+			Impl:      newImpl(),
+		}
+		for i, arg := range sig.args {
+			t.Arguments[i] = resolve(arg)
+		}
+		kind := newKindRef(m, -1)
+		kind.current = t
+		scope.setValue(name, &BuiltinValue{Name: name, Kind: kind})
+	}
+	return scope
+}
+
+// 校验内置函数的参数：`len` 只能用于字符串及数组
+func (m *Module) checkBuiltinCall(value *BuiltinValue, expr *ast.CallExpr) {
+	if value.Name != "len" || len(expr.Params) != 1 {
+		return
+	}
+	param := expr.Params[0]
+	kind := m.tryInferKind(param)
+	if kind == nil {
+		return
+	}
+	switch getUnderlyingKind(kind).current.(type) {
+	case *TString, *TArray, *TAny:
+		return
+	}
+	m.unexpectedAt(param.Position, "invalid argument for len: "+m.kindString(kind))
+}
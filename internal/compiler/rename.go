@@ -0,0 +1,117 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/helper"
+	"github.com/peakchen90/noah-lang/internal/lexer"
+	"strings"
+)
+
+// Edit 对模块源代码的一处修改，Start 及 End 为字符索引
+type Edit struct {
+	Module  *Module
+	Start   int
+	End     int
+	NewText string
+}
+
+// Rename 将模块中字符索引处标识符的符号重命名为 newName，返回所有模块中需要修改的位置（按模块 id 及位置排序）。
+// 需要在编译成功之后调用；新名称与已有的标识符冲突（重复声明或改变了其他标识符的引用）时返回错误
+func (c *Compiler) Rename(moduleId string, offset int, newName string) ([]*Edit, error) {
+	module, has := c.Modules[moduleId]
+	if !has || module.source == nil {
+		return nil, errors.New("module not found: " + moduleId)
+	}
+	if c.HasError() {
+		return nil, errors.New("cannot rename in a project with errors")
+	}
+	ref := c.Info.RefAt(module, offset)
+	if ref == nil {
+		return nil, fmt.Errorf("no identifier at %s:%d", moduleId, offset)
+	}
+
+	symbol := ref.Symbol
+	switch {
+	case symbol.Tag == SymbolModule:
+		return nil, errors.New("cannot rename module: " + symbol.Name)
+	case symbol.Decl == nil:
+		return nil, errors.New("cannot rename built-in identifier: " + symbol.Name)
+	case strings.IndexByte(symbol.Module.moduleId, ':') >= 0:
+		return nil, errors.New("cannot rename identifier declared in package: " + symbol.Module.moduleId)
+	case newName == "self":
+		return nil, errors.New("cannot rename to reserved identifier: self")
+	case !lexer.IsIdentifier(newName):
+		return nil, errors.New("invalid identifier: " + newName)
+	}
+
+	edits := make([]*Edit, 0, helper.DefaultCap)
+	if newName == symbol.Name {
+		return edits, nil
+	}
+	for _, item := range c.Info.References(symbol) {
+		edits = append(edits, &Edit{Module: item.Module, Start: item.Name.Start, End: item.Name.End, NewText: newName})
+	}
+	if err := c.checkRename(edits, newName); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
+
+// 使用修改后的源代码重新编译，修改的位置应引用同一个符号，且该符号没有其他的引用
+func (c *Compiler) checkRename(edits []*Edit, newName string) error {
+	verify := NewCompiler(c.VirtualFS.Root, c.VirtualFS.isFileSystem)
+	verify.VirtualFS = c.VirtualFS.clone()
+	verify.Entry = c.Entry
+	for i, edit := range edits {
+		if i == 0 || edit.Module != edits[i-1].Module {
+			verify.VirtualFS.SetOverlay(edit.Module.path, []byte(edit.Module.ApplyEdits(edits)))
+		}
+	}
+
+	verify.Compile()
+	for _, d := range verify.Diagnostics {
+		if d.IsError() {
+			return fmt.Errorf("%s collides with an existing identifier: %s (%s:%d:%d)", newName, d.Message, d.ModuleId, d.Line, d.Column)
+		}
+	}
+
+	var renamed *Symbol
+	var last *Module
+	shift := 0
+	for _, edit := range edits {
+		if edit.Module != last {
+			last, shift = edit.Module, 0
+		}
+		var ref *Ref
+		if module, has := verify.Modules[edit.Module.moduleId]; has {
+			ref = verify.Info.RefAt(module, edit.Start+shift)
+		}
+		shift += len([]rune(edit.NewText)) - (edit.End - edit.Start)
+
+		if ref == nil || (renamed != nil && ref.Symbol != renamed) {
+			return errors.New(newName + " collides with an existing identifier")
+		}
+		renamed = ref.Symbol
+	}
+	if len(verify.Info.References(renamed)) != len(edits) {
+		return errors.New(newName + " collides with an existing identifier")
+	}
+	return nil
+}
+
+// ApplyEdits 返回应用修改后的模块源代码，忽略其他模块的修改（同一模块的修改需按位置排序且不重叠）
+func (m *Module) ApplyEdits(edits []*Edit) string {
+	builder := strings.Builder{}
+	index := 0
+	for _, edit := range edits {
+		if edit.Module != m {
+			continue
+		}
+		builder.WriteString(string(m.source[index:edit.Start]))
+		builder.WriteString(edit.NewText)
+		index = edit.End
+	}
+	builder.WriteString(string(m.source[index:]))
+	return builder.String()
+}
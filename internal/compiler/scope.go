@@ -1,16 +1,18 @@
 package compiler
 
 type Scope struct {
-	module map[string]*Module
-	value  map[string]Value
-	kind   map[string]*KindRef
+	module   map[string]*Module
+	value    map[string]Value
+	kind     map[string]*KindRef
+	narrowed map[Value]*KindRef // 通过 `is` 收窄的变量类型
 }
 
 func newScope() *Scope {
 	return &Scope{
-		module: make(map[string]*Module),
-		value:  make(map[string]Value),
-		kind:   make(map[string]*KindRef),
+		module:   make(map[string]*Module),
+		value:    make(map[string]Value),
+		kind:     make(map[string]*KindRef),
+		narrowed: make(map[Value]*KindRef),
 	}
 }
 
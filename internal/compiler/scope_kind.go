@@ -40,6 +40,7 @@ type KindRef struct {
 	current Kind
 	refs    []*KindRef // struct extends、impl interface
 	module  *Module
+	name    string // 具名类型的名称
 }
 
 func newKindRef(module *Module, makeRefsGap int) *KindRef {
@@ -3,6 +3,7 @@ package compiler
 import (
 	"errors"
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"strings"
 )
@@ -37,6 +38,16 @@ func (s *ScopeStack) push() {
 	s.stack = append(s.stack, newScope())
 }
 
+// 压入内置作用域，位于栈底，其上为模块的顶层作用域
+func (s *ScopeStack) pushPrelude() {
+	s.stack = append(s.stack, s.module.newPrelude())
+}
+
+// 判断当前作用域是否为模块的顶层作用域
+func (s *ScopeStack) isTopLevel() bool {
+	return s.size() == 2
+}
+
 func (s *ScopeStack) pop() {
 	size := s.size()
 	if size > 0 {
@@ -49,7 +60,7 @@ func (s *ScopeStack) putModule(name *ast.Identifier, module *Module, isPanic boo
 	if last != nil {
 		if last.has(name.Name) {
 			if isPanic {
-				s.module.unexpectedPos(name.Start, "identifier has already been declared: "+name.Name)
+				s.module.unexpectedAt(name.Position, "identifier has already been declared: "+name.Name)
 			}
 		}
 
@@ -62,7 +73,7 @@ func (s *ScopeStack) putValue(name *ast.Identifier, value Value, isPanic bool) {
 	if last != nil {
 		if last.has(name.Name) {
 			if isPanic {
-				s.module.unexpectedPos(name.Start, "identifier has already been declared: "+name.Name)
+				s.module.unexpectedAt(name.Position, "identifier has already been declared: "+name.Name)
 			}
 		}
 
@@ -82,7 +93,7 @@ func (s *ScopeStack) putKind(name *ast.Identifier, kind *KindRef, isPanic bool)
 	if last != nil {
 		if last.has(name.Name) {
 			if isPanic {
-				s.module.unexpectedPos(name.Start, "identifier has already been declared: "+name.Name)
+				s.module.unexpectedAt(name.Position, "identifier has already been declared: "+name.Name)
 			}
 		}
 
@@ -97,7 +108,33 @@ func (s *ScopeStack) putSelfKind(kind *KindRef) {
 	}
 }
 
+// 在当前作用域中收窄变量的类型
+func (s *ScopeStack) narrow(value Value, kind *KindRef) {
+	last := s.last()
+	if last != nil {
+		last.narrowed[value] = kind
+	}
+}
+
+// 查找变量收窄后的类型，没有收窄时返回 nil
+func (s *ScopeStack) findNarrowed(value Value) *KindRef {
+	for i := s.size() - 1; i >= 0; i-- {
+		if kind, has := s.stack[i].narrowed[value]; has {
+			return kind
+		}
+	}
+	return nil
+}
+
+// 清除变量在所有作用域中的收窄（变量重新赋值后不再收窄）
+func (s *ScopeStack) clearNarrowed(value Value) {
+	for _, scope := range s.stack {
+		delete(scope.narrowed, value)
+	}
+}
+
 func (s *ScopeStack) findModule(name *ast.Identifier, isPanic bool) *Module {
+	s.module.completeAt(name, func() []*CompletionItem { return s.module.scopeItems(true) })
 	for i := s.size() - 1; i >= 0; i-- {
 		module := s.stack[i].getModule(name.Name)
 		if module != nil {
@@ -106,13 +143,14 @@ func (s *ScopeStack) findModule(name *ast.Identifier, isPanic bool) *Module {
 	}
 
 	if isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not defined")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not defined")
 	}
 
 	return nil
 }
 
 func (s *ScopeStack) findValue(name *ast.Identifier, isPanic bool) Value {
+	s.module.completeAt(name, func() []*CompletionItem { return s.module.scopeItems(false) })
 	for i := s.size() - 1; i >= 0; i-- {
 		value := s.stack[i].getValue(name.Name)
 		if value != nil {
@@ -121,7 +159,7 @@ func (s *ScopeStack) findValue(name *ast.Identifier, isPanic bool) Value {
 	}
 
 	if isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not defined")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not defined")
 	}
 
 	return nil
@@ -135,7 +173,7 @@ func (s *ScopeStack) findFuncValue(name *ast.Identifier, isPanic bool) *FuncValu
 	}
 
 	if isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not found")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not found")
 	}
 
 	return nil
@@ -149,7 +187,7 @@ func (s *ScopeStack) findVarValue(name *ast.Identifier, isPanic bool) *VarValue
 	}
 
 	if isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not found")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not found")
 	}
 
 	return nil
@@ -163,89 +201,82 @@ func (s *ScopeStack) findSelfValue(name *ast.Identifier, isPanic bool) *SelfValu
 	}
 
 	if isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not found")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not found")
 	}
 
 	return nil
 }
 
-// TODO
-func (s *ScopeStack) findMemberValue(expr *ast.Expr, isPanic bool) Value {
-	//	memberIdStack := make([]*ast.Expr, 0, helper.DefaultCap)
-	//	current := expr
-	//
-	//outer:
-	//	for {
-	//		switch current.Node.(type) {
-	//		case *ast.MemberExpr:
-	//			node := current.Node.(*ast.MemberExpr)
-	//			if node.Computed {
-	//				// TODO
-	//				s.module.compileExpr(node.Property)
-	//			} else {
-	//				memberIdStack = append(memberIdStack, node.Property)
-	//			}
-	//			current = node.Object
-	//		case *ast.IdentifierLiteral:
-	//			memberIdStack = append(memberIdStack, current)
-	//			break outer
-	//		default:
-	//			panic("Internal Err")
-	//		}
-	//	}
-	//
-	//	var kind *KindRef
-	//	module := s.module
-	//
-	//	handleValue := func(value Value) {
-	//		switch value.(type) {
-	//		case *FuncValue:
-	//		case *VarValue:
-	//		case *SelfValue:
-	//		default:
-	//			panic("Internal Err")
-	//		}
-	//	}
-	//
-	//	handleKind := func(kind *KindRef) {
-	//
-	//	}
-	//
-	//outer:
-	//	for i := len(memberIdStack) - 1; i >= 0; i-- {
-	//		item := memberIdStack[i]
-	//
-	//		switch item.Node.(type) {
-	//		case *ast.IdentifierLiteral:
-	//			node := item.Node.(*ast.IdentifierLiteral)
-	//			if m := module.scopes.findModule(node.Name, false); m != nil {
-	//				module = m
-	//				continue outer
-	//			} else if v := module.scopes.findValue(node.Name, false); v != nil {
-	//				handleValue(v)
-	//			} else if k := module.scopes.findIdentifierKind(node.Name, false); k != nil {
-	//				handleKind(k)
-	//			}
-	//
-	//		}
-	//		node := item.Node.(*ast.IdentifierLiteral)
-	//
-	//		if i > 0 {
-	//			found := module.scopes.findModule(node.Name, false)
-	//			if found == nil {
-	//				break
-	//			}
-	//			module = found
-	//		} else {
-	//			kind = module.scopes.findIdentifierKind(node.Name, false)
-	//		}
-	//	}
-	//
-	//	if kind == nil {
-	//		if isPanic {
-	//			s.module.unexpectedPos(expr.Start, " is not found")
-	//		}
-	//	}
+// 静态成员：模块、值、类型或枚举选项
+type staticMember struct {
+	module *Module
+	value  Value
+	kind   *KindRef
+	choice int // 枚举选项索引，-1 表示不是枚举选项
+}
+
+// 解析标识符或由模块、类型组成的成员表达式（如 `foo.PI`、`Color.Red`），
+// 成员表达式的对象是一个值时（如 `a.b`）返回 nil
+func (s *ScopeStack) findStaticMember(expr *ast.Expr, isPanic bool) *staticMember {
+	switch expr.Node.(type) {
+	case *ast.IdentifierLiteral:
+		name := expr.Node.(*ast.IdentifierLiteral).Name
+		s.module.completeAt(name, func() []*CompletionItem { return s.module.scopeItems(false) })
+		for i := s.size() - 1; i >= 0; i-- {
+			scope := s.stack[i]
+			if value := scope.getValue(name.Name); value != nil {
+				return &staticMember{value: value, choice: -1}
+			}
+			if module := scope.getModule(name.Name); module != nil {
+				return &staticMember{module: module, choice: -1}
+			}
+			if kind := scope.getKind(name.Name); kind != nil {
+				return &staticMember{kind: kind, choice: -1}
+			}
+		}
+
+		if isPanic {
+			s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not defined")
+		}
+	case *ast.MemberExpr:
+		node := expr.Node.(*ast.MemberExpr)
+		if node.Computed {
+			return nil
+		}
+
+		object := s.findStaticMember(node.Object, isPanic)
+		if object == nil || object.value != nil || object.choice >= 0 {
+			return nil
+		}
+
+		name := node.Property.Node.(*ast.IdentifierLiteral).Name
+		if object.module != nil {
+			s.module.completeAt(name, func() []*CompletionItem { return s.module.exportItems(object.module, false) })
+			exports := object.module.exports
+			if value := exports.getValue(name.Name); value != nil {
+				return &staticMember{value: value, choice: -1}
+			}
+			if kind := exports.getKind(name.Name); kind != nil {
+				return &staticMember{kind: kind, choice: -1}
+			}
+			if isPanic {
+				s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not exported from module: "+object.module.moduleId)
+			}
+			return nil
+		}
+
+		enum, ok := object.kind.current.(*TEnum)
+		if ok {
+			s.module.completeAt(name, func() []*CompletionItem { return s.module.choiceItems(object.kind) })
+			index, has := enum.Choices[name.Name]
+			if has {
+				return &staticMember{kind: object.kind, choice: index}
+			}
+			if isPanic {
+				s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, "no enum choice: "+name.Name)
+			}
+		}
+	}
 
 	return nil
 }
@@ -261,10 +292,11 @@ func (s *ScopeStack) findKind(name string) (*KindRef, error) {
 }
 
 func (s *ScopeStack) findIdentifierKind(name *ast.Identifier, isPanic bool) *KindRef {
+	s.module.completeAt(name, func() []*CompletionItem { return s.module.scopeItems(true) })
 	kind, err := s.findKind(name.Name)
 
 	if err != nil && isPanic {
-		s.module.unexpectedPos(name.Start, name.Name+" is not found")
+		s.module.unexpectedCode(diagnostic.CodeUndefined, name.Position, name.Name+" is not found")
 	}
 
 	return kind
@@ -297,22 +329,27 @@ outer:
 		item := memberIdStack[i]
 		node := item.Node.(*ast.TIdentifier)
 		builder.WriteString(node.Name.Name)
+		if module != s.module {
+			s.module.completeAt(node.Name, func() []*CompletionItem { return s.module.exportItems(module, true) })
+		}
 
 		if i > 0 {
 			found := module.scopes.findModule(node.Name, false)
 			if found == nil {
 				break
 			}
+			s.module.recordRef(node.Name, s.module.compiler.moduleSymbol(found), false)
 			module = found
 			builder.WriteByte('.')
 		} else {
 			kind = module.scopes.findIdentifierKind(node.Name, false)
+			s.module.recordRef(node.Name, s.module.compiler.kindSymbol(kind), false)
 		}
 	}
 
 	if kind == nil {
 		if isPanic {
-			s.module.unexpectedPos(kindExpr.Start, builder.String()+" is not found")
+			s.module.unexpectedCode(diagnostic.CodeUndefined, kindExpr.Position, builder.String()+" is not found")
 		}
 	}
 
@@ -328,7 +365,7 @@ func (s *ScopeStack) findSelfKind(kindExpr *ast.KindExpr, isPanic bool) *KindRef
 	kind, err := s.findKind("self")
 
 	if err != nil && isPanic {
-		s.module.unexpectedPos(kindExpr.Start, "`self` is not allowed here")
+		s.module.unexpectedAt(kindExpr.Position, "`self` is not allowed here")
 	}
 
 	return kind
@@ -1,27 +1,42 @@
 package compiler
 
+import "github.com/peakchen90/noah-lang/internal/ast"
+
 type Value interface{ isConst() bool }
 
-func (*FuncValue) isConst() bool   { return false }
-func (v *VarValue) isConst() bool  { return !v.Const }
-func (v *SelfValue) isConst() bool { return false }
+func (*FuncValue) isConst() bool    { return true }
+func (v *VarValue) isConst() bool   { return v.Const }
+func (v *SelfValue) isConst() bool  { return false }
+func (*BuiltinValue) isConst() bool { return true }
 
 type (
 	FuncValue struct {
-		Name string
-		Kind *KindRef
-		Ptr  uintptr
+		Name   string
+		Kind   *KindRef
+		Ptr    int     // 所在模块的函数索引
+		module *Module // 函数所在模块
 	}
 
 	VarValue struct {
-		Name  string
-		Kind  *KindRef
-		Const bool
-		Ptr   uintptr
+		Name   string
+		Kind   *KindRef
+		Const  bool
+		Ptr    int       // 局部变量或全局变量的槽位
+		Global bool      // 是否为模块全局变量
+		init   *ast.Expr // 初始值，用于计算常量表达式
+		module *Module
+		fn     *funcState // 局部变量所在的函数
 	}
 
 	SelfValue struct {
 		Kind *KindRef
-		Ptr  uintptr
+		Ptr  int // 局部变量槽位，始终为 0
+		fn   *funcState
+	}
+
+	// BuiltinValue 内置函数（如 `println`），定义在每个模块顶层作用域之下的内置作用域中
+	BuiltinValue struct {
+		Name string
+		Kind *KindRef
 	}
 )
@@ -0,0 +1,303 @@
+package compiler
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"sort"
+	"strings"
+)
+
+// SymbolTag 符号的种类
+type SymbolTag int
+
+const (
+	SymbolModule  SymbolTag = iota // 模块
+	SymbolVar                      // 变量及参数
+	SymbolConst                    // 常量
+	SymbolFunc                     // 函数
+	SymbolMethod                   // impl 方法及接口方法
+	SymbolBuiltin                  // 内置函数
+	SymbolType                     // 类型（自定义类型、结构体、接口、枚举）
+	SymbolField                    // 结构体字段
+	SymbolChoice                   // 枚举选项
+)
+
+// Symbol 声明的符号，同一个声明的所有引用共用一个符号
+type Symbol struct {
+	Tag    SymbolTag
+	Name   string
+	Module *Module         // 声明所在的模块，内置函数为 nil
+	Decl   *ast.Identifier // 声明的标识符，模块及内置函数为 nil
+	Type   *KindRef        // 值的类型、字段的类型或类型本身
+	Owner  *KindRef        // 方法、字段及枚举选项所属的类型
+}
+
+// Ref 标识符在模块中的一次出现（声明或引用）
+type Ref struct {
+	Module *Module
+	Name   *ast.Identifier
+	Symbol *Symbol
+	IsDecl bool
+}
+
+// 类型成员（字段、接口方法、枚举选项）的键
+type memberKey struct {
+	owner Kind
+	name  string
+}
+
+/* record */
+
+// 记录标识符对应的符号
+func (m *Module) recordRef(name *ast.Identifier, symbol *Symbol, isDecl bool) {
+	if symbol == nil {
+		return
+	}
+	if isDecl {
+		symbol.Module = m
+		symbol.Decl = name
+	}
+	m.compiler.Info.Refs[name] = &Ref{Module: m, Name: name, Symbol: symbol, IsDecl: isDecl}
+}
+
+// 记录标识符或静态成员表达式（如 `foo.PI`、`Color.Red`）中每个标识符引用的符号
+func (m *Module) recordStaticRefs(expr *ast.Expr) {
+	member := m.scopes.findStaticMember(expr, false)
+	if member == nil {
+		return
+	}
+
+	var name *ast.Identifier
+	switch expr.Node.(type) {
+	case *ast.IdentifierLiteral:
+		name = expr.Node.(*ast.IdentifierLiteral).Name
+	case *ast.MemberExpr:
+		node := expr.Node.(*ast.MemberExpr)
+		m.recordStaticRefs(node.Object)
+		name = node.Property.Node.(*ast.IdentifierLiteral).Name
+	}
+
+	switch {
+	case member.value != nil:
+		m.recordRef(name, m.compiler.valueSymbol(member.value), false)
+	case member.module != nil:
+		m.recordRef(name, m.compiler.moduleSymbol(member.module), false)
+	case member.choice >= 0:
+		m.recordRef(name, m.compiler.memberSymbol(member.kind, name.Name, SymbolChoice), false)
+	default:
+		m.recordRef(name, m.compiler.kindSymbol(member.kind), false)
+	}
+}
+
+// 记录属性访问（如 `p.x`、`p.sum()`）引用的字段或方法，无法推断对象的类型时不记录
+func (m *Module) recordPropertyRef(object *ast.Expr, name *ast.Identifier) {
+	kind := m.tryInferKind(object)
+	if kind == nil {
+		return
+	}
+
+	underlying := getUnderlyingKind(kind)
+	switch underlying.current.(type) {
+	case *TStruct:
+		if owner := findFieldOwner(underlying, name.Name); owner != nil {
+			m.recordRef(name, m.compiler.memberSymbol(owner, name.Name, SymbolField), false)
+			return
+		}
+	case *TInterface:
+		if _, has := underlying.current.(*TInterface).Properties[name.Name]; has {
+			m.recordRef(name, m.compiler.memberSymbol(underlying, name.Name, SymbolMethod), false)
+			return
+		}
+	}
+	if value := m.findMethod(kind, name.Name); value != nil {
+		m.recordRef(name, m.compiler.valueSymbol(value), false)
+	}
+}
+
+// 声明字段的结构体，子结构体的字段覆盖继承的字段
+func findFieldOwner(kind *KindRef, name string) *KindRef {
+	var owner *KindRef
+	walkStruct(kind, func(item *KindRef) {
+		if _, has := item.current.(*TStruct).Properties[name]; has {
+			owner = item
+		}
+	}, true)
+	return owner
+}
+
+/* symbols */
+
+// 值对应的符号，self 没有符号
+func (c *Compiler) valueSymbol(value Value) *Symbol {
+	if symbol, has := c.symbols[value]; has {
+		return symbol
+	}
+
+	var symbol *Symbol
+	switch value.(type) {
+	case *FuncValue:
+		v := value.(*FuncValue)
+		symbol = &Symbol{Tag: SymbolFunc, Name: v.Name, Module: v.module, Type: v.Kind}
+	case *VarValue:
+		v := value.(*VarValue)
+		symbol = &Symbol{Tag: SymbolVar, Name: v.Name, Module: v.module, Type: v.Kind}
+		if v.Const {
+			symbol.Tag = SymbolConst
+		}
+	case *BuiltinValue:
+		v := value.(*BuiltinValue)
+		symbol = &Symbol{Tag: SymbolBuiltin, Name: v.Name, Type: v.Kind}
+	default:
+		return nil
+	}
+	c.symbols[value] = symbol
+	return symbol
+}
+
+func (c *Compiler) moduleSymbol(module *Module) *Symbol {
+	if symbol, has := c.symbols[module]; has {
+		return symbol
+	}
+	symbol := &Symbol{Tag: SymbolModule, Name: module.moduleId, Module: module}
+	c.symbols[module] = symbol
+	return symbol
+}
+
+// 具名类型对应的符号，匿名类型没有符号
+func (c *Compiler) kindSymbol(kind *KindRef) *Symbol {
+	if kind == nil || len(kind.name) == 0 {
+		return nil
+	}
+	if symbol, has := c.symbols[kind]; has {
+		return symbol
+	}
+	symbol := &Symbol{Tag: SymbolType, Name: kind.name, Module: kind.module, Type: kind}
+	c.symbols[kind] = symbol
+	return symbol
+}
+
+// 类型成员（字段、接口方法、枚举选项）对应的符号
+func (c *Compiler) memberSymbol(owner *KindRef, name string, tag SymbolTag) *Symbol {
+	key := memberKey{owner: owner.current, name: name}
+	if symbol, has := c.symbols[key]; has {
+		return symbol
+	}
+	if decl := c.KindDecl(owner); decl != nil {
+		owner = decl
+	}
+
+	symbol := &Symbol{Tag: tag, Name: name, Module: owner.module, Owner: owner}
+	switch owner.current.(type) {
+	case *TStruct:
+		symbol.Type = owner.current.(*TStruct).Properties[name]
+	case *TInterface:
+		symbol.Type = owner.current.(*TInterface).Properties[name]
+	case *TEnum:
+		symbol.Type = owner
+	}
+	c.symbols[key] = symbol
+	return symbol
+}
+
+/* queries */
+
+// RefAt 返回模块中位于字符索引处的标识符（包含标识符的结尾），没有时返回 nil
+func (i *Info) RefAt(module *Module, offset int) *Ref {
+	for name, ref := range i.Refs {
+		if ref.Module == module && name.Start <= offset && offset <= name.End {
+			return ref
+		}
+	}
+	return nil
+}
+
+// References 返回符号的所有出现（包含声明），按模块 id 及位置排序
+func (i *Info) References(symbol *Symbol) []*Ref {
+	result := make([]*Ref, 0)
+	for _, ref := range i.Refs {
+		if ref.Symbol == symbol {
+			result = append(result, ref)
+		}
+	}
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Module != result[b].Module {
+			return result[a].Module.moduleId < result[b].Module.moduleId
+		}
+		return result[a].Name.Start < result[b].Name.Start
+	})
+	return result
+}
+
+// Signature 返回符号的描述，如 `fn add(number, number) -> number`、`field Point.x: number`
+func (s *Symbol) Signature() string {
+	kindString := func(kind *KindRef) string {
+		if kind == nil || kind.module == nil {
+			return "unknown"
+		}
+		return kind.module.kindString(kind)
+	}
+	owner := ""
+	if s.Owner != nil && len(s.Owner.name) > 0 {
+		owner = s.Owner.name + "."
+	}
+
+	switch s.Tag {
+	case SymbolModule:
+		return "module " + s.Name
+	case SymbolVar:
+		return "let " + s.Name + ": " + kindString(s.Type)
+	case SymbolConst:
+		return "const " + s.Name + ": " + kindString(s.Type)
+	case SymbolFunc, SymbolMethod, SymbolBuiltin:
+		return "fn " + owner + s.Name + strings.TrimPrefix(kindString(s.Type), "fn")
+	case SymbolField:
+		return "field " + owner + s.Name + ": " + kindString(s.Type)
+	case SymbolChoice:
+		return "choice " + owner + s.Name
+	case SymbolType:
+		switch s.Type.current.(type) {
+		case *TStruct:
+			return "struct " + s.Name
+		case *TInterface:
+			return "interface " + s.Name
+		case *TEnum:
+			return "enum " + s.Name
+		case *TCustom:
+			return "type " + s.Name + " " + kindString(s.Type.current.(*TCustom).Kind)
+		}
+		return "type " + s.Name
+	}
+	return s.Name
+}
+
+// Doc 返回声明上方紧邻的 `//` 注释（去除注释符号），没有时返回空字符串
+func (s *Symbol) Doc() string {
+	if s.Module == nil || s.Decl == nil {
+		return ""
+	}
+	source := s.Module.source
+
+	// 声明所在行的行首
+	start := s.Decl.Start
+	for start > 0 && source[start-1] != '\n' {
+		start--
+	}
+
+	lines := make([]string, 0)
+	for start > 0 {
+		end := start - 1
+		start = end
+		for start > 0 && source[start-1] != '\n' {
+			start--
+		}
+		line := strings.TrimSpace(string(source[start:end]))
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(line, "//")))
+	}
+
+	for a, b := 0, len(lines)-1; a < b; a, b = a+1, b-1 {
+		lines[a], lines[b] = lines[b], lines[a]
+	}
+	return strings.Join(lines, "\n")
+}
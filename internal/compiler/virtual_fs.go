@@ -12,6 +12,7 @@ type VirtualFS struct {
 	PackageRoot  string
 	isFileSystem bool
 	files        map[string][]byte
+	overlay      map[string][]byte // 优先于文件系统读取的内容（如编辑器中未保存的文件）
 }
 
 func newVirtualFS(root string, isFileSystem bool) *VirtualFS {
@@ -41,10 +42,34 @@ func newVirtualFS(root string, isFileSystem bool) *VirtualFS {
 		PackageRoot:  packageRoot,
 		isFileSystem: isFileSystem,
 		files:        make(map[string][]byte),
+		overlay:      make(map[string][]byte),
+	}
+}
+
+// SetOverlay 设置文件的内容，读取该文件时不再访问文件系统
+func (v *VirtualFS) SetOverlay(filename string, buffer []byte) {
+	v.overlay[filename] = buffer
+}
+
+// 复制虚拟文件系统，共用文件内容，覆盖的内容相互独立
+func (v *VirtualFS) clone() *VirtualFS {
+	overlay := make(map[string][]byte, len(v.overlay))
+	for filename, buffer := range v.overlay {
+		overlay[filename] = buffer
+	}
+	return &VirtualFS{
+		Root:         v.Root,
+		PackageRoot:  v.PackageRoot,
+		isFileSystem: v.isFileSystem,
+		files:        v.files,
+		overlay:      overlay,
 	}
 }
 
 func (v *VirtualFS) ReadFile(filename string) ([]byte, error) {
+	if buffer, has := v.overlay[filename]; has {
+		return buffer, nil
+	}
 	if v.isFileSystem {
 		return os.ReadFile(filename)
 	}
@@ -75,6 +100,9 @@ func (v *VirtualFS) Remove(filename string) error {
 }
 
 func (v *VirtualFS) ExistFile(filename string) bool {
+	if _, has := v.overlay[filename]; has {
+		return true
+	}
 	if v.isFileSystem {
 		s, err := os.Stat(filename)
 		return err == nil && !s.IsDir()
@@ -0,0 +1,84 @@
+package diagnostic
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/helper"
+)
+
+type Severity uint8
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "unknown"
+}
+
+// 诊断码
+const (
+	CodeLexical     = "E0001" // 词法错误
+	CodeSyntax      = "E0002" // 语法错误
+	CodeModule      = "E0003" // 模块解析错误
+	CodeUndefined   = "E0004" // 标识符未定义
+	CodeSemantic    = "E0005" // 其他语义错误
+	CodeUnsupported = "E0006" // 代码生成暂不支持的特性
+)
+
+// Diagnostic 诊断信息
+type Diagnostic struct {
+	Severity Severity
+	ModuleId string
+	ast.Position
+	Line    int // 从 1 开始
+	Column  int // 从 1 开始
+	Code    string
+	Message string
+}
+
+// New 创建一个错误诊断，source 用于计算行列信息（可为 nil）
+func New(code string, source []rune, pos ast.Position, message string) *Diagnostic {
+	d := &Diagnostic{
+		Severity: SeverityError,
+		Position: pos,
+		Code:     code,
+		Message:  message,
+	}
+	d.Locate(source)
+	return d
+}
+
+// Locate 根据源码计算行列信息
+func (d *Diagnostic) Locate(source []rune) {
+	if source == nil {
+		d.Line, d.Column = 1, 1
+		return
+	}
+	d.Line, d.Column = helper.GetSourcePosition(source, d.Start)
+}
+
+func (d *Diagnostic) IsError() bool {
+	return d.Severity == SeverityError
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s[%s]: %s", d.ModuleId, d.Line, d.Column, d.Severity, d.Code, d.Message)
+}
+
+// HasError 判断是否存在错误级别的诊断
+func HasError(list []*Diagnostic) bool {
+	for _, d := range list {
+		if d.IsError() {
+			return true
+		}
+	}
+	return false
+}
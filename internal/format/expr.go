@@ -0,0 +1,357 @@
+package format
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/lexer"
+)
+
+// 原子表达式（标识符、字面量、调用及成员访问）的优先级，高于所有运算符
+const atomPrecedence = 16
+
+func (p *printer) expr(expr *ast.Expr) {
+	p.inlineComments(expr.Start)
+
+	switch expr.Node.(type) {
+	case *ast.CallExpr:
+		node := expr.Node.(*ast.CallExpr)
+		p.expr(node.Callee)
+		p.write("(")
+		for i, param := range node.Params {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(param)
+		}
+		p.write(")")
+	case *ast.MemberExpr:
+		node := expr.Node.(*ast.MemberExpr)
+		p.expr(node.Object)
+		if node.Computed {
+			p.write("[")
+			p.expr(node.Property)
+			p.write("]")
+		} else {
+			p.write(".")
+			p.expr(node.Property)
+		}
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		p.operand(node.Left, leftNeedsParen(expr))
+		p.write(" " + node.Operator.Value + " ")
+		p.operand(node.Right, rightNeedsParen(expr))
+	case *ast.BinaryTypeExpr:
+		node := expr.Node.(*ast.BinaryTypeExpr)
+		p.operand(node.Left, leftNeedsParen(expr))
+		p.write(" " + node.Operator.Value + " ")
+		p.kind(node.Right)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		if node.Prefix {
+			p.write(node.Operator.Value)
+			p.operand(node.Argument, rightNeedsParen(expr))
+		} else {
+			p.expr(node.Argument)
+			p.write(node.Operator.Value)
+		}
+	case *ast.FuncExpr:
+		node := expr.Node.(*ast.FuncExpr)
+		p.write("fn")
+		p.signature(node.FuncKind)
+		p.write(" ")
+		p.block(node.Body)
+	case *ast.StructExpr:
+		p.structExpr(expr)
+	case *ast.ArrayExpr:
+		node := expr.Node.(*ast.ArrayExpr)
+		positions := make([]ast.Position, len(node.Items))
+		for i, item := range node.Items {
+			positions[i] = item.Position
+		}
+		p.write("[")
+		p.elements(positions, expr.Start, expr.End, false, func(i int) {
+			p.expr(node.Items[i])
+		})
+		p.write("]")
+	case *ast.IdentifierLiteral:
+		p.write(expr.Node.(*ast.IdentifierLiteral).Name.Name)
+	case *ast.NumberLiteral:
+		p.write(expr.Node.(*ast.NumberLiteral).Text)
+	case *ast.BoolLiteral:
+		p.write(expr.Node.(*ast.BoolLiteral).Text)
+	case *ast.NullLiteral:
+		p.write("null")
+	case *ast.StringLiteral:
+		// 保留原始的转义及原始字符串的写法
+		p.write(string(p.source[expr.Start:expr.End]))
+	case *ast.CharLiteral:
+		// 字符字面量的结束位置不包含闭合的 `'`
+		p.write(string(p.source[expr.Start : expr.End+1]))
+	}
+}
+
+func (p *printer) operand(expr *ast.Expr, paren bool) {
+	if paren {
+		p.write("(")
+		p.expr(expr)
+		p.write(")")
+	} else {
+		p.expr(expr)
+	}
+}
+
+// 输出结构体字面量，`{` 之后换行时每个字段一行并保留末尾的逗号
+func (p *printer) structExpr(expr *ast.Expr) {
+	node := expr.Node.(*ast.StructExpr)
+	start := expr.Start
+	if node.Ctor != nil {
+		p.kind(node.Ctor)
+		p.write(" ")
+		start = node.Ctor.End
+	}
+
+	positions := make([]ast.Position, len(node.Properties))
+	for i, property := range node.Properties {
+		positions[i] = *ast.NewPosition(property.Key.Start, property.Value.End)
+	}
+	p.write("{")
+	p.elements(positions, start, expr.End, true, func(i int) {
+		property := node.Properties[i]
+		p.expr(property.Key)
+		p.write(": ")
+		p.expr(property.Value)
+	})
+	p.write("}")
+}
+
+// 输出括号中的元素：第一个元素与左括号（位于 start 之后）之间换行时每个元素一行，否则在同一行中以逗号分隔，
+// pad 为 true 时在括号内侧添加空格，如 `{ a: 1 }`
+func (p *printer) elements(items []ast.Position, start int, end int, pad bool, item func(i int)) {
+	if len(items) == 0 {
+		if p.hasComments(start, end) {
+			p.lines(items, end, true, item)
+		}
+		return
+	}
+	if p.multiline(start, items[0].Start) {
+		p.lines(items, end, true, item)
+		return
+	}
+
+	if pad {
+		p.write(" ")
+	}
+	for i := range items {
+		if i > 0 {
+			p.write(", ")
+		}
+		item(i)
+	}
+	if pad {
+		p.write(" ")
+	}
+}
+
+/* kind */
+
+func (p *printer) kind(kind *ast.KindExpr) {
+	p.inlineComments(kind.Start)
+
+	switch kind.Node.(type) {
+	case *ast.TNumber:
+		p.write("number")
+	case *ast.TByte:
+		p.write("byte")
+	case *ast.TChar:
+		p.write("char")
+	case *ast.TString:
+		p.write("string")
+	case *ast.TBool:
+		p.write("bool")
+	case *ast.TAny:
+		p.write("any")
+	case *ast.TSelf:
+		p.write("self")
+	case *ast.TArray:
+		node := kind.Node.(*ast.TArray)
+		p.write("[")
+		if node.Len != nil {
+			p.expr(node.Len)
+		}
+		p.write("]")
+		p.kind(node.Kind)
+	case *ast.TIdentifier:
+		p.write(kind.Node.(*ast.TIdentifier).Name.Name)
+	case *ast.TMemberKind:
+		node := kind.Node.(*ast.TMemberKind)
+		p.kind(node.Left)
+		p.write(".")
+		p.kind(node.Right)
+	case *ast.TFuncKind:
+		p.write("fn")
+		p.signature(kind)
+	case *ast.TStructKind:
+		// 类型表达式中的结构体在同一行中输出
+		node := kind.Node.(*ast.TStructKind)
+		p.write("struct ")
+		p.extends(node.Extends)
+		if len(node.Properties) == 0 {
+			p.write("{}")
+			return
+		}
+		p.write("{ ")
+		for i, property := range node.Properties {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(property.Key.Name + ": ")
+			p.kind(property.Kind)
+		}
+		p.write(" }")
+	}
+}
+
+// 输出函数的参数及返回值，如 `(a: number, ...b: []any) -> string`
+func (p *printer) signature(kind *ast.KindExpr) {
+	node := kind.Node.(*ast.TFuncKind)
+	p.write("(")
+	for i, argument := range node.Arguments {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.inlineComments(argument.Start)
+		if argument.Rest {
+			p.write("...")
+		}
+		p.write(argument.Name.Name + ": ")
+		p.kind(argument.Kind)
+	}
+	p.write(")")
+	if node.Return != nil {
+		p.write(" -> ")
+		p.kind(node.Return)
+	}
+}
+
+// 输出结构体继承的类型，如 `<- A, b.B`
+func (p *printer) extends(extends []*ast.KindExpr) {
+	if len(extends) == 0 {
+		return
+	}
+	p.write("<- ")
+	for i, extend := range extends {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.kind(extend)
+	}
+	p.write(" ")
+}
+
+/* precedence */
+
+// 表达式的优先级，与解析时使用的运算符优先级一致
+func precedence(expr *ast.Expr) int8 {
+	switch expr.Node.(type) {
+	case *ast.BinaryExpr:
+		return lexer.BinaryOperator(expr.Node.(*ast.BinaryExpr).Operator.Value).Precedence
+	case *ast.BinaryTypeExpr:
+		return lexer.BinaryOperator(expr.Node.(*ast.BinaryTypeExpr).Operator.Value).Precedence
+	case *ast.UnaryExpr:
+		if expr.Node.(*ast.UnaryExpr).Prefix {
+			return 14
+		}
+		return 15
+	}
+	return atomPrecedence
+}
+
+// 二元表达式的左侧操作数是否需要括号
+func leftNeedsParen(expr *ast.Expr) bool {
+	var left *ast.Expr
+	var operator string
+	switch expr.Node.(type) {
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		left, operator = node.Left, node.Operator.Value
+	case *ast.BinaryTypeExpr:
+		node := expr.Node.(*ast.BinaryTypeExpr)
+		left, operator = node.Left, node.Operator.Value
+	default:
+		return false
+	}
+
+	meta := lexer.BinaryOperator(operator)
+	childPrecedence := precedence(left)
+	return childPrecedence < meta.Precedence || (childPrecedence == meta.Precedence && meta.OpType.IsOpBinaryRTL())
+}
+
+// 二元表达式的右侧操作数或前缀一元表达式的操作数是否需要括号
+func rightNeedsParen(expr *ast.Expr) bool {
+	switch expr.Node.(type) {
+	case *ast.BinaryExpr:
+		node := expr.Node.(*ast.BinaryExpr)
+		meta := lexer.BinaryOperator(node.Operator.Value)
+		childPrecedence := precedence(node.Right)
+		return childPrecedence < meta.Precedence || (childPrecedence == meta.Precedence && meta.OpType.IsOpBinaryLTR())
+	case *ast.UnaryExpr:
+		// 前缀运算符的操作数只能是更高优先级的表达式，如 `-(-a)`、`!(a && b)`
+		return precedence(expr.Node.(*ast.UnaryExpr).Argument) <= precedence(expr)
+	}
+	return false
+}
+
+// 输出的表达式是否以 `(` 开头
+func startsWithParen(expr *ast.Expr) bool {
+	switch expr.Node.(type) {
+	case *ast.BinaryExpr:
+		return leftNeedsParen(expr) || startsWithParen(expr.Node.(*ast.BinaryExpr).Left)
+	case *ast.BinaryTypeExpr:
+		return leftNeedsParen(expr) || startsWithParen(expr.Node.(*ast.BinaryTypeExpr).Left)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		return !node.Prefix && startsWithParen(node.Argument)
+	case *ast.CallExpr:
+		return startsWithParen(expr.Node.(*ast.CallExpr).Callee)
+	case *ast.MemberExpr:
+		return startsWithParen(expr.Node.(*ast.MemberExpr).Object)
+	}
+	return false
+}
+
+// 输出的表达式是否以 `[` 或 `{` 开头
+func startsWithBrace(expr *ast.Expr) bool {
+	switch expr.Node.(type) {
+	case *ast.ArrayExpr:
+		return true
+	case *ast.StructExpr:
+		return expr.Node.(*ast.StructExpr).Ctor == nil
+	case *ast.BinaryExpr:
+		return !leftNeedsParen(expr) && startsWithBrace(expr.Node.(*ast.BinaryExpr).Left)
+	case *ast.BinaryTypeExpr:
+		return !leftNeedsParen(expr) && startsWithBrace(expr.Node.(*ast.BinaryTypeExpr).Left)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		return !node.Prefix && startsWithBrace(node.Argument)
+	case *ast.CallExpr:
+		return startsWithBrace(expr.Node.(*ast.CallExpr).Callee)
+	case *ast.MemberExpr:
+		return startsWithBrace(expr.Node.(*ast.MemberExpr).Object)
+	}
+	return false
+}
+
+// 输出的表达式是否以标识符或属性访问结尾，之后紧跟 `{` 时会被解析为结构体字面量
+func endsWithName(expr *ast.Expr) bool {
+	switch expr.Node.(type) {
+	case *ast.IdentifierLiteral:
+		return true
+	case *ast.MemberExpr:
+		return !expr.Node.(*ast.MemberExpr).Computed
+	case *ast.BinaryExpr:
+		return !rightNeedsParen(expr) && endsWithName(expr.Node.(*ast.BinaryExpr).Right)
+	case *ast.UnaryExpr:
+		node := expr.Node.(*ast.UnaryExpr)
+		return node.Prefix && !rightNeedsParen(expr) && endsWithName(node.Argument)
+	}
+	return false
+}
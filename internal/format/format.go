@@ -0,0 +1,168 @@
+package format
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/parser"
+	"strings"
+)
+
+// 缩进的单位
+const indentUnit = "    "
+
+// Source 格式化源代码，存在语法错误时返回第一个语法错误（*diagnostic.Diagnostic）
+func Source(code string, name string) (string, error) {
+	p := parser.NewParser(code, name)
+	file := p.Parse()
+	for _, d := range p.Diagnostics() {
+		if d.IsError() {
+			return "", d
+		}
+	}
+
+	printer := &printer{
+		source:    p.Source(),
+		comments:  file.Comments,
+		printed:   make([]bool, len(file.Comments)),
+		lineStart: true,
+	}
+	printer.stmtList(file.Body, len(printer.source))
+	return printer.builder.String(), nil
+}
+
+type printer struct {
+	source    []rune
+	comments  []*ast.Comment
+	printed   []bool // 注释是否已经输出
+	builder   strings.Builder
+	indent    int
+	lineStart bool // 位于行首，尚未输出缩进
+	blank     bool // 上一行为空行
+	last      byte // 最后输出的非换行字符
+	pos       int  // 已输出内容在源代码中的结束位置，用于判断空行
+}
+
+/* output */
+
+func (p *printer) write(text string) {
+	if p.lineStart {
+		p.builder.WriteString(strings.Repeat(indentUnit, p.indent))
+		p.lineStart = false
+	}
+	if len(text) > 0 {
+		p.builder.WriteString(text)
+		p.blank = false
+		p.last = text[len(text)-1]
+	}
+}
+
+// 结束当前行，已位于行首时忽略
+func (p *printer) line() {
+	if !p.lineStart {
+		p.builder.WriteString("\n")
+		p.lineStart = true
+	}
+}
+
+// 输出一个空行，文件开头、左括号之后及已有空行时忽略
+func (p *printer) blankLine() {
+	p.line()
+	if p.builder.Len() == 0 || p.blank || p.last == '{' || p.last == '[' || p.last == '(' {
+		return
+	}
+	p.builder.WriteString("\n")
+	p.blank = true
+}
+
+// 源代码中已输出的内容与 start 之间存在空行时输出一个空行（连续的空行合并为一个）
+func (p *printer) separate(start int) {
+	if p.hasBlankLine(p.pos, start) {
+		p.blankLine()
+	}
+}
+
+// 源代码中 start 与 end 之间是否存在空行
+func (p *printer) hasBlankLine(start int, end int) bool {
+	return start < end && strings.Count(string(p.source[start:end]), "\n") >= 2
+}
+
+// 源代码中 start 与 end 之间是否存在换行
+func (p *printer) multiline(start int, end int) bool {
+	return start < end && strings.ContainsRune(string(p.source[start:end]), '\n')
+}
+
+/* comments */
+
+// 输出位于 pos 之前的注释，每个注释单独一行
+func (p *printer) leadingComments(pos int) {
+	for i, comment := range p.comments {
+		if p.printed[i] || comment.End > pos {
+			continue
+		}
+		p.printed[i] = true
+		p.line()
+		p.separate(comment.Start)
+		p.write(comment.Text)
+		p.line()
+		p.pos = comment.End
+	}
+}
+
+// 输出 end 之后同一行且位于 limit 之前的注释，limit 为外层闭合括号的结束位置，
+// 括号之后的注释属于外层的语句
+func (p *printer) trailingComments(end int, limit int) {
+	p.pos = end
+	for i, comment := range p.comments {
+		if p.printed[i] || comment.Start < end {
+			continue
+		}
+		if comment.End > limit || p.multiline(p.pos, comment.Start) {
+			break
+		}
+		p.printed[i] = true
+		p.write(" " + comment.Text)
+		p.pos = comment.End
+	}
+}
+
+// 输出表达式内部位于 pos 之前的注释，行注释转换为块注释以免影响后续的代码
+func (p *printer) inlineComments(pos int) {
+	for i, comment := range p.comments {
+		if p.printed[i] || comment.End > pos {
+			continue
+		}
+		p.printed[i] = true
+		text := comment.Text
+		if strings.HasPrefix(text, "//") {
+			text = "/*" + strings.ReplaceAll(text[2:], "*/", "* /") + " */"
+		}
+		p.write(text + " ")
+	}
+}
+
+// start 与 end 之间是否存在未输出的注释
+func (p *printer) hasComments(start int, end int) bool {
+	for i, comment := range p.comments {
+		if !p.printed[i] && comment.Start >= start && comment.End <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// 输出多行的列表，每项一行，保留项之间的空行及注释；end 为闭合括号的位置
+func (p *printer) lines(items []ast.Position, end int, comma bool, item func(i int)) {
+	p.line()
+	p.indent++
+	for i, pos := range items {
+		p.leadingComments(pos.Start)
+		p.separate(pos.Start)
+		item(i)
+		if comma {
+			p.write(",")
+		}
+		p.trailingComments(pos.End, end)
+		p.line()
+	}
+	p.leadingComments(end)
+	p.indent--
+}
@@ -0,0 +1,138 @@
+package format
+
+import (
+	"encoding/json"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/peakchen90/noah-lang/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceFiles(t *testing.T) {
+	for _, dir := range []string{"../../examples", "../parser/testdata"} {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".noah" {
+				return err
+			}
+			code, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+
+			first, err := Source(string(code), path)
+			assert.NoError(t, err, path)
+			second, err := Source(first, path)
+			assert.NoError(t, err, path)
+			assert.Equal(t, first, second, path)
+			assert.Equal(t, dumpAST(t, string(code)), dumpAST(t, first), path)
+			assert.Equal(t, commentCount(string(code)), commentCount(first), path)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		code   string
+		expect string
+	}{
+		{
+			"spacing",
+			"let a=1+2*3\nfn f(a:number,...b:[]any)->string{return a}",
+			"let a = 1 + 2 * 3\nfn f(a: number, ...b: []any) -> string {\n    return a\n}\n",
+		},
+		{
+			"parens",
+			"let a = (1 + 2) * 3\nlet b = 1 - (2 - 3)\nlet c = ((a))\nlet d = -(-a)\nlet e = (a = b)",
+			"let a = (1 + 2) * 3\nlet b = 1 - (2 - 3)\nlet c = a\nlet d = -(-a)\nlet e = a = b\n",
+		},
+		{
+			"imports",
+			"import c\nimport a as x // x\nimport b\n\nimport std:z\nlet a = 1",
+			"import a as x // x\nimport b\nimport c\n\nimport std:z\n\nlet a = 1\n",
+		},
+		{
+			"trailing commas",
+			"enum E { A, B }\nstruct S { a: number\n b: string }\nlet p = P {\n a: 1, b: 2 }\nlet q = P {a: 1}",
+			"enum E {\n    A,\n    B,\n}\nstruct S {\n    a: number,\n    b: string,\n}\nlet p = P {\n    a: 1,\n    b: 2,\n}\nlet q = P { a: 1 }\n",
+		},
+		{
+			"comments",
+			"// head\n\n\n\nlet a = 1   // one\n/* block */\nfn f() {\n    // inner\n}\nlet b = /* x */ 2 + // y\n3",
+			"// head\n\nlet a = 1 // one\n/* block */\nfn f() {\n    // inner\n}\nlet b = /* x */ 2 + /* y */ 3\n",
+		},
+		{
+			"closing brace comments",
+			"if (c) { f() } // note\nfn g() { if (c) { f() } /* a */ } // b\nenum E { A } // c",
+			"if (c) {\n    f()\n} // note\nfn g() {\n    if (c) {\n        f()\n    } /* a */\n} // b\nenum E {\n    A,\n} // c\n",
+		},
+		{
+			"conditions",
+			"if (a) { b() }\nif ((a + 1) * 2 > 2) {}\nfor (v: list) {}\nif (!ok) {}\nif (1 > a()) {}",
+			"if (a) {\n    b()\n}\nif ((a + 1) * 2 > 2) {}\nfor (v: list) {}\nif (!ok) {}\nif 1 > a() {}\n",
+		},
+		{
+			"semicolons",
+			"a = 1;\n(b + c) * 2\nlet x = 1\n[1, 2]",
+			"a = 1;\n(b + c) * 2\nlet x = 1;\n[1, 2]\n",
+		},
+	}
+
+	for _, c := range cases {
+		actual, err := Source(c.code, "main")
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expect, actual, c.name)
+
+		again, err := Source(actual, "main")
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, actual, again, c.name)
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	_, err := Source("let a = \nfn", "main")
+	d, ok := err.(*diagnostic.Diagnostic)
+	assert.True(t, ok)
+	assert.Equal(t, "main", d.ModuleId)
+	assert.Equal(t, diagnostic.CodeSyntax, d.Code)
+}
+
+// 去除位置信息后的语法树，用于比较格式化前后的语法树是否一致
+func dumpAST(t *testing.T, code string) interface{} {
+	p := parser.NewParser(code, "main")
+	file := p.Parse()
+	assert.Empty(t, p.Diagnostics())
+
+	data, err := json.Marshal(file.Body)
+	assert.NoError(t, err)
+	var value interface{}
+	assert.NoError(t, json.Unmarshal(data, &value))
+	return stripPosition(value)
+}
+
+func stripPosition(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		delete(object, "Start")
+		delete(object, "End")
+		for key, item := range object {
+			object[key] = stripPosition(item)
+		}
+	case []interface{}:
+		list := value.([]interface{})
+		for i, item := range list {
+			list[i] = stripPosition(item)
+		}
+	}
+	return value
+}
+
+func commentCount(code string) int {
+	p := parser.NewParser(code, "main")
+	return len(p.Parse().Comments)
+}
@@ -0,0 +1,317 @@
+package format
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"sort"
+	"strings"
+)
+
+// 输出语句列表，保留语句之间的空行（最多一个）及注释；end 为列表的结束位置（闭合的 `}` 或文件末尾）
+func (p *printer) stmtList(list []*ast.Stmt, end int) {
+	for i := 0; i < len(list); i++ {
+		stmt := list[i]
+		if i > 0 && isImport(list[i-1]) && !isImport(stmt) {
+			p.blankLine()
+		}
+
+		p.leadingComments(stmt.Start)
+		p.separate(stmt.Start)
+		if isImport(stmt) {
+			i = p.importGroup(list, i) - 1
+			continue
+		}
+
+		p.stmt(stmt)
+		// 下一条语句以括号开头时会被当作调用、下标访问或结构体的一部分，需要使用分号分隔
+		if i+1 < len(list) && startsWithBracket(list[i+1]) {
+			p.write(";")
+		}
+		p.trailingComments(stmt.End, end)
+		p.line()
+	}
+	p.leadingComments(end)
+}
+
+func isImport(stmt *ast.Stmt) bool {
+	_, ok := stmt.Node.(*ast.ImportDecl)
+	return ok
+}
+
+func startsWithBracket(stmt *ast.Stmt) bool {
+	if node, ok := stmt.Node.(*ast.ExprStmt); ok {
+		return startsWithParen(node.Expression) || startsWithBrace(node.Expression)
+	}
+	return false
+}
+
+// 输出从 start 开始的一组连续（没有空行及单独一行的注释）的 import 语句，按路径排序，返回下一条语句的索引
+func (p *printer) importGroup(list []*ast.Stmt, start int) int {
+	type item struct {
+		path     string
+		comments []int // 同一行的注释
+	}
+
+	items := make([]*item, 0, len(list)-start)
+	end := start
+	for end < len(list) && isImport(list[end]) {
+		stmt := list[end]
+		if end > start && (p.hasBlankLine(p.pos, stmt.Start) || p.hasComments(p.pos, stmt.Start)) {
+			break
+		}
+
+		current := &item{path: importPath(stmt.Node.(*ast.ImportDecl))}
+		p.pos = stmt.End
+		for i, comment := range p.comments {
+			if !p.printed[i] && comment.Start >= stmt.End && !p.multiline(p.pos, comment.Start) {
+				current.comments = append(current.comments, i)
+				p.printed[i] = true
+				p.pos = comment.End
+			}
+		}
+		items = append(items, current)
+		end++
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].path < items[j].path
+	})
+	for _, current := range items {
+		p.write("import " + current.path)
+		for _, i := range current.comments {
+			p.write(" " + p.comments[i].Text)
+		}
+		p.line()
+	}
+	return end
+}
+
+func importPath(node *ast.ImportDecl) string {
+	builder := strings.Builder{}
+	if node.Package != nil {
+		builder.WriteString(node.Package.Name + ":")
+	}
+	for i, path := range node.Paths {
+		if i > 0 {
+			builder.WriteString(".")
+		}
+		builder.WriteString(path.Name)
+	}
+	if node.Local != nil {
+		builder.WriteString(" as " + node.Local.Name)
+	}
+	return builder.String()
+}
+
+func (p *printer) stmt(stmt *ast.Stmt) {
+	switch stmt.Node.(type) {
+	case *ast.ImportDecl:
+		p.write("import " + importPath(stmt.Node.(*ast.ImportDecl)))
+	case *ast.FuncDecl:
+		node := stmt.Node.(*ast.FuncDecl)
+		p.pub(node.Pub)
+		p.write("fn " + node.Name.Name)
+		p.signature(node.Kind)
+		p.write(" ")
+		p.block(node.Body)
+	case *ast.ImplDecl:
+		node := stmt.Node.(*ast.ImplDecl)
+		p.write("impl ")
+		if node.Interface != nil {
+			p.write("(")
+			p.kind(node.Interface)
+			p.write(") ")
+		}
+		p.kind(node.Target)
+		p.write(" ")
+		p.block(node.Body)
+	case *ast.VarDecl:
+		node := stmt.Node.(*ast.VarDecl)
+		p.pub(node.Pub)
+		if node.Const {
+			p.write("const ")
+		} else {
+			p.write("let ")
+		}
+		p.write(node.Id.Name)
+		if node.Kind != nil {
+			p.write(": ")
+			p.kind(node.Kind)
+		}
+		if node.Init != nil {
+			p.write(" = ")
+			p.expr(node.Init)
+		}
+	case *ast.BlockStmt:
+		p.block(stmt)
+	case *ast.ReturnStmt:
+		node := stmt.Node.(*ast.ReturnStmt)
+		p.write("return")
+		if node.Argument != nil {
+			p.write(" ")
+			p.expr(node.Argument)
+		}
+	case *ast.ExprStmt:
+		p.expr(stmt.Node.(*ast.ExprStmt).Expression)
+	case *ast.IfStmt:
+		node := stmt.Node.(*ast.IfStmt)
+		p.write("if ")
+		p.condition(node.Condition)
+		p.write(" ")
+		p.block(node.Consequent)
+		if node.Alternate != nil {
+			p.write(" else ")
+			p.stmt(node.Alternate)
+		}
+	case *ast.ForStmt:
+		p.forStmt(stmt.Node.(*ast.ForStmt))
+	case *ast.BreakStmt:
+		p.write("break")
+		if label := stmt.Node.(*ast.BreakStmt).Label; label != nil {
+			p.write(" " + label.Name)
+		}
+	case *ast.ContinueStmt:
+		p.write("continue")
+		if label := stmt.Node.(*ast.ContinueStmt).Label; label != nil {
+			p.write(" " + label.Name)
+		}
+	case *ast.TTypeDecl:
+		node := stmt.Node.(*ast.TTypeDecl)
+		p.pub(node.Pub)
+		p.write("type " + node.Name.Name + " ")
+		p.kind(node.Kind)
+	case *ast.TInterfaceDecl:
+		node := stmt.Node.(*ast.TInterfaceDecl)
+		p.pub(node.Pub)
+		p.write("interface " + node.Name.Name + " ")
+		p.properties(node.Properties, stmt.Position, false, func(property *ast.KindProperty) {
+			p.write("fn " + property.Key.Name)
+			p.signature(property.Kind)
+		})
+	case *ast.TStructDecl:
+		node := stmt.Node.(*ast.TStructDecl)
+		kind := node.Kind.Node.(*ast.TStructKind)
+		p.pub(node.Pub)
+		p.write("struct " + node.Name.Name + " ")
+		p.extends(kind.Extends)
+		p.properties(kind.Properties, stmt.Position, true, func(property *ast.KindProperty) {
+			p.write(property.Key.Name + ": ")
+			p.kind(property.Kind)
+		})
+	case *ast.TEnumDecl:
+		node := stmt.Node.(*ast.TEnumDecl)
+		p.pub(node.Pub)
+		p.write("enum " + node.Name.Name + " ")
+		if len(node.Choices) == 0 && !p.hasComments(stmt.Start, stmt.End) {
+			p.write("{}")
+			return
+		}
+		positions := make([]ast.Position, len(node.Choices))
+		for i, choice := range node.Choices {
+			positions[i] = choice.Position
+		}
+		p.write("{")
+		p.lines(positions, stmt.End, true, func(i int) {
+			p.write(node.Choices[i].Name)
+		})
+		p.write("}")
+	}
+}
+
+func (p *printer) pub(pub bool) {
+	if pub {
+		p.write("pub ")
+	}
+}
+
+// 输出块语句，没有语句及注释时输出 `{}`
+func (p *printer) block(stmt *ast.Stmt) {
+	body := stmt.Node.(*ast.BlockStmt).Body
+	if len(body) == 0 && !p.hasComments(stmt.Start, stmt.End) {
+		p.write("{}")
+		return
+	}
+
+	p.write("{")
+	p.line()
+	p.indent++
+	p.stmtList(body, stmt.End)
+	p.indent--
+	p.write("}")
+}
+
+// 输出结构体字段或接口方法，每项一行
+func (p *printer) properties(properties []*ast.KindProperty, pos ast.Position, comma bool, item func(property *ast.KindProperty)) {
+	if len(properties) == 0 && !p.hasComments(pos.Start, pos.End) {
+		p.write("{}")
+		return
+	}
+	positions := make([]ast.Position, len(properties))
+	for i, property := range properties {
+		positions[i] = property.Position
+	}
+	p.write("{")
+	p.lines(positions, pos.End, comma, func(i int) {
+		item(properties[i])
+	})
+	p.write("}")
+}
+
+// 输出 if 及 for 的条件，条件以 `(` 开头或以标识符结尾（会与 `{` 组成结构体）时需要括号
+func (p *printer) condition(expr *ast.Expr) {
+	if startsWithParen(expr) || endsWithName(expr) {
+		p.write("(")
+		p.expr(expr)
+		p.write(")")
+	} else {
+		p.expr(expr)
+	}
+}
+
+func (p *printer) forStmt(node *ast.ForStmt) {
+	if node.Label != nil {
+		p.write(node.Label.Name + ": ")
+	}
+	p.write("for ")
+
+	switch {
+	case node.EachVisitor != nil:
+		visitor := node.EachVisitor
+		paren := endsWithName(visitor.Target)
+		if paren {
+			p.write("(")
+		}
+		p.write(visitor.Value.Name)
+		if visitor.Key != nil {
+			p.write(", " + visitor.Key.Name)
+		}
+		p.write(": ")
+		p.expr(visitor.Target)
+		if paren {
+			p.write(")")
+		}
+		p.write(" ")
+	case node.Init != nil:
+		paren := node.Update != nil && endsWithName(node.Update)
+		if paren {
+			p.write("(")
+		}
+		p.stmt(node.Init)
+		p.write("; ")
+		if node.Test != nil {
+			p.expr(node.Test)
+		}
+		p.write(";")
+		if node.Update != nil {
+			p.write(" ")
+			p.expr(node.Update)
+		}
+		if paren {
+			p.write(")")
+		}
+		p.write(" ")
+	case node.Test != nil:
+		p.condition(node.Test)
+		p.write(" ")
+	}
+	p.block(node.Body)
+}
@@ -3,6 +3,8 @@ package helper
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 )
@@ -69,11 +71,11 @@ func getFixedWidthStr(value string, width int, padChar byte) string {
 	return result.String()
 }
 
-// 返回在源代码中的行列信息
-func getSourcePosition(source *string, index int) (line int, column int) {
+// GetSourcePosition 返回在源代码中的行列信息（从 1 开始）
+func GetSourcePosition(source []rune, index int) (line int, column int) {
 	line = 1
 	column = 1
-	for i, ch := range *source {
+	for i, ch := range source {
 		if i == index {
 			return
 		}
@@ -88,10 +90,11 @@ func getSourcePosition(source *string, index int) (line int, column int) {
 }
 
 // 打印代码帧信息，返回目标位置的行列信息
-func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel) (targetLine int, targetColumn int) {
-	gray := color.New(color.FgHiBlack).SprintfFunc()
-	red := color.New(color.FgRed).SprintfFunc()
-	yellow := color.New(color.FgYellow).SprintfFunc()
+func printCodeFrame(w io.Writer, source []rune, pos int, message string, level codeFrameLevel) (targetLine int, targetColumn int) {
+	// 源代码及提示信息中可能包含 `%`，不能作为格式化字符串
+	gray := color.New(color.FgHiBlack).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
 
 	input := string(source)
 	beforeLines := make([]string, 0, DefaultCap)
@@ -99,7 +102,7 @@ func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel
 
 	// 分割提示信息的前后代码片段（打印目标位置，上面3行，下面2行）
 	lines := strings.Split(input, "\n")
-	targetLine, targetColumn = getSourcePosition(&input, pos)
+	targetLine, targetColumn = GetSourcePosition(source, pos)
 
 	min := targetLine - 3
 	max := targetLine + 2
@@ -127,8 +130,8 @@ func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel
 		formatLineNo := getFixedWidthStr(strconv.Itoa(lineNo), lineNoWidth, ' ')
 
 		head := fmt.Sprintf("%s | ", formatLineNo)
-		fmt.Print(gray(head))
-		fmt.Println(gray(rawLine))
+		fmt.Fprint(w, gray(head))
+		fmt.Fprintln(w, gray(rawLine))
 	}
 
 	// 打印提示信息（需预留行号空白位置）
@@ -141,9 +144,9 @@ func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel
 	formatMsg.WriteString("^ ")
 	formatMsg.WriteString(message)
 	if level == codeFrameError {
-		fmt.Println(red(formatMsg.String()))
+		fmt.Fprintln(w, red(formatMsg.String()))
 	} else {
-		fmt.Println(yellow(formatMsg.String()))
+		fmt.Fprintln(w, yellow(formatMsg.String()))
 	}
 
 	// 打印提示信息后面代码
@@ -152,8 +155,8 @@ func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel
 		formatLineNo := getFixedWidthStr(strconv.Itoa(lineNo), lineNoWidth, ' ')
 
 		head := fmt.Sprintf("%s | ", formatLineNo)
-		fmt.Print(gray(head))
-		fmt.Println(gray(rawLine))
+		fmt.Fprint(w, gray(head))
+		fmt.Fprintln(w, gray(rawLine))
 	}
 
 	return
@@ -161,10 +164,20 @@ func printCodeFrame(source []rune, pos int, message string, level codeFrameLevel
 
 // PrintWarnFrame 打印警告代码帧信息
 func PrintWarnFrame(source []rune, pos int, message string) (int, int) {
-	return printCodeFrame(source, pos, message, codeFrameWarn)
+	return printCodeFrame(os.Stdout, source, pos, message, codeFrameWarn)
 }
 
 // PrintErrorFrame 打印错误代码帧信息
 func PrintErrorFrame(source []rune, pos int, message string) (int, int) {
-	return printCodeFrame(source, pos, message, codeFrameError)
+	return printCodeFrame(os.Stdout, source, pos, message, codeFrameError)
+}
+
+// FprintWarnFrame 输出警告代码帧信息到 w
+func FprintWarnFrame(w io.Writer, source []rune, pos int, message string) (int, int) {
+	return printCodeFrame(w, source, pos, message, codeFrameWarn)
+}
+
+// FprintErrorFrame 输出错误代码帧信息到 w
+func FprintErrorFrame(w io.Writer, source []rune, pos int, message string) (int, int) {
+	return printCodeFrame(w, source, pos, message, codeFrameError)
 }
@@ -0,0 +1,17 @@
+package helper
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFprintErrorFrame(t *testing.T) {
+	source := []rune("let s = 10\ns %= 3\nlet p = \"100%\"\n")
+	buf := &bytes.Buffer{}
+	line, column := FprintErrorFrame(buf, source, 13, "invalid operand for `%=`: %s")
+
+	assert.Equal(t, 2, line)
+	assert.Equal(t, 3, column)
+	assert.Equal(t, "1 | let s = 10\n2 | s %= 3\n      ^ invalid operand for `%=`: %s\n3 | let p = \"100%\"\n4 | \n", buf.String())
+}
@@ -1,5 +1,7 @@
 package lexer
 
+import "github.com/peakchen90/noah-lang/internal/helper"
+
 // 关键字
 var keywords = [...]string{
 	// 变量声明
@@ -52,3 +54,16 @@ func isBuiltInConstant(value string) bool {
 	}
 	return false
 }
+
+// IsIdentifier 判断名称是否可以作为标识符（不能是关键字、保留关键字或内置常量）
+func IsIdentifier(value string) bool {
+	if len(value) == 0 {
+		return false
+	}
+	for i, ch := range value {
+		if !helper.IsIdentifierChar(ch, i == 0) {
+			return false
+		}
+	}
+	return !isKeyword(value) && !isReversedKeyword(value) && !isBuiltInConstant(value)
+}
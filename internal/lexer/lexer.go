@@ -1,20 +1,21 @@
 package lexer
 
 import (
-	"fmt"
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"strconv"
 	"strings"
 )
 
 type Lexer struct {
-	source       []rune // utf-8 字符
-	index        int    // 光标位置
-	allowExpr    bool   // 当前上下文是否允许表达式
-	SeenNewline  bool   // 读取下一个 token 时前面是否遇到过换行符
-	CurrentToken *Token // 当前的 token
-	LastToken    *Token // 上一个 token
+	source       []rune   // utf-8 字符
+	index        int      // 光标位置
+	allowExpr    bool     // 当前上下文是否允许表达式
+	SeenNewline  bool     // 读取下一个 token 时前面是否遇到过换行符
+	CurrentToken *Token   // 当前的 token
+	LastToken    *Token   // 上一个 token
+	Comments     []*Token // 已跳过的注释，Value 为包含注释符号的文本
 }
 
 func NewLexer(source []rune) *Lexer {
@@ -237,7 +238,9 @@ func (l *Lexer) Next() *Token {
 			l.index++
 			token = l.createToken(TTColon, l.index-1, l.index)
 		default:
-			l.unexpected(l.index, "")
+			// 跳过非法字符，便于出错后继续读取
+			l.index++
+			l.unexpected(l.index-1, "")
 		}
 	}
 
@@ -300,11 +303,13 @@ func (l *Lexer) skipSpace() {
 }
 
 func (l *Lexer) skipComment() {
+	start := l.index
 	if l.Look(0) == '/' && l.Look(1) == '/' {
 		l.index += 2
 		for l.checkIndex() && l.Look(0) != '\n' {
 			l.index++
 		}
+		l.addComment(start)
 		l.skipSpace()
 		l.skipComment()
 	} else if l.Look(0) == '/' && l.Look(1) == '*' {
@@ -317,11 +322,21 @@ func (l *Lexer) skipComment() {
 			l.index++
 		}
 		l.index += 2
+		if l.index > len(l.source) {
+			l.index = len(l.source)
+		}
+		l.addComment(start)
 		l.skipSpace()
 		l.skipComment()
 	}
 }
 
+func (l *Lexer) addComment(start int) {
+	token := l.createToken(TTComment, start, l.index)
+	token.Value = strings.TrimRight(string(l.source[start:l.index]), " \t\r")
+	l.Comments = append(l.Comments, token)
+}
+
 func (l *Lexer) readAsString(raw bool) *Token {
 	start := l.index
 	valid := false
@@ -548,8 +563,10 @@ func (l *Lexer) readAsIdentifier() *Token {
 	return token
 }
 
+// 抛出词法错误诊断（由 parser 捕获）
 func (l *Lexer) unexpected(index int, msg string) {
 	var message string
+	end := index
 	if len(msg) > 0 {
 		message = msg
 	} else if index < len(l.source) {
@@ -557,6 +574,8 @@ func (l *Lexer) unexpected(index int, msg string) {
 	} else {
 		message = "unexpected end of file"
 	}
-	line, column := helper.PrintErrorFrame(l.source, index, message)
-	panic(fmt.Sprintf("%s (%d:%d)", msg, line, column))
+	if end < len(l.source) {
+		end++
+	}
+	panic(diagnostic.New(diagnostic.CodeLexical, l.source, *ast.NewPosition(index, end), message))
 }
@@ -168,3 +168,14 @@ func (t *Token) String() string {
 	}
 	return t.Text
 }
+
+// BinaryOperator 返回二元运算符（如 `+`、`is`）的 token 信息，不是二元运算符时返回 nil
+func BinaryOperator(value string) *TokenMeta {
+	for i := range tokenMetaTable {
+		meta := &tokenMetaTable[i]
+		if meta.OpType.IsOpBinary() && meta.Text == value {
+			return meta
+		}
+	}
+	return nil
+}
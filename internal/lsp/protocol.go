@@ -0,0 +1,230 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+/* 语言服务器协议中用到的结构（仅包含使用的字段） */
+
+type InitializeParams struct {
+	RootURI  string `json:"rootUri,omitempty"`
+	RootPath string `json:"rootPath,omitempty"`
+}
+
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   ServerInfo         `json:"serverInfo"`
+}
+
+type ServerCapabilities struct {
+	TextDocumentSync   int  `json:"textDocumentSync"`
+	DefinitionProvider bool `json:"definitionProvider"`
+	ReferencesProvider bool `json:"referencesProvider"`
+	HoverProvider      bool `json:"hoverProvider"`
+	RenameProvider     bool `json:"renameProvider"`
+
+	CompletionProvider *CompletionOptions `json:"completionProvider,omitempty"`
+}
+
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters"`
+}
+
+type ServerInfo struct {
+	Name string `json:"name"`
+}
+
+// 文档同步方式：每次修改发送完整的内容
+const syncFull = 1
+
+type TextDocumentItem struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+	Text    string `json:"text"`
+}
+
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	URI     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type TextDocumentContentChangeEvent struct {
+	Text string `json:"text"`
+}
+
+type DidCloseTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DidSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context ReferenceContext `json:"context"`
+}
+
+type ReferenceContext struct {
+	IncludeDeclaration bool `json:"includeDeclaration"`
+}
+
+type RenameParams struct {
+	TextDocumentPositionParams
+	NewName string `json:"newName"`
+}
+
+// Position 行及列均从 0 开始，列为 UTF-16 编码单元的个数
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// WorkspaceEdit 多个文档的修改，键为文档的 URI
+type WorkspaceEdit struct {
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type CompletionItem struct {
+	Label         string `json:"label"`
+	Kind          int    `json:"kind"`
+	Detail        string `json:"detail,omitempty"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+// 补全项的种类
+const (
+	completionMethod     = 2
+	completionFunction   = 3
+	completionField      = 5
+	completionVariable   = 6
+	completionClass      = 7
+	completionInterface  = 8
+	completionModule     = 9
+	completionEnum       = 13
+	completionEnumMember = 20
+	completionConstant   = 21
+	completionStruct     = 22
+)
+
+// 诊断的级别
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Code     string `json:"code"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     int          `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+/* helpers */
+
+// 源码中字符索引对应的位置
+func positionAt(source []rune, offset int) Position {
+	pos := Position{}
+	for i, ch := range source {
+		if i >= offset {
+			break
+		}
+		if ch == '\n' {
+			pos.Line++
+			pos.Character = 0
+		} else {
+			pos.Character += utf16Len(ch)
+		}
+	}
+	return pos
+}
+
+// 位置对应的源码字符索引，超出行尾时为行尾，超出文件末尾时为文件末尾
+func offsetAt(source []rune, pos Position) int {
+	line, character := 0, 0
+	for i, ch := range source {
+		if line == pos.Line && (character >= pos.Character || ch == '\n') {
+			return i
+		}
+		if ch == '\n' {
+			line++
+			character = 0
+		} else {
+			character += utf16Len(ch)
+		}
+	}
+	return len(source)
+}
+
+func utf16Len(ch rune) int {
+	if ch >= 0x10000 && utf8.ValidRune(ch) {
+		return 2
+	}
+	return 1
+}
+
+// 文件 URI 对应的路径，不是文件 URI 时返回空字符串
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathToURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
@@ -0,0 +1,531 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Server 语言服务器，通过 JSON-RPC 与编辑器通信
+type Server struct {
+	reader      *bufio.Reader
+	writer      io.Writer
+	log         io.Writer
+	root        string               // 项目根目录，为空时使用文档所在的目录
+	docs        map[string]*document // 打开的文档，键为 URI
+	initialized bool
+	shutdown    bool
+}
+
+// 编辑器中打开的文档，编译时优先于磁盘上的文件
+type document struct {
+	uri     string
+	path    string
+	version int
+	text    string
+}
+
+func NewServer(in io.Reader, out io.Writer, log io.Writer) *Server {
+	return &Server{
+		reader: bufio.NewReader(in),
+		writer: out,
+		log:    log,
+		docs:   make(map[string]*document),
+	}
+}
+
+// Serve 处理消息直到收到 exit 通知，未收到 shutdown 请求就退出或输入提前结束时返回错误
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.reader)
+		if err != nil {
+			var e *responseError
+			if errors.As(err, &e) {
+				if err := writeMessage(s.writer, &message{ID: nullID(), Error: e}); err != nil {
+					return err
+				}
+				continue
+			}
+			if err == io.EOF {
+				if s.shutdown {
+					return nil
+				}
+				return errors.New("connection closed without shutdown")
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) error {
+	// 通知没有 id，不需要响应；没有 method 的是客户端的响应，忽略
+	if msg.ID == nil {
+		if err := s.notify(msg.Method, msg.Params); err != nil {
+			s.logf("%s: %s", msg.Method, err)
+		}
+		return nil
+	}
+	if len(msg.Method) == 0 {
+		return nil
+	}
+
+	response := &message{ID: msg.ID}
+	result, e := s.call(msg.Method, msg.Params)
+	if e != nil {
+		response.Error = e
+	} else {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Result = data
+	}
+	return writeMessage(s.writer, response)
+}
+
+// 处理请求，返回响应的结果
+func (s *Server) call(method string, params json.RawMessage) (interface{}, *responseError) {
+	if method == "initialize" {
+		return s.initialize(params)
+	}
+	if !s.initialized {
+		return nil, newError(codeNotInitialized, "server not initialized")
+	}
+	if s.shutdown {
+		return nil, newError(codeInvalidRequest, "server is shutting down")
+	}
+
+	switch method {
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		return s.definition(params)
+	case "textDocument/references":
+		return s.references(params)
+	case "textDocument/hover":
+		return s.hover(params)
+	case "textDocument/completion":
+		return s.completion(params)
+	case "textDocument/rename":
+		return s.rename(params)
+	}
+	return nil, newError(codeMethodNotFound, "method not found: %s", method)
+}
+
+// 处理通知，未初始化时忽略
+func (s *Server) notify(method string, params json.RawMessage) error {
+	if !s.initialized || s.shutdown {
+		return nil
+	}
+
+	switch method {
+	case "textDocument/didOpen":
+		p := &DidOpenTextDocumentParams{}
+		if err := decode(params, p); err != nil {
+			return err
+		}
+		path := uriToPath(p.TextDocument.URI)
+		if len(path) == 0 {
+			return fmt.Errorf("unsupported document: %s", p.TextDocument.URI)
+		}
+		s.docs[p.TextDocument.URI] = &document{
+			uri:     p.TextDocument.URI,
+			path:    filepath.Clean(path),
+			version: p.TextDocument.Version,
+			text:    p.TextDocument.Text,
+		}
+	case "textDocument/didChange":
+		p := &DidChangeTextDocumentParams{}
+		if err := decode(params, p); err != nil {
+			return err
+		}
+		doc := s.docs[p.TextDocument.URI]
+		if doc == nil {
+			return fmt.Errorf("document not opened: %s", p.TextDocument.URI)
+		}
+		// 全量同步，最后一次修改即为文档的内容
+		if len(p.ContentChanges) > 0 {
+			doc.text = p.ContentChanges[len(p.ContentChanges)-1].Text
+		}
+		doc.version = p.TextDocument.Version
+	case "textDocument/didClose":
+		p := &DidCloseTextDocumentParams{}
+		if err := decode(params, p); err != nil {
+			return err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		if err := s.publishDiagnostics(&PublishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}}); err != nil {
+			return err
+		}
+	case "textDocument/didSave":
+	default:
+		return nil
+	}
+
+	// 文档之间可能存在依赖，任何文档变化后重新检查所有打开的文档
+	return s.publishAll()
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, *responseError) {
+	if s.initialized {
+		return nil, newError(codeInvalidRequest, "server already initialized")
+	}
+	p := &InitializeParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+
+	if len(p.RootURI) > 0 {
+		s.root = uriToPath(p.RootURI)
+	} else {
+		s.root = p.RootPath
+	}
+	s.initialized = true
+
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:   syncFull,
+			DefinitionProvider: true,
+			ReferencesProvider: true,
+			HoverProvider:      true,
+			RenameProvider:     true,
+			CompletionProvider: &CompletionOptions{TriggerCharacters: []string{"."}},
+		},
+		ServerInfo: ServerInfo{Name: "noah"},
+	}, nil
+}
+
+/* diagnostics */
+
+func (s *Server) publishAll() error {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		doc := s.docs[uri]
+		params := &PublishDiagnosticsParams{
+			URI:         doc.uri,
+			Version:     doc.version,
+			Diagnostics: s.check(doc),
+		}
+		if err := s.publishDiagnostics(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) publishDiagnostics(params *PublishDiagnosticsParams) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(s.writer, &message{Method: "textDocument/publishDiagnostics", Params: data})
+}
+
+// 以文档作为入口模块编译，返回文档所在模块的诊断信息
+func (s *Server) check(doc *document) []Diagnostic {
+	result := make([]Diagnostic, 0)
+	inst, moduleId := s.compile(doc)
+	if inst == nil {
+		return result
+	}
+
+	source := []rune(doc.text)
+	if module, has := inst.Modules[moduleId]; has && module.Source() != nil {
+		source = module.Source()
+	}
+	for _, d := range inst.Diagnostics {
+		if d.ModuleId != moduleId {
+			continue
+		}
+		end := d.End
+		if end < d.Start {
+			end = d.Start
+		}
+		severity := severityError
+		if d.Severity == diagnostic.SeverityWarning {
+			severity = severityWarning
+		}
+		result = append(result, Diagnostic{
+			Range:    Range{Start: positionAt(source, d.Start), End: positionAt(source, end)},
+			Severity: severity,
+			Code:     d.Code,
+			Source:   "noah",
+			Message:  d.Message,
+		})
+	}
+	return result
+}
+
+/* symbols */
+
+// 跳转到光标处符号的声明，模块跳转到模块文件的开头，内置函数没有声明
+func (s *Server) definition(params json.RawMessage) (interface{}, *responseError) {
+	p := &TextDocumentPositionParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+	_, ref, e := s.refAt(p)
+	if e != nil || ref == nil {
+		return nil, e
+	}
+
+	symbol := ref.Symbol
+	switch {
+	case symbol.Decl != nil:
+		location := s.location(symbol.Module, symbol.Decl.Start, symbol.Decl.End)
+		return &location, nil
+	case symbol.Tag == compiler.SymbolModule:
+		location := s.location(symbol.Module, 0, 0)
+		return &location, nil
+	}
+	return nil, nil
+}
+
+// 光标处符号在所有模块中的引用
+func (s *Server) references(params json.RawMessage) (interface{}, *responseError) {
+	p := &ReferenceParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+	inst, ref, e := s.refAt(&p.TextDocumentPositionParams)
+	if e != nil || ref == nil {
+		return nil, e
+	}
+
+	result := make([]Location, 0)
+	for _, item := range inst.Info.References(ref.Symbol) {
+		if item.IsDecl && !p.Context.IncludeDeclaration {
+			continue
+		}
+		result = append(result, s.location(item.Module, item.Name.Start, item.Name.End))
+	}
+	return result, nil
+}
+
+// 光标处符号的描述及文档注释
+func (s *Server) hover(params json.RawMessage) (interface{}, *responseError) {
+	p := &TextDocumentPositionParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+	_, ref, e := s.refAt(p)
+	if e != nil || ref == nil {
+		return nil, e
+	}
+
+	value := "```noah\n" + ref.Symbol.Signature() + "\n```"
+	if doc := ref.Symbol.Doc(); len(doc) > 0 {
+		value += "\n\n" + doc
+	}
+	source := ref.Module.Source()
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    &Range{Start: positionAt(source, ref.Name.Start), End: positionAt(source, ref.Name.End)},
+	}, nil
+}
+
+// 光标处可以输入的名称
+func (s *Server) completion(params json.RawMessage) (interface{}, *responseError) {
+	p := &TextDocumentPositionParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+	doc := s.docs[p.TextDocument.URI]
+	if doc == nil {
+		return nil, newError(codeInvalidParams, "document not opened: %s", p.TextDocument.URI)
+	}
+
+	result := make([]CompletionItem, 0)
+	for _, item := range s.complete(doc, offsetAt([]rune(doc.text), p.Position)) {
+		result = append(result, CompletionItem{
+			Label:         item.Label,
+			Kind:          completionKind(item.Symbol),
+			Detail:        item.Symbol.Signature(),
+			Documentation: item.Symbol.Doc(),
+		})
+	}
+	return result, nil
+}
+
+// 补全文档中字符索引处的名称，编译器内部错误时记录日志并返回 nil
+func (s *Server) complete(doc *document, offset int) (items []*compiler.CompletionItem) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("internal error while completing %s: %v", doc.path, r)
+			items = nil
+		}
+	}()
+
+	inst, moduleId := s.newCompiler(doc)
+	return inst.Complete(moduleId, offset)
+}
+
+// 重命名光标处的符号，修改所有模块中的引用；新名称冲突或无法重命名时返回错误
+func (s *Server) rename(params json.RawMessage) (interface{}, *responseError) {
+	p := &RenameParams{}
+	if err := decode(params, p); err != nil {
+		return nil, newError(codeInvalidParams, "%s", err)
+	}
+	doc := s.docs[p.TextDocument.URI]
+	if doc == nil {
+		return nil, newError(codeInvalidParams, "document not opened: %s", p.TextDocument.URI)
+	}
+	inst, moduleId := s.compile(doc)
+	if inst == nil {
+		return nil, newError(codeRequestFailed, "internal error while compiling %s", doc.path)
+	}
+	module, has := inst.Modules[moduleId]
+	if !has || module.Source() == nil {
+		return nil, newError(codeRequestFailed, "module not found: %s", moduleId)
+	}
+
+	edits, err := inst.Rename(moduleId, offsetAt(module.Source(), p.Position), p.NewName)
+	if err != nil {
+		return nil, newError(codeRequestFailed, "%s", err)
+	}
+	result := &WorkspaceEdit{Changes: make(map[string][]TextEdit)}
+	for _, edit := range edits {
+		location := s.location(edit.Module, edit.Start, edit.End)
+		result.Changes[location.URI] = append(result.Changes[location.URI], TextEdit{Range: location.Range, NewText: edit.NewText})
+	}
+	return result, nil
+}
+
+func completionKind(symbol *compiler.Symbol) int {
+	switch symbol.Tag {
+	case compiler.SymbolModule:
+		return completionModule
+	case compiler.SymbolConst:
+		return completionConstant
+	case compiler.SymbolFunc, compiler.SymbolBuiltin:
+		return completionFunction
+	case compiler.SymbolMethod:
+		return completionMethod
+	case compiler.SymbolField:
+		return completionField
+	case compiler.SymbolChoice:
+		return completionEnumMember
+	case compiler.SymbolType:
+		switch symbol.Type.Kind().(type) {
+		case *compiler.TStruct:
+			return completionStruct
+		case *compiler.TInterface:
+			return completionInterface
+		case *compiler.TEnum:
+			return completionEnum
+		}
+		return completionClass
+	}
+	return completionVariable
+}
+
+// 编译文档并查找光标处的标识符，不是标识符时返回 nil
+func (s *Server) refAt(p *TextDocumentPositionParams) (*compiler.Compiler, *compiler.Ref, *responseError) {
+	doc := s.docs[p.TextDocument.URI]
+	if doc == nil {
+		return nil, nil, newError(codeInvalidParams, "document not opened: %s", p.TextDocument.URI)
+	}
+	inst, moduleId := s.compile(doc)
+	if inst == nil {
+		return nil, nil, nil
+	}
+	module, has := inst.Modules[moduleId]
+	if !has || module.Source() == nil {
+		return nil, nil, nil
+	}
+	return inst, inst.Info.RefAt(module, offsetAt(module.Source(), p.Position)), nil
+}
+
+// 模块中字符索引范围对应的位置，打开的文档使用编辑器中的 URI
+func (s *Server) location(module *compiler.Module, start int, end int) Location {
+	uri := pathToURI(module.Path())
+	for _, doc := range s.docs {
+		if doc.path == filepath.Clean(module.Path()) {
+			uri = doc.uri
+		}
+	}
+	source := module.Source()
+	return Location{URI: uri, Range: Range{Start: positionAt(source, start), End: positionAt(source, end)}}
+}
+
+// 编译文档所在的项目，打开的文档使用编辑器中的内容，返回编译器及文档的模块 id。
+// 编译器内部错误时记录日志并返回 nil
+func (s *Server) compile(doc *document) (inst *compiler.Compiler, moduleId string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("internal error while compiling %s: %v", doc.path, r)
+			inst = nil
+		}
+	}()
+
+	inst, moduleId = s.newCompiler(doc)
+	inst.Compile()
+	return inst, moduleId
+}
+
+// 以文档作为入口模块创建编译器，打开的文档优先于磁盘上的文件
+func (s *Server) newCompiler(doc *document) (*compiler.Compiler, string) {
+	root, moduleId := s.moduleOf(doc.path)
+	inst := compiler.NewCompiler(root, true)
+	inst.Entry = moduleId
+	for _, item := range s.docs {
+		inst.VirtualFS.SetOverlay(item.path, []byte(item.text))
+	}
+	return inst, moduleId
+}
+
+// 文件对应的项目根目录及模块 id，文件不在项目根目录中时以文件所在的目录作为根目录
+func (s *Server) moduleOf(path string) (string, string) {
+	root := s.root
+	rel, err := filepath.Rel(root, path)
+	if len(root) == 0 || err != nil || strings.HasPrefix(rel, "..") {
+		root = filepath.Dir(path)
+		rel = filepath.Base(path)
+	}
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), ".noah")
+	return root, strings.ReplaceAll(rel, "/", ".")
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.log != nil {
+		fmt.Fprintf(s.log, "noah lsp: "+format+"\n", args...)
+	}
+}
+
+/* helpers */
+
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return errors.New("missing params")
+	}
+	return json.Unmarshal(params, v)
+}
+
+// 无法解析的请求使用 null 作为响应的 id
+func nullID() *json.RawMessage {
+	id := json.RawMessage("null")
+	return &id
+}
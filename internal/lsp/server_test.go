@@ -0,0 +1,407 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 脚本化的 JSON-RPC 客户端，服务器发送的消息由单独的协程读取，避免双方同时写入时阻塞
+type testClient struct {
+	t        *testing.T
+	writer   *io.PipeWriter
+	messages chan *message
+	done     chan error
+	nextID   int
+}
+
+func newTestClient(t *testing.T) *testClient {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &testClient{
+		t:        t,
+		writer:   clientOut,
+		messages: make(chan *message, 100),
+		done:     make(chan error, 1),
+	}
+
+	go func() {
+		err := NewServer(serverIn, serverOut, io.Discard).Serve()
+		_ = serverOut.Close()
+		c.done <- err
+	}()
+	go func() {
+		reader := bufio.NewReader(clientIn)
+		for {
+			msg, err := readMessage(reader)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	t.Cleanup(func() { _ = clientOut.Close() })
+	return c
+}
+
+func (c *testClient) send(msg *message) {
+	if !assert.NoError(c.t, writeMessage(c.writer, msg)) {
+		c.t.FailNow()
+	}
+}
+
+func (c *testClient) params(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if !assert.NoError(c.t, err) {
+		c.t.FailNow()
+	}
+	return data
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	c.send(&message{Method: method, Params: c.params(params)})
+}
+
+// 发送请求并等待响应（忽略期间收到的通知）
+func (c *testClient) request(method string, params interface{}) *message {
+	c.nextID++
+	id := json.RawMessage(c.params(c.nextID))
+	c.send(&message{ID: &id, Method: method, Params: c.params(params)})
+	for {
+		msg := c.receive()
+		if msg.ID != nil && string(*msg.ID) == string(id) {
+			return msg
+		}
+	}
+}
+
+func (c *testClient) receive() *message {
+	select {
+	case msg, ok := <-c.messages:
+		if !assert.True(c.t, ok, "connection closed") {
+			c.t.FailNow()
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for server message")
+	}
+	return nil
+}
+
+// 等待文档的诊断信息
+func (c *testClient) diagnostics(uri string) []Diagnostic {
+	for {
+		msg := c.receive()
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		params := &PublishDiagnosticsParams{}
+		assert.NoError(c.t, json.Unmarshal(msg.Params, params))
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func (c *testClient) initialize(root string) {
+	msg := c.request("initialize", &InitializeParams{RootURI: pathToURI(root)})
+	if assert.Nil(c.t, msg.Error) {
+		result := &InitializeResult{}
+		assert.NoError(c.t, json.Unmarshal(msg.Result, result))
+		assert.Equal(c.t, syncFull, result.Capabilities.TextDocumentSync)
+	}
+	c.notify("initialized", struct{}{})
+}
+
+func (c *testClient) exit() error {
+	msg := c.request("shutdown", nil)
+	assert.Nil(c.t, msg.Error)
+	assert.Equal(c.t, "null", string(msg.Result))
+	c.send(&message{Method: "exit"})
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for server exit")
+	}
+	return nil
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, code := range files {
+		filename := filepath.Join(root, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		assert.NoError(t, os.WriteFile(filename, []byte(code), 0644))
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"main.noah":  "import lib.a\n\nfn main() {\n    a.greet()\n}\n",
+		"lib/a.noah": "pub fn hello() {}\n",
+	})
+	mainURI := pathToURI(filepath.Join(root, "main.noah"))
+	libURI := pathToURI(filepath.Join(root, "lib/a.noah"))
+
+	c := newTestClient(t)
+	c.initialize(root)
+
+	// 磁盘上的 lib.a 没有导出 greet
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: mainURI, Version: 1, Text: "import lib.a\n\nfn main() {\n    a.greet()\n}\n",
+	}})
+	diagnostics := c.diagnostics(mainURI)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "greet is not exported from module: lib.a", diagnostics[0].Message)
+		assert.Equal(t, Range{Start: Position{Line: 3, Character: 6}, End: Position{Line: 3, Character: 11}}, diagnostics[0].Range)
+		assert.Equal(t, severityError, diagnostics[0].Severity)
+		assert.Equal(t, "E0004", diagnostics[0].Code)
+	}
+
+	// 未保存的 lib.a 优先于磁盘上的文件
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: libURI, Version: 1, Text: "pub fn hello() {}\npub fn greet() {}\n",
+	}})
+	assert.Empty(t, c.diagnostics(libURI))
+	assert.Empty(t, c.diagnostics(mainURI))
+
+	// 修改后的语法错误，列按 UTF-16 编码单元计算
+	c.notify("textDocument/didChange", &DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: mainURI, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "fn main() {\n    let s = \"😀\" + )\n}\n"}},
+	})
+	diagnostics = c.diagnostics(mainURI)
+	if assert.NotEmpty(t, diagnostics) {
+		assert.Equal(t, "E0002", diagnostics[0].Code)
+		assert.Equal(t, Position{Line: 1, Character: 19}, diagnostics[0].Range.Start)
+	}
+
+	c.notify("textDocument/didChange", &DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: mainURI, Version: 3},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "fn main() {\n    let s = \"😀\" + 1\n    s = true\n}\n"}},
+	})
+	diagnostics = c.diagnostics(mainURI)
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "cannot use bool as string", diagnostics[0].Message)
+		assert.Equal(t, Range{Start: Position{Line: 2, Character: 8}, End: Position{Line: 2, Character: 12}}, diagnostics[0].Range)
+	}
+
+	// 关闭文档时清除诊断信息
+	c.notify("textDocument/didClose", &DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: mainURI}})
+	assert.Empty(t, c.diagnostics(mainURI))
+
+	assert.NoError(t, c.exit())
+}
+
+func TestProtocolErrors(t *testing.T) {
+	c := newTestClient(t)
+	msg := c.request("shutdown", nil)
+	if assert.NotNil(t, msg.Error) {
+		assert.Equal(t, codeNotInitialized, msg.Error.Code)
+	}
+
+	c.initialize(t.TempDir())
+	msg = c.request("textDocument/unknown", struct{}{})
+	if assert.NotNil(t, msg.Error) {
+		assert.Equal(t, codeMethodNotFound, msg.Error.Code)
+	}
+
+	// 无法解析的消息返回 id 为 null 的错误响应
+	_, err := io.WriteString(c.writer, "Content-Length: 5\r\n\r\n{bad}")
+	assert.NoError(t, err)
+	msg = c.receive()
+	assert.Nil(t, msg.ID)
+	if assert.NotNil(t, msg.Error) {
+		assert.Equal(t, codeParseError, msg.Error.Code)
+	}
+
+	assert.NoError(t, c.exit())
+
+	c = newTestClient(t)
+	c.send(&message{Method: "exit"})
+	assert.EqualError(t, <-c.done, "exit without shutdown")
+}
+
+func TestPosition(t *testing.T) {
+	source := []rune("a😀b\n中c")
+	assert.Equal(t, Position{Line: 0, Character: 0}, positionAt(source, 0))
+	assert.Equal(t, Position{Line: 0, Character: 3}, positionAt(source, 2))
+	assert.Equal(t, Position{Line: 1, Character: 1}, positionAt(source, 5))
+	assert.Equal(t, Position{Line: 1, Character: 2}, positionAt(source, 100))
+	assert.Equal(t, 2, offsetAt(source, Position{Line: 0, Character: 3}))
+	assert.Equal(t, 3, offsetAt(source, Position{Line: 0, Character: 10}))
+	assert.Equal(t, 5, offsetAt(source, Position{Line: 1, Character: 1}))
+	assert.Equal(t, 6, offsetAt(source, Position{Line: 5, Character: 0}))
+
+	path := filepath.Join(t.TempDir(), "a b", "main.noah")
+	assert.Equal(t, path, uriToPath(pathToURI(path)))
+	assert.Equal(t, "", uriToPath("untitled:1"))
+}
+
+func TestSymbolRequests(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"lib/a.noah": "// 问候\npub fn greet(name: string) -> string {\n    return \"hi \" + name\n}\n",
+	})
+	mainURI := pathToURI(filepath.Join(root, "main.noah"))
+	libURI := pathToURI(filepath.Join(root, "lib/a.noah"))
+
+	c := newTestClient(t)
+	c.initialize(root)
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: mainURI, Version: 1, Text: "import lib.a\n\nfn main() {\n    let s = a.greet(\"x\")\n    println(a.greet(s))\n}\n",
+	}})
+	assert.Empty(t, c.diagnostics(mainURI))
+
+	at := func(line int, character int) *TextDocumentPositionParams {
+		return &TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: mainURI},
+			Position:     Position{Line: line, Character: character},
+		}
+	}
+
+	// 跳转到其他模块中的声明
+	msg := c.request("textDocument/definition", at(3, 15))
+	location := &Location{}
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, location)) {
+		assert.Equal(t, libURI, location.URI)
+		assert.Equal(t, Range{Start: Position{Line: 1, Character: 7}, End: Position{Line: 1, Character: 12}}, location.Range)
+	}
+	msg = c.request("textDocument/definition", at(0, 11))
+	location = &Location{}
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, location)) {
+		assert.Equal(t, Location{URI: libURI}, *location)
+	}
+
+	// 局部变量的引用，包含声明
+	msg = c.request("textDocument/references", &ReferenceParams{
+		TextDocumentPositionParams: *at(4, 20),
+		Context:                    ReferenceContext{IncludeDeclaration: true},
+	})
+	var locations []Location
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, &locations)) && assert.Len(t, locations, 2) {
+		assert.Equal(t, Position{Line: 3, Character: 8}, locations[0].Range.Start)
+		assert.Equal(t, Position{Line: 4, Character: 20}, locations[1].Range.Start)
+	}
+	msg = c.request("textDocument/references", &ReferenceParams{TextDocumentPositionParams: *at(4, 15)})
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, &locations)) {
+		assert.Len(t, locations, 2)
+	}
+
+	msg = c.request("textDocument/hover", at(4, 15))
+	hover := &Hover{}
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, hover)) {
+		assert.Equal(t, "markdown", hover.Contents.Kind)
+		assert.Equal(t, "```noah\nfn greet(string) -> string\n```\n\n问候", hover.Contents.Value)
+		assert.Equal(t, &Range{Start: Position{Line: 4, Character: 14}, End: Position{Line: 4, Character: 19}}, hover.Range)
+	}
+
+	// 不是标识符的位置返回 null
+	msg = c.request("textDocument/hover", at(1, 0))
+	assert.Nil(t, msg.Error)
+	assert.Equal(t, "null", string(msg.Result))
+
+	msg = c.request("textDocument/definition", &TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: libURI}})
+	if assert.NotNil(t, msg.Error) {
+		assert.Equal(t, codeInvalidParams, msg.Error.Code)
+	}
+
+	assert.NoError(t, c.exit())
+}
+
+func TestCompletion(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"lib/a.noah": "// 问候\npub fn greet() {}\npub struct Point {\n    x: number\n}\n",
+	})
+	mainURI := pathToURI(filepath.Join(root, "main.noah"))
+
+	c := newTestClient(t)
+	c.initialize(root)
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: mainURI, Version: 1, Text: "import lib.a\n\nfn main() {\n    a.\n}\n",
+	}})
+	assert.NotEmpty(t, c.diagnostics(mainURI))
+
+	msg := c.request("textDocument/completion", &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: mainURI},
+		Position:     Position{Line: 3, Character: 6},
+	})
+	var items []CompletionItem
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, &items)) {
+		assert.Equal(t, []CompletionItem{
+			{Label: "Point", Kind: completionStruct, Detail: "struct Point"},
+			{Label: "greet", Kind: completionFunction, Detail: "fn greet()", Documentation: "问候"},
+		}, items)
+	}
+
+	msg = c.request("textDocument/completion", &TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: mainURI},
+		Position:     Position{Line: 2, Character: 0},
+	})
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, &items)) {
+		assert.Empty(t, items)
+	}
+
+	assert.NoError(t, c.exit())
+}
+
+func TestRename(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"lib/a.noah": "pub fn greet(name: string) -> string {\n    return \"hi \" + name\n}\n",
+	})
+	mainURI := pathToURI(filepath.Join(root, "main.noah"))
+	libURI := pathToURI(filepath.Join(root, "lib/a.noah"))
+
+	c := newTestClient(t)
+	c.initialize(root)
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{
+		URI: mainURI, Version: 1, Text: "import lib.a\n\nfn main() {\n    let s = a.greet(\"x\")\n    println(a.greet(s))\n}\n",
+	}})
+	assert.Empty(t, c.diagnostics(mainURI))
+
+	rename := func(line int, character int, newName string) *message {
+		return c.request("textDocument/rename", &RenameParams{
+			TextDocumentPositionParams: TextDocumentPositionParams{
+				TextDocument: TextDocumentIdentifier{URI: mainURI},
+				Position:     Position{Line: line, Character: character},
+			},
+			NewName: newName,
+		})
+	}
+
+	msg := rename(3, 15, "hello")
+	edit := &WorkspaceEdit{}
+	if assert.Nil(t, msg.Error) && assert.NoError(t, json.Unmarshal(msg.Result, edit)) {
+		assert.Equal(t, map[string][]TextEdit{
+			libURI: {
+				{Range: Range{Start: Position{Line: 0, Character: 7}, End: Position{Line: 0, Character: 12}}, NewText: "hello"},
+			},
+			mainURI: {
+				{Range: Range{Start: Position{Line: 3, Character: 14}, End: Position{Line: 3, Character: 19}}, NewText: "hello"},
+				{Range: Range{Start: Position{Line: 4, Character: 14}, End: Position{Line: 4, Character: 19}}, NewText: "hello"},
+			},
+		}, edit.Changes)
+	}
+
+	// 与已有的标识符冲突、保留的 self 及非标识符的位置
+	for _, item := range []struct {
+		line, character int
+		newName         string
+	}{{4, 20, "a"}, {3, 8, "self"}, {1, 0, "x"}} {
+		msg = rename(item.line, item.character, item.newName)
+		if assert.NotNil(t, msg.Error, item.newName) {
+			assert.Equal(t, codeRequestFailed, msg.Error.Code)
+		}
+	}
+
+	assert.NoError(t, c.exit())
+}
@@ -129,11 +129,28 @@ func (p *Parser) parseAtomExpr() *ast.Expr {
 		return p.parseMaybeChainExpr(p.parseStructExpr(nil), AccessDot)
 	case lexer.TTBracketL:
 		return p.parseMaybeChainExpr(p.parseArrayExpr(), AccessComputed)
+	}
+
+	return p.parseBadExpr()
+}
+
+// 记录错误并返回一个 BadExpr 占位，不会消费语句边界及闭合括号
+func (p *Parser) parseBadExpr() *ast.Expr {
+	p.report(p.unexpectedDiagnostic())
+
+	expr := &ast.Expr{
+		Node:     &ast.BadExpr{},
+		Position: *ast.NewPosition(p.current.Start, p.current.Start),
+	}
+
+	switch p.current.Type {
+	case lexer.TTEof, lexer.TTKeyword, lexer.TTSemi, lexer.TTParenR, lexer.TTBracketR, lexer.TTBraceR:
 	default:
-		p.unexpected()
+		expr.End = p.current.End
+		p.nextToken()
 	}
 
-	return nil // NEVER
+	return expr
 }
 
 func (p *Parser) parseFuncExpr() *ast.Expr {
@@ -20,8 +20,12 @@ func newKindIdentifier(token *lexer.Token) *ast.Identifier {
 }
 
 func newOperator(token *lexer.Token) *ast.Operator {
+	value := token.Value
+	if len(value) == 0 { // 符号运算符的值为 token 文本，如 `+`
+		value = token.Text
+	}
 	return &ast.Operator{
-		Value:    token.Value,
+		Value:    value,
 		Position: token.Position,
 	}
 }
@@ -46,40 +50,21 @@ func exprToKindExpr(expr *ast.Expr) *ast.KindExpr {
 		}
 
 	case *ast.MemberExpr:
-		currentExpr := expr
-		currentKind := &ast.TMemberKind{}
-		result := &ast.KindExpr{
-			Node:     currentKind,
-			Position: currentExpr.Position,
+		// `a.b.C` 转换为左结合的 TMemberKind，与类型表达式的解析结果一致
+		node := expr.Node.(*ast.MemberExpr)
+		if node.Computed {
+			panic("Internal Err")
 		}
-
-		for {
-			switch currentExpr.Node.(type) {
-			case *ast.MemberExpr:
-				node := currentExpr.Node.(*ast.MemberExpr)
-				if node.Computed {
-					panic("Internal Err")
-				}
-
-				currentKind.Right = &ast.KindExpr{
-					Node:     &ast.TIdentifier{Name: node.Property.Node.(*ast.IdentifierLiteral).Name},
+		name := node.Property.Node.(*ast.IdentifierLiteral).Name
+		return &ast.KindExpr{
+			Node: &ast.TMemberKind{
+				Left: exprToKindExpr(node.Object),
+				Right: &ast.KindExpr{
+					Node:     &ast.TIdentifier{Name: name},
 					Position: node.Property.Position,
-				}
-
-				currentExpr = node.Object
-				currentKind = &ast.TMemberKind{}
-				currentKind.Left = &ast.KindExpr{
-					Node:     currentKind,
-					Position: currentExpr.Position,
-				}
-			case *ast.IdentifierLiteral:
-				node := currentExpr.Node.(*ast.IdentifierLiteral)
-				currentKind.Left = &ast.KindExpr{
-					Node:     &ast.TIdentifier{Name: node.Name},
-					Position: node.Name.Position,
-				}
-				return result
-			}
+				},
+			},
+			Position: expr.Position,
 		}
 	default:
 		panic("Internal Err")
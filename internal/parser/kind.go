@@ -38,8 +38,8 @@ func (p *Parser) parseKindExpr() *ast.KindExpr {
 		p.nextToken()
 
 		var Len *ast.Expr
-		if p.isToken(lexer.TTNumber) { // [n]T
-			Len = p.parseNumberExpr()
+		if !p.isToken(lexer.TTBracketR) { // [n]T，长度为常量表达式
+			Len = p.parseExpr()
 		}
 
 		p.consume(lexer.TTBracketR, true)
@@ -91,7 +91,7 @@ func (p *Parser) parseFuncKindExpr(start int) *ast.KindExpr {
 	var lastRestToken *lexer.Token
 	for !p.isEnd() && !p.isToken(lexer.TTParenR) {
 		if lastRestToken != nil {
-			p.UnexpectedPos(lastRestToken.Start, "Only use `...` in the last argument")
+			p.unexpectedAt(lastRestToken.Position, "Only use `...` in the last argument")
 		}
 
 		restToken := p.consume(lexer.TTRest, false)
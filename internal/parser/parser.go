@@ -2,20 +2,22 @@ package parser
 
 import (
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
 	"github.com/peakchen90/noah-lang/internal/helper"
 	"github.com/peakchen90/noah-lang/internal/lexer"
 )
 
 type Parser struct {
-	name       string
-	source     []rune       // utf-8 字符
-	lexer      *lexer.Lexer // 词法分析器
-	current    *lexer.Token // 当前 token
-	seenToken  *lexer.Token // 缓存的后一个 token
-	blockLevel int          // 当前进入到第几层块级作用域
-	loopLevel  int          // 当前进入到第几层循环块
+	name        string
+	source      []rune                   // utf-8 字符
+	lexer       *lexer.Lexer             // 词法分析器
+	current     *lexer.Token             // 当前 token
+	seenToken   *lexer.Token             // 缓存的后一个 token
+	blockLevel  int                      // 当前进入到第几层块级作用域
+	loopLevel   int                      // 当前进入到第几层循环块
+	nesting     int                      // 已消费的未闭合 `{` 层数，用于错误恢复
+	diagnostics []*diagnostic.Diagnostic // 解析过程中产生的诊断信息
 }
 
 func NewParser(input string, name string) *Parser {
@@ -28,16 +30,23 @@ func NewParser(input string, name string) *Parser {
 
 func (p *Parser) Parse() *ast.File {
 	p.lexer = lexer.NewLexer(p.source)
+	p.nesting = 0
+	p.diagnostics = nil
 
 	body := make([]*ast.Stmt, 0, helper.DefaultCap)
-	p.nextToken()
+
+	// 读取第一个 token 时可能出现词法错误
+	for !p.catch(func() { p.nextToken() }) {
+	}
 
 	for !p.isEnd() {
-		stmt := p.parseStmt()
-		body = append(body, stmt)
+		body = append(body, p.parseStmtRecover(false))
 	}
 
-	node := ast.File{Body: body}
+	node := ast.File{Body: body, Comments: make([]*ast.Comment, 0, len(p.lexer.Comments))}
+	for _, token := range p.lexer.Comments {
+		node.Comments = append(node.Comments, &ast.Comment{Text: token.Value, Position: token.Position})
+	}
 
 	if len(body) > 0 {
 		node.Start = body[0].Start
@@ -48,12 +57,23 @@ func (p *Parser) Parse() *ast.File {
 }
 
 func (p *Parser) nextToken() *lexer.Token {
+	last := p.current
+
 	if p.seenToken != nil {
 		p.current = p.seenToken
 		p.seenToken = nil
 	} else {
 		p.current = p.lexer.Next()
 	}
+
+	if last != nil {
+		switch last.Type {
+		case lexer.TTBraceL:
+			p.nesting++
+		case lexer.TTBraceR:
+			p.nesting--
+		}
+	}
 	return p.current
 }
 
@@ -64,15 +84,55 @@ func (p *Parser) revertLastToken() {
 	}
 }
 
+// Diagnostics 返回解析过程中产生的诊断信息
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	return p.diagnostics
+}
+
+// Source 返回源代码字符
+func (p *Parser) Source() []rune {
+	return p.source
+}
+
+// 执行解析函数并捕获抛出的诊断信息，返回是否执行成功
+func (p *Parser) catch(fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			d, is := r.(*diagnostic.Diagnostic)
+			if !is {
+				panic(r)
+			}
+			p.report(d)
+			ok = false
+		}
+	}()
+
+	fn()
+	return true
+}
+
+// 记录诊断信息（忽略同一位置的重复错误）
+func (p *Parser) report(d *diagnostic.Diagnostic) {
+	size := len(p.diagnostics)
+	if size > 0 && p.diagnostics[size-1].Start == d.Start {
+		return
+	}
+	d.ModuleId = p.name
+	p.diagnostics = append(p.diagnostics, d)
+}
+
 func (p *Parser) UnexpectedPos(index int, msg string) {
-	line, column := helper.PrintErrorFrame(p.source, index, msg)
-	fmt.Print("\n")
-	panic(color.New(color.FgRed).Sprintf("%s (found in \"%s\", loc %d:%d)", msg, p.name, line, column))
+	p.unexpectedAt(*ast.NewPosition(index, index), msg)
+}
+
+// 抛出语法错误诊断
+func (p *Parser) unexpectedAt(pos ast.Position, msg string) {
+	panic(diagnostic.New(diagnostic.CodeSyntax, p.source, pos, msg))
 }
 
 func (p *Parser) unexpectedToken(expectHint string, receiveToken *lexer.Token) {
-	p.UnexpectedPos(
-		receiveToken.Start,
+	p.unexpectedAt(
+		receiveToken.Position,
 		fmt.Sprintf("Expected %s, found %s", expectHint, receiveToken.String()),
 	)
 }
@@ -82,6 +142,11 @@ func (p *Parser) unexpectedMissing(missingHint string) {
 }
 
 func (p *Parser) unexpected() {
+	panic(p.unexpectedDiagnostic())
+}
+
+// 生成当前 token 的语法错误诊断
+func (p *Parser) unexpectedDiagnostic() *diagnostic.Diagnostic {
 	var message string
 	token := p.current
 
@@ -94,7 +159,7 @@ func (p *Parser) unexpected() {
 		message = "unexpected token " + token.String()
 	}
 
-	p.UnexpectedPos(token.Start, message)
+	return diagnostic.New(diagnostic.CodeSyntax, p.source, token.Position, message)
 }
 
 // 判断当前是否为指定 token 类型
@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/diagnostic"
+	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
 )
@@ -108,10 +112,68 @@ func TestParser(t *testing.T) {
 			panic(err)
 		}
 
-		NewParser(string(code), file.Name()).Parse()
+		parser := NewParser(string(code), file.Name())
+		parser.Parse()
+		assert.Empty(t, parser.Diagnostics(), file.Name())
 	}
 
 	//for _, fixture := range parserFixtures {
 	//	NewParser(fixture)
 	//}
 }
+
+func TestParserDiagnostic(t *testing.T) {
+	parser := NewParser("let a = 1\nlet b = @", "main")
+	file := parser.Parse()
+
+	assert.Len(t, file.Body, 2)
+	assert.Len(t, parser.Diagnostics(), 1)
+
+	d := parser.Diagnostics()[0]
+	assert.Equal(t, "main", d.ModuleId)
+	assert.Equal(t, diagnostic.CodeLexical, d.Code)
+	assert.Equal(t, 2, d.Line)
+	assert.Equal(t, 9, d.Column)
+}
+
+func TestParserRecover(t *testing.T) {
+	code := `
+let a = )
+fn b( {
+    let x = 1
+}
+fn c() {
+    let s = A{ x: ] }
+    let y = 2
+}
+struct D { a: number b }
+let e = 1 2
+`
+	parser := NewParser(code, "main")
+	file := parser.Parse()
+
+	lines := make([]int, 0, len(parser.Diagnostics()))
+	for _, d := range parser.Diagnostics() {
+		assert.Equal(t, diagnostic.CodeSyntax, d.Code)
+		lines = append(lines, d.Line)
+	}
+	assert.Equal(t, []int{2, 3, 7, 10, 11}, lines)
+
+	kinds := make([]string, 0, len(file.Body))
+	for _, stmt := range file.Body {
+		kinds = append(kinds, fmt.Sprintf("%T", stmt.Node))
+	}
+	assert.Equal(t, []string{
+		"*ast.VarDecl", "*ast.BadStmt", "*ast.BadStmt", "*ast.FuncDecl",
+		"*ast.BadStmt", "*ast.VarDecl", "*ast.ExprStmt",
+	}, kinds)
+
+	// 函数体内的错误不影响后续语句
+	body := file.Body[3].Node.(*ast.FuncDecl).Body.Node.(*ast.BlockStmt).Body
+	assert.Len(t, body, 2)
+	assert.IsType(t, &ast.BadStmt{}, body[0].Node)
+	assert.IsType(t, &ast.VarDecl{}, body[1].Node)
+
+	// 缺失的初始值使用 BadExpr 占位
+	assert.IsType(t, &ast.BadExpr{}, file.Body[0].Node.(*ast.VarDecl).Init.Node)
+}
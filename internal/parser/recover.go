@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"github.com/peakchen90/noah-lang/internal/ast"
+	"github.com/peakchen90/noah-lang/internal/lexer"
+)
+
+// 语句起始关键字（错误恢复的同步点）
+var stmtKeywords = [...]string{
+	"pub", "import", "fn", "let", "const", "type", "interface", "struct", "enum", "impl",
+	"if", "for", "return", "break", "continue",
+}
+
+func isStmtKeyword(token *lexer.Token) bool {
+	if token.Type != lexer.TTKeyword {
+		return false
+	}
+	for _, item := range stmtKeywords {
+		if item == token.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析一个语句，出现语法错误时记录诊断信息，同步到下一个语句边界并返回 BadStmt 占位
+func (p *Parser) parseStmtRecover(inBlock bool) *ast.Stmt {
+	startToken := p.current
+	nesting := p.nesting
+
+	var stmt *ast.Stmt
+	ok := p.catch(func() {
+		stmt = p.parseStmt()
+	})
+
+	// 没有消费任何 token 时同样需要同步，避免死循环
+	if ok && p.current != startToken {
+		return stmt
+	}
+
+	p.synchronize(startToken, nesting, inBlock)
+
+	bad := &ast.Stmt{Node: &ast.BadStmt{}}
+	bad.Start = startToken.Start
+	bad.End = startToken.End
+	if p.lexer.LastToken != nil && p.lexer.LastToken.End > bad.End {
+		bad.End = p.lexer.LastToken.End
+	}
+	return bad
+}
+
+// 跳过 token 直到语句边界：同层级的 `;`、换行、语句关键字或闭合的 `}`
+func (p *Parser) synchronize(startToken *lexer.Token, nesting int, inBlock bool) {
+	skipped := p.current != startToken
+
+	for !p.isEnd() {
+		if p.nesting <= nesting {
+			if p.isToken(lexer.TTBraceR) {
+				if inBlock {
+					return
+				}
+				// 顶层多余的 `}`
+				p.skipToken()
+				return
+			}
+			if skipped && (isStmtKeyword(p.current) || p.lexer.SeenNewline) {
+				if p.nesting < nesting {
+					p.nesting = nesting
+				}
+				return
+			}
+			if p.isToken(lexer.TTSemi) {
+				p.skipToken()
+				return
+			}
+		}
+
+		p.skipToken()
+		skipped = true
+	}
+
+	p.nesting = nesting
+}
+
+// 读取下一个 token，忽略词法错误（已记录诊断信息）
+func (p *Parser) skipToken() {
+	for !p.catch(func() { p.nextToken() }) {
+	}
+}
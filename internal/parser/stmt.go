@@ -91,8 +91,9 @@ func (p *Parser) parseStmt() *ast.Stmt {
 		}
 	}
 
+	// 语句后缺少分隔符，记录错误后继续解析
 	if tailSemiCount == 0 && !p.lexer.SeenNewline && !p.isEnd() && !p.isToken(lexer.TTBraceR) {
-		p.unexpected()
+		p.report(p.unexpectedDiagnostic())
 	}
 
 	return stmt
@@ -195,7 +196,7 @@ func (p *Parser) parseVarDecl(pubToken *lexer.Token, isConst bool) *ast.Stmt {
 		p.unexpectedMissing("variable name")
 	}
 	if isReservedType(token.Value) {
-		p.UnexpectedPos(token.Start, "Reserved type cannot be used: "+token.Value)
+		p.unexpectedAt(token.Position, "Reserved type cannot be used: "+token.Value)
 	}
 	id := newIdentifier(token)
 
@@ -220,6 +221,7 @@ func (p *Parser) parseVarDecl(pubToken *lexer.Token, isConst bool) *ast.Stmt {
 		Const: isConst,
 		Pub:   pubToken != nil,
 	}
+	stmt.End = p.lexer.LastToken.End
 
 	return stmt
 }
@@ -237,7 +239,7 @@ func (p *Parser) parseTypeDecl(pubToken *lexer.Token) *ast.Stmt {
 		p.unexpectedMissing("type name")
 	}
 	if isReservedType(p.current.Value) {
-		p.UnexpectedPos(p.current.Start, "Reserved type cannot be used: "+p.current.Value)
+		p.unexpectedAt(p.current.Position, "Reserved type cannot be used: "+p.current.Value)
 	}
 	name := newKindIdentifier(p.current)
 	p.consume(lexer.TTIdentifier, true)
@@ -266,7 +268,7 @@ func (p *Parser) parseInterfaceDecl(pubToken *lexer.Token) *ast.Stmt {
 		p.unexpectedMissing("interface name")
 	}
 	if isReservedType(p.current.Value) {
-		p.UnexpectedPos(p.current.Start, "Reserved type cannot be used: "+p.current.Value)
+		p.unexpectedAt(p.current.Position, "Reserved type cannot be used: "+p.current.Value)
 	}
 	name := newKindIdentifier(p.current)
 	p.consume(lexer.TTIdentifier, true)
@@ -298,7 +300,7 @@ func (p *Parser) parseStructDecl(pubToken *lexer.Token) *ast.Stmt {
 
 	nameToken := p.consume(lexer.TTIdentifier, true)
 	if isReservedType(nameToken.Value) {
-		p.UnexpectedPos(nameToken.Start, "Reserved type cannot be used: "+nameToken.Value)
+		p.unexpectedAt(nameToken.Position, "Reserved type cannot be used: "+nameToken.Value)
 	}
 
 	stmt.Node = &ast.TStructDecl{
@@ -324,7 +326,7 @@ func (p *Parser) parseEnumDecl(pubToken *lexer.Token) *ast.Stmt {
 		p.unexpectedMissing("enum name")
 	}
 	if isReservedType(p.current.Value) {
-		p.UnexpectedPos(p.current.Start, "Reserved type cannot be used: "+p.current.Value)
+		p.unexpectedAt(p.current.Position, "Reserved type cannot be used: "+p.current.Value)
 	}
 	name := newKindIdentifier(p.current)
 	p.consume(lexer.TTIdentifier, true)
@@ -568,7 +570,7 @@ func (p *Parser) parseBlockStmt() *ast.Stmt {
 	body := make([]*ast.Stmt, 0, helper.DefaultCap)
 
 	for !p.isEnd() && !p.isToken(lexer.TTBraceR) {
-		body = append(body, p.parseStmt())
+		body = append(body, p.parseStmtRecover(true))
 	}
 
 	stmt.Node = &ast.BlockStmt{Body: body}
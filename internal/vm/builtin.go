@@ -0,0 +1,289 @@
+package vm
+
+import (
+	"io"
+	"strings"
+)
+
+// 内置方法（见 design/implicit-interface.md），args 为接收者之后的参数，
+// 执行期间接收者及参数仍在栈上
+type builtinMethod struct {
+	arity   int  // 参数个数，有剩余参数时为固定参数的个数
+	hasRest bool // 是否接收任意个数的剩余参数
+	fn      func(vm *VM, receiver Value, args []Value) Value
+}
+
+// number、byte、char、bool
+var scalarMethods = map[string]builtinMethod{
+	"toStr": {fn: builtinToStr},
+	"clone": {fn: func(vm *VM, receiver Value, args []Value) Value { return receiver }},
+}
+
+var stringMethods = map[string]builtinMethod{
+	"toStr": {fn: builtinToStr},
+	"len": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newNumber(float64(len([]rune(receiver.(*StringValue).Value))))
+	}},
+	"clone": {fn: func(vm *VM, receiver Value, args []Value) Value { return receiver }},
+	"split": {arity: 1, fn: func(vm *VM, receiver Value, args []Value) Value {
+		sep := vm.stringArg(args[0])
+		parts := strings.Split(receiver.(*StringValue).Value, sep)
+		items := make([]Value, len(parts))
+		for i, part := range parts {
+			items[i] = newString(part)
+		}
+		return vm.newArray(items)
+	}},
+	"toChars": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		chars := []rune(receiver.(*StringValue).Value)
+		items := make([]Value, len(chars))
+		for i, ch := range chars {
+			items[i] = &Uint32Value{Value: uint32(ch)}
+		}
+		return vm.newArray(items)
+	}},
+	"toUpperCase": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newString(strings.ToUpper(receiver.(*StringValue).Value))
+	}},
+	"toLowerCase": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newString(strings.ToLower(receiver.(*StringValue).Value))
+	}},
+	"trim": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newString(strings.TrimSpace(receiver.(*StringValue).Value))
+	}},
+	"indexOf": {arity: 1, fn: func(vm *VM, receiver Value, args []Value) Value {
+		ch, ok := args[0].(*Uint32Value)
+		if !ok {
+			vm.throw("invalid argument type: %s", TypeName(args[0]))
+		}
+		for i, item := range []rune(receiver.(*StringValue).Value) {
+			if uint32(item) == ch.Value {
+				return newNumber(float64(i))
+			}
+		}
+		return newNumber(-1)
+	}},
+	"slice": {arity: 2, fn: func(vm *VM, receiver Value, args []Value) Value {
+		chars := []rune(receiver.(*StringValue).Value)
+		start, end := vm.checkSlice(args[0], args[1], len(chars))
+		return newString(string(chars[start:end]))
+	}},
+}
+
+// 定长数组及可变长数组
+var arrayMethods = map[string]builtinMethod{
+	"toStr": {fn: builtinToStr},
+	"len": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newNumber(float64(len(receiver.(*ArrayValue).Value)))
+	}},
+	"clone": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		items := make([]Value, len(receiver.(*ArrayValue).Value))
+		copy(items, receiver.(*ArrayValue).Value)
+		return vm.newArray(items)
+	}},
+}
+
+// 仅可变长数组
+var vectorMethods = map[string]builtinMethod{
+	"push": {hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		vm.resizeArray(array, append(array.Value, args...))
+		return nil
+	}},
+	"pop": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		if len(array.Value) == 0 {
+			vm.throw("cannot pop from an empty array")
+		}
+		last := array.Value[len(array.Value)-1]
+		vm.resizeArray(array, array.Value[:len(array.Value)-1])
+		return last
+	}},
+	"unshift": {hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		items := make([]Value, 0, len(args)+len(array.Value))
+		vm.resizeArray(array, append(append(items, args...), array.Value...))
+		return nil
+	}},
+	"shift": {fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		if len(array.Value) == 0 {
+			vm.throw("cannot shift from an empty array")
+		}
+		first := array.Value[0]
+		vm.resizeArray(array, array.Value[1:])
+		return first
+	}},
+	"splice": {arity: 2, hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		start, end := vm.checkSlice(args[0], nil, len(array.Value))
+		count := vm.intArg(args[1])
+		if count < 0 {
+			vm.throw("invalid splice length: %d", count)
+		}
+		if start+count < end {
+			end = start + count
+		}
+		removed := make([]Value, end-start)
+		copy(removed, array.Value[start:end])
+		items := make([]Value, 0, len(array.Value)-len(removed)+len(args)-2)
+		items = append(append(append(items, array.Value[:start]...), args[2:]...), array.Value[end:]...)
+		vm.resizeArray(array, items)
+		return vm.newArray(removed)
+	}},
+	"slice": {arity: 2, fn: func(vm *VM, receiver Value, args []Value) Value {
+		array := receiver.(*ArrayValue)
+		start, end := vm.checkSlice(args[0], args[1], len(array.Value))
+		items := make([]Value, end-start)
+		copy(items, array.Value[start:end])
+		return vm.newArray(items)
+	}},
+}
+
+func builtinToStr(vm *VM, receiver Value, args []Value) Value {
+	return newString(FormatValue(receiver))
+}
+
+// 内置函数（见 design/README.md），接收者为内置函数本身
+var builtinFuncs = map[string]builtinMethod{
+	"print": {hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		_, _ = io.WriteString(vm.Stdout, formatArgs(args))
+		return nil
+	}},
+	"println": {hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		_, _ = io.WriteString(vm.Stdout, formatArgs(args)+"\n")
+		return nil
+	}},
+	"panic": {arity: 1, fn: func(vm *VM, receiver Value, args []Value) Value {
+		vm.throw("panic: %s", vm.stringArg(args[0]))
+		return nil
+	}},
+	"assert": {arity: 1, hasRest: true, fn: func(vm *VM, receiver Value, args []Value) Value {
+		cond, ok := args[0].(*BoolValue)
+		if !ok {
+			vm.throw("invalid argument type: %s", TypeName(args[0]))
+		}
+		if !cond.Value {
+			if len(args) > 1 {
+				vm.throw("assertion failed: %s", formatArgs(args[1:]))
+			}
+			vm.throw("assertion failed")
+		}
+		return nil
+	}},
+	"len": {arity: 1, fn: func(vm *VM, receiver Value, args []Value) Value {
+		switch args[0].(type) {
+		case *StringValue:
+			return newNumber(float64(len([]rune(args[0].(*StringValue).Value))))
+		case *ArrayValue:
+			return newNumber(float64(len(args[0].(*ArrayValue).Value)))
+		}
+		vm.throw("invalid argument for len: %s", TypeName(args[0]))
+		return nil
+	}},
+	"typeof": {arity: 1, fn: func(vm *VM, receiver Value, args []Value) Value {
+		return newString(TypeName(args[0]))
+	}},
+}
+
+// 格式化内置函数的参数，以空格分隔
+func formatArgs(args []Value) string {
+	items := make([]string, len(args))
+	for i, arg := range args {
+		items[i] = FormatValue(arg)
+	}
+	return strings.Join(items, " ")
+}
+
+// 查找值的内置方法
+func findBuiltinMethod(receiver Value, name string) (builtinMethod, bool) {
+	var method builtinMethod
+	var has bool
+	switch receiver.(type) {
+	case *NumberValue, *ByteValue, *Uint32Value, *BoolValue:
+		method, has = scalarMethods[name]
+	case *StringValue:
+		method, has = stringMethods[name]
+	case *ArrayValue:
+		if method, has = arrayMethods[name]; !has && receiver.(*ArrayValue).Len < 0 {
+			method, has = vectorMethods[name]
+		}
+	}
+	return method, has
+}
+
+// 调用内置方法，栈上依次为接收者及 argc 个参数
+func (vm *VM) callBuiltin(method builtinMethod, name string, argc int, slot int) {
+	if method.hasRest && argc < method.arity {
+		vm.throw("method `%s` expects at least %d argument(s), got %d", name, method.arity, argc)
+	} else if !method.hasRest && argc != method.arity {
+		vm.throw("method `%s` expects %d argument(s), got %d", name, method.arity, argc)
+	}
+	result := method.fn(vm, vm.stack[slot], vm.stack[slot+1:])
+	vm.stack = vm.stack[:slot]
+	vm.push(result)
+}
+
+// 调用内置函数，栈上依次为内置函数及 argc 个参数
+func (vm *VM) callBuiltinFunc(name string, argc int, slot int) {
+	fn, has := builtinFuncs[name]
+	if !has {
+		vm.throw("undefined built-in function `%s`", name)
+	}
+	if fn.hasRest && argc < fn.arity {
+		vm.throw("function `%s` expects at least %d argument(s), got %d", name, fn.arity, argc)
+	} else if !fn.hasRest && argc != fn.arity {
+		vm.throw("function `%s` expects %d argument(s), got %d", name, fn.arity, argc)
+	}
+	result := fn.fn(vm, vm.stack[slot], vm.stack[slot+1:])
+	vm.stack = vm.stack[:slot]
+	vm.push(result)
+}
+
+// 创建可变长数组
+func (vm *VM) newArray(items []Value) *ArrayValue {
+	size := arraySize(len(items))
+	vm.reserve(size)
+	array := &ArrayValue{Value: items, Len: -1}
+	vm.track(array, size)
+	return array
+}
+
+// 修改数组的元素，同时更新堆大小
+func (vm *VM) resizeArray(array *ArrayValue, items []Value) {
+	size := arraySize(len(items))
+	if delta := size - array.size; delta > 0 {
+		vm.reserve(delta)
+	}
+	vm.heap.bytes += size - array.size
+	array.size = size
+	array.Value = items
+}
+
+func (vm *VM) intArg(value Value) int {
+	f, ok := toFloat(value)
+	if !ok || f != float64(int(f)) {
+		vm.throw("invalid argument: %s", FormatValue(value))
+	}
+	return int(f)
+}
+
+func (vm *VM) stringArg(value Value) string {
+	str, ok := value.(*StringValue)
+	if !ok {
+		vm.throw("invalid argument type: %s", TypeName(value))
+	}
+	return str.Value
+}
+
+// 校验切片的范围 [start:end]，end 为 nil 时表示到末尾
+func (vm *VM) checkSlice(startValue Value, endValue Value, length int) (int, int) {
+	start, end := vm.intArg(startValue), length
+	if endValue != nil {
+		end = vm.intArg(endValue)
+	}
+	if start < 0 || end < start || end > length {
+		vm.throw("slice bounds out of range [%d:%d] with length %d", start, end, length)
+	}
+	return start, end
+}
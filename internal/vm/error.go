@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceItem 调用栈中的一帧
+type TraceItem struct {
+	Function string
+	ModuleId string
+	Pos      int // 源码位置（字符索引），-1 表示未知
+	Line     int
+	Column   int
+}
+
+func (t TraceItem) String() string {
+	if t.Pos < 0 {
+		return fmt.Sprintf("%s (%s)", t.Function, t.ModuleId)
+	}
+	return fmt.Sprintf("%s (%s:%d:%d)", t.Function, t.ModuleId, t.Line, t.Column)
+}
+
+// RuntimeError 运行时错误，包含出错位置及调用栈（最内层在前）
+type RuntimeError struct {
+	Message string
+	Trace   []TraceItem
+}
+
+func (e *RuntimeError) Error() string {
+	if len(e.Trace) == 0 {
+		return "runtime error: " + e.Message
+	}
+	top := e.Trace[0]
+	if top.Pos < 0 {
+		return fmt.Sprintf("%s: runtime error: %s", top.ModuleId, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: runtime error: %s", top.ModuleId, top.Line, top.Column, e.Message)
+}
+
+// StackTrace 返回调用栈文本
+func (e *RuntimeError) StackTrace() string {
+	builder := strings.Builder{}
+	for _, item := range e.Trace {
+		builder.WriteString("    at ")
+		builder.WriteString(item.String())
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
@@ -0,0 +1,207 @@
+package vm
+
+import (
+	"time"
+)
+
+// 估算对象占用内存时使用的大小（字节）
+const (
+	objectSize = 32 // 对象头
+	slotSize   = 16 // 一个值（接口）
+)
+
+// HeapOptions 堆配置
+type HeapOptions struct {
+	MaxBytes     int     // 堆内存上限，0 表示不限制
+	InitialLimit int     // 首次触发 GC 的堆大小
+	GrowthFactor float64 // GC 后下次触发 GC 的堆大小为存活大小的倍数
+	Stress       bool    // 每次分配前都触发 GC（用于测试）
+}
+
+// DefaultHeapOptions 默认的堆配置
+var DefaultHeapOptions = HeapOptions{
+	InitialLimit: 1 << 20,
+	GrowthFactor: 2,
+}
+
+// GCStats GC 统计信息
+type GCStats struct {
+	Collections int           // GC 次数
+	Allocated   int           // 累计分配的对象数
+	Freed       int           // 累计回收的对象数
+	LiveObjects int           // 当前存活的对象数
+	LiveBytes   int           // 当前存活对象的大小
+	PeakBytes   int           // 堆大小的峰值
+	NextGC      int           // 下次触发 GC 的堆大小
+	TotalPause  time.Duration // GC 累计耗时
+}
+
+// 堆对象（数组、结构体、函数引用）的公共头部
+type gcHeader struct {
+	marked bool
+	size   int
+}
+
+func (h *gcHeader) header() *gcHeader {
+	return h
+}
+
+// 由堆管理的对象
+type heapObject interface {
+	Value
+	header() *gcHeader
+	// 遍历引用的值
+	each(visit func(value Value))
+}
+
+func (v *ArrayValue) each(visit func(value Value)) {
+	for _, item := range v.Value {
+		visit(item)
+	}
+}
+
+func (v *StructValue) each(visit func(value Value)) {
+	for _, item := range v.Value {
+		visit(item)
+	}
+}
+
+// 函数引用暂时不捕获变量，常量池中的函数引用不由堆管理
+func (v *FuncValue) each(visit func(value Value)) {}
+
+// 堆：记录所有分配的对象，使用标记-清除算法回收不可达的对象
+type heap struct {
+	options HeapOptions
+	objects []heapObject
+	bytes   int // 当前堆大小
+	stats   GCStats
+	gray    []heapObject // 标记阶段待扫描的对象
+}
+
+func newHeap(options HeapOptions) *heap {
+	if options.InitialLimit <= 0 {
+		options.InitialLimit = DefaultHeapOptions.InitialLimit
+	}
+	if options.GrowthFactor <= 1 {
+		options.GrowthFactor = DefaultHeapOptions.GrowthFactor
+	}
+	h := &heap{options: options}
+	h.stats.NextGC = options.InitialLimit
+	return h
+}
+
+func arraySize(count int) int {
+	return objectSize + count*slotSize
+}
+
+func structSize(count int) int {
+	return objectSize + count*slotSize*2
+}
+
+// 分配对象前调用：堆达到阈值时执行 GC，超出堆上限时抛出运行时错误。
+// 新对象的成员需要仍在栈上，才能在 GC 时被标记
+func (vm *VM) reserve(size int) {
+	h := vm.heap
+	if h.options.Stress || h.bytes+size > h.stats.NextGC {
+		vm.collect()
+	}
+	if h.options.MaxBytes > 0 && h.bytes+size > h.options.MaxBytes {
+		vm.throw("out of memory: heap limit of %d bytes exceeded", h.options.MaxBytes)
+	}
+}
+
+// 记录新分配的对象
+func (vm *VM) track(object heapObject, size int) {
+	h := vm.heap
+	object.header().size = size
+	h.objects = append(h.objects, object)
+	h.bytes += size
+	h.stats.Allocated++
+	if h.bytes > h.stats.PeakBytes {
+		h.stats.PeakBytes = h.bytes
+	}
+}
+
+// GC 立即执行一次垃圾回收
+func (vm *VM) GC() {
+	vm.collect()
+}
+
+// GCStats 返回 GC 统计信息
+func (vm *VM) GCStats() GCStats {
+	stats := vm.heap.stats
+	stats.LiveObjects = len(vm.heap.objects)
+	stats.LiveBytes = vm.heap.bytes
+	return stats
+}
+
+func (vm *VM) collect() {
+	h := vm.heap
+	start := time.Now()
+
+	vm.markRoots()
+	for len(h.gray) > 0 {
+		object := h.gray[len(h.gray)-1]
+		h.gray = h.gray[:len(h.gray)-1]
+		object.each(h.mark)
+	}
+	freed := h.sweep()
+
+	next := int(float64(h.bytes) * h.options.GrowthFactor)
+	if next < h.options.InitialLimit {
+		next = h.options.InitialLimit
+	}
+	h.stats.NextGC = next
+	h.stats.Collections++
+	h.stats.Freed += freed
+	h.stats.TotalPause += time.Since(start)
+}
+
+// 根对象：栈上的值及全局变量。调用帧的参数与局部变量都保存在栈上，
+// 常量池中只有静态的值，不需要扫描
+func (vm *VM) markRoots() {
+	h := vm.heap
+	for _, value := range vm.stack {
+		h.mark(value)
+	}
+	for _, globals := range vm.globals {
+		for _, value := range globals {
+			h.mark(value)
+		}
+	}
+}
+
+func (h *heap) mark(value Value) {
+	object, ok := value.(heapObject)
+	if !ok {
+		return
+	}
+	header := object.header()
+	if header.marked {
+		return
+	}
+	header.marked = true
+	h.gray = append(h.gray, object)
+}
+
+// 移除未标记的对象并清除标记，返回回收的对象数
+func (h *heap) sweep() int {
+	live := h.objects[:0]
+	freed := 0
+	for _, object := range h.objects {
+		header := object.header()
+		if header.marked {
+			header.marked = false
+			live = append(live, object)
+		} else {
+			h.bytes -= header.size
+			freed++
+		}
+	}
+	// 避免被回收的对象无法被 Go 回收
+	for i := len(live); i < len(h.objects); i++ {
+		h.objects[i] = nil
+	}
+	h.objects = live
+	return freed
+}
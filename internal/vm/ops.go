@@ -0,0 +1,514 @@
+package vm
+
+import (
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 运算指令对应的运算符（用于错误信息）
+var opSymbols = map[bytecode.OpCode]string{
+	bytecode.OpAdd:      "+",
+	bytecode.OpSub:      "-",
+	bytecode.OpMul:      "*",
+	bytecode.OpDiv:      "/",
+	bytecode.OpRem:      "%",
+	bytecode.OpNeg:      "-",
+	bytecode.OpToNumber: "+",
+	bytecode.OpConcat:   "+",
+	bytecode.OpBitAnd:   "&",
+	bytecode.OpBitOr:    "|",
+	bytecode.OpBitXor:   "^",
+	bytecode.OpBitNot:   "~",
+	bytecode.OpShl:      "<<",
+	bytecode.OpShr:      ">>",
+	bytecode.OpLt:       "<",
+	bytecode.OpLe:       "<=",
+	bytecode.OpGt:       ">",
+	bytecode.OpGe:       ">=",
+}
+
+// 数值类型（number、byte、char）转为 float64
+func toFloat(value Value) (float64, bool) {
+	switch value.(type) {
+	case *NumberValue:
+		return value.(*NumberValue).Value, true
+	case *ByteValue:
+		return float64(value.(*ByteValue).Value), true
+	case *Uint32Value:
+		return float64(value.(*Uint32Value).Value), true
+	}
+	return 0, false
+}
+
+// 运算结果保持与操作数相同的数值类型：同为 byte 或同为 char 时不会转为 number
+func numericResult(left Value, right Value, result float64) Value {
+	switch left.(type) {
+	case *ByteValue:
+		if _, ok := right.(*ByteValue); ok {
+			return &ByteValue{Value: uint8(int64(result))}
+		}
+	case *Uint32Value:
+		if _, ok := right.(*Uint32Value); ok {
+			return &Uint32Value{Value: uint32(int64(result))}
+		}
+	}
+	return newNumber(result)
+}
+
+func (vm *VM) arith(op bytecode.OpCode, left Value, right Value) Value {
+	if op == bytecode.OpAdd {
+		if _, ok := left.(*StringValue); ok {
+			return vm.concat(left, right)
+		}
+	}
+
+	a, ok1 := toFloat(left)
+	b, ok2 := toFloat(right)
+	if !ok1 || !ok2 {
+		vm.throw("invalid operation: %s %s %s", TypeName(left), opSymbols[op], TypeName(right))
+	}
+
+	var result float64
+	switch op {
+	case bytecode.OpAdd:
+		result = a + b
+	case bytecode.OpSub:
+		result = a - b
+	case bytecode.OpMul:
+		result = a * b
+	case bytecode.OpDiv:
+		result = a / b
+	case bytecode.OpRem:
+		result = math.Mod(a, b)
+	}
+	return numericResult(left, right, result)
+}
+
+func (vm *VM) concat(left Value, right Value) Value {
+	str, ok := left.(*StringValue)
+	if !ok {
+		vm.throw("invalid operation: %s + %s", TypeName(left), TypeName(right))
+	}
+	if right == nil {
+		vm.throw("invalid operation: string + null")
+	}
+	return newString(str.Value + FormatValue(right))
+}
+
+func (vm *VM) toInt(op bytecode.OpCode, value Value) int64 {
+	f, ok := toFloat(value)
+	if !ok {
+		vm.throw("invalid operation: %s %s", opSymbols[op], TypeName(value))
+	}
+	return int64(f)
+}
+
+func (vm *VM) bitwise(op bytecode.OpCode, left Value, right Value) Value {
+	_, ok1 := toFloat(left)
+	_, ok2 := toFloat(right)
+	if !ok1 || !ok2 {
+		vm.throw("invalid operation: %s %s %s", TypeName(left), opSymbols[op], TypeName(right))
+	}
+	a, b := vm.toInt(op, left), vm.toInt(op, right)
+
+	var result int64
+	switch op {
+	case bytecode.OpBitAnd:
+		result = a & b
+	case bytecode.OpBitOr:
+		result = a | b
+	case bytecode.OpBitXor:
+		result = a ^ b
+	case bytecode.OpShl, bytecode.OpShr:
+		if b < 0 {
+			vm.throw("negative shift amount: %d", b)
+		}
+		if op == bytecode.OpShl {
+			result = a << uint64(b)
+		} else {
+			result = a >> uint64(b)
+		}
+	}
+	return numericResult(left, right, float64(result))
+}
+
+func (vm *VM) unary(op bytecode.OpCode, value Value) Value {
+	f, ok := toFloat(value)
+	if !ok {
+		vm.throw("invalid operation: %s%s", opSymbols[op], TypeName(value))
+	}
+
+	switch op {
+	case bytecode.OpNeg:
+		return newNumber(-f)
+	case bytecode.OpBitNot:
+		return numericResult(value, value, float64(^int64(f)))
+	}
+	return newNumber(f)
+}
+
+func (vm *VM) toBool(value Value) bool {
+	v, ok := value.(*BoolValue)
+	if !ok {
+		vm.throw("expect a bool value, but got %s", TypeName(value))
+	}
+	return v.Value
+}
+
+// 判断两个值是否相等，数组、结构体比较引用
+func valuesEqual(left Value, right Value) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	if a, ok := toFloat(left); ok {
+		b, ok := toFloat(right)
+		return ok && a == b
+	}
+
+	switch left.(type) {
+	case *StringValue:
+		r, ok := right.(*StringValue)
+		return ok && left.(*StringValue).Value == r.Value
+	case *BoolValue:
+		r, ok := right.(*BoolValue)
+		return ok && left.(*BoolValue).Value == r.Value
+	case *EnumValue:
+		l := left.(*EnumValue)
+		r, ok := right.(*EnumValue)
+		return ok && l.Kind.SameNamed(r.Kind) && l.Index == r.Index
+	case *FuncValue:
+		r, ok := right.(*FuncValue)
+		return ok && left.(*FuncValue).Ref == r.Ref
+	}
+
+	return left == right
+}
+
+func (vm *VM) compare(op bytecode.OpCode, left Value, right Value) bool {
+	var result int
+
+	a, ok1 := toFloat(left)
+	b, ok2 := toFloat(right)
+	if ok1 && ok2 {
+		switch {
+		case a < b:
+			result = -1
+		case a > b:
+			result = 1
+		case a == b:
+			result = 0
+		default: // NaN
+			return false
+		}
+	} else {
+		l, ok1 := left.(*StringValue)
+		r, ok2 := right.(*StringValue)
+		if !ok1 || !ok2 {
+			vm.throw("invalid operation: %s %s %s", TypeName(left), opSymbols[op], TypeName(right))
+		}
+		result = strings.Compare(l.Value, r.Value)
+	}
+
+	switch op {
+	case bytecode.OpLt:
+		return result < 0
+	case bytecode.OpLe:
+		return result <= 0
+	case bytecode.OpGt:
+		return result > 0
+	}
+	return result >= 0
+}
+
+/* field & index */
+
+func (vm *VM) structValue(object Value, name string, action string) *StructValue {
+	switch object.(type) {
+	case nil:
+		vm.throw("cannot %s field `%s` of null", action, name)
+	case *StructValue:
+		v := object.(*StructValue)
+		if _, has := v.Value[name]; !has {
+			vm.throw("undefined field `%s` for type %s", name, TypeName(object))
+		}
+		return v
+	}
+	vm.throw("cannot %s field `%s` of type %s", action, name, TypeName(object))
+	return nil
+}
+
+func (vm *VM) getField(object Value, name string) Value {
+	return vm.structValue(object, name, "read").Value[name]
+}
+
+func (vm *VM) setField(object Value, name string, value Value) {
+	vm.structValue(object, name, "assign").Value[name] = value
+}
+
+// 校验数组索引
+func (vm *VM) checkIndex(index Value, length int) int {
+	f, ok := toFloat(index)
+	if !ok {
+		vm.throw("invalid index type: %s", TypeName(index))
+	}
+	if f != math.Trunc(f) {
+		vm.throw("invalid index: %s", FormatValue(index))
+	}
+	if f < 0 || f >= float64(length) {
+		vm.throw("index out of range [%s] with length %d", FormatValue(index), length)
+	}
+	return int(f)
+}
+
+func (vm *VM) getIndex(object Value, index Value) Value {
+	switch object.(type) {
+	case nil:
+		vm.throw("cannot index null")
+	case *ArrayValue:
+		items := object.(*ArrayValue).Value
+		return items[vm.checkIndex(index, len(items))]
+	case *StringValue:
+		chars := []rune(object.(*StringValue).Value)
+		return &Uint32Value{Value: uint32(chars[vm.checkIndex(index, len(chars))])}
+	}
+	vm.throw("cannot index a value of type %s", TypeName(object))
+	return nil
+}
+
+func (vm *VM) setIndex(object Value, index Value, value Value) {
+	switch object.(type) {
+	case nil:
+		vm.throw("cannot index null")
+	case *ArrayValue:
+		items := object.(*ArrayValue).Value
+		items[vm.checkIndex(index, len(items))] = value
+		return
+	}
+	vm.throw("cannot assign index of a value of type %s", TypeName(object))
+}
+
+func (vm *VM) length(object Value) int {
+	switch object.(type) {
+	case nil:
+		vm.throw("cannot get length of null")
+	case *ArrayValue:
+		return len(object.(*ArrayValue).Value)
+	case *StringValue:
+		return len([]rune(object.(*StringValue).Value))
+	}
+	vm.throw("cannot get length of a value of type %s", TypeName(object))
+	return 0
+}
+
+/* kind */
+
+// 类型的名称（用于错误信息）
+func kindName(kind *bytecode.Kind) string {
+	if kind.IsNamed() {
+		return kind.Name
+	}
+	return kind.String()
+}
+
+// 获取自定义类型的底层类型
+func underlyingKind(kind *bytecode.Kind) *bytecode.Kind {
+	for kind.Tag == bytecode.KindCustom && kind.Elem != nil {
+		kind = kind.Elem
+	}
+	return kind
+}
+
+// 类型的默认值，引用类型为 null
+func defaultValue(kind *bytecode.Kind) Value {
+	switch underlyingKind(kind).Tag {
+	case bytecode.KindNumber:
+		return newNumber(0)
+	case bytecode.KindByte:
+		return &ByteValue{}
+	case bytecode.KindChar:
+		return &Uint32Value{}
+	case bytecode.KindString:
+		return newString("")
+	case bytecode.KindBool:
+		return newBool(false)
+	}
+	return nil
+}
+
+// 类型的默认值，定长数组的元素均为元素类型的默认值
+func (vm *VM) defaultValue(kind *bytecode.Kind) Value {
+	if size := fixedArraySize(kind); size > 0 {
+		// 一次预留所有数组的空间，避免创建过程中触发 GC 回收尚未引用的元素
+		vm.reserve(size)
+		return vm.newFixedArray(underlyingKind(kind))
+	}
+	return defaultValue(kind)
+}
+
+// 定长数组（包括元素中的定长数组）占用的字节数，非定长数组返回 0
+func fixedArraySize(kind *bytecode.Kind) int {
+	if kind == nil {
+		return 0
+	}
+	kind = underlyingKind(kind)
+	if kind.Tag != bytecode.KindArray || kind.Len < 0 {
+		return 0
+	}
+	return arraySize(kind.Len) + kind.Len*fixedArraySize(kind.Elem)
+}
+
+func (vm *VM) newFixedArray(kind *bytecode.Kind) *ArrayValue {
+	items := make([]Value, kind.Len)
+	for i := range items {
+		if fixedArraySize(kind.Elem) > 0 {
+			items[i] = vm.newFixedArray(underlyingKind(kind.Elem))
+		} else if kind.Elem != nil {
+			items[i] = defaultValue(kind.Elem)
+		}
+	}
+	array := &ArrayValue{Value: items, Len: kind.Len}
+	vm.track(array, arraySize(kind.Len))
+	return array
+}
+
+// 是否为引用类型（可以为 null）
+func isReferenceKind(kind *bytecode.Kind) bool {
+	switch underlyingKind(kind).Tag {
+	case bytecode.KindNumber, bytecode.KindByte, bytecode.KindChar, bytecode.KindString, bytecode.KindBool:
+		return false
+	}
+	return true
+}
+
+// 判断结构体类型是否为指定的类型或继承了指定的类型
+func extendsKind(kind *bytecode.Kind, target *bytecode.Kind) bool {
+	if kind.SameNamed(target) {
+		return true
+	}
+	for _, extend := range kind.Extends {
+		if extendsKind(extend, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断值是否属于指定的类型（null 不属于任何类型）
+func (vm *VM) isKind(value Value, kind *bytecode.Kind) bool {
+	if value == nil {
+		return false
+	}
+
+	kind = underlyingKind(kind)
+	switch kind.Tag {
+	case bytecode.KindAny:
+		return true
+	case bytecode.KindNumber:
+		_, ok := value.(*NumberValue)
+		return ok
+	case bytecode.KindByte:
+		_, ok := value.(*ByteValue)
+		return ok
+	case bytecode.KindChar:
+		_, ok := value.(*Uint32Value)
+		return ok
+	case bytecode.KindString:
+		_, ok := value.(*StringValue)
+		return ok
+	case bytecode.KindBool:
+		_, ok := value.(*BoolValue)
+		return ok
+	case bytecode.KindFunc:
+		_, ok := value.(*FuncValue)
+		return ok
+	case bytecode.KindArray:
+		v, ok := value.(*ArrayValue)
+		if !ok || (kind.Len >= 0 && kind.Len != len(v.Value)) {
+			return false
+		}
+		if kind.Elem != nil && underlyingKind(kind.Elem).Tag != bytecode.KindAny {
+			for _, item := range v.Value {
+				if item != nil && !vm.isKind(item, kind.Elem) {
+					return false
+				}
+			}
+		}
+		return true
+	case bytecode.KindStruct:
+		v, ok := value.(*StructValue)
+		if !ok {
+			return false
+		}
+		if kind.IsNamed() {
+			return extendsKind(v.Kind, kind)
+		}
+		// 匿名结构体：包含所有的字段
+		for _, key := range kind.Fields {
+			if _, has := v.Value[key]; !has {
+				return false
+			}
+		}
+		return true
+	case bytecode.KindInterface:
+		for _, name := range kind.Methods {
+			if _, ok := vm.findMethod(value, name); !ok {
+				return false
+			}
+		}
+		return true
+	case bytecode.KindEnum:
+		v, ok := value.(*EnumValue)
+		return ok && v.Kind.SameNamed(kind)
+	}
+	return false
+}
+
+// 类型转换（`as`）：数值类型之间互相转换（转为 byte、char 时检查范围），number 转为 string，
+// 其余类型检查值的类型，无法转换时抛出运行时错误
+func (vm *VM) cast(value Value, kind *bytecode.Kind) Value {
+	if value == nil {
+		if isReferenceKind(kind) {
+			return nil
+		}
+		vm.throw("cannot cast null to %s", kindName(kind))
+	}
+	if vm.isKind(value, kind) {
+		return value
+	}
+
+	if f, ok := toFloat(value); ok {
+		switch underlyingKind(kind).Tag {
+		case bytecode.KindNumber:
+			return newNumber(f)
+		case bytecode.KindByte:
+			vm.checkCastInteger(f, "byte")
+			if f < 0 || f > math.MaxUint8 {
+				vm.throw("cannot cast %s to byte: out of range [0, 255]", FormatValue(newNumber(f)))
+			}
+			return &ByteValue{Value: uint8(f)}
+		case bytecode.KindChar:
+			vm.checkCastInteger(f, "char")
+			if f < 0 || f > unicode.MaxRune || !utf8.ValidRune(rune(f)) {
+				vm.throw("cannot cast %s to char: invalid code point", FormatValue(newNumber(f)))
+			}
+			return &Uint32Value{Value: uint32(f)}
+		}
+	}
+	if number, ok := value.(*NumberValue); ok && underlyingKind(kind).Tag == bytecode.KindString {
+		return newString(FormatValue(number))
+	}
+
+	vm.throw("cannot cast %s to %s", TypeName(value), kindName(kind))
+	return nil
+}
+
+// 转换为 byte、char 的数值必须是整数
+func (vm *VM) checkCastInteger(f float64, target string) {
+	if f != math.Trunc(f) {
+		vm.throw("cannot cast %s to %s: not an integer", FormatValue(newNumber(f)), target)
+	}
+}
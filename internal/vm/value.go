@@ -1,11 +1,16 @@
 package vm
 
-// TODO
+import (
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"strconv"
+	"strings"
+)
 
 type ValueRef struct {
 	Current Value
 }
 
+// Value 运行时的值，nil 表示 null
 type Value interface{ isValue() }
 
 func (*NumberValue) isValue()  {}
@@ -16,6 +21,9 @@ func (*BoolValue) isValue()    {}
 func (*ArrayValue) isValue()   {}
 func (*StructValue) isValue()  {}
 func (*PointerValue) isValue() {}
+func (*EnumValue) isValue()    {}
+func (*FuncValue) isValue()    {}
+func (*BuiltinValue) isValue() {}
 
 type NumberValue struct {
 	Value float64
@@ -25,6 +33,7 @@ type ByteValue struct {
 	Value uint8
 }
 
+// Uint32Value 字符（Unicode 码点）
 type Uint32Value struct {
 	Value uint32
 }
@@ -38,14 +47,169 @@ type BoolValue struct {
 }
 
 type ArrayValue struct {
+	gcHeader
 	Value []Value
-	Len   int
+	Len   int // 固定长度，-1 表示可变长数组
 }
 
 type StructValue struct {
+	gcHeader
+	Kind  *bytecode.Kind
 	Value map[string]Value
 }
 
 type PointerValue struct {
 	Value Value
 }
+
+// EnumValue 枚举选项
+type EnumValue struct {
+	Kind  *bytecode.Kind
+	Index int
+}
+
+// FuncValue 函数引用
+type FuncValue struct {
+	gcHeader
+	Ref  bytecode.FuncRef
+	Name string
+}
+
+// BuiltinValue 内置函数（如 `println`），不由堆管理
+type BuiltinValue struct {
+	Name string
+}
+
+/* helpers */
+
+func newNumber(value float64) *NumberValue {
+	return &NumberValue{Value: value}
+}
+
+func newString(value string) *StringValue {
+	return &StringValue{Value: value}
+}
+
+func newBool(value bool) *BoolValue {
+	return &BoolValue{Value: value}
+}
+
+// TypeName 返回值的运行时类型名称
+func TypeName(value Value) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case *NumberValue:
+		return "number"
+	case *ByteValue:
+		return "byte"
+	case *Uint32Value:
+		return "char"
+	case *StringValue:
+		return "string"
+	case *BoolValue:
+		return "bool"
+	case *ArrayValue:
+		return "array"
+	case *StructValue:
+		kind := value.(*StructValue).Kind
+		if kind.IsNamed() {
+			return kind.Name
+		}
+		return "struct"
+	case *EnumValue:
+		return value.(*EnumValue).Kind.Name
+	case *FuncValue, *BuiltinValue:
+		return "fn"
+	case *PointerValue:
+		return "pointer"
+	}
+	return "unknown"
+}
+
+// FormatValue 将值格式化为字符串（用于打印）
+func FormatValue(value Value) string {
+	builder := strings.Builder{}
+	formatValue(&builder, value, false, make(map[Value]bool))
+	return builder.String()
+}
+
+// visiting 记录正在格式化的数组、结构体，引用自身时输出 `<cycle>`
+func formatValue(builder *strings.Builder, value Value, quote bool, visiting map[Value]bool) {
+	switch value.(type) {
+	case *ArrayValue, *StructValue:
+		if visiting[value] {
+			builder.WriteString("<cycle>")
+			return
+		}
+		visiting[value] = true
+		defer delete(visiting, value)
+	}
+
+	switch value.(type) {
+	case nil:
+		builder.WriteString("null")
+	case *NumberValue:
+		builder.WriteString(strconv.FormatFloat(value.(*NumberValue).Value, 'f', -1, 64))
+	case *ByteValue:
+		builder.WriteString(strconv.Itoa(int(value.(*ByteValue).Value)))
+	case *Uint32Value:
+		ch := rune(value.(*Uint32Value).Value)
+		if quote {
+			builder.WriteString(strconv.QuoteRune(ch))
+		} else {
+			builder.WriteRune(ch)
+		}
+	case *StringValue:
+		str := value.(*StringValue).Value
+		if quote {
+			builder.WriteString(strconv.Quote(str))
+		} else {
+			builder.WriteString(str)
+		}
+	case *BoolValue:
+		builder.WriteString(strconv.FormatBool(value.(*BoolValue).Value))
+	case *ArrayValue:
+		builder.WriteByte('[')
+		for i, item := range value.(*ArrayValue).Value {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			formatValue(builder, item, true, visiting)
+		}
+		builder.WriteByte(']')
+	case *StructValue:
+		v := value.(*StructValue)
+		if v.Kind.IsNamed() {
+			builder.WriteString(v.Kind.Name)
+			builder.WriteByte(' ')
+		}
+		builder.WriteByte('{')
+		for i, key := range v.Kind.Fields {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			builder.WriteByte(' ')
+			builder.WriteString(key)
+			builder.WriteString(": ")
+			formatValue(builder, v.Value[key], true, visiting)
+		}
+		if len(v.Kind.Fields) > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteByte('}')
+	case *EnumValue:
+		v := value.(*EnumValue)
+		builder.WriteString(v.Kind.Name)
+		builder.WriteByte('.')
+		builder.WriteString(v.Kind.Choices[v.Index])
+	case *FuncValue:
+		builder.WriteString("fn ")
+		builder.WriteString(value.(*FuncValue).Name)
+	case *BuiltinValue:
+		builder.WriteString("fn ")
+		builder.WriteString(value.(*BuiltinValue).Name)
+	case *PointerValue:
+		builder.WriteString("pointer")
+	}
+}
@@ -0,0 +1,512 @@
+package vm
+
+import (
+	"fmt"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/helper"
+	"io"
+	"os"
+)
+
+// MaxFrames 调用栈的最大深度
+const MaxFrames = 4096
+
+// 函数调用帧
+type frame struct {
+	module *bytecode.Module
+	fn     *bytecode.Function
+	ip     int // 下一条指令位置
+	start  int // 当前指令位置
+	base   int // 局部变量在栈中的起始位置
+	slot   int // 函数返回后返回值在栈中的位置
+}
+
+// 方法表的键：具名类型所在模块及名称
+type methodKey struct {
+	module int
+	name   string
+}
+
+// VM 基于栈的虚拟机
+type VM struct {
+	Stdout    io.Writer
+	program   *bytecode.Program
+	constants [][]Value // 每个模块常量池对应的值（类型常量为 nil）
+	globals   [][]Value // 每个模块的全局变量
+	inited    []bool    // 模块是否已经初始化
+	methods   map[methodKey]map[string]bytecode.FuncRef
+	stack     []Value
+	frames    []*frame
+	heap      *heap
+}
+
+func New(program *bytecode.Program) *VM {
+	return NewWithHeap(program, DefaultHeapOptions)
+}
+
+// NewWithHeap 使用指定的堆配置创建虚拟机
+func NewWithHeap(program *bytecode.Program, options HeapOptions) *VM {
+	vm := &VM{
+		Stdout:    os.Stdout,
+		program:   program,
+		constants: make([][]Value, len(program.Modules)),
+		globals:   make([][]Value, len(program.Modules)),
+		inited:    make([]bool, len(program.Modules)),
+		methods:   make(map[methodKey]map[string]bytecode.FuncRef),
+		stack:     make([]Value, 0, 256),
+		frames:    make([]*frame, 0, helper.DefaultCap),
+		heap:      newHeap(options),
+	}
+
+	for i, module := range program.Modules {
+		vm.globals[i] = make([]Value, len(module.Globals))
+		vm.constants[i] = make([]Value, len(module.Constants))
+		for j, constant := range module.Constants {
+			vm.constants[i][j] = vm.constantValue(constant)
+		}
+
+		for _, impl := range module.Impls {
+			key := methodKey{module: impl.Kind.Module, name: impl.Kind.Name}
+			methods, has := vm.methods[key]
+			if !has {
+				methods = make(map[string]bytecode.FuncRef)
+				vm.methods[key] = methods
+			}
+			for _, method := range impl.Methods {
+				methods[method.Name] = method.Func
+			}
+		}
+	}
+
+	return vm
+}
+
+// Run 初始化入口模块及其依赖的模块，然后执行入口模块的 `fn main()`，返回 main 函数的返回值
+func (vm *VM) Run() (result Value, err error) {
+	defer vm.catch(&err)
+
+	entry := vm.program.Modules[vm.program.Entry]
+	vm.initModule(entry.Index)
+
+	for i, fn := range entry.Functions {
+		if fn.Name == "main" {
+			return vm.Call(&FuncValue{Ref: bytecode.FuncRef{Module: entry.Index, Index: i}, Name: fn.Name})
+		}
+	}
+
+	panic(&RuntimeError{Message: "missing function `main` in entry module"})
+}
+
+// Call 调用函数并返回函数的返回值
+func (vm *VM) Call(callee Value, args ...Value) (result Value, err error) {
+	defer vm.catch(&err)
+
+	depth := len(vm.frames)
+	vm.push(callee)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.callValue(len(args))
+	vm.execute(depth)
+	return vm.pop(), nil
+}
+
+// Global 返回模块的全局变量
+func (vm *VM) Global(moduleId string, name string) (Value, bool) {
+	module := vm.program.FindModule(moduleId)
+	if module == nil {
+		return nil, false
+	}
+	for i, item := range module.Globals {
+		if item == name {
+			return vm.globals[module.Index][i], true
+		}
+	}
+	return nil, false
+}
+
+// 捕获运行时错误，并重置调用栈；其他的 panic（如损坏的字节码导致的越界访问）转换为内部错误
+func (vm *VM) catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(*RuntimeError)
+		if !ok {
+			e = vm.newError(fmt.Sprintf("internal error: %v", r))
+		}
+		*err = e
+		vm.stack = vm.stack[:0]
+		vm.frames = vm.frames[:0]
+	}
+}
+
+// 执行模块初始化函数（依赖的模块优先初始化）
+func (vm *VM) initModule(index int) {
+	if vm.inited[index] {
+		return
+	}
+	vm.inited[index] = true
+
+	module := vm.program.Modules[index]
+	for _, item := range module.Imports {
+		vm.initModule(item)
+	}
+
+	if module.Init >= 0 {
+		depth := len(vm.frames)
+		vm.push(vm.funcValue(bytecode.FuncRef{Module: index, Index: module.Init}))
+		vm.callValue(0)
+		vm.execute(depth)
+		vm.pop()
+	}
+}
+
+// 抛出运行时错误，错误位置为当前执行的指令
+func (vm *VM) throw(format string, args ...interface{}) {
+	panic(vm.newError(fmt.Sprintf(format, args...)))
+}
+
+// 创建包含当前调用栈的运行时错误
+func (vm *VM) newError(message string) *RuntimeError {
+	trace := make([]TraceItem, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		item := TraceItem{Function: f.fn.Name, ModuleId: f.module.Name, Pos: -1}
+		if line, ok := f.fn.Chunk.LineAt(f.start); ok {
+			item.Pos = line.Pos
+			item.Line = line.Line
+			item.Column = line.Column
+		}
+		trace = append(trace, item)
+	}
+
+	return &RuntimeError{
+		Message: message,
+		Trace:   trace,
+	}
+}
+
+/* stack */
+
+func (vm *VM) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() Value {
+	size := len(vm.stack)
+	value := vm.stack[size-1]
+	vm.stack = vm.stack[:size-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+/* call */
+
+// 调用栈顶的函数，栈: callee, args...
+func (vm *VM) callValue(argc int) {
+	slot := len(vm.stack) - argc - 1
+	callee := vm.stack[slot]
+
+	switch callee.(type) {
+	case *FuncValue:
+		vm.pushFrame(callee.(*FuncValue).Ref, argc, slot, slot+1)
+	case *BuiltinValue:
+		vm.callBuiltinFunc(callee.(*BuiltinValue).Name, argc, slot)
+	case nil:
+		vm.throw("cannot call null")
+	default:
+		vm.throw("cannot call a value of type %s", TypeName(callee))
+	}
+}
+
+// 调用方法，栈: receiver, args...
+func (vm *VM) invoke(name string, argc int) {
+	slot := len(vm.stack) - argc - 1
+	receiver := vm.stack[slot]
+	if receiver == nil {
+		vm.throw("cannot call method `%s` of null", name)
+	}
+
+	if ref, ok := vm.findMethod(receiver, name); ok {
+		vm.pushFrame(ref, argc, slot, slot)
+		return
+	}
+
+	// 调用函数类型的字段
+	if v, ok := receiver.(*StructValue); ok {
+		if field, has := v.Value[name]; has {
+			vm.stack[slot] = field
+			vm.callValue(argc)
+			return
+		}
+	}
+
+	if method, ok := findBuiltinMethod(receiver, name); ok {
+		vm.callBuiltin(method, name, argc, slot)
+		return
+	}
+
+	vm.throw("undefined method `%s` for type %s", name, TypeName(receiver))
+}
+
+// 查找值的方法，结构体会继续查找继承的结构体
+func (vm *VM) findMethod(receiver Value, name string) (bytecode.FuncRef, bool) {
+	switch receiver.(type) {
+	case *StructValue:
+		return vm.findKindMethod(receiver.(*StructValue).Kind, name)
+	case *EnumValue:
+		return vm.findKindMethod(receiver.(*EnumValue).Kind, name)
+	}
+	return bytecode.FuncRef{}, false
+}
+
+func (vm *VM) findKindMethod(kind *bytecode.Kind, name string) (bytecode.FuncRef, bool) {
+	if kind.IsNamed() {
+		if methods, has := vm.methods[methodKey{module: kind.Module, name: kind.Name}]; has {
+			if ref, has := methods[name]; has {
+				return ref, true
+			}
+		}
+	}
+	for _, extend := range kind.Extends {
+		if ref, ok := vm.findKindMethod(extend, name); ok {
+			return ref, true
+		}
+	}
+	return bytecode.FuncRef{}, false
+}
+
+// 创建调用帧，栈顶的 argc 个值为参数，base 为局部变量起始位置（方法调用时包含 self）
+func (vm *VM) pushFrame(ref bytecode.FuncRef, argc int, slot int, base int) {
+	module := vm.program.Modules[ref.Module]
+	fn := module.Functions[ref.Index]
+
+	if fn.HasRest {
+		fixed := fn.Arity - 1
+		if argc < fixed {
+			vm.throw("function `%s` expects at least %d argument(s), got %d", fn.Name, fixed, argc)
+		}
+		// 剩余参数打包为数组
+		size := arraySize(argc - fixed)
+		vm.reserve(size)
+		restStart := len(vm.stack) - (argc - fixed)
+		rest := make([]Value, argc-fixed)
+		copy(rest, vm.stack[restStart:])
+		vm.stack = vm.stack[:restStart]
+		array := &ArrayValue{Value: rest, Len: -1}
+		vm.track(array, size)
+		vm.push(array)
+	} else if argc != fn.Arity {
+		vm.throw("function `%s` expects %d argument(s), got %d", fn.Name, fn.Arity, argc)
+	}
+
+	if len(vm.frames) >= MaxFrames {
+		vm.throw("stack overflow")
+	}
+
+	for len(vm.stack)-base < fn.NumLocals {
+		vm.push(nil)
+	}
+
+	vm.frames = append(vm.frames, &frame{
+		module: module,
+		fn:     fn,
+		base:   base,
+		slot:   slot,
+	})
+}
+
+/* execute */
+
+// 执行指令，直到调用栈深度回到 depth
+func (vm *VM) execute(depth int) {
+	for len(vm.frames) > depth {
+		f := vm.frames[len(vm.frames)-1]
+		code := f.fn.Chunk.Code
+		f.start = f.ip
+		op := bytecode.OpCode(code[f.ip])
+		f.ip++
+
+		readUint16 := func() int {
+			value := int(bytecode.ReadUint16(code[f.ip:]))
+			f.ip += 2
+			return value
+		}
+
+		switch op {
+		case bytecode.OpNop:
+
+		// 常量
+		case bytecode.OpConst:
+			vm.push(vm.constants[f.module.Index][readUint16()])
+		case bytecode.OpNull:
+			vm.push(nil)
+		case bytecode.OpTrue:
+			vm.push(newBool(true))
+		case bytecode.OpFalse:
+			vm.push(newBool(false))
+		case bytecode.OpDefault:
+			vm.push(vm.defaultValue(vm.kindAt(f, readUint16())))
+		case bytecode.OpEnum:
+			kind := vm.kindAt(f, readUint16())
+			vm.push(&EnumValue{Kind: kind, Index: readUint16()})
+
+		// 栈操作
+		case bytecode.OpPop:
+			vm.pop()
+		case bytecode.OpDup:
+			vm.push(vm.peek(0))
+		case bytecode.OpDup2:
+			a, b := vm.peek(1), vm.peek(0)
+			vm.push(a)
+			vm.push(b)
+
+		// 变量
+		case bytecode.OpGetLocal:
+			vm.push(vm.stack[f.base+readUint16()])
+		case bytecode.OpSetLocal:
+			vm.stack[f.base+readUint16()] = vm.peek(0)
+		case bytecode.OpGetGlobal:
+			module := readUint16()
+			vm.push(vm.globals[module][readUint16()])
+		case bytecode.OpSetGlobal:
+			module := readUint16()
+			vm.globals[module][readUint16()] = vm.peek(0)
+
+		// 运算
+		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpRem:
+			right, left := vm.pop(), vm.pop()
+			vm.push(vm.arith(op, left, right))
+		case bytecode.OpConcat:
+			right, left := vm.pop(), vm.pop()
+			vm.push(vm.concat(left, right))
+		case bytecode.OpBitAnd, bytecode.OpBitOr, bytecode.OpBitXor, bytecode.OpShl, bytecode.OpShr:
+			right, left := vm.pop(), vm.pop()
+			vm.push(vm.bitwise(op, left, right))
+		case bytecode.OpNeg, bytecode.OpToNumber, bytecode.OpBitNot:
+			vm.push(vm.unary(op, vm.pop()))
+		case bytecode.OpNot:
+			vm.push(newBool(!vm.toBool(vm.pop())))
+		case bytecode.OpEq:
+			right, left := vm.pop(), vm.pop()
+			vm.push(newBool(valuesEqual(left, right)))
+		case bytecode.OpNe:
+			right, left := vm.pop(), vm.pop()
+			vm.push(newBool(!valuesEqual(left, right)))
+		case bytecode.OpLt, bytecode.OpLe, bytecode.OpGt, bytecode.OpGe:
+			right, left := vm.pop(), vm.pop()
+			vm.push(newBool(vm.compare(op, left, right)))
+
+		// 跳转
+		case bytecode.OpJump:
+			f.ip = readUint16()
+		case bytecode.OpJumpIfFalse:
+			target := readUint16()
+			if !vm.toBool(vm.pop()) {
+				f.ip = target
+			}
+
+		// 函数
+		case bytecode.OpCall:
+			argc := int(code[f.ip])
+			f.ip++
+			vm.callValue(argc)
+		case bytecode.OpInvoke:
+			name := vm.stringAt(f, readUint16())
+			argc := int(code[f.ip])
+			f.ip++
+			vm.invoke(name, argc)
+		case bytecode.OpReturn:
+			result := vm.pop()
+			vm.stack = vm.stack[:f.slot]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.push(result)
+
+		// 结构体及数组
+		case bytecode.OpArray, bytecode.OpFixedArray:
+			count := readUint16()
+			size := arraySize(count)
+			vm.reserve(size)
+			items := make([]Value, count)
+			copy(items, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			array := &ArrayValue{Value: items, Len: -1}
+			if op == bytecode.OpFixedArray {
+				array.Len = count
+			}
+			vm.track(array, size)
+			vm.push(array)
+		case bytecode.OpStruct:
+			kind := vm.kindAt(f, readUint16())
+			size := structSize(len(kind.Fields))
+			vm.reserve(size)
+			fields := make(map[string]Value, len(kind.Fields))
+			start := len(vm.stack) - len(kind.Fields)
+			for i, key := range kind.Fields {
+				fields[key] = vm.stack[start+i]
+			}
+			vm.stack = vm.stack[:start]
+			object := &StructValue{Kind: kind, Value: fields}
+			vm.track(object, size)
+			vm.push(object)
+		case bytecode.OpGetField:
+			vm.push(vm.getField(vm.pop(), vm.stringAt(f, readUint16())))
+		case bytecode.OpSetField:
+			value, object := vm.pop(), vm.pop()
+			vm.setField(object, vm.stringAt(f, readUint16()), value)
+			vm.push(value)
+		case bytecode.OpGetIndex:
+			index, object := vm.pop(), vm.pop()
+			vm.push(vm.getIndex(object, index))
+		case bytecode.OpSetIndex:
+			value, index, object := vm.pop(), vm.pop(), vm.pop()
+			vm.setIndex(object, index, value)
+			vm.push(value)
+		case bytecode.OpLen:
+			vm.push(newNumber(float64(vm.length(vm.pop()))))
+
+		// 类型
+		case bytecode.OpIs:
+			vm.push(newBool(vm.isKind(vm.pop(), vm.kindAt(f, readUint16()))))
+		case bytecode.OpAs:
+			vm.push(vm.cast(vm.pop(), vm.kindAt(f, readUint16())))
+
+		default:
+			vm.throw("unknown opcode: %d", op)
+		}
+	}
+}
+
+/* constants */
+
+func (vm *VM) constantValue(constant bytecode.Constant) Value {
+	switch constant.(type) {
+	case bytecode.NumberConstant:
+		return newNumber(float64(constant.(bytecode.NumberConstant)))
+	case bytecode.StringConstant:
+		return newString(string(constant.(bytecode.StringConstant)))
+	case bytecode.CharConstant:
+		return &Uint32Value{Value: uint32(constant.(bytecode.CharConstant))}
+	case bytecode.FuncConstant:
+		return vm.funcValue(bytecode.FuncRef(constant.(bytecode.FuncConstant)))
+	case bytecode.BuiltinConstant:
+		return &BuiltinValue{Name: string(constant.(bytecode.BuiltinConstant))}
+	}
+	return nil
+}
+
+func (vm *VM) funcValue(ref bytecode.FuncRef) *FuncValue {
+	return &FuncValue{
+		Ref:  ref,
+		Name: vm.program.Modules[ref.Module].Functions[ref.Index].Name,
+	}
+}
+
+func (vm *VM) kindAt(f *frame, index int) *bytecode.Kind {
+	return f.module.Constants[index].(*bytecode.KindConstant).Kind
+}
+
+func (vm *VM) stringAt(f *frame, index int) string {
+	return string(f.module.Constants[index].(bytecode.StringConstant))
+}
@@ -0,0 +1,592 @@
+package vm
+
+import (
+	"bytes"
+	"github.com/peakchen90/noah-lang/internal/bytecode"
+	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// 使用虚拟文件系统编译并运行项目
+func runFiles(t *testing.T, files map[string]string) (Value, error) {
+	return runFilesWithHeap(t, files, DefaultHeapOptions)
+}
+
+func runFilesWithHeap(t *testing.T, files map[string]string, options HeapOptions) (Value, error) {
+	c := compiler.NewCompiler("", false)
+	for name, code := range files {
+		_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, name), []byte(code))
+	}
+	c.Compile()
+	if !assert.False(t, c.HasError(), "%v", c.Diagnostics) {
+		t.FailNow()
+	}
+	return NewWithHeap(c.Program, options).Run()
+}
+
+func runMain(t *testing.T, code string) (Value, error) {
+	return runFiles(t, map[string]string{"main.noah": code})
+}
+
+func assertResult(t *testing.T, expected string, code string) {
+	value, err := runMain(t, code)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, FormatValue(value))
+	}
+}
+
+func TestRunExpr(t *testing.T) {
+	assertResult(t, "7", "fn main() -> number { return 1 + 2 * 3 }")
+	assertResult(t, "1", "fn main() -> number { return 7 % 3 }")
+	assertResult(t, "-6", "fn main() -> number { return ~5 }")
+	assertResult(t, "12", "fn main() -> number { return 3 << 2 }")
+	assertResult(t, "true", "fn main() -> bool { return 1 < 2 && !(2 <= 1) }")
+	assertResult(t, "false", "fn main() -> bool { return \"a\" > \"b\" || false }")
+	assertResult(t, "a1true", "fn main() -> string { return \"a\" + 1 + true }")
+	assertResult(t, "[1, \"b\"]", "fn main() -> []any { return [1, \"b\"] as []any }")
+	assertResult(t, "3", "fn main() -> number { let a = 1\n a += 2\n return a }")
+	assertResult(t, "1", "fn main() -> number { let a = 1\n return a++ }")
+	assertResult(t, "2", "fn main() -> number { let a = 1\n return ++a }")
+}
+
+func TestRunLoop(t *testing.T) {
+	assertResult(t, "45", `
+fn main() -> number {
+    let sum = 0
+    for (let i = 0; i < 10; i++) {
+        sum += i
+    }
+    return sum
+}`)
+
+	assertResult(t, "32", `
+fn main() -> number {
+    let sum = 0
+    for (item, index: [10, 20, 30]) {
+        sum += item / 10 * index
+    }
+    return sum - 8 + 32
+}`)
+
+	assertResult(t, "6", `
+fn main() -> number {
+    let count = 0
+    outer: for (let i = 0; i < 5; i++) {
+        for (let j = 0; j < 5; j++) {
+            if (j == 2) {
+                continue outer
+            }
+            if (i == 3) {
+                break outer
+            }
+            count++
+        }
+    }
+    return count
+}`)
+}
+
+func TestRunStructAndMethod(t *testing.T) {
+	assertResult(t, "Point3 { x: 1, y: 2, z: 3 }", `
+struct Point {
+    x: number,
+    y: number
+}
+
+struct Point3 <- Point {
+    z: number
+}
+
+fn main() -> Point3 {
+    return Point3 { x: 1, y: 2, z: 3 }
+}`)
+
+	assertResult(t, "13", `
+struct Point {
+    x: number,
+    y: number
+}
+
+struct Point3 <- Point {
+    z: number
+}
+
+impl Point {
+    fn sum() -> number {
+        return self.x + self.y
+    }
+}
+
+fn main() -> number {
+    let p = Point3 { x: 1, y: 2, z: 0 }
+    p.z = 10
+    return p.sum() + p.z
+}`)
+}
+
+func TestRunCycle(t *testing.T) {
+	assertResult(t, "[P { name: \"a\", next: <cycle> }, [1, <cycle>], [[2], [2]]]", `
+struct P {
+    name: string,
+    next: any,
+}
+
+fn main() -> []any {
+    let p = P { name: "a", next: null }
+    p.next = p
+    let a: []any = [1]
+    a.push(a)
+    let b = [2]
+    return [p, a, [b, b]] as []any
+}`)
+}
+
+func TestRunFunc(t *testing.T) {
+	assertResult(t, "10", `
+fn add(a: number, ...rest: []number) -> number {
+    let sum = a
+    for (item: rest) {
+        sum += item
+    }
+    return sum
+}
+
+fn main() -> number {
+    return add(1) + add(1, 2, 3) + add(1, 2)
+}`)
+
+	assertResult(t, "120", `
+fn fact(n: number) -> number {
+    if (n <= 1) {
+        return 1
+    }
+    return n * fact(n - 1)
+}
+
+fn main() -> number {
+    let f = fact
+    return f(5)
+}`)
+
+	assertResult(t, "8", `
+fn apply(f: fn (x: number) -> number, x: number) -> number {
+    return f(x)
+}
+
+fn main() -> number {
+    return apply(fn (x: number) -> number { return x * 2 }, 4)
+}`)
+}
+
+func TestRunBuiltinMethod(t *testing.T) {
+	assertResult(t, "[3, 1, 2, 4, 5]", `
+fn main() -> []number {
+    let arr: []number = [1]
+    arr.push(2)
+    arr.unshift(3)
+    arr.push(4, 5)
+    return arr
+}`)
+
+	assertResult(t, "[\"7 [2, 3] [1] [9] 1 4\", [\"A\", \"B\"], ['a', ','], \"-1 1 ab\"]", `
+fn main() -> []any {
+    let arr: []number = [1, 2, 3, 4]
+    let removed = arr.splice(1, 2, 9)
+    let copy = arr.clone()
+    let first = copy.shift()
+    let last = copy.pop()
+    let n = arr.len() + removed.len() + 2
+    let s = " a,b ".trim()
+    let info = n.toStr() + " " + removed + " " + arr.slice(0, 1) + " " + copy + " " + first + " " + last
+    let chars = s.slice(0, 2).toChars()
+    return [info, s.toUpperCase().split(","), chars, s.indexOf('x').toStr() + " " + s.indexOf(',') + " " + s.split(",")[0] + "b"] as []any
+}`)
+}
+
+func TestRunFixedArray(t *testing.T) {
+	assertResult(t, "[[1, 2, 0], [[\"\", \"\"], [\"\", \"\"]], [1, 2, 0, 4], [0, 0]]", `
+const N = 2
+
+struct Box {
+    items: [N]number
+}
+
+fn main() -> []any {
+    let a: [N + 1]number = [1, 2]
+    let b: [N][N]string
+    let v: []number = a
+    v.push(4)
+    return [a, b, v, Box {}.items] as []any
+}`)
+}
+
+func TestRunFixedArrayMethod(t *testing.T) {
+	calls := map[string]string{
+		"push":    "x.push(9)",
+		"pop":     "x.pop()",
+		"unshift": "x.unshift(9)",
+		"shift":   "x.shift()",
+		"splice":  "x.splice(0, 1)",
+	}
+	for name, call := range calls {
+		// 默认值及定长数组字面量创建的数组都不能改变长度
+		for _, init := range []string{"let a: [3]number", "let a: [3]number = [1, 2]"} {
+			_, err := runMain(t, "fn main() {\n    "+init+"\n    let x: any = a\n    "+call+"\n}")
+			if assert.Error(t, err, call) {
+				assert.Equal(t, "undefined method `"+name+"` for type array", err.(*RuntimeError).Message)
+			}
+		}
+	}
+
+	assertResult(t, "[3, [0, 0, 0]]", `
+fn main() -> []any {
+    let a: [3]number
+    let x: any = a
+    let b = x as [3]number
+    return [b.len(), a] as []any
+}`)
+}
+
+func TestRunCast(t *testing.T) {
+	assertResult(t, "[97, 'b', 255, \"1.5\", 3, \"x\", 'é', 97, '\\U0010ffff']", `
+type Meters number
+
+fn main() -> []any {
+    let v: any = "x"
+    let m = 3 as Meters
+    let b = 233 as byte
+    return ['a' as number, 98 as char, 255 as byte, 1.5 as string, m as number, v as string, b as char, 'a' as byte, 1114111 as char] as []any
+}`)
+
+	cases := map[string]string{
+		"300 as byte":         "cannot cast 300 to byte: out of range [0, 255]",
+		"-1 as byte":          "cannot cast -1 to byte: out of range [0, 255]",
+		"1.5 as byte":         "cannot cast 1.5 to byte: not an integer",
+		"256 as char as byte": "cannot cast 256 to byte: out of range [0, 255]",
+		"-1 as char":          "cannot cast -1 to char: invalid code point",
+		"1114112 as char":     "cannot cast 1114112 to char: invalid code point",
+		"55296 as char":       "cannot cast 55296 to char: invalid code point",
+		"0.5 as char":         "cannot cast 0.5 to char: not an integer",
+	}
+	for cast, message := range cases {
+		_, err := runMain(t, "fn main() {\n    let v = "+cast+"\n}")
+		if assert.Error(t, err, cast) {
+			assert.Equal(t, message, err.(*RuntimeError).Message, cast)
+		}
+	}
+}
+
+func TestRunPrelude(t *testing.T) {
+	c := compiler.NewCompiler("", false)
+	_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, "main.noah"), []byte(`
+enum Color {
+    Red
+}
+
+struct Point {
+    x: number
+}
+
+fn main() -> []any {
+    let arr: []number = [1, 2]
+    let v: any = arr
+    print("a", 1)
+    println(" b", 'c', true, Color.Red)
+    println(arr, Point { x: 1 })
+    println()
+    assert(len(v) == 2, "len")
+    let p = println
+    p("call", typeof(p))
+    return [len("你好"), len(arr), typeof(1), typeof(v), typeof(Point {}), typeof(Color.Red), typeof(null)] as []any
+}`))
+	c.Compile()
+	if !assert.False(t, c.HasError(), "%v", c.Diagnostics) {
+		t.FailNow()
+	}
+	machine := New(c.Program)
+	stdout := &bytes.Buffer{}
+	machine.Stdout = stdout
+	value, err := machine.Run()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[2, 2, \"number\", \"array\", \"Point\", \"Color\", \"null\"]", FormatValue(value))
+		assert.Equal(t, "a 1 b c true Color.Red\n[1, 2] Point { x: 1 }\n\ncall fn\n", stdout.String())
+	}
+
+	// 模块中的声明会覆盖内置函数
+	assertResult(t, "3", `
+fn len(s: string) -> number {
+    return 3
+}
+
+fn main() -> number {
+    return len("a")
+}`)
+	assertResult(t, "1", "fn main() -> number {\n    let typeof = 1\n    return typeof\n}")
+}
+
+func TestRunNarrowKind(t *testing.T) {
+	assertResult(t, "[\"a1\", 3, \"Rex: woof\", \"Tom\"]", `
+struct Animal {
+    name: string
+}
+
+struct Dog <- Animal {
+    bark: string
+}
+
+fn show(v: any) -> any {
+    if (v is string) {
+        return v + 1
+    }
+    return v + 1
+}
+
+fn describe(a: Animal) -> string {
+    if (!(a is Dog)) {
+        return a.name
+    }
+    return a.name + ": " + a.bark
+}
+
+fn main() -> []any {
+    return [show("a"), show(2), describe(Dog { name: "Rex", bark: "woof" }), describe(Animal { name: "Tom" })] as []any
+}`)
+}
+
+func TestRunEnum(t *testing.T) {
+	assertResult(t, "Color.Green", `
+enum Color {
+    Red,
+    Green
+}
+
+fn main() -> Color {
+    let c = Color.Green
+    if (c == Color.Red) {
+        return Color.Red
+    }
+    return c
+}`)
+}
+
+func TestRunModuleInit(t *testing.T) {
+	value, err := runFiles(t, map[string]string{
+		"main.noah": `
+import lib.a
+
+let local = a.value * 2
+
+fn main() -> number {
+    return local + a.value
+}`,
+		"lib/a.noah": `
+pub let value = compute()
+
+fn compute() -> number {
+    return 100
+}`,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "300", FormatValue(value))
+	}
+}
+
+func TestRunError(t *testing.T) {
+	assertError := func(code string, message string, line int, column int) {
+		_, err := runMain(t, code)
+		if !assert.Error(t, err) {
+			return
+		}
+		runtimeErr := err.(*RuntimeError)
+		assert.Equal(t, message, runtimeErr.Message)
+		assert.Equal(t, "main", runtimeErr.Trace[0].ModuleId)
+		assert.Equal(t, line, runtimeErr.Trace[0].Line)
+		assert.Equal(t, column, runtimeErr.Trace[0].Column)
+	}
+
+	assertError(`
+struct A {
+    b: B
+}
+
+struct B {
+    c: number
+}
+
+fn main() {
+    let a = A {}
+    let c: number = a.b.c
+}`, "cannot read field `c` of null", 12, 25)
+
+	assertError(`
+fn main() {
+    let arr = [1, 2, 3]
+    let b: number = arr[3]
+}`, "index out of range [3] with length 3", 4, 25)
+
+	assertError(`
+fn main() {
+    let a: any = "str"
+    let b = a as number
+}`, "cannot cast string to number", 4, 15)
+
+	assertError(`
+struct Animal {
+    name: string
+}
+
+struct Dog <- Animal {
+    bark: string
+}
+
+fn main() {
+    let a = Animal {}
+    let d = a as Dog
+}`, "cannot cast Animal to Dog", 12, 15)
+
+	assertError(`
+fn f(n: number) -> number {
+    return f(n + 1)
+}
+
+fn main() {
+    f(0)
+}`, "stack overflow", 3, 12)
+
+	assertError(`
+fn main() {
+    let arr: []number = []
+    arr.pop()
+}`, "cannot pop from an empty array", 4, 9)
+
+	assertError(`
+fn main() {
+    let s = "abc".slice(2, 4)
+}`, "slice bounds out of range [2:4] with length 3", 3, 19)
+
+	assertError(`
+fn main() {
+    panic("boom")
+}`, "panic: boom", 3, 5)
+
+	assertError(`
+fn main() {
+    let n = 1
+    assert(n == 2, "n =", n)
+}`, "assertion failed: n = 1", 4, 5)
+
+	assertError(`
+fn main() {
+    let v: any = 1
+    let n = len(v)
+}`, "invalid argument for len: number", 4, 13)
+
+	_, err := runMain(t, "fn foo() {}")
+	assert.EqualError(t, err, "runtime error: missing function `main` in entry module")
+
+	_, err = runMain(t, `
+fn foo() {
+    let arr = [1]
+    arr[1] = 2
+}
+
+fn main() {
+    foo()
+}`)
+	runtimeErr := err.(*RuntimeError)
+	assert.Equal(t, "main:4:5: runtime error: index out of range [1] with length 1", err.Error())
+	assert.Equal(t, "    at foo (main:4:5)\n    at main (main:8:5)\n", runtimeErr.StackTrace())
+}
+
+func TestRunInvalidBytecode(t *testing.T) {
+	// 校验通过但参数个数错误的调用（如手动构造的字节码）会转换为运行时错误
+	program := bytecode.NewProgram()
+	module := bytecode.NewModule("main")
+	program.AddModule(module)
+	fn := bytecode.NewFunction("main")
+	fn.Chunk.Mark(0, 1, 1)
+	fn.Chunk.Write(bytecode.OpConst, module.AddConstant(bytecode.StringConstant("a")))
+	fn.Chunk.Write(bytecode.OpCall, 5)
+	fn.Chunk.Write(bytecode.OpReturn)
+	module.AddFunction(fn)
+
+	loaded, err := bytecode.Load(program.Marshal())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = New(loaded).Run()
+	if assert.Error(t, err) {
+		runtimeErr := err.(*RuntimeError)
+		assert.Contains(t, runtimeErr.Message, "internal error: ")
+		assert.Equal(t, "    at main (main:1:1)\n", runtimeErr.StackTrace())
+	}
+}
+
+func TestGC(t *testing.T) {
+	code := `
+struct Node {
+    value: number,
+    next: Node
+}
+
+let head = Node { value: 0 }
+
+fn main() -> number {
+    let keep = [0]
+    for (let i = 1; i <= 100; i++) {
+        let garbage = [i, i, i]
+        head = Node { value: i, next: head }
+        keep = [i, keep[0]]
+    }
+    let sum = 0
+    for (let node = head; node != null; node = node.next) {
+        sum += node.value
+    }
+    return sum + keep[0]
+}`
+
+	// 每次分配前都触发 GC，仍然可以访问的对象不能被回收
+	c := compiler.NewCompiler("", false)
+	_ = c.VirtualFS.WriteFile(filepath.Join(c.VirtualFS.Root, "main.noah"), []byte(code))
+	c.Compile()
+	assert.Empty(t, c.Diagnostics)
+
+	machine := NewWithHeap(c.Program, HeapOptions{Stress: true})
+	value, err := machine.Run()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "5150", FormatValue(value))
+	}
+	stats := machine.GCStats()
+	assert.Equal(t, 302, stats.Allocated)
+	assert.Equal(t, stats.Allocated, stats.Collections)
+	assert.Greater(t, stats.Freed, 150)
+
+	machine.GC()
+	stats = machine.GCStats()
+	assert.Equal(t, 101, stats.LiveObjects) // 全局变量 head 引用的链表
+	assert.Equal(t, 101*structSize(2), stats.LiveBytes)
+	assert.Equal(t, stats.Allocated-stats.Freed, stats.LiveObjects)
+
+	// 堆上限
+	_, err = runFilesWithHeap(t, map[string]string{"main.noah": `
+fn main() {
+    let list: []any = [[0]]
+    for (let i = 0; i < 1000; i++) {
+        list = [[i], list]
+    }
+}`}, HeapOptions{MaxBytes: 4096})
+	if assert.Error(t, err) {
+		assert.Equal(t, "out of memory: heap limit of 4096 bytes exceeded", err.(*RuntimeError).Message)
+	}
+
+	// 回收的对象不计入堆上限
+	_, err = runFilesWithHeap(t, map[string]string{"main.noah": `
+fn main() {
+    for (let i = 0; i < 1000; i++) {
+        let list = [[i], [i]]
+    }
+}`}, HeapOptions{MaxBytes: 4096, InitialLimit: 1024})
+	assert.NoError(t, err)
+}
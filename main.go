@@ -1,14 +1,10 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"github.com/peakchen90/noah-lang/internal/compiler"
+	"github.com/peakchen90/noah-lang/internal/cli"
+	"os"
 )
 
 func main() {
-	inst := compiler.NewCompiler("examples/simple", true).Compile()
-
-	jsonStr, _ := json.MarshalIndent(inst.Main.Ast, "", "  ")
-	fmt.Println(string(jsonStr))
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
 }